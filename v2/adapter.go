@@ -29,21 +29,25 @@ type Config struct {
 	Port          string            // port name, or path to dll/so/dylib
 	PortBaudrate  int               // serial port baudrate in bps
 	CANRate       float64           // CAN bus rate in kbit/s
+	CANDataRate   float64           // CAN FD data phase rate in kbit/s, 0 for classic CAN
 	CANFilter     []uint32          // CAN ID filters
 	UseExtendedID bool              // use 29-bit IDs when setting up frame filters
+	ListenOnly    bool              // open the controller silent: no ACKs, no error frames, no sending
 	Debug         bool              // enable debug logging
 	Extra         map[string]string // adapter specific key/value configuration
 }
 
 // Capabilities describes what a registered adapter can do.
 type Capabilities struct {
-	HSCAN bool
-	SWCAN bool
-	KLine bool
+	HSCAN      bool
+	SWCAN      bool
+	KLine      bool
+	FD         bool // sends and receives CAN FD frames
+	ListenOnly bool // honours Config.ListenOnly
 }
 
 func (c Capabilities) String() string {
-	return fmt.Sprintf("HSCAN: %v, SWCAN: %v, KLine: %v", c.HSCAN, c.SWCAN, c.KLine)
+	return fmt.Sprintf("HSCAN: %v, SWCAN: %v, KLine: %v, FD: %v, ListenOnly: %v", c.HSCAN, c.SWCAN, c.KLine, c.FD, c.ListenOnly)
 }
 
 // AdapterInfo describes a registered adapter: its registry name, what it
@@ -172,6 +176,18 @@ func AdapterName(a Adapter) string {
 	return fmt.Sprintf("%T", a)
 }
 
+// adapterCapabilities reports the capabilities registered under name, or
+// those the adapter itself advertises through a Capabilities method.
+func adapterCapabilities(name string, a Adapter) (Capabilities, bool) {
+	if info, err := lookupAdapter(name); err == nil {
+		return info.Capabilities, true
+	}
+	if c, ok := a.(interface{ Capabilities() Capabilities }); ok {
+		return c.Capabilities(), true
+	}
+	return Capabilities{}, false
+}
+
 func lookupAdapter(name string) (AdapterInfo, error) {
 	adapterMu.Lock()
 	defer adapterMu.Unlock()
@@ -16,6 +16,7 @@ import (
 	_ "github.com/roffe/gocan/v2/adapters/just4trionic"
 	_ "github.com/roffe/gocan/v2/adapters/obdx"
 	_ "github.com/roffe/gocan/v2/adapters/pcan"
+	_ "github.com/roffe/gocan/v2/adapters/replay"
 	_ "github.com/roffe/gocan/v2/adapters/scantool"
 	_ "github.com/roffe/gocan/v2/adapters/slcan"
 	_ "github.com/roffe/gocan/v2/adapters/socketcan"
@@ -4,10 +4,10 @@ package canlib
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"strings"
 	"sync"
+	"time"
 
 	gocan "github.com/roffe/gocan/v2"
 	"github.com/roffe/gocan/v2/pkg/canlib"
@@ -46,7 +46,7 @@ func scanDevices() []gocan.AdapterInfo {
 		out = append(out, gocan.AdapterInfo{
 			Name:         fmt.Sprintf("CANlib #%d %v", channel, devDescr),
 			Description:  "Canlib driver for Kvaser devices",
-			Capabilities: gocan.Capabilities{HSCAN: true},
+			Capabilities: gocan.Capabilities{HSCAN: true, FD: fdCapable(channel), ListenOnly: true},
 			New: func(cfg gocan.Config) (gocan.Adapter, error) {
 				return New(ch, cfg)
 			},
@@ -63,6 +63,8 @@ type CANlib struct {
 	writeHandle  canlib.Handle
 	timeoutRead  uint32
 	timeoutWrite uint32
+	clock        gocan.DeviceClock
+	status       gocan.BusStatus // last reported by checkStatus
 	closeOnce    sync.Once
 }
 
@@ -72,6 +74,7 @@ func New(channel int, cfg gocan.Config) (gocan.Adapter, error) {
 		channel:      channel,
 		timeoutRead:  defaultReadTimeoutMs,
 		timeoutWrite: defaultWriteTimeoutMs,
+		clock:        gocan.DeviceClock{Period: timestampPeriod},
 	}, nil
 }
 
@@ -87,6 +90,14 @@ func (k *CANlib) Open(ctx context.Context, bus *gocan.Bus) error {
 		err2 := k.writeHandle.Close()
 		return fmt.Errorf("setSpeed: %v, RH: %v WH: %v", err, err1, err2)
 	}
+	if k.cfg.ListenOnly {
+		// Silent mode: the controller neither ACKs nor sends error frames.
+		if err := canlib.SetBusOutputControl(k.readHandle, canlib.DRIVER_SILENT); err != nil {
+			k.readHandle.Close()
+			k.writeHandle.Close()
+			return fmt.Errorf("SetBusOutputControl: %w", err)
+		}
+	}
 
 	go k.readLoop(ctx)
 
@@ -113,18 +124,18 @@ func (k *CANlib) Close() error {
 // Send writes one frame; WriteWait blocks until the frame is on the bus (or
 // the write timeout hits), which is the v2 write confirmation.
 func (k *CANlib) Send(ctx context.Context, f gocan.Frame) error {
-	if err := k.writeHandle.WriteWait(f.ID, f.Bytes(), canlib.MSG_STD, k.timeoutWrite); err != nil {
+	if err := k.writeHandle.WriteWait(f.ID, f.Bytes(), k.msgFlags(f), k.timeoutWrite); err != nil {
 		return fmt.Errorf("Send: %w", err)
 	}
 	return nil
 }
 
 func (k *CANlib) openChannels() (err error) {
-	k.readHandle, err = canlib.OpenChannel(k.channel, canlib.OPEN_REQUIRE_INIT_ACCESS)
+	k.readHandle, err = canlib.OpenChannel(k.channel, canlib.OPEN_REQUIRE_INIT_ACCESS|k.openFlags())
 	if err != nil {
 		return fmt.Errorf("OpenChannel error: %v", err)
 	}
-	k.writeHandle, err = canlib.OpenChannel(k.channel, canlib.OPEN_NO_INIT_ACCESS)
+	k.writeHandle, err = canlib.OpenChannel(k.channel, canlib.OPEN_NO_INIT_ACCESS|k.openFlags())
 	if err != nil {
 		k.readHandle.Close()
 		return fmt.Errorf("OpenChannel error: %v", err)
@@ -133,6 +144,9 @@ func (k *CANlib) openChannels() (err error) {
 }
 
 func (k *CANlib) setSpeed(canRate float64) error {
+	if k.cfg.CANDataRate > 0 {
+		return k.setFDSpeed()
+	}
 	var freq canlib.BusParamsFreq
 	switch canRate {
 	case 1000:
@@ -171,7 +185,12 @@ func (k *CANlib) setSpeed(canRate float64) error {
 }
 
 func (k *CANlib) readLoop(ctx context.Context) {
+	var nextStatus time.Time
 	for ctx.Err() == nil {
+		if now := time.Now(); now.After(nextStatus) {
+			k.checkStatus()
+			nextStatus = now.Add(statusInterval)
+		}
 		msg, err := k.readHandle.ReadWait(k.timeoutRead)
 		if err != nil {
 			if err == canlib.ErrNoMsg || err == canlib.ErrTimeout {
@@ -187,18 +206,3 @@ func (k *CANlib) readLoop(ctx context.Context) {
 		}
 	}
 }
-
-func (k *CANlib) deliver(msg *canlib.CANMessage) error {
-	if len(msg.Data) < int(msg.DLC) || msg.DLC > 8 {
-		return errors.New("readLoop invalid data length")
-	}
-	f := gocan.Frame{
-		ID:       uint32(msg.Identifier),
-		Length:   uint8(msg.DLC),
-		Extended: msg.Flags&uint32(canlib.MSG_EXT) != 0,
-		Remote:   msg.Flags&uint32(canlib.MSG_RTR) != 0,
-	}
-	copy(f.Data[:], msg.Data[:msg.DLC])
-	k.bus.Deliver(f)
-	return nil
-}
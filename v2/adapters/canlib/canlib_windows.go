@@ -4,7 +4,6 @@ package canlib
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"strings"
 	"sync"
@@ -46,7 +45,7 @@ func scanDevices() []gocan.AdapterInfo {
 		out = append(out, gocan.AdapterInfo{
 			Name:         fmt.Sprintf("CANlib #%d %v", channel, devDescr),
 			Description:  "Canlib driver for Kvaser devices",
-			Capabilities: gocan.Capabilities{HSCAN: true},
+			Capabilities: gocan.Capabilities{HSCAN: true, FD: fdCapable(channel), ListenOnly: true},
 			New: func(cfg gocan.Config) (gocan.Adapter, error) {
 				return New(ch, cfg)
 			},
@@ -63,6 +62,8 @@ type CANlib struct {
 	writeHandle  canlib.Handle
 	timeoutRead  uint32
 	timeoutWrite uint32
+	clock        gocan.DeviceClock
+	status       gocan.BusStatus // last reported by checkStatus
 	closeOnce    sync.Once
 }
 
@@ -72,6 +73,7 @@ func New(channel int, cfg gocan.Config) (gocan.Adapter, error) {
 		channel:      channel,
 		timeoutRead:  defaultReadTimeoutMs,
 		timeoutWrite: defaultWriteTimeoutMs,
+		clock:        gocan.DeviceClock{Period: timestampPeriod},
 	}, nil
 }
 
@@ -87,6 +89,14 @@ func (k *CANlib) Open(ctx context.Context, bus *gocan.Bus) error {
 		err2 := k.writeHandle.Close()
 		return fmt.Errorf("setSpeed: %v, RH: %v WH: %v", err, err1, err2)
 	}
+	if k.cfg.ListenOnly {
+		// Silent mode: the controller neither ACKs nor sends error frames.
+		if err := canlib.SetBusOutputControl(k.readHandle, canlib.DRIVER_SILENT); err != nil {
+			k.readHandle.Close()
+			k.writeHandle.Close()
+			return fmt.Errorf("SetBusOutputControl: %w", err)
+		}
+	}
 
 	go k.readLoop(ctx)
 
@@ -113,18 +123,18 @@ func (k *CANlib) Close() error {
 // Send writes one frame; WriteWait blocks until the frame is on the bus (or
 // the write timeout hits), which is the v2 write confirmation.
 func (k *CANlib) Send(ctx context.Context, f gocan.Frame) error {
-	if err := k.writeHandle.WriteWait(f.ID, f.Bytes(), canlib.MSG_STD, k.timeoutWrite); err != nil {
+	if err := k.writeHandle.WriteWait(f.ID, f.Bytes(), k.msgFlags(f), k.timeoutWrite); err != nil {
 		return fmt.Errorf("Send: %w", err)
 	}
 	return nil
 }
 
 func (k *CANlib) openChannels() (err error) {
-	k.readHandle, err = canlib.OpenChannel(k.channel, canlib.OPEN_REQUIRE_INIT_ACCESS)
+	k.readHandle, err = canlib.OpenChannel(k.channel, canlib.OPEN_REQUIRE_INIT_ACCESS|k.openFlags())
 	if err != nil {
 		return fmt.Errorf("OpenChannel error: %v", err)
 	}
-	k.writeHandle, err = canlib.OpenChannel(k.channel, canlib.OPEN_NO_INIT_ACCESS)
+	k.writeHandle, err = canlib.OpenChannel(k.channel, canlib.OPEN_NO_INIT_ACCESS|k.openFlags())
 	if err != nil {
 		k.readHandle.Close()
 		return fmt.Errorf("OpenChannel error: %v", err)
@@ -136,6 +146,9 @@ func (k *CANlib) openChannels() (err error) {
 // SetBusParamsC200 path is not used on Windows (matches the v1 driver, where
 // it is disabled); the default SetBitrate branch handles it approximately.
 func (k *CANlib) setSpeed(canRate float64) error {
+	if k.cfg.CANDataRate > 0 {
+		return k.setFDSpeed()
+	}
 	var freq canlib.BusParamsFreq
 	switch canRate {
 	case 1000:
@@ -168,17 +181,23 @@ func (k *CANlib) setSpeed(canRate float64) error {
 	return k.writeHandle.SetBusParams(freq, 0, 0, 0, 0, 0)
 }
 
-// readLoop installs the RX notification callback and parks until shutdown;
-// deliveries happen on the driver's callback thread.
+// notifyEvents are the driver notifications handleCallback serves.
+const notifyEvents = canlib.NOTIFY_RX | canlib.NOTIFY_ERROR | canlib.NOTIFY_STATUS
+
+// readLoop installs the notification callback and parks until shutdown;
+// deliveries and status reports happen on the driver's callback thread.
 func (k *CANlib) readLoop(ctx context.Context) {
-	if err := k.readHandle.SetNotifyCallback(k.handleCallback, canlib.NOTIFY_RX); err != nil {
+	if err := k.readHandle.SetNotifyCallback(k.handleCallback, notifyEvents); err != nil {
 		k.bus.Emit(gocan.Event{Type: gocan.EventTypeError, Details: fmt.Sprintf("set callback error: %v", err), Err: err})
 	}
-	defer k.readHandle.SetNotifyCallback(nil, canlib.NOTIFY_RX)
+	defer k.readHandle.SetNotifyCallback(nil, notifyEvents)
 	<-ctx.Done()
 }
 
 func (k *CANlib) handleCallback(hhnd int32, cbctx uintptr, event canlib.NotifyFlag) uintptr {
+	if event&canlib.NOTIFY_STATUS != 0 {
+		k.checkStatus()
+	}
 	for {
 		msg, err := k.readHandle.Read()
 		if err != nil {
@@ -194,18 +213,3 @@ func (k *CANlib) handleCallback(hhnd int32, cbctx uintptr, event canlib.NotifyFl
 	}
 	return 0
 }
-
-func (k *CANlib) deliver(msg *canlib.CANMessage) error {
-	if len(msg.Data) < int(msg.DLC) || msg.DLC > 8 {
-		return errors.New("readLoop invalid data length")
-	}
-	f := gocan.Frame{
-		ID:       uint32(msg.Identifier),
-		Length:   uint8(msg.DLC),
-		Extended: msg.Flags&uint32(canlib.MSG_EXT) != 0,
-		Remote:   msg.Flags&uint32(canlib.MSG_RTR) != 0,
-	}
-	copy(f.Data[:], msg.Data[:msg.DLC])
-	k.bus.Deliver(f)
-	return nil
-}
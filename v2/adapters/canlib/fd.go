@@ -0,0 +1,124 @@
+//go:build canlib && (linux || windows)
+
+package canlib
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	gocan "github.com/roffe/gocan/v2"
+	"github.com/roffe/gocan/v2/pkg/canlib"
+)
+
+// channelCapCANFD is canCHANNEL_CAP_CAN_FD in the CHANNELDATA_CHANNEL_CAP
+// bit mask.
+const channelCapCANFD = 0x80000
+
+func fdCapable(channel int) bool {
+	caps, err := canlib.GetChannelDataBytes(channel, canlib.CHANNELDATA_CHANNEL_CAP)
+	return err == nil && binary.LittleEndian.Uint32(caps)&channelCapCANFD != 0
+}
+
+// fdBusParams maps CAN FD arbitration and data rates to CANlib's predefined
+// FD bus parameters.
+func fdBusParams(canRate, dataRate float64) (arb, data canlib.BusParamsFreq, err error) {
+	switch canRate {
+	case 500:
+		arb = canlib.FD_BITRATE_500K_80P
+	case 1000:
+		arb = canlib.FD_BITRATE_1M_80P
+	default:
+		return 0, 0, fmt.Errorf("unsupported CAN FD arbitration rate %v kbit/s (500, 1000)", canRate)
+	}
+	switch dataRate {
+	case 500:
+		data = canlib.FD_BITRATE_500K_80P
+	case 1000:
+		data = canlib.FD_BITRATE_1M_80P
+	case 2000:
+		data = canlib.FD_BITRATE_2M_80P
+	case 4000:
+		data = canlib.FD_BITRATE_4M_80P
+	case 8000:
+		data = canlib.FD_BITRATE_8M_60P
+	default:
+		return 0, 0, fmt.Errorf("unsupported CAN FD data rate %v kbit/s (500, 1000, 2000, 4000, 8000)", dataRate)
+	}
+	return arb, data, nil
+}
+
+// setFDSpeed configures both handles for CAN FD; they must have been opened
+// with OPEN_CAN_FD.
+func (k *CANlib) setFDSpeed() error {
+	arb, data, err := fdBusParams(k.cfg.CANRate, k.cfg.CANDataRate)
+	if err != nil {
+		return err
+	}
+	for _, h := range []canlib.Handle{k.readHandle, k.writeHandle} {
+		if err := h.SetBusParams(arb, 0, 0, 0, 0, 0); err != nil {
+			return err
+		}
+		if err := h.SetBusParamsFd(data, 0, 0, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (k *CANlib) openFlags() canlib.OpenFlag {
+	if k.cfg.CANDataRate > 0 {
+		return canlib.OPEN_CAN_FD
+	}
+	return 0
+}
+
+func (k *CANlib) msgFlags(f gocan.Frame) canlib.MsgFlag {
+	flags := canlib.MSG_STD
+	if f.Extended || k.cfg.UseExtendedID {
+		flags = canlib.MSG_EXT
+	}
+	if f.Remote {
+		flags |= canlib.MSG_RTR
+	}
+	if f.FD {
+		flags |= canlib.FDMSG_FDF
+		if f.BRS {
+			flags |= canlib.FDMSG_BRS
+		}
+	}
+	return flags
+}
+
+// timestampPeriod is the wrap of CANlib's receive timestamp, a 32-bit
+// count of milliseconds at the default timer scale.
+const timestampPeriod = 1 << 32 * time.Millisecond
+
+func (k *CANlib) deliver(msg *canlib.CANMessage) error {
+	if msg.Flags&uint32(canlib.MSGERR_OVERRUN) != 0 {
+		k.bus.Emit(gocan.BusEvent(gocan.EventKindOverrun, gocan.BusStatus{}))
+	}
+	if msg.Flags&uint32(canlib.MSG_ERROR_FRAME) != 0 {
+		k.bus.Emit(gocan.BusEvent(gocan.EventKindErrorFrame, gocan.BusStatus{Errors: busErrors(msg.Flags)}))
+		return nil
+	}
+	fd := msg.Flags&uint32(canlib.FDMSG_FDF) != 0
+	if len(msg.Data) < int(msg.DLC) || msg.DLC > 8 && !fd || msg.DLC > gocan.MaxFDLength {
+		return errors.New("readLoop invalid data length")
+	}
+	f := gocan.Frame{
+		ID:       uint32(msg.Identifier),
+		Length:   uint8(msg.DLC),
+		Extended: msg.Flags&uint32(canlib.MSG_EXT) != 0,
+		Remote:   msg.Flags&uint32(canlib.MSG_RTR) != 0,
+		FD:       fd,
+		BRS:      msg.Flags&uint32(canlib.FDMSG_BRS) != 0,
+		ESI:      msg.Flags&uint32(canlib.FDMSG_ESI) != 0,
+	}
+	copy(f.Data[:], msg.Data[:msg.DLC])
+	f.Timestamp = k.clock.Time(time.Duration(msg.Timestamp) * time.Millisecond)
+	f.TimestampSource = gocan.TimestampHardware
+	k.bus.Deliver(f)
+	return nil
+}
@@ -0,0 +1,68 @@
+//go:build canlib && (linux || windows)
+
+package canlib
+
+import (
+	"time"
+
+	gocan "github.com/roffe/gocan/v2"
+	"github.com/roffe/gocan/v2/pkg/canlib"
+)
+
+// statusInterval is how often the Linux read loop polls the circuit status;
+// on Windows the driver notifies status changes instead.
+const statusInterval = time.Second
+
+// checkStatus reports the circuit state and, when they changed, the error
+// counters. It must run where the read handle is used: the read loop on
+// Linux, the notify callback on Windows.
+func (k *CANlib) checkStatus() {
+	flags, err := k.readHandle.ReadStatus()
+	if err != nil {
+		return
+	}
+	s := gocan.BusStatus{State: busState(flags)}
+	if tx, rx, _, err := k.readHandle.ReadErrorCounters(); err == nil {
+		s.Counters, s.TxErrors, s.RxErrors = true, int(tx), int(rx)
+	}
+	if s.State != gocan.BusStateUnknown {
+		k.bus.ReportState(s)
+	}
+	if s.Counters && (s.TxErrors != k.status.TxErrors || s.RxErrors != k.status.RxErrors) {
+		k.bus.Emit(gocan.BusEvent(gocan.EventKindErrorCounters, s))
+	}
+	k.status = s
+}
+
+func busState(flags canlib.StatusFlag) gocan.BusState {
+	switch {
+	case flags&canlib.STAT_BUS_OFF != 0:
+		return gocan.BusStateBusOff
+	case flags&canlib.STAT_ERROR_PASSIVE != 0:
+		return gocan.BusStateErrorPassive
+	case flags&canlib.STAT_ERROR_WARNING != 0:
+		return gocan.BusStateErrorWarning
+	case flags&canlib.STAT_ERROR_ACTIVE != 0:
+		return gocan.BusStateErrorActive
+	}
+	return gocan.BusStateUnknown
+}
+
+// busErrors maps the canMSGERR flags of an error frame to protocol errors.
+func busErrors(flags uint32) gocan.BusError {
+	var e gocan.BusError
+	for _, m := range []struct {
+		flag canlib.MsgFlag
+		err  gocan.BusError
+	}{
+		{canlib.MSGERR_BIT, gocan.BusErrorBit},
+		{canlib.MSGERR_STUFF, gocan.BusErrorStuff},
+		{canlib.MSGERR_FORM, gocan.BusErrorForm},
+		{canlib.MSGERR_CRC, gocan.BusErrorCRC},
+	} {
+		if flags&uint32(m.flag) != 0 {
+			e |= m.err
+		}
+	}
+	return e
+}
@@ -7,12 +7,13 @@
 //	Sn          set standard bit-rate (S0..S8)
 //	sxxyy       set bit-rate via BTR0/BTR1 (used for non-standard rates)
 //	O / C       open / close the CAN channel
+//	L           open the CAN channel listen-only (Config.ListenOnly)
 //	tiiildd..   transmit standard (11-bit) frame, ack: z
 //	Tiiiiiiiildd.. transmit extended (29-bit) frame, ack: Z
 //	Mxxxxxxxx   acceptance code   (channel initiated, not open)
 //	mxxxxxxxx   acceptance mask   (channel initiated, not open)
 //	V / N       hardware+software version / serial number
-//	Zn          received-frame timestamp on/off (we keep it OFF)
+//	Zn          received-frame timestamp on/off (we turn it on: Z1)
 //	F           read & clear status flags (only while open)
 //
 // Replies: CR (OK) / BELL 0x07 (error) for setup commands, z/Z for transmit
@@ -30,6 +31,7 @@ import (
 	"fmt"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	gocan "github.com/roffe/gocan/v2"
@@ -46,7 +48,7 @@ func init() {
 		Name:               "CANUSB VCP",
 		Description:        "Lawicel CANUSB (VCP, manual 1.0D)",
 		RequiresSerialPort: true,
-		Capabilities:       gocan.Capabilities{HSCAN: true, SWCAN: true},
+		Capabilities:       gocan.Capabilities{HSCAN: true, SWCAN: true, ListenOnly: true},
 		New:                New,
 	})
 }
@@ -71,9 +73,11 @@ type CANUSB struct {
 	canRate    string // S/s command for the configured bit-rate
 	code, mask string // M acceptance-code / m acceptance-mask commands
 
-	sendSem chan struct{} // one outstanding command at a time
-	writeMu sync.Mutex    // serializes port writes (Send vs status poll vs SetFilter)
-	line    []byte        // reply parser accumulator
+	sendSem  chan struct{} // one outstanding command at a time
+	bouncing atomic.Bool   // SetFilter holds sendSem until its F reply
+	writeMu  sync.Mutex    // serializes port writes (Send vs status poll vs SetFilter)
+	line     []byte        // reply parser accumulator
+	clock    gocan.DeviceClock
 }
 
 func New(cfg gocan.Config) (gocan.Adapter, error) {
@@ -91,6 +95,7 @@ func New(cfg gocan.Config) (gocan.Adapter, error) {
 		code:    code,
 		mask:    mask,
 		sendSem: make(chan struct{}, 1),
+		clock:   gocan.DeviceClock{Period: timestampPeriod},
 	}, nil
 }
 
@@ -119,10 +124,10 @@ func (cu *CANUSB) Open(ctx context.Context, bus *gocan.Bus) error {
 	}
 	cu.port.SetReadTimeout(4 * time.Millisecond)
 
-	// Setup sequence per manual §1.5: flush stale queue, probe version, force
-	// timestamp off, set bit-rate, set acceptance filters. Channel stays
-	// closed until we send O below (filters require closed-but-initiated).
-	for _, c := range []string{"", "", "", "V", "N", "Z0", cu.canRate, cu.code, cu.mask} {
+	// Setup sequence per manual §1.5: flush stale queue, probe version, turn
+	// receive timestamps on, set bit-rate, set acceptance filters. Channel
+	// stays closed until we send O below (filters require closed-but-initiated).
+	for _, c := range []string{"", "", "", "V", "N", "Z1", cu.canRate, cu.code, cu.mask} {
 		if _, err := cu.port.Write(append([]byte(c), cr)); err != nil {
 			cu.port.Close()
 			return fmt.Errorf("canusb setup write failed: %w", err)
@@ -135,7 +140,15 @@ func (cu *CANUSB) Open(ctx context.Context, bus *gocan.Bus) error {
 	go cu.statusPoll(ctx)
 
 	// Open the CAN channel.
-	return cu.write([]byte{'O', cr})
+	return cu.write([]byte{cu.openCmd(), cr})
+}
+
+// openCmd is the command opening the channel: L for listen-only, else O.
+func (cu *CANUSB) openCmd() byte {
+	if cu.cfg.ListenOnly {
+		return 'L'
+	}
+	return 'O'
 }
 
 // Close shuts the CAN channel and the port. cu.port is written once in Open
@@ -170,12 +183,26 @@ func (cu *CANUSB) Send(ctx context.Context, f gocan.Frame) error {
 	return cu.write(encode(f))
 }
 
-// SetFilter reconfigures the SJA1000 acceptance filter at runtime. The
-// channel must be closed to set M/m, so we bounce C -> M -> m -> O.
+// SetFilter reconfigures the SJA1000 acceptance filter at runtime to cover
+// the given 11-bit IDs.
 func (cu *CANUSB) SetFilter(filters []uint32) error {
-	code, mask := acceptanceFilters(filters)
-	for _, c := range []string{"C", code, mask, "O"} {
+	return cu.setAcceptance(acceptanceFilters(filters))
+}
+
+// setAcceptance writes the M/m commands. The channel must be closed to set
+// them, so we bounce C -> M -> m -> O (or L). The bounce holds the send gate
+// like a transmit and ends with an F, whose reply releases it; a BELL in
+// between is the bounce's own and must not free the slot for a Send.
+func (cu *CANUSB) setAcceptance(code, mask string) error {
+	select {
+	case cu.sendSem <- struct{}{}:
+	case <-cu.bus.Done():
+		return gocan.ErrClosed
+	}
+	cu.bouncing.Store(true)
+	for _, c := range []string{"C", code, mask, string(cu.openCmd()), "F"} {
 		if err := cu.write(append([]byte(c), cr)); err != nil {
+			cu.bouncing.Store(false)
 			return err
 		}
 	}
@@ -241,7 +268,9 @@ func (cu *CANUSB) parse(data []byte) {
 		switch b {
 		case bell: // command error: release the send semaphore
 			cu.error(errors.New("command error (BELL)"))
-			cu.ack()
+			if !cu.bouncing.Load() {
+				cu.ack()
+			}
 		case cr:
 			if len(cu.line) > 0 {
 				cu.dispatch(cu.line)
@@ -265,10 +294,14 @@ func (cu *CANUSB) dispatch(line []byte) {
 	case 'z', 'Z': // transmit ack
 		cu.ack()
 	case 'F': // status reply (also a command ack)
+		cu.bouncing.Store(false)
 		cu.ack()
-		if err := decodeStatus(line[1:]); err != nil {
-			cu.error(fmt.Errorf("CAN status error: %w", err))
+		v, err := strconv.ParseUint(string(line[1:]), 16, 8)
+		if err != nil {
+			cu.error(fmt.Errorf("failed to decode status %q: %w", line[1:], err))
+			break
 		}
+		reportStatus(cu.bus, v)
 	case 'V':
 		cu.bus.Emit(gocan.Event{Type: gocan.EventTypeInfo, Details: "CANUSB version " + string(line[1:])})
 	case 'N':
@@ -290,10 +323,17 @@ func (cu *CANUSB) error(err error) {
 	cu.bus.Emit(gocan.Event{Type: gocan.EventTypeError, Details: err.Error(), Err: err})
 }
 
-// deliverFrame decodes a received frame line. Layout (timestamp off):
+// timestampPeriod is the wrap of the Z1 receive timestamp, which counts
+// milliseconds from 0 to 0xEA5F.
+const timestampPeriod = time.Minute
+
+// deliverFrame decodes a received frame line. Layout:
 //
-//	standard: t iii l dd..   (id 3 hex, dlc 1, data dlc*2 hex)
-//	extended: T iiiiiiii l dd..
+//	standard: t iii l dd.. ssss   (id 3 hex, dlc 1, data dlc*2 hex)
+//	extended: T iiiiiiii l dd.. ssss
+//
+// Remote frames (r/R) carry no data. ssss is the Z1 timestamp; frames
+// without it get the host clock.
 func (cu *CANUSB) deliverFrame(line []byte, extended bool) {
 	idLen := 3
 	if extended {
@@ -314,18 +354,27 @@ func (cu *CANUSB) deliverFrame(line []byte, extended bool) {
 		cu.error(fmt.Errorf("bad DLC in %q", line))
 		return
 	}
+	f := gocan.Frame{ID: uint32(id), Extended: extended, Length: uint8(dlc)}
+	f.Remote = line[0] == 'r' || line[0] == 'R'
+	n := dlc * 2
+	if f.Remote {
+		n = 0
+	}
 	body := line[2+idLen:]
-	if len(body) < dlc*2 { // ignore any trailing bytes (e.g. timestamp)
+	if len(body) < n {
 		cu.error(fmt.Errorf("truncated data in %q", line))
 		return
 	}
-
-	f := gocan.Frame{ID: uint32(id), Extended: extended, Length: uint8(dlc)}
-	if _, err := hex.Decode(f.Data[:dlc], body[:dlc*2]); err != nil {
+	if _, err := hex.Decode(f.Data[:n/2], body[:n]); err != nil {
 		cu.error(fmt.Errorf("bad data in %q: %w", line, err))
 		return
 	}
-	f.Remote = line[0] == 'r' || line[0] == 'R'
+	if ts := body[n:]; len(ts) == 4 {
+		if ms, err := strconv.ParseUint(string(ts), 16, 16); err == nil {
+			f.Timestamp = cu.clock.Time(time.Duration(ms) * time.Millisecond)
+			f.TimestampSource = gocan.TimestampHardware
+		}
+	}
 	cu.bus.Deliver(f)
 }
 
@@ -377,33 +426,49 @@ func bitRate(rate float64) (string, error) {
 	}
 }
 
-// decodeStatus decodes the F status flags (2 hex chars). Returns the first
-// error condition set, or nil. Bit map per manual §2.0 (F command).
-func decodeStatus(b []byte) error {
-	v, err := strconv.ParseUint(string(b), 16, 16)
-	if err != nil {
-		return fmt.Errorf("failed to decode status %q: %w", b, err)
+// Status flag bits of the F reply (manual §2.0), the SJA1000 interrupt
+// register. The DLL's canusb_Status returns the same bits.
+const (
+	statusRxFIFOFull      = 1 << 0
+	statusTxFIFOFull      = 1 << 1
+	statusErrorWarning    = 1 << 2 // EI
+	statusDataOverrun     = 1 << 3 // DOI
+	statusErrorPassive    = 1 << 5 // EPI
+	statusArbitrationLost = 1 << 6 // ALI
+	statusBusError        = 1 << 7 // BEI
+)
+
+// reportStatus turns status flags into bus events. The flags latch what
+// happened since the previous poll, so a poll with neither EI nor EPI set
+// means the controller is back to error-active.
+func reportStatus(bus *gocan.Bus, v uint64) {
+	switch {
+	case v&statusErrorPassive != 0:
+		bus.ReportState(gocan.BusStatus{State: gocan.BusStateErrorPassive})
+	case v&statusErrorWarning != 0:
+		bus.ReportState(gocan.BusStatus{State: gocan.BusStateErrorWarning})
+	default:
+		bus.ReportState(gocan.BusStatus{State: gocan.BusStateErrorActive})
 	}
-	flags := []struct {
-		bit uint
-		msg string
+	// Arbitration lost is normal contention, retried by the controller, and
+	// reported at debug level only.
+	for _, c := range []struct {
+		bit     uint64
+		kind    gocan.EventKind
+		details string
 	}{
-		{0, "CAN receive FIFO queue full"},
-		{1, "CAN transmit FIFO queue full"},
-		{2, "error warning (EI)"},
-		{3, "data overrun (DOI)"},
-		{5, "error passive (EPI)"},
-		// bit 6 (arbitration lost, ALI) is omitted on purpose: it's normal bus
-		// contention, auto-retransmitted, and the device doesn't even flag it
-		// as a fault (manual §2.0: "doesn't generate a blinking RED light").
-		{7, "bus error (BEI)"},
-	}
-	for _, f := range flags {
-		if v&(1<<f.bit) != 0 {
-			return errors.New(f.msg)
+		{statusDataOverrun, gocan.EventKindOverrun, "data overrun (DOI)"},
+		{statusRxFIFOFull, gocan.EventKindOverrun, "CAN receive FIFO queue full"},
+		{statusTxFIFOFull, gocan.EventKindMessage, "CAN transmit FIFO queue full"},
+		{statusArbitrationLost, gocan.EventKindArbitrationLost, "arbitration lost (ALI)"},
+		{statusBusError, gocan.EventKindErrorFrame, "bus error (BEI)"},
+	} {
+		if v&c.bit != 0 {
+			e := gocan.BusEvent(c.kind, gocan.BusStatus{})
+			e.Details = c.details
+			bus.Emit(e)
 		}
 	}
-	return nil
 }
 
 // acceptanceFilters maps a CAN ID list to M/m commands for the SJA1000
@@ -413,6 +478,10 @@ func acceptanceFilters(ids []uint32) (string, string) {
 	if err != nil {
 		return "M00000000", "mFFFFFFFF"
 	}
+	return acceptanceCommands(code, mask)
+}
+
+func acceptanceCommands(code, mask [4]byte) (string, string) {
 	return fmt.Sprintf("M%02X%02X%02X%02X", code[0], code[1], code[2], code[3]),
 		fmt.Sprintf("m%02X%02X%02X%02X", mask[0], mask[1], mask[2], mask[3])
 }
@@ -437,7 +506,14 @@ func accept11(ids []uint32) (ac, am [4]byte, err error) {
 
 	// maskID: 1 where *all* IDs share the same bit, 0 where they differ
 	maskID := (^diff) & idMask
-	codeID := base & maskID
+	ac, am = dualFilter(base, maskID)
+	return ac, am, nil
+}
+
+// dualFilter maps an 11-bit ID/mask pair (mask 1 = care) into the SJA1000
+// acceptance registers.
+func dualFilter(id, maskID uint32) (ac, am [4]byte) {
+	codeID := id & maskID
 
 	// ---- Map into SJA1000 dual-standard filter 2 layout ----
 	//
@@ -460,5 +536,5 @@ func accept11(ids []uint32) (ac, am [4]byte, err error) {
 	am[2] = ^mask10_3
 	am[3] = ^(mask2_0<<5)&0xE0 | 0x10 // ID2..0 mask, RTR = don't care
 
-	return ac, am, nil
+	return ac, am
 }
@@ -109,7 +109,7 @@ func TestCANUSBOpenSequence(t *testing.T) {
 	fp := newFakePort(true)
 	bus := openCANUSB(t, fp)
 
-	want := []string{"\r", "\r", "\r", "V\r", "N\r", "Z0\r", "S6\r", "M00004300\r", "m00000C10\r", "O\r"}
+	want := []string{"\r", "\r", "\r", "V\r", "N\r", "Z1\r", "S6\r", "M00004300\r", "m00000C10\r", "O\r"}
 	got := fp.writes()
 	if len(got) < len(want) {
 		t.Fatalf("want %d setup writes, got %v", len(want), got)
@@ -130,6 +130,23 @@ func TestCANUSBOpenSequence(t *testing.T) {
 	}
 }
 
+func TestCANUSBListenOnly(t *testing.T) {
+	fp := newFakePort(true)
+	a, err := New(gocan.Config{CANRate: 500, ListenOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.(*CANUSB).port = fp
+	bus, err := gocan.OpenAdapter(context.Background(), a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bus.Close()
+	if got := fp.writes(); got[len(got)-1] != "L\r" {
+		t.Fatalf("want the channel opened with L, got %q", got)
+	}
+}
+
 func TestCANUSBSendReceive(t *testing.T) {
 	fp := newFakePort(true)
 	bus := openCANUSB(t, fp)
@@ -157,7 +174,7 @@ func TestCANUSBSendReceive(t *testing.T) {
 	fp.feed("t25883F81112233445566\r")
 	select {
 	case f := <-sub:
-		if f.ID != 0x258 || f.Extended || f.Length != 8 || f.Data != [8]byte{0x3F, 0x81, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66} {
+		if f.ID != 0x258 || f.Extended || f.Length != 8 || f.Data != [gocan.MaxFDLength]byte{0x3F, 0x81, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66} {
 			t.Fatalf("bad decoded frame: %s", f)
 		}
 	case <-ctx.Done():
@@ -165,6 +182,37 @@ func TestCANUSBSendReceive(t *testing.T) {
 	}
 }
 
+func TestCANUSBTimestamps(t *testing.T) {
+	fp := newFakePort(true)
+	bus := openCANUSB(t, fp)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	sub := bus.Subscribe(ctx, 0x258)
+	// The second stamp has wrapped past 0xEA5F; the third frame has none.
+	fp.feed("t2581AAEA56\rt2581BB000F\rr2582\r")
+	var got []gocan.Frame
+	for len(got) < 3 {
+		select {
+		case f := <-sub:
+			got = append(got, f)
+		case <-ctx.Done():
+			t.Fatalf("got %d of 3 frames", len(got))
+		}
+	}
+	for i, want := range []gocan.TimestampSource{gocan.TimestampHardware, gocan.TimestampHardware, gocan.TimestampHost} {
+		if got[i].TimestampSource != want {
+			t.Fatalf("frame %d: source %v, want %v", i, got[i].TimestampSource, want)
+		}
+	}
+	if d := got[1].Timestamp.Sub(got[0].Timestamp); d != 25*time.Millisecond {
+		t.Fatalf("want 25ms between stamps, got %v", d)
+	}
+	if got[2].Data[0] != 0 || got[2].Length != 2 || !got[2].Remote {
+		t.Fatalf("bad remote frame: %+v", got[2])
+	}
+}
+
 func TestCANUSBSendGatedOnAck(t *testing.T) {
 	fp := newFakePort(false) // no auto-ack
 	bus := openCANUSB(t, fp)
@@ -186,6 +234,36 @@ func TestCANUSBSendGatedOnAck(t *testing.T) {
 	}
 }
 
+func TestCANUSBSetFilterHoldsSendGate(t *testing.T) {
+	fp := newFakePort(true)
+	bus := openCANUSB(t, fp)
+	if err := bus.Adapter().(*CANUSB).SetFilter([]uint32{0x7E8}); err != nil {
+		t.Fatal(err)
+	}
+	w := fp.writes()
+	if got := strings.Join(w[len(w)-5:], ""); got != "C\rM0000FD00\rm00000010\rO\rF\r" {
+		t.Fatalf("unexpected filter bounce %q", got)
+	}
+	// A BELL answering the bounce must not let a send through before the F
+	// reply closes it.
+	fp.feed("\a")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if err := bus.Send(ctx, gocan.NewFrame(0x7E0, nil)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want DeadlineExceeded during the bounce, got %v", err)
+	}
+	fp.feed("F00\r")
+	ctx2, cancel2 := context.WithTimeout(context.Background(), time.Second)
+	defer cancel2()
+	if err := bus.Send(ctx2, gocan.NewFrame(0x7E0, nil)); err != nil {
+		t.Fatalf("send after the bounce: %v", err)
+	}
+	// Reprogramming bounces the channel, so the bus must not manage it.
+	if _, ok := bus.Adapter().(gocan.HardwareFilter); ok {
+		t.Fatal("CANUSB must not implement gocan.HardwareFilter")
+	}
+}
+
 func TestCANUSBErrorReplies(t *testing.T) {
 	fp := newFakePort(true)
 	var mu sync.Mutex
@@ -197,20 +275,20 @@ func TestCANUSBErrorReplies(t *testing.T) {
 	}))
 
 	fp.feed("\a")    // BELL: command error
-	fp.feed("F04\r") // status: error warning (EI)
+	fp.feed("F8C\r") // status: error warning (EI), data overrun (DOI), bus error (BEI)
 
 	deadline := time.After(time.Second)
 	for {
 		mu.Lock()
-		var gotBell, gotStatus bool
+		var gotBell, gotState, gotOverrun, gotBusError bool
 		for _, e := range events {
-			if e.Type == gocan.EventTypeError {
-				gotBell = gotBell || strings.Contains(e.Details, "BELL")
-				gotStatus = gotStatus || strings.Contains(e.Details, "error warning")
-			}
+			gotBell = gotBell || e.Type == gocan.EventTypeError && strings.Contains(e.Details, "BELL")
+			gotState = gotState || e.Kind == gocan.EventKindBusState && e.Status.State == gocan.BusStateErrorWarning
+			gotOverrun = gotOverrun || e.Kind == gocan.EventKindOverrun
+			gotBusError = gotBusError || e.Kind == gocan.EventKindErrorFrame
 		}
 		mu.Unlock()
-		if gotBell && gotStatus {
+		if gotBell && gotState && gotOverrun && gotBusError {
 			return
 		}
 		select {
@@ -231,4 +309,9 @@ func TestCANUSBAcceptanceFilters(t *testing.T) {
 	if code != "M00000000" || mask != "mFFFFFFFF" {
 		t.Fatalf("fallback: got %s %s", code, mask)
 	}
+	// A bus entry for 0x7E8-0x7EF.
+	code, mask = acceptanceCommands(dualFilter(0x7E8, 0x7F8))
+	if code != "M0000FD00" || mask != "m000000F0" {
+		t.Fatalf("entry: got %s %s", code, mask)
+	}
 }
@@ -40,7 +40,7 @@ func scanDLLDevices() []gocan.AdapterInfo {
 			Description:  "Lawicel CANUSB via canusbdrv.dll",
 			Capabilities: gocan.Capabilities{HSCAN: true},
 			New: func(cfg gocan.Config) (gocan.Adapter, error) {
-				return &DLL{cfg: cfg, serial: serial}, nil
+				return &DLL{cfg: cfg, serial: serial, clock: gocan.DeviceClock{Period: timestampPeriod}}, nil
 			},
 		})
 	}
@@ -56,6 +56,7 @@ type DLL struct {
 	serial string
 
 	h         *dll.CANHANDLE
+	clock     gocan.DeviceClock
 	closeOnce sync.Once
 }
 
@@ -166,14 +167,16 @@ func (d *DLL) deliver(msg *dll.CANMsg) uintptr {
 		Length:   msg.Len,
 	}
 	copy(f.Data[:], msg.Data[:msg.Len])
+	f.Timestamp = d.clock.Time(time.Duration(msg.Timestamp) * time.Millisecond)
+	f.TimestampSource = gocan.TimestampHardware
 	d.bus.Deliver(f)
 	return 0
 }
 
-// statusLoop polls the controller status flags and reports error conditions.
-// The API spec warns Status degrades performance and recommends calling it at
-// most once every ten seconds. Arbitration lost is normal bus contention and
-// ERROR_CANUSB_TIMEOUT just means "call again" (spec), so both are skipped.
+// statusLoop polls the controller status flags and reports them as bus
+// events. The API spec warns Status degrades performance and recommends
+// calling it at most once every ten seconds. ERROR_CANUSB_TIMEOUT just means
+// "call again" (spec), so it is skipped.
 func (d *DLL) statusLoop(ctx context.Context) {
 	ticker := time.NewTicker(10 * time.Second)
 	defer ticker.Stop()
@@ -182,7 +185,11 @@ func (d *DLL) statusLoop(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			if err := d.h.Status(); err != nil && err != dll.ErrArbitrationLost && err != dll.ErrTimeout {
+			flags, err := d.h.StatusFlags()
+			switch {
+			case err == nil:
+				reportStatus(d.bus, uint64(flags))
+			case err != dll.ErrTimeout:
 				d.error(err)
 			}
 			if d.cfg.Debug {
@@ -35,7 +35,7 @@ func scanD2XXDevices() []gocan.AdapterInfo {
 		out = append(out, gocan.AdapterInfo{
 			Name:         name,
 			Description:  "Lawicell CANUSB over d2xx",
-			Capabilities: gocan.Capabilities{HSCAN: true, SWCAN: true},
+			Capabilities: gocan.Capabilities{HSCAN: true, SWCAN: true, ListenOnly: true},
 			New: func(cfg gocan.Config) (gocan.Adapter, error) {
 				a, err := New(cfg)
 				if err != nil {
@@ -88,6 +88,8 @@ type Combi struct {
 	handle *libusb.DeviceHandle
 	useEP2 bool // device exposes OUT on EP2 instead of EP5
 
+	hwFilter bool // firmware has cmdCanFilter (>= 1.2)
+
 	closeOnce sync.Once
 
 	txAck     chan struct{} // firmware per-frame cmdCanTxFrame ack
@@ -158,7 +160,8 @@ func (ca *Combi) Open(ctx context.Context, bus *gocan.Bus) error {
 	// Install the firmware acceptance filter only AFTER the read loop is
 	// running (it delivers the ack) and only on firmware >= 1.2; older
 	// firmware has no cmdCanFilter and the Bus filters host-side.
-	if len(ca.cfg.CANFilter) > 0 && verErr == nil && (major > 1 || (major == 1 && minor >= 2)) {
+	ca.hwFilter = verErr == nil && (major > 1 || (major == 1 && minor >= 2))
+	if len(ca.cfg.CANFilter) > 0 && ca.hwFilter {
 		if err := ca.setHardwareFilter(ca.cfg.CANFilter); err != nil {
 			ca.emit(gocan.EventTypeWarning, fmt.Sprintf("failed to set CAN filter: %v", err))
 		}
@@ -244,6 +247,24 @@ func (ca *Combi) setHardwareFilter(ids []uint32) error {
 	}
 }
 
+// FilterCaps reports the firmware's list of up to 32 exact 11-bit IDs.
+func (ca *Combi) FilterCaps() gocan.FilterCaps {
+	return gocan.FilterCaps{MaxEntries: maxHWFilterIDs}
+}
+
+// SetAcceptanceFilters installs the firmware filter from the bus's entries,
+// or disables it for nil. Firmware before 1.2 has none.
+func (ca *Combi) SetAcceptanceFilters(entries []gocan.AcceptanceFilter) error {
+	if !ca.hwFilter {
+		return fmt.Errorf("combi: firmware has no CAN filter: %w", errors.ErrUnsupported)
+	}
+	ids := make([]uint32, len(entries))
+	for i, e := range entries {
+		ids[i] = e.ID
+	}
+	return ca.setHardwareFilter(ids)
+}
+
 // GetADCValue reads one of the board's analog inputs (float32 reply).
 // Requires the read loop for the reply.
 func (ca *Combi) GetADCValue(ctx context.Context, channel int) (float64, error) {
@@ -0,0 +1,144 @@
+// Package gateway uses an adapter shared by a gocan gateway server (see
+// package server and cmd/cangateway), so several tools can use one piece of
+// hardware at once, or a 64-bit tool a 32-bit driver. Importing the package
+// registers the "gateway" adapter; it is not in adapters/all.
+//
+// Extra "adapter" names the adapter to open on the server and Extra
+// "address" overrides server.DefaultAddress. The rest of the Config (port,
+// rates, filter, listen-only, other Extra keys) is passed on to the server,
+// which opens the adapter or joins the tools already using it.
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+
+	gocan "github.com/roffe/gocan/v2"
+	"github.com/roffe/gocan/v2/proto"
+	"github.com/roffe/gocan/v2/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func init() {
+	gocan.Register(gocan.AdapterInfo{
+		Name:        "gateway",
+		Description: "adapter shared by a gocan gateway server",
+		// Whatever the server's adapter can do; the server refuses the rest.
+		Capabilities: gocan.Capabilities{HSCAN: true, SWCAN: true, FD: true, ListenOnly: true},
+		New:          New,
+	})
+}
+
+type Gateway struct {
+	cfg     gocan.Config
+	name    string // adapter on the server
+	address string
+	bus     *gocan.Bus
+	conn    *grpc.ClientConn
+	stream  grpc.BidiStreamingClient[proto.CANFrame, proto.StreamMessage]
+	cancel  context.CancelFunc
+}
+
+func New(cfg gocan.Config) (gocan.Adapter, error) {
+	name := cfg.Extra["adapter"]
+	if name == "" {
+		return nil, errors.New("gateway: Extra[\"adapter\"] must name the server's adapter")
+	}
+	address := cfg.Extra["address"]
+	if address == "" {
+		address = server.DefaultAddress
+	}
+	cfg.Extra = maps.Clone(cfg.Extra)
+	delete(cfg.Extra, "adapter")
+	delete(cfg.Extra, "address")
+	return &Gateway{cfg: cfg, name: name, address: address}, nil
+}
+
+func (g *Gateway) Open(ctx context.Context, bus *gocan.Bus) error {
+	g.bus = bus
+	conn, err := server.Dial(g.address)
+	if err != nil {
+		return fmt.Errorf("could not connect to gocan gateway: %w", err)
+	}
+	sctx, cancel := context.WithCancel(metadata.NewOutgoingContext(ctx, server.Metadata(g.name, g.cfg)))
+	stream, err := proto.NewGocanClient(conn).Stream(sctx)
+	if err == nil {
+		err = expectOK(stream)
+	}
+	if err != nil {
+		cancel()
+		conn.Close()
+		return fmt.Errorf("gateway: %w", err)
+	}
+	g.conn, g.stream, g.cancel = conn, stream, cancel
+	go g.readLoop(ctx)
+	return nil
+}
+
+// expectOK waits for the server's answer to the stream's request.
+func expectOK(stream grpc.BidiStreamingClient[proto.CANFrame, proto.StreamMessage]) error {
+	m, err := stream.Recv()
+	if err != nil {
+		if s, ok := status.FromError(err); ok {
+			return errors.New(s.Message())
+		}
+		return err
+	}
+	if ev := m.GetEvent(); ev == nil || ev.GetMessage() != "OK" {
+		return fmt.Errorf("unexpected answer: %v", m)
+	}
+	return nil
+}
+
+func (g *Gateway) readLoop(ctx context.Context) {
+	for {
+		m, err := g.stream.Recv()
+		if err != nil {
+			if ctx.Err() == nil {
+				if s, ok := status.FromError(err); ok && s.Code() != codes.Unknown {
+					err = errors.New(s.Message())
+				}
+				g.bus.Fatal(fmt.Errorf("gateway: %w", err))
+			}
+			return
+		}
+		switch p := m.GetPayload().(type) {
+		case *proto.StreamMessage_Frame:
+			g.bus.Deliver(p.Frame.Frame())
+		case *proto.StreamMessage_Event:
+			// The server ends the stream after a fatal event; that ends the bus.
+			if e := p.Event.Event(); e.Type != gocan.EventTypeFatal {
+				g.bus.Emit(e)
+			}
+		}
+	}
+}
+
+// Send queues one frame on the stream; the server reports a failed send as
+// an error event. Expected responses (see gocan.WithExpectedResponses) are
+// passed on for the server's adapter.
+func (g *Gateway) Send(ctx context.Context, f gocan.Frame) error {
+	m := proto.FromFrame(f)
+	m.FrameType = proto.CANFrameTypeEnum_Outgoing
+	if n := gocan.ExpectedResponses(ctx); n > 0 {
+		m.FrameType, m.Responses = proto.CANFrameTypeEnum_OutgoingResponseRequired, uint32(n)
+	}
+	if err := g.stream.Send(m); err != nil {
+		return fmt.Errorf("gateway: %w", err)
+	}
+	return nil
+}
+
+func (g *Gateway) Close() error {
+	if g.conn == nil {
+		return nil
+	}
+	g.stream.CloseSend()
+	g.cancel()
+	return g.conn.Close()
+}
@@ -0,0 +1,90 @@
+package gateway
+
+import (
+	"context"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	gocan "github.com/roffe/gocan/v2"
+	"github.com/roffe/gocan/v2/server"
+)
+
+// serve starts a gateway server for the test and returns its address.
+func serve(t *testing.T) string {
+	t.Helper()
+	address := filepath.Join(t.TempDir(), "gw.sock")
+	if runtime.GOOS == "windows" {
+		address = `\\.\pipe\gocan-` + t.Name()
+	}
+	lis, err := server.Listen(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- server.New().Serve(ctx, lis) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	})
+	return address
+}
+
+func TestGateway(t *testing.T) {
+	address := serve(t)
+	cfg := gocan.Config{Port: "gateway test", CANRate: 500, Extra: map[string]string{"adapter": "virtual", "address": address}}
+	var tools [2]*gocan.Bus
+	for i := range tools {
+		bus, err := gocan.Open(context.Background(), "gateway", cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer bus.Close()
+		tools[i] = bus
+	}
+	ecu, err := gocan.OpenAdapter(context.Background(), gocan.Virtual("gateway test").Node(gocan.VirtualNodeConfig{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ecu.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	atECU := ecu.Subscribe(ctx, 0x7E0)
+	if err := tools[0].Send(ctx, gocan.NewFrame(0x7E0, []byte{0x02, 0x10, 0x03})); err != nil {
+		t.Fatal(err)
+	}
+	if f := <-atECU; f.Data[1] != 0x10 {
+		t.Fatalf("ecu: got %v", f)
+	}
+
+	var heard [2]<-chan gocan.Frame
+	for i, bus := range tools {
+		heard[i] = bus.Subscribe(ctx, 0x7E8)
+	}
+	if err := ecu.Send(ctx, gocan.NewExtendedFrame(0x7E8, []byte{0x02, 0x50, 0x03})); err != nil {
+		t.Fatal(err)
+	}
+	for i, ch := range heard {
+		f, ok := <-ch
+		if !ok {
+			t.Fatalf("tool %d heard nothing", i)
+		}
+		if !f.Extended || f.Data[1] != 0x50 || f.TimestampSource != gocan.TimestampHost {
+			t.Fatalf("tool %d: got %v", i, f)
+		}
+	}
+
+	cfg.CANRate = 250
+	if _, err := gocan.Open(context.Background(), "gateway", cfg); err == nil {
+		t.Fatal("opened the shared bus at another rate")
+	}
+	delete(cfg.Extra, "adapter")
+	if _, err := gocan.Open(context.Background(), "gateway", cfg); err == nil {
+		t.Fatal("opened without a server adapter")
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"strconv"
+	"sync"
 	"time"
 
 	gocan "github.com/roffe/gocan/v2"
@@ -41,6 +42,7 @@ type Just4Trionic struct {
 	port    serial.Port
 	canRate string
 	line    []byte
+	writeMu sync.Mutex // keeps a filter bounce from interleaving with Send
 }
 
 func New(cfg gocan.Config) (gocan.Adapter, error) {
@@ -114,7 +116,10 @@ func (a *Just4Trionic) Send(ctx context.Context, f gocan.Frame) error {
 		out += "00"
 	}
 	out += "\r"
-	if _, err := a.port.Write([]byte(out)); err != nil {
+	a.writeMu.Lock()
+	_, err := a.port.Write([]byte(out))
+	a.writeMu.Unlock()
+	if err != nil {
 		return fmt.Errorf("failed to write to com port: %q, %w", out, err)
 	}
 	if a.cfg.Debug {
@@ -123,10 +128,16 @@ func (a *Just4Trionic) Send(ctx context.Context, f gocan.Frame) error {
 	return nil
 }
 
-// SetFilter reprograms the acceptance filter; the channel must be closed
-// while setting M/m, so bounce C -> M -> m -> O.
+// SetFilter reprograms the acceptance filter to cover the given 11-bit IDs.
 func (a *Just4Trionic) SetFilter(filters []uint32) error {
-	code, mask := acceptanceFilters(filters)
+	return a.setAcceptance(acceptanceFilters(filters))
+}
+
+// setAcceptance writes the M/m commands; the channel must be closed while
+// setting them, so bounce C -> M -> m -> O, with sends held off.
+func (a *Just4Trionic) setAcceptance(code, mask string) error {
+	a.writeMu.Lock()
+	defer a.writeMu.Unlock()
 	for _, c := range []string{"C", code, mask, "O"} {
 		if _, err := a.port.Write([]byte(c + "\r")); err != nil {
 			return err
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"log"
 	"syscall"
+	"time"
 	"unsafe"
 
 	gocan "github.com/roffe/gocan/v2"
@@ -34,7 +35,7 @@ func scanDevices() []gocan.AdapterInfo {
 		out = append(out, gocan.AdapterInfo{
 			Name:         name,
 			Description:  "PEAK-System CAN adapter for Windows",
-			Capabilities: gocan.Capabilities{HSCAN: true},
+			Capabilities: gocan.Capabilities{HSCAN: true, ListenOnly: true},
 			New: func(cfg gocan.Config) (gocan.Adapter, error) {
 				return New(handle, cfg)
 			},
@@ -44,10 +45,11 @@ func scanDevices() []gocan.AdapterInfo {
 }
 
 type PCAN struct {
-	cfg  gocan.Config
-	bus  *gocan.Bus
-	ch   pcan.TPCANHandle
-	rate pcan.TPCANBaudrate
+	cfg   gocan.Config
+	bus   *gocan.Bus
+	ch    pcan.TPCANHandle
+	rate  pcan.TPCANBaudrate
+	clock gocan.DeviceClock
 }
 
 func New(ch pcan.TPCANHandle, cfg gocan.Config) (gocan.Adapter, error) {
@@ -64,6 +66,15 @@ func (p *PCAN) Open(ctx context.Context, bus *gocan.Bus) error {
 	if err != nil {
 		return fmt.Errorf("failed to get hardware name: %w", err)
 	}
+	// Listen-only is a pre-initialization parameter, and the driver keeps it
+	// for the channel: set it either way.
+	listen := pcan.DWORD(pcan.PCAN_PARAMETER_OFF)
+	if p.cfg.ListenOnly {
+		listen = pcan.PCAN_PARAMETER_ON
+	}
+	if err := pcan.CAN_SetValue(p.ch, pcan.PCAN_LISTEN_ONLY, uintptr(unsafe.Pointer(&listen)), 4); err != nil && p.cfg.ListenOnly {
+		return fmt.Errorf("failed to set listen-only mode: %w", err)
+	}
 	if err := pcan.CAN_Initialize(p.ch, p.rate); err != nil {
 		return err
 	}
@@ -135,11 +146,20 @@ func (p *PCAN) readLoop(ctx context.Context) {
 			}
 			f := gocan.Frame{ID: msg.ID, Length: msg.LEN}
 			copy(f.Data[:], msg.DATA[:msg.LEN])
+			f.Timestamp = p.clock.Time(sinceStart(timestamp))
+			f.TimestampSource = gocan.TimestampHardware
 			p.bus.Deliver(f)
 		}
 	}
 }
 
+// sinceStart returns a receive timestamp as time since the driver started
+// counting.
+func sinceStart(t pcan.TPCANTimestamp) time.Duration {
+	us := uint64(t.Micros) + 1000*uint64(t.Millis) + 0x100000000*1000*uint64(t.MillisOverflow)
+	return time.Duration(us) * time.Microsecond
+}
+
 func cString(b []byte) string {
 	for i, v := range b {
 		if v == 0 {
@@ -0,0 +1,332 @@
+// Package replay plays recorded CAN logs back as a gocan adapter, so
+// decoders and diagnostic tools can be developed against a captured drive
+// without the car. Importing the package registers the "replay" adapter;
+// cfg.Port is the log file, in any format canlog recognizes (candump, ASC,
+// TRC, CSV, BLF, pcap, pcapng, MDF), optionally gzipped.
+//
+// Frames are delivered with their original inter-frame timing, scaled by
+// the speed setting, and carry their recorded time as a TimestampLog
+// timestamp, so cycle times measured on the bus match the log at any speed.
+//
+// Adapter-specific settings go in cfg.Extra:
+//
+//	speed  playback rate: 1 real time (default), 10 ten times faster,
+//	       0 as fast as possible
+//	loop   "true" restarts the log when it ends
+//	start  skip to this offset into the log, e.g. "90s"
+//	end    stop at this offset into the log
+//	match  "true" turns the log's transmitted (T) frames into expectations:
+//	       playback waits at each one until the client sends the same
+//	       frame, so a tester replays against a recorded ECU
+//
+// cfg.CANFilter limits playback to the listed identifiers. Frames sent to
+// the adapter are kept and can be read back with Sent. With cfg.ListenOnly
+// the adapter refuses to send, like a silent controller; match mode needs
+// sending and cannot be combined with it.
+package replay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	gocan "github.com/roffe/gocan/v2"
+	"github.com/roffe/gocan/v2/canlog"
+)
+
+func init() {
+	gocan.Register(gocan.AdapterInfo{
+		Name:         "replay",
+		Description:  "plays a recorded CAN log file (cfg.Port) back as bus traffic",
+		Capabilities: gocan.Capabilities{FD: true, ListenOnly: true},
+		New:          New,
+	})
+}
+
+// Option configures a Replay.
+type Option func(*Replay)
+
+// WithSpeed scales playback timing: 2 plays twice as fast, 0 as fast as
+// possible.
+func WithSpeed(speed float64) Option {
+	return func(r *Replay) { r.speed = speed }
+}
+
+// WithLoop restarts the log when it ends.
+func WithLoop() Option {
+	return func(r *Replay) { r.loop = true }
+}
+
+// WithStart skips the first d of the log.
+func WithStart(d time.Duration) Option {
+	return func(r *Replay) { r.start = d }
+}
+
+// WithEnd stops playback d into the log.
+func WithEnd(d time.Duration) Option {
+	return func(r *Replay) { r.end = d }
+}
+
+// WithIDs limits playback to frames carrying one of ids.
+func WithIDs(ids ...uint32) Option {
+	return func(r *Replay) {
+		if r.ids == nil && len(ids) > 0 {
+			r.ids = make(map[uint32]bool)
+		}
+		for _, id := range ids {
+			r.ids[id] = true
+		}
+	}
+}
+
+// WithMatch makes the log's transmitted frames expectations that the client
+// has to send before playback continues.
+func WithMatch() Option {
+	return func(r *Replay) { r.match = true }
+}
+
+// WithListenOnly makes Send fail with gocan.ErrListenOnly.
+func WithListenOnly() Option {
+	return func(r *Replay) { r.listenOnly = true }
+}
+
+// sentBuffer is how many client frames may queue up ahead of playback in
+// match mode.
+const sentBuffer = 64
+
+// Replay is the replay adapter.
+type Replay struct {
+	path  string
+	speed float64
+	loop  bool
+	start time.Duration
+	end   time.Duration
+	ids   map[uint32]bool
+	match bool
+
+	listenOnly bool
+
+	bus      *gocan.Bus
+	pending  chan gocan.Frame // client frames awaiting a match
+	finished chan struct{}
+
+	mu   sync.Mutex
+	sent []gocan.Frame
+}
+
+// New builds a replay adapter from cfg; see the package documentation for
+// the settings.
+func New(cfg gocan.Config) (gocan.Adapter, error) {
+	opts := []Option{WithIDs(cfg.CANFilter...)}
+	if cfg.ListenOnly {
+		opts = append(opts, WithListenOnly())
+	}
+	if v := cfg.Extra["speed"]; v != "" {
+		speed, err := strconv.ParseFloat(v, 64)
+		if err != nil || speed < 0 {
+			return nil, fmt.Errorf("replay: invalid speed %q", v)
+		}
+		opts = append(opts, WithSpeed(speed))
+	}
+	for key, opt := range map[string]Option{"loop": WithLoop(), "match": WithMatch()} {
+		if v := cfg.Extra[key]; v != "" {
+			on, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("replay: invalid %s %q", key, v)
+			}
+			if on {
+				opts = append(opts, opt)
+			}
+		}
+	}
+	for key, opt := range map[string]func(time.Duration) Option{"start": WithStart, "end": WithEnd} {
+		if v := cfg.Extra[key]; v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return nil, fmt.Errorf("replay: invalid %s %q", key, v)
+			}
+			opts = append(opts, opt(d))
+		}
+	}
+	return NewReplay(cfg.Port, opts...)
+}
+
+// NewReplay builds a replay adapter for the log at path, for use with
+// gocan.OpenAdapter.
+func NewReplay(path string, opts ...Option) (*Replay, error) {
+	if path == "" {
+		return nil, errors.New("replay: no log file given")
+	}
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("replay: %w", err)
+	}
+	r := &Replay{
+		path:     path,
+		speed:    1,
+		pending:  make(chan gocan.Frame, sentBuffer),
+		finished: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.end > 0 && r.end <= r.start {
+		return nil, fmt.Errorf("replay: end %v is not after start %v", r.end, r.start)
+	}
+	if r.match && r.listenOnly {
+		return nil, errors.New("replay: match mode needs sending, not listen-only")
+	}
+	return r, nil
+}
+
+func (r *Replay) Open(ctx context.Context, bus *gocan.Bus) error {
+	r.bus = bus
+	f, err := r.openLog()
+	if err != nil {
+		return err
+	}
+	go r.run(ctx, f)
+	return nil
+}
+
+func (r *Replay) Close() error { return nil }
+
+// Send records f. In match mode it is also checked against the next
+// transmitted frame in the log.
+func (r *Replay) Send(ctx context.Context, f gocan.Frame) error {
+	if r.listenOnly {
+		return gocan.ErrListenOnly
+	}
+	r.mu.Lock()
+	r.sent = append(r.sent, f)
+	r.mu.Unlock()
+	if !r.match {
+		return nil
+	}
+	select {
+	case r.pending <- f:
+		return nil
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
+
+// Sent returns the frames sent to the adapter so far.
+func (r *Replay) Sent() []gocan.Frame {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]gocan.Frame(nil), r.sent...)
+}
+
+// Finished is closed when playback reaches the end of the log (or the end
+// offset) without looping. The bus stays open.
+func (r *Replay) Finished() <-chan struct{} { return r.finished }
+
+func (r *Replay) openLog() (*canlog.FileReader, error) {
+	f, err := canlog.Open(r.path)
+	if err != nil {
+		return nil, fmt.Errorf("replay: %w", err)
+	}
+	return f, nil
+}
+
+func (r *Replay) run(ctx context.Context, f *canlog.FileReader) {
+	for {
+		err := r.play(ctx, f)
+		f.Close()
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err != nil:
+			r.bus.Fatal(fmt.Errorf("replay: %s: %w", r.path, err))
+			return
+		case !r.loop:
+			r.bus.Emit(gocan.Event{Type: gocan.EventTypeInfo, Details: "replay: end of log"})
+			close(r.finished)
+			return
+		}
+		if f, err = r.openLog(); err != nil {
+			r.bus.Fatal(err)
+			return
+		}
+	}
+}
+
+// play runs one pass over the log.
+func (r *Replay) play(ctx context.Context, log canlog.Reader) error {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	var (
+		first    time.Time // log time of the first record
+		anchor   time.Time // wall time matching log offset anchorAt
+		anchorAt time.Duration
+	)
+	for {
+		rec, err := log.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if first.IsZero() {
+			first = rec.Time
+		}
+		at := rec.Time.Sub(first)
+		if at < r.start {
+			continue
+		}
+		if r.end > 0 && at > r.end {
+			return nil
+		}
+		if rec.Error || r.ids != nil && !r.ids[rec.Frame.ID] {
+			continue
+		}
+		if anchor.IsZero() {
+			anchor, anchorAt = time.Now(), at
+		}
+
+		if r.match && rec.Tx {
+			if err := r.expect(ctx, rec.Frame); err != nil {
+				return err
+			}
+			// The log's timing resumes from when the client caught up.
+			anchor, anchorAt = time.Now(), at
+			continue
+		}
+		if r.speed > 0 {
+			due := anchor.Add(time.Duration(float64(at-anchorAt) / r.speed))
+			if wait := time.Until(due); wait > 0 {
+				timer.Reset(wait)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					return context.Cause(ctx)
+				}
+			}
+		}
+		f := rec.Frame
+		f.Timestamp, f.TimestampSource = rec.Time, gocan.TimestampLog
+		r.bus.Deliver(f)
+	}
+}
+
+// expect waits for the client to send want, reporting any other frames it
+// sends in the meantime.
+func (r *Replay) expect(ctx context.Context, want gocan.Frame) error {
+	for {
+		select {
+		case f := <-r.pending:
+			if f == want {
+				return nil
+			}
+			r.bus.Emit(gocan.Event{Type: gocan.EventTypeWarning, Details: fmt.Sprintf("replay: sent %s, log expects %s", f, want)})
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	gocan "github.com/roffe/gocan/v2"
+)
+
+func writeLog(t *testing.T, lines ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "drive.log")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func openReplay(t *testing.T, cfg gocan.Config, opts ...gocan.Option) (*gocan.Bus, *Replay) {
+	t.Helper()
+	bus, err := gocan.Open(t.Context(), "replay", cfg, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { bus.Close() })
+	return bus, bus.Adapter().(*Replay)
+}
+
+func TestTimingAndOffsets(t *testing.T) {
+	path := writeLog(t,
+		"(100.000000) can0 100#01",
+		"(100.100000) can0 200#02",
+		"(100.300000) can0 100#03",
+		"(100.500000) can0 100#04",
+	)
+	start := time.Now()
+	bus, rp := openReplay(t, gocan.Config{Port: path, Extra: map[string]string{"speed": "2", "start": "50ms", "end": "400ms"}})
+	ch := bus.Subscribe(t.Context())
+	<-rp.Finished()
+	elapsed := time.Since(start)
+	// 0.1 s to 0.3 s of log at double speed.
+	if elapsed < 90*time.Millisecond || elapsed > 400*time.Millisecond {
+		t.Errorf("playback took %v, want about 100ms", elapsed)
+	}
+	var got []byte
+	for len(ch) > 0 {
+		got = append(got, (<-ch).Data[0])
+	}
+	if string(got) != "\x02\x03" {
+		t.Fatalf("got frames % X, want 02 03", got)
+	}
+}
+
+func TestFilterLoopFast(t *testing.T) {
+	path := writeLog(t,
+		"(1.000000) can0 100#01",
+		"(9.000000) can0 200#02",
+	)
+	bus, _ := openReplay(t, gocan.Config{
+		Port: path, CANFilter: []uint32{0x200}, Extra: map[string]string{"speed": "0", "loop": "true"},
+	})
+	ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+	defer cancel()
+	n := 0
+	for f := range bus.Frames(ctx) {
+		if f.ID != 0x200 {
+			t.Fatalf("unfiltered frame %s", f)
+		}
+		if f.TimestampSource != gocan.TimestampLog || f.Timestamp.Unix() != 9 {
+			t.Fatalf("want the log's timestamp, got %v from %v", f.Timestamp, f.TimestampSource)
+		}
+		if n++; n == 3 {
+			break // looped twice
+		}
+	}
+	if n != 3 {
+		t.Fatalf("got %d frames", n)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	path := writeLog(t,
+		"(1.000000) can0 7E0#0210030000000000 T",
+		"(1.020000) can0 7E8#0650030032015700 R",
+		"(5.000000) can0 7E0#023E000000000000 T",
+		"(5.010000) can0 7E8#027E000000000000 R",
+	)
+	var warnings []string
+	bus, rp := openReplay(t, gocan.Config{Port: path, Extra: map[string]string{"match": "true"}},
+		gocan.WithEventFunc(func(e gocan.Event) {
+			if e.Type == gocan.EventTypeWarning {
+				warnings = append(warnings, e.Details)
+			}
+		}))
+
+	ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+	defer cancel()
+	resp, err := bus.Request(ctx, gocan.NewFrame(0x7E0, []byte{0x02, 0x10, 0x03, 0, 0, 0, 0, 0}), 0x7E8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data[1] != 0x50 {
+		t.Fatalf("got %s", resp)
+	}
+	// A wrong frame is reported and playback keeps waiting; the 4 s gap
+	// before the tester present is not replayed.
+	bus.Send(ctx, gocan.NewFrame(0x7E0, []byte{0x02, 0x3E, 0x80, 0, 0, 0, 0, 0}))
+	resp, err = bus.Request(ctx, gocan.NewFrame(0x7E0, []byte{0x02, 0x3E, 0, 0, 0, 0, 0, 0}), 0x7E8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data[1] != 0x7E || len(warnings) != 1 {
+		t.Fatalf("got %s, warnings %q", resp, warnings)
+	}
+	if n := len(rp.Sent()); n != 3 {
+		t.Fatalf("recorded %d sent frames, want 3", n)
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	path := writeLog(t, "(1.000000) can0 100#01")
+	for _, extra := range []map[string]string{
+		{"speed": "-1"},
+		{"loop": "maybe"},
+		{"start": "soon"},
+		{"start": "2s", "end": "1s"},
+	} {
+		if _, err := New(gocan.Config{Port: path, Extra: extra}); err == nil {
+			t.Errorf("accepted %v", extra)
+		}
+	}
+	if _, err := New(gocan.Config{Port: filepath.Join(t.TempDir(), "missing.log")}); err == nil {
+		t.Error("accepted a missing file")
+	}
+	if _, err := New(gocan.Config{Port: path, ListenOnly: true, Extra: map[string]string{"match": "true"}}); err == nil {
+		t.Error("accepted match mode listen-only")
+	}
+}
+
+func TestListenOnly(t *testing.T) {
+	path := writeLog(t, "(1.000000) can0 100#01")
+	bus, rp := openReplay(t, gocan.Config{Port: path, ListenOnly: true})
+	if err := bus.Send(t.Context(), gocan.NewFrame(0x7E0, []byte{1})); !errors.Is(err, gocan.ErrListenOnly) {
+		t.Fatalf("bus send: want ErrListenOnly, got %v", err)
+	}
+	if err := rp.Send(t.Context(), gocan.NewFrame(0x7E0, []byte{1})); !errors.Is(err, gocan.ErrListenOnly) {
+		t.Fatalf("adapter send: want ErrListenOnly, got %v", err)
+	}
+	if n := len(rp.Sent()); n != 0 {
+		t.Fatalf("recorded %d sent frames, want 0", n)
+	}
+}
@@ -38,7 +38,7 @@ func scanD2XXDevices() []gocan.AdapterInfo {
 		out = append(out, gocan.AdapterInfo{
 			Name:         name,
 			Description:  "ftdi d2xx " + baseName,
-			Capabilities: gocan.Capabilities{HSCAN: true, KLine: true},
+			Capabilities: gocan.Capabilities{HSCAN: true, KLine: true, ListenOnly: true},
 			New: func(cfg gocan.Config) (gocan.Adapter, error) {
 				// the base model name drives the STP protocol/bit-rate table
 				a, err := New(baseName, cfg)
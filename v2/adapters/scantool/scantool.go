@@ -11,6 +11,10 @@
 // returning; the reply-count hint is taken from gocan.ExpectedResponses and
 // the timeout from the context deadline.
 //
+// With Config.ListenOnly the controller is put in silent monitor mode
+// (STCMM0, no ACKs) and STMA streams every frame on the bus until Close;
+// nothing can be sent.
+//
 // Open hunts for the adapter across the known baud rates and switches it to
 // 2 Mbit with STBR before running the init sequence (echo/spaces off, STP
 // protocol + bit-rate, headers on, flow control off, ATCF/ATCM filter).
@@ -57,10 +61,10 @@ func init() {
 			},
 		})
 	}
-	register(OBDLinkSX, "ScanTool.net "+OBDLinkSX, gocan.Capabilities{HSCAN: true})
-	register(OBDLinkEX, "ScanTool.net "+OBDLinkEX, gocan.Capabilities{HSCAN: true})
-	register(STN1170, "ScanTool.net STN1170 based adapter", gocan.Capabilities{HSCAN: true, SWCAN: true, KLine: true})
-	register(STN2120, "ScanTool.net STN2120 based adapter", gocan.Capabilities{HSCAN: true, SWCAN: true, KLine: true})
+	register(OBDLinkSX, "ScanTool.net "+OBDLinkSX, gocan.Capabilities{HSCAN: true, ListenOnly: true})
+	register(OBDLinkEX, "ScanTool.net "+OBDLinkEX, gocan.Capabilities{HSCAN: true, ListenOnly: true})
+	register(STN1170, "ScanTool.net STN1170 based adapter", gocan.Capabilities{HSCAN: true, SWCAN: true, KLine: true, ListenOnly: true})
+	register(STN2120, "ScanTool.net STN2120 based adapter", gocan.Capabilities{HSCAN: true, SWCAN: true, KLine: true, ListenOnly: true})
 }
 
 // port is the transport under the STN command interpreter; implemented by
@@ -170,6 +174,13 @@ hunt:
 		}
 	}
 
+	// ACK received frames (normal node): an unACKed ECU retransmits
+	// back-to-back, flooding the reply window with duplicates (seen on
+	// STN1130 v5.10.1). Listen-only monitors silently instead.
+	monitorMode := "STCMM1"
+	if st.cfg.ListenOnly {
+		monitorMode = "STCMM0"
+	}
 	initCmds := []string{
 		"ATE0",         // echo off (insurance; the probe already sent it)
 		"STUFC0",       // flow control off
@@ -182,7 +193,7 @@ hunt:
 		st.canrateCMD,  // CAN bit-rate (may be empty)
 		"ATCFC0",       // automatic CAN flow control off
 		"STPTO250",     // default reply wait 250 ms (STPX t: only sent when it differs)
-		"STCMM1",       // ACK received frames (normal node): an unACKed ECU retransmits back-to-back, flooding the reply window with duplicates (seen on STN1130 v5.10.1)
+		monitorMode,    // CAN monitor mode
 		"ATR0",         // replies off
 		st.mask,
 		st.filter,
@@ -207,14 +218,49 @@ hunt:
 			st.bus.Emit(gocan.Event{Type: gocan.EventTypeWarning, Details: fmt.Sprintf("init %q answered %q", cmd, lines)})
 		}
 	}
+	if st.cfg.ListenOnly {
+		if _, err := st.port.Write([]byte("STMA\r")); err != nil {
+			st.port.Close()
+			return fmt.Errorf("scantool monitor: %w", err)
+		}
+		go st.monitor(ctx)
+	}
 	return nil
 }
 
+// monitor delivers the frames STMA streams until ctx is done.
+func (st *Scantool) monitor(ctx context.Context) {
+	st.line = st.line[:0]
+	var readBuf [64]byte
+	for ctx.Err() == nil {
+		n, err := st.port.Read(readBuf[:])
+		if err != nil {
+			if ctx.Err() == nil {
+				st.bus.Fatal(fmt.Errorf("scantool monitor: %w", err))
+			}
+			return
+		}
+		for _, b := range readBuf[:n] {
+			switch b {
+			case '\r', '>':
+				st.handleLine()
+			default:
+				st.line = append(st.line, b)
+			}
+		}
+	}
+}
+
 func (st *Scantool) Close() error {
 	if st.port == nil {
 		return nil
 	}
 	time.Sleep(25 * time.Millisecond)
+	if st.cfg.ListenOnly {
+		// Any character stops the monitor, and is swallowed doing so.
+		st.port.Write([]byte{'\r'})
+		time.Sleep(10 * time.Millisecond)
+	}
 	// Full reset, not ATWS: reusing a warm-started device showed CAN-level
 	// misbehavior on STN1130 v5.10.1 (unACKed ECU frames retransmitted in
 	// bursts, stale replies leaking into the next STPX window). ATZ reboots
@@ -230,6 +276,9 @@ func (st *Scantool) Close() error {
 // frames ride in the command response (there is no monitor mode), so they are
 // delivered to the bus here before Send returns.
 func (st *Scantool) Send(ctx context.Context, f gocan.Frame) error {
+	if st.cfg.ListenOnly {
+		return errors.New("scantool: listen-only")
+	}
 	var cmd bytes.Buffer
 	fmt.Fprintf(&cmd, "STPXh:%03x,d:", f.ID&0xFFF)
 	fmt.Fprintf(&cmd, "%x", f.Bytes())
@@ -267,7 +316,30 @@ func (st *Scantool) Send(ctx context.Context, f gocan.Frame) error {
 // SetFilter reprograms the ATCF/ATCM acceptance filter at runtime; the
 // protocol must be closed (STPC) while setting it.
 func (st *Scantool) SetFilter(filters []uint32) error {
-	st.filter, st.mask = canFilter(filters)
+	return st.setAcceptance(canFilter(filters))
+}
+
+// FilterCaps reports the single 11-bit ATCF/ATCM pair.
+func (st *Scantool) FilterCaps() gocan.FilterCaps {
+	return gocan.FilterCaps{MaxEntries: 1, Mask: true}
+}
+
+// SetAcceptanceFilters programs ATCF/ATCM from the bus's entry, or opens
+// the filter up for nil. A running monitor can't take commands, so
+// listen-only mode filters on the host.
+func (st *Scantool) SetAcceptanceFilters(entries []gocan.AcceptanceFilter) error {
+	var e gocan.AcceptanceFilter // a zero mask passes everything
+	if len(entries) > 0 {
+		e = entries[0]
+	}
+	return st.setAcceptance(fmt.Sprintf("ATCF%03X", e.ID), fmt.Sprintf("ATCM%03X", e.Mask))
+}
+
+func (st *Scantool) setAcceptance(filter, mask string) error {
+	if st.cfg.ListenOnly {
+		return fmt.Errorf("%w: filter fixed while monitoring", errors.ErrUnsupported)
+	}
+	st.filter, st.mask = filter, mask
 	for _, cmd := range []string{"STPC", st.mask, st.filter, "STPO"} {
 		if err := st.sendCommand(context.Background(), cmd, 0); err != nil {
 			return err
@@ -288,7 +360,9 @@ func (st *Scantool) handleLine() {
 	}
 	switch msg {
 	case "CAN ERROR":
-		st.bus.Emit(gocan.Event{Type: gocan.EventTypeError, Details: "CAN ERROR"})
+		st.bus.Emit(gocan.Event{Type: gocan.EventTypeError, Kind: gocan.EventKindErrorFrame, Details: "CAN ERROR"})
+	case "BUFFER FULL":
+		st.bus.Emit(gocan.BusEvent(gocan.EventKindOverrun, gocan.BusStatus{}))
 	case "STOPPED":
 		st.bus.Emit(gocan.Event{Type: gocan.EventTypeInfo, Details: "STOPPED"})
 	case "?":
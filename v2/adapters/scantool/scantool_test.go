@@ -27,6 +27,8 @@ type stnPort struct {
 	out      []chunk // pending device output
 	wrote    []string
 	closed   bool
+	// monitoring streams a frame on every idle read, until the next write.
+	monitoring bool
 }
 
 type chunk struct {
@@ -60,6 +62,8 @@ func (p *stnPort) command(cmd string) {
 		p.emit("OK\r>")
 	case cmd == "STI":
 		p.emit("STN1170 v4.2.0\r>")
+	case cmd == "STMA":
+		p.monitoring = true
 	case strings.HasPrefix(cmd, "STBRT"):
 		p.emit("OK\r>")
 	case strings.HasPrefix(cmd, "STBR"):
@@ -84,6 +88,11 @@ func (p *stnPort) Write(b []byte) (int, error) {
 		return 0, io.ErrClosedPipe
 	}
 	p.wrote = append(p.wrote, string(b))
+	if p.monitoring {
+		p.monitoring = false // any character stops the monitor, and is swallowed
+		p.emit("STOPPED\r>")
+		return len(b), nil
+	}
 	if p.hostBaud != p.devBaud {
 		p.dirty = true // arrives as line noise
 		return len(b), nil
@@ -98,6 +107,9 @@ func (p *stnPort) Read(b []byte) (int, error) {
 		p.mu.Unlock()
 		return 0, io.ErrClosedPipe
 	}
+	if len(p.out) == 0 && p.monitoring {
+		p.emit("7E8021003\r")
+	}
 	if len(p.out) == 0 {
 		p.mu.Unlock()
 		time.Sleep(time.Millisecond) // read timeout, nothing arrived
@@ -211,3 +223,31 @@ func TestOpenFastPathAtTarget(t *testing.T) {
 		t.Fatalf("device baud after open: %d", fp.devBaud)
 	}
 }
+
+// Listen-only monitors silently and streams frames instead of sending.
+func TestListenOnlyMonitor(t *testing.T) {
+	fp := &stnPort{devBaud: 2_000_000}
+	a, err := New(OBDLinkSX, gocan.Config{CANRate: 500, ListenOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.(*Scantool).port = fp
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	bus, err := gocan.OpenAdapter(ctx, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bus.Close()
+	ch := bus.Subscribe(ctx, 0x7E8)
+	if f := <-ch; f.ID != 0x7E8 || f.Data[0] != 0x02 {
+		t.Fatalf("monitored frame: %s", f)
+	}
+	got := strings.Join(fp.writes(), "")
+	if !strings.Contains(got, "STCMM0\r") || strings.Contains(got, "STCMM1") {
+		t.Fatalf("want silent monitor mode, wrote %q", got)
+	}
+	if err := bus.Send(ctx, gocan.NewFrame(0x7E0, nil)); err == nil {
+		t.Fatal("sent in listen-only mode")
+	}
+}
@@ -2,9 +2,10 @@
 // port. Importing the package registers the "SLCan" adapter.
 //
 // Wire protocol (ASCII, CR terminated): Sn sets the bit-rate (S9 = the
-// CANable custom 615.384 kbit/s), O/C open/close the channel and standard
-// frames travel as "t iii l dd..". The firmware acks transmits with 'z';
-// the ack is not gated on (fire-and-forget like v1).
+// CANable custom 615.384 kbit/s), O/C open/close the channel (L opens it
+// listen-only, for Config.ListenOnly) and standard frames travel as
+// "t iii l dd..". The firmware acks transmits with 'z'; the ack is not
+// gated on (fire-and-forget like v1).
 package slcan
 
 import (
@@ -23,7 +24,7 @@ func init() {
 		Name:               "SLCan",
 		Description:        "Canable SLCan adapter",
 		RequiresSerialPort: true,
-		Capabilities:       gocan.Capabilities{HSCAN: true},
+		Capabilities:       gocan.Capabilities{HSCAN: true, ListenOnly: true},
 		New:                New,
 	})
 }
@@ -69,7 +70,11 @@ func (sl *SLCan) Open(ctx context.Context, bus *gocan.Bus) error {
 		return err
 	}
 	time.Sleep(10 * time.Millisecond)
-	if _, err := p.Write([]byte("O\r")); err != nil {
+	open := "O\r"
+	if sl.cfg.ListenOnly {
+		open = "L\r"
+	}
+	if _, err := p.Write([]byte(open)); err != nil {
 		p.Close()
 		return err
 	}
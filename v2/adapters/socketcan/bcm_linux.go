@@ -0,0 +1,150 @@
+package socketcan
+
+import (
+	"errors"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/roffe/gocan/v2"
+	"golang.org/x/sys/unix"
+)
+
+// Broadcast manager opcodes and flags from linux/can/bcm.h.
+const (
+	bcmTxSetup    = 1
+	bcmSetTimer   = 0x0001
+	bcmStartTimer = 0x0002
+	bcmCANFDFrame = 0x0800
+)
+
+// bcmHead is struct bcm_msg_head; struct bcm_timeval is two longs, like
+// unix.Timeval.
+type bcmHead struct {
+	Opcode  uint32
+	Flags   uint32
+	Count   uint32
+	Ival1   unix.Timeval
+	Ival2   unix.Timeval
+	CanID   uint32
+	Nframes uint32
+}
+
+// The frames following the head are 8-byte aligned.
+const bcmFrameOffset = (unsafe.Sizeof(bcmHead{}) + 7) &^ 7
+
+// StartCyclic has the kernel's broadcast manager send f every period, so
+// the timing is as good as the kernel's timers. Each transmission gets its
+// own BCM socket; closing it ends the transmission.
+//
+// The kernel loops the frames back to the raw socket like any other local
+// sender's. The read loop drops the ones matching a running transmission,
+// so they don't show up as received; like all offloaded frames they bypass
+// the bus's send taps and statistics.
+func (a *SocketCAN) StartCyclic(f gocan.Frame, period time.Duration, count int) (gocan.CyclicTx, error) {
+	if f.FD && !a.fd {
+		return nil, gocan.ErrFDNotSupported
+	}
+	fd, err := unix.Socket(unix.AF_CAN, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, unix.CAN_BCM)
+	if err != nil {
+		return nil, err
+	}
+	if err := unix.Connect(fd, &unix.SockaddrCAN{Ifindex: a.ifindex}); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	tx := &bcmTx{a: a, fd: fd, count: count}
+	if err := tx.setup(f, period, bcmSetTimer|bcmStartTimer); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	return tx, nil
+}
+
+// bcmTx is one broadcast manager transmission.
+type bcmTx struct {
+	a      *SocketCAN
+	mu     sync.Mutex
+	fd     int // -1 once stopped
+	count  int
+	period time.Duration
+	wire   string // the frame as sent, for recognizing its loopback
+}
+
+// Update replaces the frame, and the period from the next transmission on.
+func (t *bcmTx) Update(f gocan.Frame, period time.Duration) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.fd < 0 {
+		return errors.New("socketcan: cyclic transmission stopped")
+	}
+	var flags uint32
+	if period != t.period {
+		flags = bcmSetTimer
+	}
+	return t.setup(f, period, flags)
+}
+
+func (t *bcmTx) Stop() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.fd < 0 {
+		return nil
+	}
+	err := unix.Close(t.fd)
+	t.fd = -1
+	t.a.trackCyclic(t.wire, "")
+	return err
+}
+
+// trackCyclic swaps a running transmission's wire frame from old to new;
+// either may be empty.
+func (a *SocketCAN) trackCyclic(old, new string) {
+	a.cyclicMu.Lock()
+	defer a.cyclicMu.Unlock()
+	if old != "" {
+		if a.cyclic[old]--; a.cyclic[old] <= 0 {
+			delete(a.cyclic, old)
+		}
+	}
+	if new != "" {
+		if a.cyclic == nil {
+			a.cyclic = make(map[string]int)
+		}
+		a.cyclic[new]++
+	}
+}
+
+// isCyclic reports whether frame, as read from the raw socket, is one the
+// broadcast manager is sending.
+func (a *SocketCAN) isCyclic(frame []byte) bool {
+	a.cyclicMu.Lock()
+	defer a.cyclicMu.Unlock()
+	return a.cyclic[string(frame)] > 0
+}
+
+// setup sends a TX_SETUP. With count set the frame goes count times at
+// ival1 and then stops (ival2 is 0); otherwise it repeats at ival2.
+func (t *bcmTx) setup(f gocan.Frame, period time.Duration, flags uint32) error {
+	frame := t.a.encode(f)
+	head := bcmHead{Opcode: bcmTxSetup, Flags: flags, CanID: t.a.canID(f), Nframes: 1}
+	if f.FD {
+		head.Flags |= bcmCANFDFrame
+	}
+	ival := unix.NsecToTimeval(period.Nanoseconds())
+	if t.count > 0 {
+		head.Count, head.Ival1 = uint32(t.count), ival
+	} else {
+		head.Ival2 = ival
+	}
+	msg := make([]byte, bcmFrameOffset, int(bcmFrameOffset)+len(frame))
+	copy(msg, unsafe.Slice((*byte)(unsafe.Pointer(&head)), unsafe.Sizeof(head)))
+	msg = append(msg, frame...)
+	if _, err := unix.Write(t.fd, msg); err != nil {
+		return err
+	}
+	t.period = period
+	t.a.trackCyclic(t.wire, string(frame))
+	t.wire = string(frame)
+	return nil
+}
@@ -2,17 +2,32 @@ package socketcan
 
 import (
 	"context"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"net"
+	"os"
 	"strings"
+	"sync"
+	"time"
+	"unsafe"
 
 	"github.com/roffe/gocan/v2"
-	"go.einride.tech/can"
 	"go.einride.tech/can/pkg/candevice"
-	"go.einride.tech/can/pkg/socketcan"
 	"golang.org/x/sys/unix"
 )
 
+// struct canfd_frame layout and flags from linux/can.h; x/sys/unix only
+// carries the classic CAN constants.
+const (
+	canMTU   = 16 // struct can_frame
+	canfdMTU = 72 // struct canfd_frame
+
+	canfdBRS = 0x01
+	canfdESI = 0x02
+	canfdFDF = 0x04
+)
+
 func init() {
 	gocan.RegisterScanner(scanDevices)
 }
@@ -21,11 +36,11 @@ func scanDevices() []gocan.AdapterInfo {
 	var out []gocan.AdapterInfo
 	for _, dev := range findDevices() {
 		out = append(out, gocan.AdapterInfo{
-			Name:         "SocketCAN " + dev,
+			Name:         "SocketCAN " + dev.Name,
 			Description:  "Linux Driver",
-			Capabilities: gocan.Capabilities{HSCAN: true, SWCAN: true},
+			Capabilities: gocan.Capabilities{HSCAN: true, SWCAN: true, FD: dev.MTU == canfdMTU, ListenOnly: !strings.HasPrefix(dev.Name, "vcan")},
 			New: func(cfg gocan.Config) (gocan.Adapter, error) {
-				cfg.Port = dev
+				cfg.Port = dev.Name
 				return New(cfg)
 			},
 		})
@@ -34,13 +49,17 @@ func scanDevices() []gocan.AdapterInfo {
 }
 
 type SocketCAN struct {
-	cfg     gocan.Config
-	bus     *gocan.Bus
-	dev     *candevice.Device
-	virtual bool
-	conn    net.Conn
-	tx      *socketcan.Transmitter
-	rx      *socketcan.Receiver
+	cfg           gocan.Config
+	bus           *gocan.Bus
+	dev           *candevice.Device
+	virtual       bool
+	fd            bool // socket carries struct canfd_frame
+	wasListenOnly bool // the interface was listen-only before Open
+	conn          *os.File
+	ifindex       int
+
+	cyclicMu sync.Mutex
+	cyclic   map[string]int // wire frames the broadcast manager is sending
 }
 
 func New(cfg gocan.Config) (gocan.Adapter, error) {
@@ -58,77 +77,357 @@ func (a *SocketCAN) Open(ctx context.Context, bus *gocan.Bus) error {
 	// leave their device state alone.
 	a.virtual = strings.HasPrefix(a.cfg.Port, "vcan")
 	if !a.virtual {
+		info, err := a.dev.Info()
+		if err != nil {
+			return err
+		}
+		a.wasListenOnly = info.CtrlMode.Flags&unix.CAN_CTRLMODE_LISTENONLY != 0
 		if err := a.dev.SetBitrate(uint32(a.cfg.CANRate * 1000)); err != nil {
 			return err
 		}
+		if a.cfg.ListenOnly && !a.wasListenOnly {
+			if err := a.dev.SetListenOnlyMode(true); err != nil {
+				return err
+			}
+		}
 		if err := a.dev.SetUp(); err != nil {
 			return err
 		}
 	}
 
-	filters := make([]socketcan.IDFilter, len(a.cfg.CANFilter))
-	for i, filter := range a.cfg.CANFilter {
-		filters[i].ID = filter
-		filters[i].Mask = unix.CAN_SFF_MASK
-	}
-
-	a.conn, err = socketcan.DialContext(ctx, "can", a.cfg.Port, socketcan.WithFilterReceivedFramesByID(filters))
+	ifi, err := net.InterfaceByName(a.cfg.Port)
 	if err != nil {
 		return err
 	}
-	a.tx = socketcan.NewTransmitter(a.conn)
-	a.rx = socketcan.NewReceiver(a.conn)
+	// The data bittiming can only be set together with FD mode through
+	// "ip link"; all we can do is check the interface is in FD mode.
+	a.fd = ifi.MTU == canfdMTU
+	if a.cfg.CANDataRate > 0 && !a.fd {
+		return fmt.Errorf("socketcan: %s is not in CAN FD mode, configure it with: ip link set %s type can bitrate %.0f dbitrate %.0f fd on",
+			a.cfg.Port, a.cfg.Port, a.cfg.CANRate*1000, a.cfg.CANDataRate*1000)
+	}
 
+	a.ifindex = ifi.Index
+	a.conn, err = a.dial(ifi.Index)
+	if err != nil {
+		return fmt.Errorf("socketcan: %w", err)
+	}
 	go a.readLoop(ctx)
 	return nil
 }
 
+// dial opens a non-blocking raw CAN socket bound to the interface, so reads
+// and writes go through the runtime poller and Close unblocks them.
+func (a *SocketCAN) dial(ifindex int) (*os.File, error) {
+	fd, err := unix.Socket(unix.AF_CAN, unix.SOCK_RAW|unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC, unix.CAN_RAW)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.setup(fd, ifindex); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+	return os.NewFile(uintptr(fd), a.cfg.Port), nil
+}
+
+func (a *SocketCAN) setup(fd, ifindex int) error {
+	if len(a.cfg.CANFilter) > 0 {
+		filters := make([]unix.CanFilter, len(a.cfg.CANFilter))
+		for i, filter := range a.cfg.CANFilter {
+			filters[i].Id = filter
+			filters[i].Mask = unix.CAN_SFF_MASK
+		}
+		if err := unix.SetsockoptCanRawFilter(fd, unix.SOL_CAN_RAW, unix.CAN_RAW_FILTER, filters); err != nil {
+			return err
+		}
+	}
+	if a.fd {
+		if err := unix.SetsockoptInt(fd, unix.SOL_CAN_RAW, unix.CAN_RAW_FD_FRAMES, 1); err != nil {
+			return err
+		}
+	}
+	// Error frames carry the controller state, counters and bus errors.
+	if err := unix.SetsockoptInt(fd, unix.SOL_CAN_RAW, unix.CAN_RAW_ERR_FILTER, unix.CAN_ERR_MASK); err != nil {
+		return err
+	}
+	// Receive timestamps are best effort: without them Deliver stamps frames
+	// with the host clock.
+	unix.SetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_TIMESTAMPING, unix.SOF_TIMESTAMPING_RX_HARDWARE|
+		unix.SOF_TIMESTAMPING_RAW_HARDWARE|unix.SOF_TIMESTAMPING_RX_SOFTWARE|unix.SOF_TIMESTAMPING_SOFTWARE)
+	return unix.Bind(fd, &unix.SockaddrCAN{Ifindex: ifindex})
+}
+
 func (a *SocketCAN) Close() error {
 	if a.conn != nil {
 		a.conn.Close() // unblocks the read loop
 	}
 	if a.dev != nil && !a.virtual {
-		return a.dev.SetDown()
+		err := a.dev.SetDown()
+		if a.cfg.ListenOnly && !a.wasListenOnly {
+			// Leave the interface as we found it for the next user.
+			if lerr := a.dev.SetListenOnlyMode(false); err == nil {
+				err = lerr
+			}
+		}
+		return err
 	}
 	return nil
 }
 
-// Send transmits one frame; TransmitFrame blocks until the kernel accepts it.
+// FilterCaps reports the kernel's CAN_RAW_FILTER list: ID/mask pairs in
+// either format.
+func (a *SocketCAN) FilterCaps() gocan.FilterCaps {
+	return gocan.FilterCaps{MaxEntries: unix.CAN_RAW_FILTER_MAX, Mask: true, Extended: true}
+}
+
+// SetAcceptanceFilters replaces the socket's receive filter, so the kernel
+// drops unwanted frames before they are copied to us.
+func (a *SocketCAN) SetAcceptanceFilters(entries []gocan.AcceptanceFilter) error {
+	if a.conn == nil {
+		return errors.New("socketcan: not open")
+	}
+	rc, err := a.conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	filters := rawFilters(entries)
+	if cerr := rc.Control(func(fd uintptr) {
+		err = unix.SetsockoptCanRawFilter(int(fd), unix.SOL_CAN_RAW, unix.CAN_RAW_FILTER, filters)
+	}); cerr != nil {
+		return cerr
+	}
+	return err
+}
+
+// rawFilters converts bus filter entries to CAN_RAW_FILTER ones, matching
+// the frame format through CAN_EFF_FLAG. No entries pass everything.
+func rawFilters(entries []gocan.AcceptanceFilter) []unix.CanFilter {
+	if len(entries) == 0 {
+		return []unix.CanFilter{{Id: 0, Mask: 0}}
+	}
+	filters := make([]unix.CanFilter, len(entries))
+	for i, e := range entries {
+		filters[i] = unix.CanFilter{Id: e.ID, Mask: e.Mask | unix.CAN_EFF_FLAG}
+		if e.Extended {
+			filters[i].Id |= unix.CAN_EFF_FLAG
+		}
+	}
+	return filters
+}
+
+// Send transmits one frame, blocking until the kernel accepts it or ctx's
+// deadline passes.
 func (a *SocketCAN) Send(ctx context.Context, f gocan.Frame) error {
-	frame := can.Frame{
-		ID:         f.ID,
-		Length:     f.Length,
-		IsExtended: f.Extended || a.cfg.UseExtendedID,
+	if f.FD && !a.fd {
+		return gocan.ErrFDNotSupported
 	}
-	copy(frame.Data[:], f.Data[:f.Length])
-	if err := a.tx.TransmitFrame(ctx, frame); err != nil {
+	buf := a.encode(f)
+	deadline, _ := ctx.Deadline()
+	a.conn.SetWriteDeadline(deadline)
+	if _, err := a.conn.Write(buf); err != nil {
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return ctx.Err()
+		}
 		return fmt.Errorf("send error: %w", err)
 	}
 	return nil
 }
 
+// encode lays f out as a struct can_frame, or a struct canfd_frame for CAN
+// FD.
+func (a *SocketCAN) encode(f gocan.Frame) []byte {
+	buf := make([]byte, canMTU, canfdMTU)
+	binary.NativeEndian.PutUint32(buf, a.canID(f))
+	buf[4] = f.Length
+	if f.FD {
+		buf = buf[:canfdMTU]
+		buf[5] = canfdFDF
+		if f.BRS {
+			buf[5] |= canfdBRS
+		}
+		if f.ESI {
+			buf[5] |= canfdESI
+		}
+	}
+	copy(buf[8:], f.Bytes())
+	return buf
+}
+
+// canID returns f's identifier with the kernel's format flags.
+func (a *SocketCAN) canID(f gocan.Frame) uint32 {
+	id := f.ID
+	if f.Extended || a.cfg.UseExtendedID {
+		id = id&unix.CAN_EFF_MASK | unix.CAN_EFF_FLAG
+	}
+	if f.Remote {
+		id |= unix.CAN_RTR_FLAG
+	}
+	return id
+}
+
 func (a *SocketCAN) readLoop(ctx context.Context) {
-	for a.rx.Receive() {
+	rc, err := a.conn.SyscallConn()
+	if err != nil {
+		a.bus.Fatal(fmt.Errorf("socketcan receive: %w", err))
+		return
+	}
+	buf := make([]byte, canfdMTU)
+	oob := make([]byte, unix.CmsgSpace(3*int(unsafe.Sizeof(unix.Timespec{}))))
+	for {
+		var n, oobn, flags int
+		var rerr error
+		err := rc.Read(func(fd uintptr) bool {
+			n, oobn, flags, _, rerr = unix.Recvmsg(int(fd), buf, oob, 0)
+			return rerr != unix.EAGAIN
+		})
+		if err == nil {
+			err = rerr
+		}
 		if ctx.Err() != nil {
 			return
 		}
-		f := a.rx.Frame()
-		frame := gocan.Frame{ID: f.ID, Length: f.Length, Extended: f.IsExtended, Remote: f.IsRemote}
-		copy(frame.Data[:], f.Data[:f.Length])
+		if err != nil {
+			a.bus.Fatal(fmt.Errorf("socketcan receive: %w", err))
+			return
+		}
+		if n != canMTU && n != canfdMTU {
+			continue
+		}
+		if flags&unix.MSG_DONTROUTE != 0 && a.isCyclic(buf[:n]) {
+			continue // our own broadcast manager transmission looped back
+		}
+		id := binary.NativeEndian.Uint32(buf)
+		if id&unix.CAN_ERR_FLAG != 0 {
+			a.errorFrame(id, buf[8:16])
+			continue
+		}
+		frame := gocan.Frame{
+			Extended: id&unix.CAN_EFF_FLAG != 0,
+			Remote:   id&unix.CAN_RTR_FLAG != 0,
+			Length:   min(buf[4], gocan.MaxFDLength),
+		}
+		if frame.Extended {
+			frame.ID = id & unix.CAN_EFF_MASK
+		} else {
+			frame.ID = id & unix.CAN_SFF_MASK
+		}
+		if n == canfdMTU {
+			frame.FD = true
+			frame.BRS = buf[5]&canfdBRS != 0
+			frame.ESI = buf[5]&canfdESI != 0
+		} else {
+			frame.Length = min(frame.Length, 8)
+		}
+		if !frame.Remote {
+			copy(frame.Data[:], buf[8:8+int(frame.Length)])
+		}
+		frame.Timestamp, frame.TimestampSource = rxTimestamp(oob[:oobn])
 		a.bus.Deliver(frame)
 	}
-	if ctx.Err() == nil {
-		if err := a.rx.Err(); err != nil {
-			a.bus.Fatal(fmt.Errorf("socketcan receive: %w", err))
+}
+
+// rxTimestamp picks the receive time out of a SCM_TIMESTAMPING control
+// message: the raw hardware stamp when the controller provides one, else
+// the kernel's software stamp.
+func rxTimestamp(oob []byte) (time.Time, gocan.TimestampSource) {
+	msgs, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return time.Time{}, gocan.TimestampNone
+	}
+	for _, m := range msgs {
+		if m.Header.Level != unix.SOL_SOCKET || m.Header.Type != unix.SCM_TIMESTAMPING ||
+			len(m.Data) < 3*int(unsafe.Sizeof(unix.Timespec{})) {
+			continue
+		}
+		// struct scm_timestamping: software, legacy, raw hardware.
+		ts := (*[3]unix.Timespec)(unsafe.Pointer(&m.Data[0]))
+		if ts[2].Sec != 0 || ts[2].Nsec != 0 {
+			return time.Unix(ts[2].Unix()), gocan.TimestampHardware
+		}
+		if ts[0].Sec != 0 || ts[0].Nsec != 0 {
+			return time.Unix(ts[0].Unix()), gocan.TimestampKernel
+		}
+	}
+	return time.Time{}, gocan.TimestampNone
+}
+
+// errorFrame reports a SocketCAN error frame as bus events.
+func (a *SocketCAN) errorFrame(id uint32, data []byte) {
+	status, events := decodeErrorFrame(id, data)
+	if status.State != gocan.BusStateUnknown {
+		a.bus.ReportState(status)
+	}
+	for _, e := range events {
+		a.bus.Emit(e)
+	}
+}
+
+// decodeErrorFrame decodes an error frame (linux/can/error.h) into the
+// controller state it announces, if any, and events for the arbitration
+// loss, overruns, protocol errors and error counters it carries.
+func decodeErrorFrame(id uint32, data []byte) (gocan.BusStatus, []gocan.Event) {
+	var status gocan.BusStatus
+	if id&unix.CAN_ERR_CNT != 0 {
+		status.Counters, status.TxErrors, status.RxErrors = true, int(data[6]), int(data[7])
+	}
+	ctrl := byte(0)
+	if id&unix.CAN_ERR_CRTL != 0 {
+		ctrl = data[1]
+	}
+	switch {
+	case id&unix.CAN_ERR_BUSOFF != 0:
+		status.State = gocan.BusStateBusOff
+	case ctrl&(unix.CAN_ERR_CRTL_TX_PASSIVE|unix.CAN_ERR_CRTL_RX_PASSIVE) != 0:
+		status.State = gocan.BusStateErrorPassive
+	case ctrl&(unix.CAN_ERR_CRTL_TX_WARNING|unix.CAN_ERR_CRTL_RX_WARNING) != 0:
+		status.State = gocan.BusStateErrorWarning
+	case ctrl&unix.CAN_ERR_CRTL_ACTIVE != 0 || id&unix.CAN_ERR_RESTARTED != 0:
+		status.State = gocan.BusStateErrorActive
+	}
+
+	var events []gocan.Event
+	if id&unix.CAN_ERR_LOSTARB != 0 {
+		events = append(events, gocan.BusEvent(gocan.EventKindArbitrationLost, gocan.BusStatus{}))
+	}
+	if ctrl&(unix.CAN_ERR_CRTL_RX_OVERFLOW|unix.CAN_ERR_CRTL_TX_OVERFLOW) != 0 {
+		events = append(events, gocan.BusEvent(gocan.EventKindOverrun, gocan.BusStatus{}))
+	}
+	if id&(unix.CAN_ERR_PROT|unix.CAN_ERR_BUSERROR|unix.CAN_ERR_ACK) != 0 {
+		s := gocan.BusStatus{Counters: status.Counters, TxErrors: status.TxErrors, RxErrors: status.RxErrors}
+		if id&unix.CAN_ERR_PROT != 0 {
+			prot, loc := data[2], data[3]
+			if prot&(unix.CAN_ERR_PROT_BIT|unix.CAN_ERR_PROT_BIT0|unix.CAN_ERR_PROT_BIT1) != 0 {
+				s.Errors |= gocan.BusErrorBit
+			}
+			if prot&unix.CAN_ERR_PROT_STUFF != 0 {
+				s.Errors |= gocan.BusErrorStuff
+			}
+			if prot&unix.CAN_ERR_PROT_FORM != 0 {
+				s.Errors |= gocan.BusErrorForm
+			}
+			switch loc {
+			case unix.CAN_ERR_PROT_LOC_CRC_SEQ, unix.CAN_ERR_PROT_LOC_CRC_DEL:
+				s.Errors |= gocan.BusErrorCRC
+			case unix.CAN_ERR_PROT_LOC_ACK, unix.CAN_ERR_PROT_LOC_ACK_DEL:
+				s.Errors |= gocan.BusErrorAck
+			}
 		}
+		if id&unix.CAN_ERR_ACK != 0 {
+			s.Errors |= gocan.BusErrorAck
+		}
+		events = append(events, gocan.BusEvent(gocan.EventKindErrorFrame, s))
+	}
+	if status.Counters && status.State == gocan.BusStateUnknown && len(events) == 0 {
+		events = append(events, gocan.BusEvent(gocan.EventKindErrorCounters, status))
 	}
+	return status, events
 }
 
-func findDevices() (dev []string) {
+func findDevices() (dev []net.Interface) {
 	iFaces, _ := net.Interfaces()
 	for _, i := range iFaces {
 		if strings.Contains(i.Name, "can") {
-			dev = append(dev, i.Name)
+			dev = append(dev, i)
 		}
 	}
 	return
@@ -0,0 +1,74 @@
+package socketcan
+
+import (
+	"testing"
+
+	"github.com/roffe/gocan/v2"
+	"golang.org/x/sys/unix"
+)
+
+func TestDecodeErrorFrame(t *testing.T) {
+	// Controller went error-passive on receive, counters attached.
+	status, events := decodeErrorFrame(unix.CAN_ERR_CRTL|unix.CAN_ERR_CNT, []byte{0, unix.CAN_ERR_CRTL_RX_PASSIVE, 0, 0, 0, 0, 12, 130})
+	if status.State != gocan.BusStateErrorPassive || !status.Counters || status.TxErrors != 12 || status.RxErrors != 130 {
+		t.Fatalf("bad status %+v", status)
+	}
+	if len(events) != 0 {
+		t.Fatalf("state change should be the only report, got %v", events)
+	}
+
+	// Stuff error in the CRC sequence plus a missing ack, with an overflow.
+	id := uint32(unix.CAN_ERR_PROT | unix.CAN_ERR_ACK | unix.CAN_ERR_CRTL)
+	status, events = decodeErrorFrame(id, []byte{0, unix.CAN_ERR_CRTL_RX_OVERFLOW, unix.CAN_ERR_PROT_STUFF, unix.CAN_ERR_PROT_LOC_CRC_SEQ, 0, 0, 0, 0})
+	if status.State != gocan.BusStateUnknown {
+		t.Fatalf("unexpected state %v", status.State)
+	}
+	if len(events) != 2 || events[0].Kind != gocan.EventKindOverrun || events[1].Kind != gocan.EventKindErrorFrame {
+		t.Fatalf("want overrun and error frame, got %v", events)
+	}
+	if want := gocan.BusErrorStuff | gocan.BusErrorCRC | gocan.BusErrorAck; events[1].Status.Errors != want {
+		t.Fatalf("errors %v, want %v", events[1].Status.Errors, want)
+	}
+
+	status, _ = decodeErrorFrame(unix.CAN_ERR_BUSOFF, make([]byte, 8))
+	if status.State != gocan.BusStateBusOff {
+		t.Fatalf("want bus-off, got %v", status.State)
+	}
+	status, _ = decodeErrorFrame(unix.CAN_ERR_RESTARTED, make([]byte, 8))
+	if status.State != gocan.BusStateErrorActive {
+		t.Fatalf("want error-active after restart, got %v", status.State)
+	}
+}
+
+func TestRawFilters(t *testing.T) {
+	got := rawFilters([]gocan.AcceptanceFilter{{ID: 0x7E8, Mask: 0x7F8}, {ID: 0x18DAF100, Mask: 0x1FFFFF00, Extended: true}})
+	want := []unix.CanFilter{
+		{Id: 0x7E8, Mask: 0x7F8 | unix.CAN_EFF_FLAG},
+		{Id: 0x18DAF100 | unix.CAN_EFF_FLAG, Mask: 0x1FFFFF00 | unix.CAN_EFF_FLAG},
+	}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	if all := rawFilters(nil); len(all) != 1 || all[0].Mask != 0 {
+		t.Fatalf("nil entries should pass everything, got %+v", all)
+	}
+}
+
+func TestCyclicLoopback(t *testing.T) {
+	a := &SocketCAN{}
+	f1, f2 := a.encode(gocan.NewFrame(0x200, []byte{1})), a.encode(gocan.NewFrame(0x200, []byte{2}))
+	a.trackCyclic("", string(f1))
+	a.trackCyclic("", string(f1)) // a second transmission of the same frame
+	if !a.isCyclic(f1) || a.isCyclic(f2) {
+		t.Fatal("want only the running frame recognized")
+	}
+	a.trackCyclic(string(f1), string(f2)) // one of them updated
+	if !a.isCyclic(f1) || !a.isCyclic(f2) {
+		t.Fatal("want both running frames recognized")
+	}
+	a.trackCyclic(string(f1), "")
+	a.trackCyclic(string(f2), "")
+	if a.isCyclic(f1) || a.isCyclic(f2) || len(a.cyclic) != 0 {
+		t.Fatalf("stopped frames still tracked: %v", a.cyclic)
+	}
+}
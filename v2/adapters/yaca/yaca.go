@@ -3,7 +3,8 @@
 //
 // Wire protocol (Lawicel-flavoured ASCII): Sn selects one of the four fixed
 // bit-rates (33.3 / 47.619 / 500 / 615.384 kbit/s), M/m program the SJA1000
-// style acceptance code/mask, O/C open/close the channel. Transmit is
+// style acceptance code/mask, O/C open/close the channel (L opens it
+// listen-only, as on the CANUSB). Transmit is
 // "t iii l dd..\r"; received lines are LF terminated: "t..." frames, "F.."
 // status flags and BEL for an unknown command.
 package yaca
@@ -11,9 +12,9 @@ package yaca
 import (
 	"context"
 	"encoding/hex"
-	"errors"
 	"fmt"
 	"strconv"
+	"sync"
 	"time"
 
 	gocan "github.com/roffe/gocan/v2"
@@ -25,20 +26,42 @@ func init() {
 		Name:               "YACA",
 		Description:        "Yet Another CANBus Adapter",
 		RequiresSerialPort: true,
-		Capabilities:       gocan.Capabilities{HSCAN: true},
+		Capabilities:       gocan.Capabilities{HSCAN: true, ListenOnly: true},
 		New:                New,
 	})
 }
 
 type YACA struct {
-	cfg  gocan.Config
-	bus  *gocan.Bus
-	port serial.Port
-	line []byte
+	cfg     gocan.Config
+	bus     *gocan.Bus
+	port    serial.Port
+	line    []byte
+	canRate string     // S command for the configured bit-rate
+	writeMu sync.Mutex // keeps a filter bounce from interleaving with Send
 }
 
 func New(cfg gocan.Config) (gocan.Adapter, error) {
-	return &YACA{cfg: cfg}, nil
+	rate, err := bitRate(cfg.CANRate)
+	if err != nil {
+		return nil, err
+	}
+	return &YACA{cfg: cfg, canRate: rate}, nil
+}
+
+// bitRate maps a CAN rate in kbit/s to one of the four fixed rates.
+func bitRate(rate float64) (string, error) {
+	switch rate {
+	case 33.3:
+		return "S0", nil
+	case 47.619:
+		return "S1", nil
+	case 500:
+		return "S2", nil
+	case 615.384:
+		return "S3", nil
+	default:
+		return "", fmt.Errorf("unsupported CAN rate: %g kbit/s", rate)
+	}
 }
 
 func (ya *YACA) Open(ctx context.Context, bus *gocan.Bus) error {
@@ -57,16 +80,7 @@ func (ya *YACA) Open(ctx context.Context, bus *gocan.Bus) error {
 	p.ResetOutputBuffer()
 	p.ResetInputBuffer()
 
-	switch ya.cfg.CANRate {
-	case 33.3:
-		p.Write([]byte("S0\r"))
-	case 47.619:
-		p.Write([]byte("S1\r"))
-	case 500:
-		p.Write([]byte("S2\r"))
-	case 615.384:
-		p.Write([]byte("S3\r"))
-	}
+	p.Write([]byte(ya.canRate + "\r"))
 	time.Sleep(5 * time.Millisecond)
 
 	code, mask := filterCodeAndMask(ya.cfg.CANFilter)
@@ -74,7 +88,7 @@ func (ya *YACA) Open(ctx context.Context, bus *gocan.Bus) error {
 	time.Sleep(5 * time.Millisecond)
 	p.Write([]byte(mask + "\r"))
 	time.Sleep(5 * time.Millisecond)
-	p.Write([]byte("O\r"))
+	p.Write([]byte(ya.openCmd() + "\r"))
 
 	go ya.readLoop(ctx)
 	return nil
@@ -92,7 +106,10 @@ func (ya *YACA) Close() error {
 
 func (ya *YACA) Send(ctx context.Context, f gocan.Frame) error {
 	out := fmt.Sprintf("t%03x%d%s\x0D", f.ID&0xFFF, f.Length, hex.EncodeToString(f.Bytes()))
-	if _, err := ya.port.Write([]byte(out)); err != nil {
+	ya.writeMu.Lock()
+	_, err := ya.port.Write([]byte(out))
+	ya.writeMu.Unlock()
+	if err != nil {
 		return fmt.Errorf("failed to write to com port: %s, %w", out, err)
 	}
 	if ya.cfg.Debug {
@@ -101,11 +118,17 @@ func (ya *YACA) Send(ctx context.Context, f gocan.Frame) error {
 	return nil
 }
 
-// SetFilter reprograms the acceptance filter; the channel must be closed
-// while setting M/m, so bounce C -> M -> m -> O.
+// SetFilter reprograms the acceptance filter to cover the given 11-bit IDs.
 func (ya *YACA) SetFilter(filters []uint32) error {
-	code, mask := filterCodeAndMask(filters)
-	for _, c := range []string{"C", code, mask, "O"} {
+	return ya.setAcceptance(filterCodeAndMask(filters))
+}
+
+// setAcceptance writes the M/m commands; the channel must be closed while
+// setting them, so bounce C -> M -> m -> O (or L), with sends held off.
+func (ya *YACA) setAcceptance(code, mask string) error {
+	ya.writeMu.Lock()
+	defer ya.writeMu.Unlock()
+	for _, c := range []string{"C", code, mask, ya.openCmd()} {
 		if _, err := ya.port.Write([]byte(c + "\r")); err != nil {
 			return err
 		}
@@ -113,6 +136,14 @@ func (ya *YACA) SetFilter(filters []uint32) error {
 	return nil
 }
 
+// openCmd is the command opening the channel: L for listen-only, else O.
+func (ya *YACA) openCmd() string {
+	if ya.cfg.ListenOnly {
+		return "L"
+	}
+	return "O"
+}
+
 func (ya *YACA) readLoop(ctx context.Context) {
 	readBuffer := make([]byte, 8)
 	for {
@@ -144,8 +175,8 @@ func (ya *YACA) parse(data []byte) {
 		}
 		switch ya.line[0] {
 		case 'F':
-			if err := decodeStatus(ya.line); err != nil {
-				ya.bus.Emit(gocan.Event{Type: gocan.EventTypeWarning, Details: fmt.Sprintf("CAN status error: %v", err)})
+			if err := ya.reportStatus(ya.line); err != nil {
+				ya.bus.Emit(gocan.Event{Type: gocan.EventTypeWarning, Details: err.Error(), Err: err})
 			}
 		case 't':
 			f, err := decodeFrame(ya.line)
@@ -184,27 +215,47 @@ func decodeFrame(buff []byte) (gocan.Frame, error) {
 	return f, nil
 }
 
-func decodeStatus(b []byte) error {
+// Status flag bits of an F line, the SJA1000 interrupt register.
+const (
+	statusRxFIFOFull      = 1 << 0
+	statusTxFIFOFull      = 1 << 1
+	statusErrorWarning    = 1 << 2 // EI
+	statusDataOverrun     = 1 << 3 // DOI
+	statusErrorPassive    = 1 << 5 // EPI
+	statusArbitrationLost = 1 << 6 // ALI
+	statusBusError        = 1 << 7 // BEI
+)
+
+// reportStatus turns an F line into bus events. A status with neither EI
+// nor EPI set means the controller is error-active.
+func (ya *YACA) reportStatus(b []byte) error {
 	v, err := strconv.ParseUint(string(b[1:]), 16, 16)
 	if err != nil {
 		return fmt.Errorf("failed to decode status: %w", err)
 	}
-	flags := []struct {
-		bit int
-		msg string
+	switch {
+	case v&statusErrorPassive != 0:
+		ya.bus.ReportState(gocan.BusStatus{State: gocan.BusStateErrorPassive})
+	case v&statusErrorWarning != 0:
+		ya.bus.ReportState(gocan.BusStatus{State: gocan.BusStateErrorWarning})
+	default:
+		ya.bus.ReportState(gocan.BusStatus{State: gocan.BusStateErrorActive})
+	}
+	for _, c := range []struct {
+		bit     uint64
+		kind    gocan.EventKind
+		details string
 	}{
-		{1, "CAN receive FIFO queue full"},
-		{2, "CAN transmit FIFO queue full"},
-		{3, "error warning (EI)"},
-		{4, "data overrun (DOI)"},
-		{5, "not used"},
-		{6, "error passive (EPI)"},
-		{7, "arbitration lost (ALI)"},
-		{8, "bus error (BEI)"},
-	}
-	for _, f := range flags {
-		if v&(1<<(f.bit-1)) != 0 {
-			return errors.New(f.msg)
+		{statusDataOverrun, gocan.EventKindOverrun, "data overrun (DOI)"},
+		{statusRxFIFOFull, gocan.EventKindOverrun, "CAN receive FIFO queue full"},
+		{statusTxFIFOFull, gocan.EventKindMessage, "CAN transmit FIFO queue full"},
+		{statusArbitrationLost, gocan.EventKindArbitrationLost, "arbitration lost (ALI)"},
+		{statusBusError, gocan.EventKindErrorFrame, "bus error (BEI)"},
+	} {
+		if v&c.bit != 0 {
+			e := gocan.BusEvent(c.kind, gocan.BusStatus{})
+			e.Details = c.details
+			ya.bus.Emit(e)
 		}
 	}
 	return nil
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"iter"
 	"log/slog"
+	"slices"
 	"sync"
 	"time"
 )
@@ -14,6 +15,14 @@ import (
 // reported as a clean shutdown (Bus.Err returns nil) rather than a failure.
 var ErrClosed = errors.New("gocan: bus closed")
 
+// ErrFDNotSupported is returned by Bus.Send for CAN FD frames when the
+// adapter does not advertise Capabilities.FD.
+var ErrFDNotSupported = errors.New("gocan: adapter does not support CAN FD")
+
+// ErrListenOnly is returned by Bus.Send and Bus.SendPeriodic on a bus
+// opened listen-only (see Config.ListenOnly and WithListenOnly).
+var ErrListenOnly = errors.New("gocan: bus is listen-only")
+
 // Option configures a Bus before its adapter is opened.
 type Option func(*Bus)
 
@@ -23,6 +32,12 @@ func WithEventFunc(fn func(Event)) Option {
 	return func(b *Bus) { b.addSink(fn) }
 }
 
+// WithReceiveFunc registers fn like Bus.OnReceive, before the adapter
+// starts, so it sees the first frame the adapter delivers.
+func WithReceiveFunc(fn func(Frame)) Option {
+	return func(b *Bus) { b.addTap(&b.recvTaps, fn) }
+}
+
 // WithLogger forwards every adapter event to l at the matching slog level.
 // Error and fatal events attach the underlying error under the "err" key.
 func WithLogger(l *slog.Logger) Option {
@@ -37,11 +52,22 @@ func WithLogger(l *slog.Logger) Option {
 	}
 }
 
+// WithListenOnly marks the bus listen-only: Send and SendPeriodic fail with
+// ErrListenOnly, and opening fails if the adapter is known not to support
+// it (Capabilities.ListenOnly). Open sets it from Config.ListenOnly; use it
+// with OpenAdapter on an adapter constructed listen-only.
+func WithListenOnly() Option {
+	return func(b *Bus) { b.listenOnly = true }
+}
+
 // Bus is a connection to a CAN bus through an adapter. It fans incoming
 // frames out to subscribers and serializes outgoing frames to the adapter.
 type Bus struct {
-	adapter Adapter
-	name    string
+	adapter    Adapter
+	name       string
+	caps       Capabilities
+	capsKnown  bool
+	listenOnly bool // set by WithListenOnly
 
 	// ctx is cancelled when the bus terminates. The cancel cause carries the
 	// fatal adapter error, or ErrClosed on a clean shutdown.
@@ -53,10 +79,34 @@ type Bus struct {
 	subMu      sync.Mutex
 	submap     map[uint32]map[*sub]struct{}
 	globalSubs []*sub
+	filterSubs []*sub // checked frame by frame
 
 	sinkMu sync.Mutex
 	sinks  []*eventSink
 
+	tapMu    sync.Mutex
+	sendTaps []*frameTap
+	recvTaps []*frameTap
+
+	stateMu sync.Mutex
+	state   BusState
+
+	// hw is the adapter's hardware filter, nil with WithHostFiltering.
+	hw            HardwareFilter
+	hwMu          sync.Mutex
+	hwEntries     []AcceptanceFilter // last programmed, nil = pass all
+	hwKnown       bool               // hwEntries reflects the hardware
+	hwUnsupported bool               // the adapter turned out to have no filter
+	hwTimer       *time.Timer
+
+	sched scheduler
+
+	reconnect  *Reconnect              // set by WithReconnect
+	newAdapter func() (Adapter, error) // constructs a fresh adapter, from Open
+
+	stats                busStats
+	bitrate, dataBitrate float64 // kbit/s, for Stats.Load
+
 	closeOnce sync.Once
 }
 
@@ -71,6 +121,17 @@ func Open(ctx context.Context, adapterName string, cfg Config, opts ...Option) (
 	if err != nil {
 		return nil, err
 	}
+	opts = append([]Option{
+		WithBitrate(cfg.CANRate, cfg.CANDataRate),
+		func(b *Bus) { b.newAdapter = func() (Adapter, error) { return info.New(cfg) } },
+	}, opts...)
+	if cfg.ListenOnly {
+		opts = append([]Option{WithListenOnly()}, opts...)
+	}
+	if len(cfg.CANFilter) > 0 {
+		// The caller picked the hardware filter; leave it be.
+		opts = append([]Option{WithHostFiltering()}, opts...)
+	}
 	return open(ctx, info.Name, adapter, opts...)
 }
 
@@ -90,9 +151,24 @@ func open(ctx context.Context, name string, adapter Adapter, opts ...Option) (*B
 		cancel:  cancel,
 		submap:  make(map[uint32]map[*sub]struct{}),
 	}
+	b.caps, b.capsKnown = adapterCapabilities(name, adapter)
+	b.stats.init(time.Now())
+	b.hw, _ = adapter.(HardwareFilter)
 	for _, opt := range opts {
 		opt(b)
 	}
+	if b.listenOnly && b.capsKnown && !b.caps.ListenOnly {
+		err := fmt.Errorf("gocan: %s has no listen-only mode", name)
+		cancel(err)
+		return nil, err
+	}
+	if b.reconnect != nil {
+		r := &reconnector{cfg: *b.reconnect, adapter: adapter, newAdapter: b.newAdapter}
+		if b.hw != nil {
+			b.hw = r
+		}
+		adapter, b.adapter = r, r
+	}
 	// Wake pending Recv/Request/Subscribe consumers whenever the bus dies,
 	// for whatever reason.
 	context.AfterFunc(cctx, b.releaseAllSubs)
@@ -103,12 +179,25 @@ func open(ctx context.Context, name string, adapter Adapter, opts ...Option) (*B
 	return b, nil
 }
 
-// Adapter returns the underlying adapter.
-func (b *Bus) Adapter() Adapter { return b.adapter }
+// Adapter returns the underlying adapter: with WithReconnect, the one
+// currently (or last) open.
+func (b *Bus) Adapter() Adapter {
+	if r, ok := b.adapter.(*reconnector); ok {
+		return r.current()
+	}
+	return b.adapter
+}
 
 // AdapterName returns the registry name the bus was opened with.
 func (b *Bus) AdapterName() string { return b.name }
 
+// ListenOnly reports whether the bus was opened listen-only.
+func (b *Bus) ListenOnly() bool { return b.listenOnly }
+
+// Capabilities returns what the adapter advertises, from its registry entry
+// or its own Capabilities method; ok is false when neither is available.
+func (b *Bus) Capabilities() (caps Capabilities, ok bool) { return b.caps, b.capsKnown }
+
 // Context returns the bus context. It is cancelled when the bus is closed or
 // the adapter fails fatally; context.Cause reports why (ErrClosed on a clean
 // shutdown, otherwise the fatal adapter error).
@@ -177,22 +266,57 @@ func (b *Bus) alive() error {
 
 // Send writes one frame to the bus, returning once the adapter has written
 // it (or ctx is done). Concurrent callers are serialized, giving natural
-// inter-frame pacing.
+// inter-frame pacing. Malformed frames (see Frame.Validate) are rejected, as
+// are CAN FD frames on adapters known to lack FD support, and every frame on
+// a listen-only bus.
 func (b *Bus) Send(ctx context.Context, f Frame) error {
 	if err := b.alive(); err != nil {
 		return err
 	}
+	if b.listenOnly {
+		return ErrListenOnly
+	}
+	if err := f.Validate(); err != nil {
+		return err
+	}
+	if f.FD && b.capsKnown && !b.caps.FD {
+		return ErrFDNotSupported
+	}
+	// A resent received frame goes out now, not at its receive time.
+	f.Timestamp, f.TimestampSource = time.Time{}, TimestampNone
 	b.sendMu.Lock()
 	defer b.sendMu.Unlock()
-	return b.adapter.Send(ctx, f)
+	start := time.Now()
+	err := b.adapter.Send(ctx, f)
+	now := time.Now()
+	var busy float64
+	if err == nil {
+		busy = b.busTime(&f)
+	}
+	b.stats.sent(now, &f, busy, now.Sub(start), err)
+	if err != nil {
+		return err
+	}
+	b.runTaps(&b.sendTaps, f)
+	return nil
 }
 
 // Recv waits for a single frame carrying one of the given identifiers (no
 // identifiers = any frame). Bound it with a context deadline.
 func (b *Bus) Recv(ctx context.Context, identifiers ...uint32) (Frame, error) {
+	return b.recv(ctx, identifiers, nil)
+}
+
+// RecvFilter waits for a single frame matching one of the filters (no
+// filters = any frame). Bound it with a context deadline.
+func (b *Bus) RecvFilter(ctx context.Context, filters ...Filter) (Frame, error) {
+	return b.recv(ctx, nil, filters)
+}
+
+func (b *Bus) recv(ctx context.Context, identifiers []uint32, filters []Filter) (Frame, error) {
 	sctx, cancel := context.WithCancel(ctx)
 	defer cancel()
-	s := b.newSub(sctx, 1, identifiers)
+	s := b.newSub(sctx, 1, identifiers, filters)
 	return b.waitSub(ctx, s)
 }
 
@@ -208,6 +332,16 @@ const maxAutoResponseTimeout = 10 * time.Second
 // and a near deadline (≤ 10 s) is stamped as their reply-wait; use
 // WithExpectedResponses / WithResponseTimeout to override.
 func (b *Bus) Request(ctx context.Context, frame Frame, replyIdentifiers ...uint32) (Frame, error) {
+	return b.request(ctx, frame, replyIdentifiers, nil)
+}
+
+// RequestFilter is Request with the reply selected by filters, e.g. any
+// diagnostic response with MatchRange(0x7E8, 0x7EF).
+func (b *Bus) RequestFilter(ctx context.Context, frame Frame, replyFilters ...Filter) (Frame, error) {
+	return b.request(ctx, frame, nil, replyFilters)
+}
+
+func (b *Bus) request(ctx context.Context, frame Frame, identifiers []uint32, filters []Filter) (Frame, error) {
 	if ExpectedResponses(ctx) == 0 {
 		ctx = WithExpectedResponses(ctx, 1)
 	}
@@ -220,7 +354,7 @@ func (b *Bus) Request(ctx context.Context, frame Frame, replyIdentifiers ...uint
 	}
 	sctx, cancel := context.WithCancel(ctx)
 	defer cancel()
-	s := b.newSub(sctx, 1, replyIdentifiers)
+	s := b.newSub(sctx, 1, identifiers, filters)
 	if err := b.Send(ctx, frame); err != nil {
 		return Frame{}, err
 	}
@@ -232,7 +366,13 @@ func (b *Bus) Request(ctx context.Context, frame Frame, replyIdentifiers ...uint
 // subscriber that stops draining loses frames. The channel is closed when
 // ctx is cancelled or the bus terminates.
 func (b *Bus) Subscribe(ctx context.Context, identifiers ...uint32) <-chan Frame {
-	return b.newSub(ctx, 64, identifiers).ch
+	return b.newSub(ctx, 64, identifiers, nil).ch
+}
+
+// SubscribeFilter is Subscribe for frames matching any of the filters (no
+// filters = all traffic).
+func (b *Bus) SubscribeFilter(ctx context.Context, filters ...Filter) <-chan Frame {
+	return b.newSub(ctx, 64, nil, filters).ch
 }
 
 // Frames returns an iterator over frames carrying one of the given
@@ -250,6 +390,19 @@ func (b *Bus) Frames(ctx context.Context, identifiers ...uint32) iter.Seq[Frame]
 	}
 }
 
+// FramesFilter is Frames for frames matching any of the filters.
+func (b *Bus) FramesFilter(ctx context.Context, filters ...Filter) iter.Seq[Frame] {
+	return func(yield func(Frame) bool) {
+		sctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		for f := range b.SubscribeFilter(sctx, filters...) {
+			if !yield(f) {
+				return
+			}
+		}
+	}
+}
+
 // waitSub returns the first frame delivered to s, or the reason none will come.
 func (b *Bus) waitSub(ctx context.Context, s *sub) (Frame, error) {
 	select {
@@ -270,16 +423,32 @@ func (b *Bus) waitSub(ctx context.Context, s *sub) (Frame, error) {
 }
 
 // sub is a single subscription. Its channel is closed exactly once, under
-// subMu, when the subscription is released.
+// subMu, when the subscription is released. A subscription with filters
+// lives in filterSubs, one with only identifiers in submap, and one with
+// neither in globalSubs.
 type sub struct {
-	ids  map[uint32]struct{}
-	ch   chan Frame
-	once sync.Once
+	ids     map[uint32]struct{}
+	filters []Filter
+	ch      chan Frame
+	once    sync.Once
+	dropped uint64 // guarded by subMu
 }
 
-func (b *Bus) newSub(ctx context.Context, buffer int, identifiers []uint32) *sub {
+func (b *Bus) newSub(ctx context.Context, buffer int, identifiers []uint32, filters []Filter) *sub {
 	s := &sub{ch: make(chan Frame, buffer)}
-	if len(identifiers) > 0 {
+	for _, f := range filters {
+		if f.exact() {
+			identifiers = append(identifiers, f.id)
+		} else {
+			s.filters = append(s.filters, f)
+		}
+	}
+	if len(s.filters) > 0 {
+		// Checked frame by frame anyway, so the identifiers go along.
+		for _, id := range identifiers {
+			s.filters = append(s.filters, MatchID(id))
+		}
+	} else if len(identifiers) > 0 {
 		s.ids = make(map[uint32]struct{}, len(identifiers))
 		for _, id := range identifiers {
 			s.ids[id] = struct{}{}
@@ -293,9 +462,12 @@ func (b *Bus) newSub(ctx context.Context, buffer int, identifiers []uint32) *sub
 		s.once.Do(func() { close(s.ch) })
 		return s
 	}
-	if s.ids == nil {
+	switch {
+	case s.filters != nil:
+		b.filterSubs = append(b.filterSubs, s)
+	case s.ids == nil:
 		b.globalSubs = append(b.globalSubs, s)
-	} else {
+	default:
 		for id := range s.ids {
 			m, ok := b.submap[id]
 			if !ok {
@@ -306,6 +478,7 @@ func (b *Bus) newSub(ctx context.Context, buffer int, identifiers []uint32) *sub
 		}
 	}
 	b.subMu.Unlock()
+	b.widenFilter(s)
 	context.AfterFunc(ctx, func() { b.releaseSub(s) })
 	return s
 }
@@ -314,14 +487,12 @@ func (b *Bus) releaseSub(s *sub) {
 	s.once.Do(func() {
 		b.subMu.Lock()
 		defer b.subMu.Unlock()
-		if s.ids == nil {
-			for i, cur := range b.globalSubs {
-				if cur == s {
-					b.globalSubs = append(b.globalSubs[:i], b.globalSubs[i+1:]...)
-					break
-				}
-			}
-		} else {
+		switch {
+		case s.filters != nil:
+			b.filterSubs = slices.DeleteFunc(b.filterSubs, func(cur *sub) bool { return cur == s })
+		case s.ids == nil:
+			b.globalSubs = slices.DeleteFunc(b.globalSubs, func(cur *sub) bool { return cur == s })
+		default:
 			for id := range s.ids {
 				if m, ok := b.submap[id]; ok {
 					delete(m, s)
@@ -335,32 +506,51 @@ func (b *Bus) releaseSub(s *sub) {
 		// same lock.
 		close(s.ch)
 	})
+	b.scheduleTighten()
 }
 
 func (b *Bus) releaseAllSubs() {
 	b.subMu.Lock()
-	subs := append([]*sub{}, b.globalSubs...)
-	for _, m := range b.submap {
-		for s := range m {
-			subs = append(subs, s)
-		}
-	}
+	subs := b.subs()
 	b.subMu.Unlock()
 	for _, s := range subs {
 		b.releaseSub(s)
 	}
 }
 
+// subs lists every live subscription once. Call with subMu held.
+func (b *Bus) subs() []*sub {
+	subs := slices.Concat(b.globalSubs, b.filterSubs)
+	seen := make(map[*sub]bool)
+	for _, m := range b.submap {
+		for s := range m {
+			if !seen[s] {
+				seen[s] = true
+				subs = append(subs, s)
+			}
+		}
+	}
+	return subs
+}
+
 // Deliver hands an incoming frame from the adapter to every matching
 // subscriber. Delivery is non-blocking; subscribers that have fallen behind
-// lose the frame.
+// lose the frame. Frames the adapter did not timestamp are stamped with the
+// host clock.
 func (b *Bus) Deliver(f Frame) {
+	now := time.Now()
+	if f.TimestampSource == TimestampNone {
+		f.Timestamp, f.TimestampSource = now, TimestampHost
+	}
+	b.stats.received(now, &f, b.busTime(&f))
+	b.runTaps(&b.recvTaps, f)
 	dropped := 0
 	b.subMu.Lock()
 	for _, s := range b.globalSubs {
 		select {
 		case s.ch <- f:
 		default:
+			s.dropped++
 			dropped++
 		}
 	}
@@ -369,20 +559,56 @@ func (b *Bus) Deliver(f Frame) {
 			select {
 			case s.ch <- f:
 			default:
+				s.dropped++
 				dropped++
 			}
 		}
 	}
+	for _, s := range b.filterSubs {
+		if !s.match(&f) {
+			continue
+		}
+		select {
+		case s.ch <- f:
+		default:
+			s.dropped++
+			dropped++
+		}
+	}
 	b.subMu.Unlock()
 	if dropped > 0 {
+		b.stats.dropped(dropped)
 		// Emitted outside subMu so a sink may subscribe without deadlocking.
-		b.Emit(Event{Type: EventTypeWarning, Details: fmt.Sprintf("dropped frame 0x%03X for %d slow subscriber(s)", f.ID, dropped)})
+		b.Emit(Event{Type: EventTypeWarning, Kind: EventKindFrameDropped,
+			Details: fmt.Sprintf("dropped frame 0x%03X for %d slow subscriber(s)", f.ID, dropped)})
 	}
 }
 
+// ReportState records the controller state an adapter observed and emits
+// an EventKindBusState event when it differs from the last one reported.
+// Adapters that poll the controller can call it on every poll.
+func (b *Bus) ReportState(s BusStatus) {
+	b.stateMu.Lock()
+	changed := s.State != b.state
+	b.state = s.State
+	b.stateMu.Unlock()
+	if changed {
+		b.Emit(BusEvent(EventKindBusState, s))
+	}
+}
+
+// State returns the controller state last reported by the adapter, or
+// BusStateUnknown for adapters that report none.
+func (b *Bus) State() BusState {
+	b.stateMu.Lock()
+	defer b.stateMu.Unlock()
+	return b.state
+}
+
 // Emit forwards an adapter event to every registered listener, in
 // registration order, on the calling goroutine.
 func (b *Bus) Emit(e Event) {
+	b.stats.event(&e)
 	b.sinkMu.Lock()
 	sinks := b.sinks
 	b.sinkMu.Unlock()
@@ -442,3 +668,61 @@ func (b *Bus) OnEvent(fn func(Event)) (cancel func()) {
 		}
 	}
 }
+
+// frameTap wraps an OnSend/OnReceive callback, for the same reason as
+// eventSink.
+type frameTap struct {
+	fn func(Frame)
+}
+
+// OnSend registers fn to observe every frame the adapter accepted through
+// Send, for recorders and bridges that need the transmit side too. fn runs
+// on the sending goroutine while sends are serialized; keep it quick. The
+// returned function unregisters it.
+func (b *Bus) OnSend(fn func(Frame)) (cancel func()) {
+	return b.addTap(&b.sendTaps, fn)
+}
+
+// OnReceive registers fn to observe every frame the adapter delivers, before
+// subscribers see it. Unlike a subscription it cannot fall behind and lose
+// frames, so it suits recorders; fn runs on the adapter's receive goroutine
+// and must not block. The returned function unregisters it.
+func (b *Bus) OnReceive(fn func(Frame)) (cancel func()) {
+	remove := b.addTap(&b.recvTaps, fn)
+	// A tap sees all traffic, so the hardware filter must pass it.
+	b.widenFilter(nil)
+	return func() {
+		remove()
+		b.scheduleTighten()
+	}
+}
+
+func (b *Bus) addTap(taps *[]*frameTap, fn func(Frame)) func() {
+	t := &frameTap{fn: fn}
+	b.tapMu.Lock()
+	// Copy on write, like addSink, so runTaps can iterate without the lock.
+	*taps = append((*taps)[:len(*taps):len(*taps)], t)
+	b.tapMu.Unlock()
+	return func() {
+		b.tapMu.Lock()
+		defer b.tapMu.Unlock()
+		for i, cur := range *taps {
+			if cur == t {
+				next := make([]*frameTap, 0, len(*taps)-1)
+				next = append(next, (*taps)[:i]...)
+				next = append(next, (*taps)[i+1:]...)
+				*taps = next
+				return
+			}
+		}
+	}
+}
+
+func (b *Bus) runTaps(taps *[]*frameTap, f Frame) {
+	b.tapMu.Lock()
+	cur := *taps
+	b.tapMu.Unlock()
+	for _, t := range cur {
+		t.fn(f)
+	}
+}
@@ -32,7 +32,7 @@ func TestSubscribeFilters(t *testing.T) {
 	}
 
 	f := <-ch
-	if f.ID != 0x123 || f.Length != 3 || f.Data != [8]byte{1, 2, 3} {
+	if f.ID != 0x123 || f.Length != 3 || f.Data != [MaxFDLength]byte{1, 2, 3} {
 		t.Fatalf("filtered sub got wrong frame: %s", f)
 	}
 	if f := <-all; f.ID != 0x456 {
@@ -177,3 +177,147 @@ func TestOnEventUnregister(t *testing.T) {
 		t.Fatalf("want 1 event after unregister, got %d", n)
 	}
 }
+
+func TestFrameTaps(t *testing.T) {
+	bus := openLoopback(t)
+	var sent, recv []Frame
+	cancelSend := bus.OnSend(func(f Frame) { sent = append(sent, f) })
+	cancelRecv := bus.OnReceive(func(f Frame) { recv = append(recv, f) })
+	bus.Send(context.Background(), NewFrame(0x123, []byte{1}))
+	cancelSend()
+	bus.Send(context.Background(), NewFrame(0x456, []byte{2}))
+	cancelRecv()
+	bus.Send(context.Background(), NewFrame(0x789, []byte{3}))
+	if len(sent) != 1 || sent[0].ID != 0x123 {
+		t.Fatalf("want one sent frame 0x123, got %v", sent)
+	}
+	if len(recv) != 2 || recv[1].ID != 0x456 {
+		t.Fatalf("want received 0x123 and 0x456, got %v", recv)
+	}
+}
+
+// classicOnly is a loopback that advertises no CAN FD support.
+type classicOnly struct{ Loopback }
+
+func (*classicOnly) Capabilities() Capabilities { return Capabilities{HSCAN: true} }
+
+func TestSendFD(t *testing.T) {
+	fd := NewFDFrame(0x123, make([]byte, 20))
+	bus := openLoopback(t)
+	got, err := bus.Request(context.Background(), fd, 0x123)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.FD || !got.BRS || got.Length != 20 {
+		t.Fatalf("FD flags lost: %+v", got)
+	}
+	if err := bus.Send(context.Background(), Frame{ID: 1, Length: 9}); err == nil {
+		t.Fatal("classic frame over 8 bytes should be rejected")
+	}
+
+	classic, err := OpenAdapter(context.Background(), &classicOnly{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer classic.Close()
+	if err := classic.Send(context.Background(), fd); !errors.Is(err, ErrFDNotSupported) {
+		t.Fatalf("want ErrFDNotSupported, got %v", err)
+	}
+	if err := classic.Send(context.Background(), NewFrame(0x123, []byte{1})); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestListenOnly(t *testing.T) {
+	if _, err := Open(context.Background(), "loopback", Config{ListenOnly: true}); err == nil {
+		t.Fatal("loopback has no listen-only mode")
+	}
+
+	talker, err := OpenAdapter(context.Background(), Virtual("listen-only test").Node(VirtualNodeConfig{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer talker.Close()
+	sniffer, err := Open(context.Background(), "virtual", Config{Port: "listen-only test", ListenOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sniffer.Close()
+	if !sniffer.ListenOnly() {
+		t.Fatal("bus should report listen-only")
+	}
+	if err := sniffer.Send(context.Background(), NewFrame(0x123, nil)); !errors.Is(err, ErrListenOnly) {
+		t.Fatalf("want ErrListenOnly, got %v", err)
+	}
+	if _, err := sniffer.SendPeriodic(context.Background(), Periodic{Frame: NewFrame(0x123, nil), Period: time.Second}); !errors.Is(err, ErrListenOnly) {
+		t.Fatalf("want ErrListenOnly, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	heard := sniffer.Subscribe(ctx, 0x7E8)
+	if err := talker.Send(ctx, NewFrame(0x7E8, []byte{1})); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-heard; !ok {
+		t.Fatal("listen-only bus heard nothing")
+	}
+}
+
+func TestDeliverTimestamps(t *testing.T) {
+	bus := openLoopback(t)
+	var sent Frame
+	bus.OnSend(func(f Frame) { sent = f })
+	before := time.Now()
+	got, err := bus.Request(context.Background(), NewFrame(0x123, []byte{1}), 0x123)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.TimestampSource != TimestampHost || got.Timestamp.Before(before) || got.Timestamp.After(time.Now()) {
+		t.Fatalf("want a host timestamp, got %v from %v", got.Timestamp, got.TimestampSource)
+	}
+	// Resending a received frame stamps it anew.
+	again, err := bus.Request(context.Background(), got, 0x123)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent.TimestampSource != TimestampNone || !again.Timestamp.After(got.Timestamp) {
+		t.Fatalf("resent frame kept its timestamp: sent %v, received %v", sent.Timestamp, again.Timestamp)
+	}
+
+	hw := Frame{ID: 0x456, Timestamp: time.Unix(1000, 0), TimestampSource: TimestampHardware}
+	ch := bus.Subscribe(context.Background(), 0x456)
+	bus.Deliver(hw)
+	if f := <-ch; f.TimestampSource != TimestampHardware || !f.Timestamp.Equal(hw.Timestamp) {
+		t.Fatalf("adapter timestamp replaced: %v from %v", f.Timestamp, f.TimestampSource)
+	}
+}
+
+func TestReportState(t *testing.T) {
+	var events []Event
+	bus, err := Open(context.Background(), "loopback", Config{}, WithEventFunc(func(e Event) { events = append(events, e) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bus.Close()
+	if bus.State() != BusStateUnknown {
+		t.Fatalf("want unknown state before any report, got %v", bus.State())
+	}
+	bus.ReportState(BusStatus{State: BusStateErrorActive})
+	bus.ReportState(BusStatus{State: BusStateErrorActive})
+	bus.ReportState(BusStatus{State: BusStateBusOff, Counters: true, TxErrors: 256})
+	if bus.State() != BusStateBusOff {
+		t.Fatalf("want bus-off, got %v", bus.State())
+	}
+	if len(events) != 2 {
+		t.Fatalf("want one event per state change, got %v", events)
+	}
+	if e := events[1]; e.Kind != EventKindBusState || e.Type != EventTypeError || e.Details != "bus state: bus-off, TEC 256, REC 0" {
+		t.Fatalf("bad bus-off event %+v", e)
+	}
+
+	e := BusEvent(EventKindErrorFrame, BusStatus{Errors: BusErrorStuff | BusErrorCRC})
+	if e.Type != EventTypeWarning || e.Details != "error frame: stuff, crc" {
+		t.Fatalf("bad error frame event %+v", e)
+	}
+}
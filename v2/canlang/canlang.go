@@ -113,11 +113,11 @@ func checkBus(L *lua.LState) *scriptBus {
 }
 
 // tableToBytes converts a 1-based Lua byte table to a payload, rejecting
-// anything classic CAN cannot carry.
+// anything CAN FD cannot carry.
 func tableToBytes(L *lua.LState, t *lua.LTable) []byte {
 	n := t.Len()
-	if n > 8 {
-		L.RaiseError("payload is %d bytes, classic CAN carries at most 8", n)
+	if n > gocan.MaxFDLength {
+		L.RaiseError("payload is %d bytes, CAN FD carries at most %d", n, gocan.MaxFDLength)
 	}
 	b := make([]byte, n)
 	for i := range n {
@@ -126,6 +126,15 @@ func tableToBytes(L *lua.LState, t *lua.LTable) []byte {
 	return b
 }
 
+// newPayloadFrame builds a classic frame for payloads of up to 8 bytes and a
+// CAN FD frame for longer ones.
+func newPayloadFrame(id uint32, data []byte) gocan.Frame {
+	if len(data) > 8 {
+		return gocan.NewFDFrame(id, data)
+	}
+	return gocan.NewFrame(id, data)
+}
+
 // restIDs collects the identifiers from stack position start onward.
 func restIDs(L *lua.LState, start int) []uint32 {
 	var ids []uint32
@@ -155,7 +164,7 @@ func pushFrameResult(L *lua.LState, f gocan.Frame, err error) int {
 
 func busSend(L *lua.LState) int {
 	sb := checkBus(L)
-	f := gocan.NewFrame(uint32(L.CheckInt(2)), tableToBytes(L, L.CheckTable(3)))
+	f := newPayloadFrame(uint32(L.CheckInt(2)), tableToBytes(L, L.CheckTable(3)))
 	if err := sb.bus.Send(sb.ctx, f); err != nil {
 		L.RaiseError("send: %v", err)
 	}
@@ -173,7 +182,7 @@ func busRecv(L *lua.LState) int {
 
 func busRequest(L *lua.LState) int {
 	sb := checkBus(L)
-	f := gocan.NewFrame(uint32(L.CheckInt(2)), tableToBytes(L, L.CheckTable(3)))
+	f := newPayloadFrame(uint32(L.CheckInt(2)), tableToBytes(L, L.CheckTable(3)))
 	timeout := time.Duration(L.CheckInt(4)) * time.Millisecond
 	ctx, cancel := context.WithTimeout(sb.ctx, timeout)
 	defer cancel()
@@ -211,6 +220,7 @@ func registerFrameType(L *lua.LState) {
 	L.SetField(mt, "__index", L.SetFuncs(L.NewTable(), map[string]lua.LGFunction{
 		"id":    frameID,
 		"len":   frameLen,
+		"fd":    frameFD,
 		"u8":    frameU8,
 		"u16":   frameU16,
 		"bytes": frameBytes,
@@ -253,6 +263,11 @@ func frameLen(L *lua.LState) int {
 	return 1
 }
 
+func frameFD(L *lua.LState) int {
+	L.Push(lua.LBool(checkFrame(L).FD))
+	return 1
+}
+
 func frameU8(L *lua.LState) int {
 	f := checkFrame(L)
 	L.Push(lua.LNumber(f.Data[checkOffset(L, f, 1)]))
@@ -118,3 +118,27 @@ func TestRecvTimeout(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// TestFDPayload checks payloads over 8 bytes go out as padded CAN FD frames.
+func TestFDPayload(t *testing.T) {
+	bus, err := gocan.Open(t.Context(), "loopback", gocan.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bus.Close()
+
+	err = RunSource(t.Context(), bus, "fd", `
+		local f = assert(bus:request(0x300, {1, 2, 3, 4, 5, 6, 7, 8, 9}, 100, 0x300))
+		assert(f:fd(), "not fd")
+		assert(f:len() == 12, tostring(f:len()))
+		assert(f:u8(8) == 9 and f:u8(11) == 0)
+		f = assert(bus:request(0x301, {1}, 100, 0x301))
+		assert(not f:fd() and f:len() == 1)
+		local big = {}
+		for i = 1, 65 do big[i] = i end
+		assert(not pcall(bus.send, bus, 0x302, big))
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
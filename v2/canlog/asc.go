@@ -0,0 +1,410 @@
+package canlog
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	gocan "github.com/roffe/gocan/v2"
+)
+
+func init() {
+	RegisterFormat(Format{
+		Name:        "asc",
+		Description: "Vector ASCII log (CANalyzer, CANoe)",
+		Extensions:  []string{".asc"},
+		Detect: func(head []byte) bool {
+			line := firstLine(head, "//")
+			return strings.HasPrefix(line, "date ") || strings.HasPrefix(line, "base ")
+		},
+		NewReader: func(r io.Reader) Reader { return NewASCReader(r) },
+		NewWriter: func(w io.Writer) Writer { return NewASCWriter(w) },
+	})
+}
+
+// ascDate is the layout of the date lines, e.g. "Sat Oct 17 03:30:00.000 pm
+// 2026". Vector writes local time.
+const ascDate = "Mon Jan 2 03:04:05.000 pm 2006"
+
+// ASCWriter writes Vector ASC logs with hexadecimal identifiers and
+// timestamps relative to the first record.
+type ASCWriter struct {
+	w     *bufio.Writer
+	start time.Time // measurement start, zero until the header is written
+	buf   []byte
+}
+
+// NewASCWriter writes an ASC log to w. Call Close when done to write the
+// trailer.
+func NewASCWriter(w io.Writer) *ASCWriter {
+	return &ASCWriter{w: bufio.NewWriter(w)}
+}
+
+func (aw *ASCWriter) header(start time.Time) error {
+	// The date line only has millisecond resolution; the offsets carry the
+	// rest.
+	aw.start = start.Truncate(time.Millisecond)
+	date := aw.start.Local().Format(ascDate)
+	_, err := fmt.Fprintf(aw.w, "date %s\nbase hex  timestamps absolute\ninternal events logged\n// version 13.0.0\n"+
+		"Begin TriggerBlock %s\n   0.000000 Start of measurement\n", date, date)
+	return err
+}
+
+// Write writes one record.
+func (aw *ASCWriter) Write(r Record) error {
+	if aw.start.IsZero() {
+		if err := aw.header(r.Time); err != nil {
+			return err
+		}
+	}
+	f := r.Frame
+	b := aw.buf[:0]
+	ts := appendFixed(nil, max(r.Time.Sub(aw.start), 0), time.Second, 6)
+	b = appendSpaces(b, 11-len(ts))
+	b = append(b, ts...)
+	b = append(b, ' ')
+	if f.FD && !r.Error {
+		b = append(b, "CANFD "...)
+	}
+	col := len(b)
+	b = strconv.AppendInt(b, int64(channelIndex(r.Channel)+1), 10)
+	b = appendSpaces(b, col+2-len(b))
+	b = append(b, ' ')
+	if f.FD && !r.Error {
+		b = aw.appendFD(b, r)
+		aw.buf = b
+		_, err := aw.w.Write(b)
+		return err
+	}
+	if r.Error {
+		b = append(b, "ErrorFrame\n"...)
+		aw.buf = b
+		_, err := aw.w.Write(b)
+		return err
+	}
+	col = len(b)
+	b = append(b, strings.ToUpper(strconv.FormatUint(uint64(f.ID), 16))...)
+	if f.Extended {
+		b = append(b, 'x')
+	}
+	b = appendSpaces(b, col+15-len(b))
+	if r.Tx {
+		b = append(b, " Tx  "...)
+	} else {
+		b = append(b, " Rx  "...)
+	}
+	if f.Remote {
+		b = append(b, " r "...)
+		b = append(b, hexDigits[f.Length&0x0F])
+	} else {
+		b = append(b, " d "...)
+		b = append(b, hexDigits[f.Length&0x0F])
+		for _, c := range f.Data[:f.Length] {
+			b = append(b, ' ', hexDigits[c>>4], hexDigits[c&0x0F])
+		}
+	}
+	b = append(b, '\n')
+	aw.buf = b
+	_, err := aw.w.Write(b)
+	return err
+}
+
+// ASC CANFD line flags.
+const (
+	ascFDRemote = 0x0010
+	ascFDEDL    = 0x1000
+	ascFDBRS    = 0x2000
+	ascFDESI    = 0x4000
+)
+
+// appendFD appends the rest of a CANFD line: direction, identifier, BRS,
+// ESI, DLC, data length, data, and zeros for the bus timing details we do
+// not know.
+func (aw *ASCWriter) appendFD(b []byte, r Record) []byte {
+	f := r.Frame
+	if r.Tx {
+		b = append(b, "Tx "...)
+	} else {
+		b = append(b, "Rx "...)
+	}
+	col := len(b)
+	b = append(b, strings.ToUpper(strconv.FormatUint(uint64(f.ID), 16))...)
+	if f.Extended {
+		b = append(b, 'x')
+	}
+	b = appendSpaces(b, col+9-len(b))
+	flags := ascFDEDL
+	brs, esi := byte('0'), byte('0')
+	if f.BRS {
+		brs, flags = '1', flags|ascFDBRS
+	}
+	if f.ESI {
+		esi, flags = '1', flags|ascFDESI
+	}
+	b = append(b, ' ', brs, ' ', esi, ' ', hexDigits[f.DLC()], ' ')
+	b = strconv.AppendInt(b, int64(f.Length), 10)
+	for _, c := range f.Bytes() {
+		b = append(b, ' ', hexDigits[c>>4], hexDigits[c&0x0F])
+	}
+	b = append(b, "  0 0 "...)
+	b = strconv.AppendUint(b, uint64(flags), 16)
+	b = append(b, " 0 0 0 0 0\n"...)
+	return b
+}
+
+func appendSpaces(b []byte, n int) []byte {
+	for range n {
+		b = append(b, ' ')
+	}
+	return b
+}
+
+// Flush writes buffered lines to the underlying writer.
+func (aw *ASCWriter) Flush() error {
+	return aw.w.Flush()
+}
+
+// Close ends the trigger block and flushes.
+func (aw *ASCWriter) Close() error {
+	if aw.start.IsZero() {
+		if err := aw.header(time.Now()); err != nil {
+			return err
+		}
+	}
+	if _, err := aw.w.WriteString("End TriggerBlock\n"); err != nil {
+		return err
+	}
+	return aw.w.Flush()
+}
+
+// ASCReader reads Vector ASC logs. CAN and CAN FD data, remote and error
+// frames are returned; other events (statistics, log triggers) are skipped.
+type ASCReader struct {
+	s        *bufio.Scanner
+	line     int
+	start    time.Time
+	dec      bool // base dec
+	relative bool // timestamps relative to the previous event
+	last     time.Duration
+}
+
+// NewASCReader reads an ASC log from r.
+func NewASCReader(r io.Reader) *ASCReader {
+	return &ASCReader{s: bufio.NewScanner(r), start: time.Unix(0, 0)}
+}
+
+// Read returns the next record, or io.EOF at the end of the log.
+func (ar *ASCReader) Read() (Record, error) {
+	for ar.s.Scan() {
+		ar.line++
+		fields := strings.Fields(ar.s.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "date":
+			ar.start = parseASCDate(fields[1:])
+			continue
+		case "base":
+			ar.dec = len(fields) > 1 && fields[1] == "dec"
+			ar.relative = len(fields) > 3 && fields[3] == "relative"
+			continue
+		}
+		if c := fields[0][0]; c < '0' || c > '9' || len(fields) < 3 {
+			continue // header, comment or trigger block line
+		}
+		r, ok, err := ar.parse(fields)
+		if err != nil {
+			return Record{}, fmt.Errorf("asc: line %d: %w", ar.line, err)
+		}
+		if ok {
+			return r, nil
+		}
+	}
+	if err := ar.s.Err(); err != nil {
+		return Record{}, err
+	}
+	return Record{}, io.EOF
+}
+
+// parseASCDate parses the fields of a date line, falling back to the Unix
+// epoch for unknown (e.g. localized) layouts.
+func parseASCDate(fields []string) time.Time {
+	s := strings.Join(fields, " ")
+	for _, layout := range []string{"Mon Jan 2 3:04:05 pm 2006", "Mon Jan 2 15:04:05 2006"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t
+		}
+	}
+	return time.Unix(0, 0)
+}
+
+// parse parses an event line; ok is false for events that are not frames.
+func (ar *ASCReader) parse(fields []string) (r Record, ok bool, err error) {
+	at, err := parseFixed(fields[0], time.Second)
+	if err != nil {
+		return r, false, err
+	}
+	if ar.relative {
+		at += ar.last
+	}
+	ar.last = at
+	if fields[1] == "CANFD" {
+		return ar.parseFD(at, fields[2:])
+	}
+	ch, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return r, false, nil // not a CAN event
+	}
+	r.Time = ar.start.Add(at)
+	r.Channel = channelName(ch - 1)
+	if fields[2] == "ErrorFrame" {
+		r.Error = true
+		return r, true, nil
+	}
+	if len(fields) < 5 {
+		return r, false, nil
+	}
+	id := fields[2]
+	if strings.HasSuffix(id, "x") || strings.HasSuffix(id, "X") {
+		r.Frame.Extended = true
+		id = id[:len(id)-1]
+	}
+	base := 16
+	if ar.dec {
+		base = 10
+	}
+	v, err := strconv.ParseUint(id, base, 32)
+	if err != nil {
+		if strings.HasSuffix(id, ":") {
+			return r, false, nil // e.g. "Statistic:"
+		}
+		return r, false, fmt.Errorf("malformed identifier %q", fields[2])
+	}
+	r.Frame.ID = uint32(v)
+	if r.Frame.Extended && v > 0x1FFFFFFF || !r.Frame.Extended && v > 0x7FF {
+		return r, false, fmt.Errorf("identifier %q out of range", fields[2])
+	}
+	switch fields[3] {
+	case "Rx":
+	case "Tx", "TxRq":
+		r.Tx = true
+	default:
+		return r, false, fmt.Errorf("unknown direction %q", fields[3])
+	}
+	var dlc uint64
+	if len(fields) > 5 {
+		if dlc, err = strconv.ParseUint(fields[5], 16, 8); err != nil || dlc > 15 {
+			return r, false, fmt.Errorf("malformed DLC %q", fields[5])
+		}
+	}
+	switch strings.ToLower(fields[4]) {
+	case "r":
+		r.Frame.Remote = true
+		r.Frame.Length = uint8(min(dlc, 8))
+	case "d":
+		n := int(min(dlc, 8))
+		if len(fields) < 6+n {
+			return r, false, fmt.Errorf("want %d data bytes", n)
+		}
+		for i, s := range fields[6 : 6+n] {
+			c, err := strconv.ParseUint(s, base, 8)
+			if err != nil {
+				return r, false, fmt.Errorf("malformed data byte %q", s)
+			}
+			r.Frame.Data[i] = byte(c)
+		}
+		r.Frame.Length = uint8(n)
+	default:
+		return r, false, fmt.Errorf("unknown frame type %q", fields[4])
+	}
+	return r, true, nil
+}
+
+// parseFD parses the fields of a CANFD event after the keyword: channel,
+// direction, identifier, an optional symbolic name, BRS, ESI, DLC, data
+// length, data, and optionally message duration, bit length and flags.
+func (ar *ASCReader) parseFD(at time.Duration, fields []string) (r Record, ok bool, err error) {
+	if len(fields) < 3 {
+		return r, false, nil
+	}
+	ch, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return r, false, fmt.Errorf("malformed channel %q", fields[0])
+	}
+	r.Time = ar.start.Add(at)
+	r.Channel = channelName(ch - 1)
+	switch fields[1] {
+	case "Rx":
+	case "Tx", "TxRq":
+		r.Tx = true
+	default:
+		return r, false, fmt.Errorf("unknown direction %q", fields[1])
+	}
+	if fields[2] == "ErrorFrame" {
+		r.Error = true
+		return r, true, nil
+	}
+	f := &r.Frame
+	id := fields[2]
+	if strings.HasSuffix(id, "x") || strings.HasSuffix(id, "X") {
+		f.Extended = true
+		id = id[:len(id)-1]
+	}
+	base := 16
+	if ar.dec {
+		base = 10
+	}
+	v, err := strconv.ParseUint(id, base, 32)
+	if err != nil || f.Extended && v > 0x1FFFFFFF || !f.Extended && v > 0x7FF {
+		return r, false, fmt.Errorf("malformed identifier %q", fields[2])
+	}
+	f.ID = uint32(v)
+	rest := fields[3:]
+	if len(rest) > 0 && rest[0] != "0" && rest[0] != "1" {
+		rest = rest[1:] // symbolic name
+	}
+	if len(rest) < 4 {
+		return r, false, fmt.Errorf("short CANFD event")
+	}
+	f.BRS, f.ESI = rest[0] == "1", rest[1] == "1"
+	dlc, err := strconv.ParseUint(rest[2], 16, 8)
+	if err != nil || dlc > 15 {
+		return r, false, fmt.Errorf("malformed DLC %q", rest[2])
+	}
+	n, err := strconv.Atoi(rest[3])
+	if err != nil || n < 0 || n > gocan.MaxFDLength || len(rest) < 4+n {
+		return r, false, fmt.Errorf("malformed data length %q", rest[3])
+	}
+	for i, s := range rest[4 : 4+n] {
+		c, err := strconv.ParseUint(s, base, 8)
+		if err != nil {
+			return r, false, fmt.Errorf("malformed data byte %q", s)
+		}
+		f.Data[i] = byte(c)
+	}
+	f.Length = uint8(n)
+	// Without the flags field, a CANFD event is an FD frame; with it, EDL
+	// tells FD frames from classic frames logged on an FD channel.
+	f.FD = true
+	if tail := rest[4+n:]; len(tail) >= 3 {
+		flags, err := strconv.ParseUint(tail[2], 16, 32)
+		if err != nil {
+			return r, false, fmt.Errorf("malformed flags %q", tail[2])
+		}
+		f.FD = flags&ascFDEDL != 0
+		f.Remote = !f.FD && flags&ascFDRemote != 0
+	}
+	if !f.FD {
+		f.BRS, f.ESI = false, false
+		if f.Remote {
+			f.Length = uint8(min(dlc, 8))
+		} else if n > 8 {
+			return r, false, fmt.Errorf("classic frame with %d data bytes", n)
+		}
+	}
+	return r, true, nil
+}
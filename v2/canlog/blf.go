@@ -0,0 +1,546 @@
+package canlog
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	gocan "github.com/roffe/gocan/v2"
+)
+
+func init() {
+	RegisterFormat(Format{
+		Name:        "blf",
+		Description: "Vector binary logging format (CANalyzer, CANoe)",
+		Extensions:  []string{".blf"},
+		Detect: func(head []byte) bool {
+			return bytes.HasPrefix(head, blfFileMagic)
+		},
+		NewReader: func(r io.Reader) Reader { return NewBLFReader(r) },
+		NewWriter: func(w io.Writer) Writer { return NewBLFWriter(w) },
+	})
+}
+
+// BLF layout, as written by Vector's binlog library.
+const (
+	blfFileHeaderSize = 144
+	blfObjHeaderSize  = 16 // LOBJ, header size, header version, object size, object type
+	blfObjHeaderV1    = 16 // flags, client index, object version, timestamp
+	blfContainerSize  = 16 // compression method, uncompressed size
+
+	blfCANMessage   = 1
+	blfLogContainer = 10
+	blfCANErrorExt  = 73
+	blfCANMessage2  = 86
+	blfCANFDMessage = 100
+	blfCANFDMsg64   = 101
+
+	blfTimeTenMics = 1 // object timestamp in 10 µs units
+	blfTimeOneNans = 2 // object timestamp in nanoseconds
+
+	blfNoCompression   = 0
+	blfZlibCompression = 2
+
+	blfDirTx    = 0x01
+	blfRemote   = 0x80
+	blfExtended = 0x80000000
+	blfFDEDL    = 0x01 // CAN_FD_MESSAGE fdFlags
+	blfFDBRS    = 0x02
+	blfFDESI    = 0x04
+	blfFD64RTR  = 0x0010 // CAN_FD_MESSAGE_64 flags
+	blfFD64EDL  = 0x1000
+	blfFD64BRS  = 0x2000
+	blfFD64ESI  = 0x4000
+
+	// blfContainerMax is how much object data goes into one log container.
+	blfContainerMax = 128 << 10
+)
+
+var (
+	blfFileMagic = []byte("LOGG")
+	blfObjMagic  = []byte("LOBJ")
+)
+
+// systemTime encodes t as a Windows SYSTEMTIME in local time.
+func systemTime(b []byte, t time.Time) {
+	t = t.Local()
+	for i, v := range []int{t.Year(), int(t.Month()), int(t.Weekday()), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond() / 1e6} {
+		binary.LittleEndian.PutUint16(b[2*i:], uint16(v))
+	}
+}
+
+func fromSystemTime(b []byte) time.Time {
+	v := func(i int) int { return int(binary.LittleEndian.Uint16(b[2*i:])) }
+	if v(0) == 0 {
+		return time.Unix(0, 0)
+	}
+	return time.Date(v(0), time.Month(v(1)), v(3), v(4), v(5), v(6), v(7)*1e6, time.Local)
+}
+
+// BLFWriter writes Vector BLF files. Objects are collected into
+// zlib-compressed log containers of up to 128 KiB.
+//
+// The file header holds the object count and file size, which are only
+// known at the end: when the underlying writer can seek (an *os.File), Close
+// rewrites the header; otherwise they are left zero, which Vector tools and
+// python-can accept.
+type BLFWriter struct {
+	// Level is the zlib compression level, zlib.DefaultCompression unless
+	// changed before the first Write.
+	Level int
+
+	w       io.Writer
+	seeker  io.WriteSeeker
+	base    int64 // offset of the file header in seeker
+	start   time.Time
+	last    time.Time
+	pending []byte // uncompressed object data not yet in a container
+	zbuf    bytes.Buffer
+	zw      *zlib.Writer
+	objects uint32
+	size    uint64 // bytes written, including the file header
+	raw     uint64 // uncompressed size, as the header counts it
+}
+
+// NewBLFWriter writes a BLF file to w. Call Close when done.
+func NewBLFWriter(w io.Writer) *BLFWriter {
+	bw := &BLFWriter{Level: zlib.DefaultCompression, w: w}
+	if s, ok := w.(io.WriteSeeker); ok {
+		if pos, err := s.Seek(0, io.SeekCurrent); err == nil {
+			bw.seeker, bw.base = s, pos
+		}
+	}
+	return bw
+}
+
+func (bw *BLFWriter) header() []byte {
+	h := make([]byte, blfFileHeaderSize)
+	copy(h, blfFileMagic)
+	binary.LittleEndian.PutUint32(h[4:], blfFileHeaderSize)
+	h[8] = 5                           // application: CANoe
+	copy(h[12:16], []byte{2, 6, 8, 1}) // binlog version
+	binary.LittleEndian.PutUint64(h[16:], bw.size)
+	binary.LittleEndian.PutUint64(h[24:], bw.raw)
+	binary.LittleEndian.PutUint32(h[32:], bw.objects)
+	systemTime(h[40:], bw.start)
+	systemTime(h[56:], bw.last)
+	return h
+}
+
+func (bw *BLFWriter) begin(start time.Time) error {
+	if bw.zw == nil {
+		zw, err := zlib.NewWriterLevel(&bw.zbuf, bw.Level)
+		if err != nil {
+			return fmt.Errorf("blf: %w", err)
+		}
+		bw.zw = zw
+	}
+	// SYSTEMTIME has millisecond resolution; the object timestamps carry
+	// the rest.
+	bw.start = start.Truncate(time.Millisecond)
+	bw.last = bw.start
+	bw.size, bw.raw = blfFileHeaderSize, blfFileHeaderSize
+	_, err := bw.w.Write(bw.header())
+	return err
+}
+
+// Write writes one record.
+func (bw *BLFWriter) Write(r Record) error {
+	if bw.start.IsZero() {
+		if err := bw.begin(r.Time); err != nil {
+			return err
+		}
+	}
+	if r.Time.After(bw.last) {
+		bw.last = r.Time
+	}
+	f := r.Frame
+	id := f.ID
+	if f.Extended {
+		id |= blfExtended
+	}
+	channel := uint16(channelIndex(r.Channel) + 1)
+
+	var typ uint32
+	var body []byte
+	if r.Error {
+		typ, body = blfCANErrorExt, make([]byte, 32)
+		binary.LittleEndian.PutUint16(body[0:], channel)
+		body[10] = f.Length
+		binary.LittleEndian.PutUint32(body[16:], id)
+		copy(body[24:], f.Data[:8])
+	} else if f.FD {
+		typ, body = blfCANFDMsg64, make([]byte, 40+int(f.Length))
+		body[0] = byte(channel)
+		body[1] = f.DLC()
+		body[2] = f.Length
+		binary.LittleEndian.PutUint32(body[4:], id)
+		flags := uint32(blfFD64EDL)
+		if f.BRS {
+			flags |= blfFD64BRS
+		}
+		if f.ESI {
+			flags |= blfFD64ESI
+		}
+		binary.LittleEndian.PutUint32(body[12:], flags)
+		if r.Tx {
+			body[34] = 1
+		}
+		copy(body[40:], f.Bytes())
+	} else {
+		typ, body = blfCANMessage2, make([]byte, 24)
+		binary.LittleEndian.PutUint16(body[0:], channel)
+		if r.Tx {
+			body[2] |= blfDirTx
+		}
+		if f.Remote {
+			body[2] |= blfRemote
+		}
+		body[3] = f.Length
+		binary.LittleEndian.PutUint32(body[4:], id)
+		if !f.Remote {
+			copy(body[8:], f.Data[:f.Length])
+		}
+	}
+
+	size := blfObjHeaderSize + blfObjHeaderV1 + len(body)
+	obj := make([]byte, blfObjHeaderSize+blfObjHeaderV1, size+size%4)
+	copy(obj, blfObjMagic)
+	binary.LittleEndian.PutUint16(obj[4:], blfObjHeaderSize+blfObjHeaderV1)
+	binary.LittleEndian.PutUint16(obj[6:], 1)
+	binary.LittleEndian.PutUint32(obj[8:], uint32(size))
+	binary.LittleEndian.PutUint32(obj[12:], typ)
+	binary.LittleEndian.PutUint32(obj[16:], blfTimeOneNans)
+	binary.LittleEndian.PutUint64(obj[24:], uint64(max(r.Time.Sub(bw.start), 0)))
+	obj = append(obj, body...)
+	obj = obj[:size+size%4] // objects are padded by size%4 bytes
+	bw.pending = append(bw.pending, obj...)
+	bw.objects++
+
+	for len(bw.pending) >= blfContainerMax {
+		if err := bw.container(bw.pending[:blfContainerMax]); err != nil {
+			return err
+		}
+		bw.pending = append(bw.pending[:0], bw.pending[blfContainerMax:]...)
+	}
+	return nil
+}
+
+// container compresses data into a log container and writes it out.
+func (bw *BLFWriter) container(data []byte) error {
+	bw.zbuf.Reset()
+	bw.zw.Reset(&bw.zbuf)
+	if _, err := bw.zw.Write(data); err != nil {
+		return err
+	}
+	if err := bw.zw.Close(); err != nil {
+		return err
+	}
+	size := blfObjHeaderSize + blfContainerSize + bw.zbuf.Len()
+	h := make([]byte, blfObjHeaderSize+blfContainerSize, size+size%4)
+	copy(h, blfObjMagic)
+	binary.LittleEndian.PutUint16(h[4:], blfObjHeaderSize)
+	binary.LittleEndian.PutUint16(h[6:], 1)
+	binary.LittleEndian.PutUint32(h[8:], uint32(size))
+	binary.LittleEndian.PutUint32(h[12:], blfLogContainer)
+	binary.LittleEndian.PutUint16(h[16:], blfZlibCompression)
+	binary.LittleEndian.PutUint32(h[24:], uint32(len(data)))
+	h = append(h, bw.zbuf.Bytes()...)
+	h = h[:size+size%4]
+	bw.size += uint64(len(h))
+	bw.raw += uint64(blfObjHeaderSize + blfContainerSize + len(data))
+	_, err := bw.w.Write(h)
+	return err
+}
+
+// Flush writes the pending objects out as a (short) container.
+func (bw *BLFWriter) Flush() error {
+	if len(bw.pending) == 0 {
+		return nil
+	}
+	err := bw.container(bw.pending)
+	bw.pending = bw.pending[:0]
+	return err
+}
+
+// Close flushes and, if the underlying writer can seek, completes the file
+// header.
+func (bw *BLFWriter) Close() error {
+	if bw.start.IsZero() {
+		if err := bw.begin(time.Now()); err != nil {
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	if bw.seeker == nil {
+		return nil
+	}
+	end, err := bw.seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := bw.seeker.Seek(bw.base, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := bw.seeker.Write(bw.header()); err != nil {
+		return err
+	}
+	_, err = bw.seeker.Seek(end, io.SeekStart)
+	return err
+}
+
+// BLFReader reads Vector BLF files as a stream, one log container at a
+// time. CAN_MESSAGE, CAN_MESSAGE2, CAN_FD_MESSAGE, CAN_FD_MESSAGE_64 and
+// CAN_ERROR_EXT objects are returned; other objects are skipped.
+type BLFReader struct {
+	r      io.Reader
+	start  time.Time
+	header bool
+	data   []byte // uncompressed objects, possibly ending in a partial one
+	pos    int
+	zr     io.ReadCloser
+	hdr    [blfObjHeaderSize]byte
+}
+
+// NewBLFReader reads a BLF file from r.
+func NewBLFReader(r io.Reader) *BLFReader {
+	return &BLFReader{r: r}
+}
+
+func (br *BLFReader) readHeader() error {
+	h := make([]byte, blfFileHeaderSize)
+	if _, err := io.ReadFull(br.r, h[:8]); err != nil {
+		return fmt.Errorf("blf: file header: %w", err)
+	}
+	if !bytes.Equal(h[:4], blfFileMagic) {
+		return errors.New("blf: not a BLF file")
+	}
+	size := int(binary.LittleEndian.Uint32(h[4:]))
+	if size < 72 {
+		return fmt.Errorf("blf: file header size %d", size)
+	}
+	if size > len(h) {
+		h = make([]byte, size)
+	}
+	if _, err := io.ReadFull(br.r, h[8:size]); err != nil {
+		return fmt.Errorf("blf: file header: %w", err)
+	}
+	br.start = fromSystemTime(h[40:])
+	br.header = true
+	return nil
+}
+
+// Read returns the next record, or io.EOF at the end of the file.
+func (br *BLFReader) Read() (Record, error) {
+	if !br.header {
+		if err := br.readHeader(); err != nil {
+			return Record{}, err
+		}
+	}
+	for {
+		r, ok, err := br.next()
+		if err != nil || ok {
+			return r, err
+		}
+		if err := br.fill(); err != nil {
+			return Record{}, err
+		}
+	}
+}
+
+// fill reads the next top-level object, appending its uncompressed content
+// to data.
+func (br *BLFReader) fill() error {
+	br.data = append(br.data[:0], br.data[br.pos:]...)
+	br.pos = 0
+	if _, err := io.ReadFull(br.r, br.hdr[:]); err != nil {
+		if err == io.EOF {
+			if len(br.data) > 0 {
+				return fmt.Errorf("blf: %d bytes of truncated object at end of file", len(br.data))
+			}
+			return io.EOF
+		}
+		return fmt.Errorf("blf: %w", err)
+	}
+	h := br.hdr[:]
+	if !bytes.Equal(h[:4], blfObjMagic) {
+		return errors.New("blf: object signature missing")
+	}
+	size := int(binary.LittleEndian.Uint32(h[8:]))
+	if size < blfObjHeaderSize {
+		return fmt.Errorf("blf: object size %d", size)
+	}
+	body := io.LimitReader(br.r, int64(size-blfObjHeaderSize))
+	if binary.LittleEndian.Uint32(h[12:]) != blfLogContainer {
+		// Objects outside containers, as very old loggers wrote them.
+		br.data = append(br.data, h...)
+		n := len(br.data)
+		br.data = append(br.data, make([]byte, size-blfObjHeaderSize)...)
+		if _, err := io.ReadFull(body, br.data[n:]); err != nil {
+			return fmt.Errorf("blf: %w", io.ErrUnexpectedEOF)
+		}
+	} else {
+		var ch [blfContainerSize]byte
+		if _, err := io.ReadFull(body, ch[:]); err != nil {
+			return fmt.Errorf("blf: container: %w", io.ErrUnexpectedEOF)
+		}
+		method := binary.LittleEndian.Uint16(ch[0:])
+		raw := int(binary.LittleEndian.Uint32(ch[8:]))
+		var src io.Reader = body
+		switch method {
+		case blfNoCompression:
+		case blfZlibCompression:
+			var err error
+			if br.zr == nil {
+				br.zr, err = zlib.NewReader(body)
+			} else {
+				err = br.zr.(zlib.Resetter).Reset(body, nil)
+			}
+			if err != nil {
+				return fmt.Errorf("blf: container: %w", err)
+			}
+			src = br.zr
+		default:
+			return fmt.Errorf("blf: unknown container compression %d", method)
+		}
+		n := len(br.data)
+		br.data = append(br.data, make([]byte, raw)...)
+		if _, err := io.ReadFull(src, br.data[n:]); err != nil {
+			return fmt.Errorf("blf: container: %w", err)
+		}
+		io.Copy(io.Discard, body)
+	}
+	if pad := size % 4; pad > 0 {
+		if _, err := io.ReadFull(br.r, make([]byte, pad)); err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return fmt.Errorf("blf: %w", err)
+		}
+	}
+	return nil
+}
+
+// next decodes the next complete object in data; ok is false when data has
+// run out.
+func (br *BLFReader) next() (r Record, ok bool, err error) {
+	for {
+		// Objects are padded; find the next signature.
+		rest := br.data[br.pos:]
+		i := bytes.Index(rest[:min(len(rest), 8)], blfObjMagic)
+		if i < 0 {
+			if len(rest) >= 8 {
+				return r, false, errors.New("blf: object signature missing")
+			}
+			return r, false, nil
+		}
+		rest = rest[i:]
+		if len(rest) < blfObjHeaderSize {
+			return r, false, nil
+		}
+		hsize := int(binary.LittleEndian.Uint16(rest[4:]))
+		hver := binary.LittleEndian.Uint16(rest[6:])
+		size := int(binary.LittleEndian.Uint32(rest[8:]))
+		typ := binary.LittleEndian.Uint32(rest[12:])
+		if size < hsize || hsize < blfObjHeaderSize+blfObjHeaderV1 {
+			return r, false, fmt.Errorf("blf: object size %d, header size %d", size, hsize)
+		}
+		if len(rest) < size {
+			return r, false, nil
+		}
+		br.pos += i + size
+		obj := rest[:size]
+		if hver != 1 && hver != 2 {
+			continue
+		}
+		// Both header versions keep the flags at 16 and the timestamp at 24.
+		ts := time.Duration(binary.LittleEndian.Uint64(obj[24:]))
+		if binary.LittleEndian.Uint32(obj[16:]) == blfTimeTenMics {
+			ts *= 10 * time.Microsecond
+		}
+		r = Record{Time: br.start.Add(ts)}
+		ok, err := blfObject(&r, typ, obj[hsize:])
+		if err != nil || ok {
+			return r, ok, err
+		}
+	}
+}
+
+// blfObject decodes an object body into r; ok is false for object types
+// that are not frames.
+func blfObject(r *Record, typ uint32, b []byte) (ok bool, err error) {
+	f := &r.Frame
+	var channel uint16
+	var id uint32
+	switch typ {
+	case blfCANMessage, blfCANMessage2:
+		if len(b) < 16 {
+			return false, fmt.Errorf("blf: short CAN message")
+		}
+		channel, id = binary.LittleEndian.Uint16(b[0:]), binary.LittleEndian.Uint32(b[4:])
+		r.Tx = b[2]&blfDirTx != 0
+		f.Remote = b[2]&blfRemote != 0
+		f.Length = min(b[3], 8)
+		if !f.Remote {
+			copy(f.Data[:f.Length], b[8:16])
+		}
+	case blfCANFDMessage:
+		if len(b) < 20 {
+			return false, fmt.Errorf("blf: short CAN FD message")
+		}
+		channel, id = binary.LittleEndian.Uint16(b[0:]), binary.LittleEndian.Uint32(b[4:])
+		r.Tx = b[2]&blfDirTx != 0
+		if b[13]&blfFDEDL != 0 {
+			f.FD, f.BRS, f.ESI = true, b[13]&blfFDBRS != 0, b[13]&blfFDESI != 0
+			f.Length = gocan.DLCLength(b[3])
+			copy(f.Data[:min(f.Length, b[14])], b[20:])
+			break
+		}
+		f.Remote = b[2]&blfRemote != 0
+		f.Length = min(b[3], 8)
+		if !f.Remote {
+			copy(f.Data[:f.Length], b[20:])
+		}
+	case blfCANFDMsg64:
+		if len(b) < 40 {
+			return false, fmt.Errorf("blf: short CAN FD message")
+		}
+		channel, id = uint16(b[0]), binary.LittleEndian.Uint32(b[4:])
+		flags := binary.LittleEndian.Uint32(b[12:])
+		r.Tx = b[34] != 0
+		if flags&blfFD64EDL != 0 {
+			f.FD, f.BRS, f.ESI = true, flags&blfFD64BRS != 0, flags&blfFD64ESI != 0
+			f.Length = gocan.DLCLength(b[1])
+			copy(f.Data[:min(f.Length, b[2])], b[40:])
+			break
+		}
+		f.Remote = flags&blfFD64RTR != 0
+		f.Length = min(b[1], 8)
+		if !f.Remote {
+			copy(f.Data[:min(f.Length, b[2])], b[40:])
+		}
+	case blfCANErrorExt:
+		if len(b) < 32 {
+			return false, fmt.Errorf("blf: short CAN error frame")
+		}
+		channel, id = binary.LittleEndian.Uint16(b[0:]), binary.LittleEndian.Uint32(b[16:])
+		r.Error = true
+		f.Length = min(b[10], 8)
+		copy(f.Data[:f.Length], b[24:32])
+	default:
+		return false, nil
+	}
+	f.Extended = id&blfExtended != 0
+	f.ID = id &^ blfExtended
+	if f.Extended && f.ID > 0x1FFFFFFF || !f.Extended && f.ID > 0x7FF {
+		if !r.Error {
+			return false, fmt.Errorf("blf: identifier %#x out of range", id)
+		}
+		f.ID &= 0x1FFFFFFF
+	}
+	r.Channel = channelName(int(channel) - 1)
+	return true, nil
+}
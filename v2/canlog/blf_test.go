@@ -0,0 +1,168 @@
+package canlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gocan "github.com/roffe/gocan/v2"
+)
+
+func TestBLFRoundTrip(t *testing.T) {
+	start := time.Unix(1436509052, 249713000)
+	var want []Record
+	// Enough objects for several containers, with objects split across
+	// container boundaries.
+	for i := range 20000 {
+		rec := Record{
+			Time:    start.Add(time.Duration(i) * 137 * time.Microsecond),
+			Channel: channelName(i % 3),
+			Frame:   gocan.NewFrame(uint32(i%0x800), []byte{byte(i), byte(i >> 8), 3}),
+			Tx:      i%5 == 0,
+		}
+		switch i % 97 {
+		case 1:
+			rec.Frame = gocan.NewExtendedFrame(0x18DAF110, []byte{1, 2, 3, 4, 5, 6, 7, 8})
+		case 2:
+			rec.Frame = gocan.Frame{ID: 0x7DF, Remote: true, Length: 3}
+		case 3:
+			rec.Frame, rec.Error, rec.Tx = gocan.Frame{}, true, false
+		}
+		want = append(want, rec)
+	}
+
+	path := filepath.Join(t.TempDir(), "drive.blf")
+	w, err := Create(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rec := range want {
+		if err := w.Write(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := binary.LittleEndian.Uint64(raw[16:]); size != uint64(len(raw)) {
+		t.Errorf("header file size %d, file is %d bytes", size, len(raw))
+	}
+	if n := binary.LittleEndian.Uint32(raw[32:]); n != uint32(len(want)) {
+		t.Errorf("header object count %d, want %d", n, len(want))
+	}
+
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if r.Format.Name != "blf" {
+		t.Fatalf("detected as %s", r.Format.Name)
+	}
+	checkRecords(t, "blf", r, want)
+}
+
+// testBLFObject builds a BLF object with a version 1 or 2 header.
+func testBLFObject(typ uint32, hver uint16, flags uint32, ts uint64, body []byte) []byte {
+	hsize := 32
+	if hver == 2 {
+		hsize = 40
+	}
+	obj := make([]byte, hsize, hsize+len(body)+4)
+	copy(obj, "LOBJ")
+	binary.LittleEndian.PutUint16(obj[4:], uint16(hsize))
+	binary.LittleEndian.PutUint16(obj[6:], hver)
+	binary.LittleEndian.PutUint32(obj[8:], uint32(hsize+len(body)))
+	binary.LittleEndian.PutUint32(obj[12:], typ)
+	binary.LittleEndian.PutUint32(obj[16:], flags)
+	binary.LittleEndian.PutUint64(obj[24:], ts)
+	obj = append(obj, body...)
+	return append(obj, make([]byte, len(obj)%4)...)
+}
+
+func TestBLFObjects(t *testing.T) {
+	can1 := make([]byte, 16) // CAN_MESSAGE, channel 2, Tx
+	binary.LittleEndian.PutUint16(can1, 2)
+	can1[2], can1[3] = blfDirTx, 2
+	binary.LittleEndian.PutUint32(can1[4:], 0x7E0)
+	copy(can1[8:], []byte{0x01, 0x0C})
+
+	fd := make([]byte, 84) // CAN_FD_MESSAGE without EDL: a classic frame
+	binary.LittleEndian.PutUint16(fd, 1)
+	fd[3] = 3
+	binary.LittleEndian.PutUint32(fd[4:], 0x18FEF100|blfExtended)
+	copy(fd[20:], []byte{0xAA, 0xBB, 0xCC})
+
+	fd64 := make([]byte, 48) // CAN_FD_MESSAGE_64 remote frame
+	fd64[0], fd64[1] = 1, 4
+	binary.LittleEndian.PutUint32(fd64[4:], 0x123)
+	binary.LittleEndian.PutUint32(fd64[12:], blfFD64RTR)
+
+	errExt := make([]byte, 32)
+	binary.LittleEndian.PutUint16(errExt, 1)
+	errExt[10] = 1
+	binary.LittleEndian.PutUint32(errExt[16:], 0x100)
+
+	var objects []byte
+	objects = append(objects, testBLFObject(blfCANMessage, 1, blfTimeTenMics, 100, can1)...)
+	objects = append(objects, testBLFObject(96, 1, blfTimeOneNans, 0, make([]byte, 8))...) // global marker
+	objects = append(objects, testBLFObject(blfCANFDMessage, 2, blfTimeOneNans, 2_000_000, fd)...)
+	objects = append(objects, testBLFObject(blfCANFDMsg64, 1, blfTimeOneNans, 3_000_000, fd64)...)
+	objects = append(objects, testBLFObject(blfCANErrorExt, 1, blfTimeOneNans, 4_000_000, errExt)...)
+
+	header := make([]byte, blfFileHeaderSize)
+	copy(header, "LOGG")
+	binary.LittleEndian.PutUint32(header[4:], blfFileHeaderSize)
+	for i, v := range []uint16{2022, 4, 4, 28, 10, 44, 52, 480} {
+		binary.LittleEndian.PutUint16(header[40+2*i:], v)
+	}
+	// One uncompressed container holding all but the last object, which
+	// sits outside any container.
+	last := testBLFObject(blfCANMessage, 1, blfTimeOneNans, 5_000_000, can1)
+	container := make([]byte, 32)
+	copy(container, "LOBJ")
+	binary.LittleEndian.PutUint16(container[4:], 16)
+	binary.LittleEndian.PutUint16(container[6:], 1)
+	binary.LittleEndian.PutUint32(container[8:], uint32(32+len(objects)))
+	binary.LittleEndian.PutUint32(container[12:], blfLogContainer)
+	binary.LittleEndian.PutUint32(container[24:], uint32(len(objects)))
+	file := append(header, container...)
+	file = append(file, objects...)
+	file = append(file, make([]byte, (len(container)+len(objects))%4)...)
+	file = append(file, last...)
+
+	start := time.Date(2022, 4, 28, 10, 44, 52, 480e6, time.Local)
+	r, format, err := NewReader(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format.Name != "blf" {
+		t.Fatalf("detected as %s", format.Name)
+	}
+	checkRecords(t, "objects", r, []Record{
+		{Time: start.Add(time.Millisecond), Channel: "can1", Frame: gocan.NewFrame(0x7E0, []byte{0x01, 0x0C}), Tx: true},
+		{Time: start.Add(2 * time.Millisecond), Channel: "can0", Frame: gocan.NewExtendedFrame(0x18FEF100, []byte{0xAA, 0xBB, 0xCC})},
+		{Time: start.Add(3 * time.Millisecond), Channel: "can0", Frame: gocan.Frame{ID: 0x123, Remote: true, Length: 4}},
+		{Time: start.Add(4 * time.Millisecond), Channel: "can0", Frame: gocan.Frame{ID: 0x100, Length: 1}, Error: true},
+		{Time: start.Add(5 * time.Millisecond), Channel: "can1", Frame: gocan.NewFrame(0x7E0, []byte{0x01, 0x0C}), Tx: true},
+	})
+
+	// A truncated file fails instead of ending early.
+	r = NewBLFReader(bytes.NewReader(file[:len(file)-len(last)-10]))
+	var err2 error
+	for err2 == nil {
+		_, err2 = r.Read()
+	}
+	if err2 == io.EOF {
+		t.Fatal("truncated file read to EOF")
+	}
+}
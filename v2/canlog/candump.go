@@ -0,0 +1,264 @@
+package canlog
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	gocan "github.com/roffe/gocan/v2"
+)
+
+func init() {
+	RegisterFormat(Format{
+		Name:        "candump",
+		Description: "Linux can-utils candump -l",
+		Extensions:  []string{".log", ".candump"},
+		Detect: func(head []byte) bool {
+			_, err := ParseCandump(firstLine(head, "#"))
+			return err == nil
+		},
+		NewReader: func(r io.Reader) Reader { return NewCandumpReader(r) },
+		NewWriter: func(w io.Writer) Writer {
+			cw := NewCandumpWriter(w)
+			cw.Direction = true
+			return cw
+		},
+	})
+}
+
+// CandumpWriter writes candump -l log lines.
+type CandumpWriter struct {
+	// Direction appends the " T"/" R" field, as candump -l -x does.
+	Direction bool
+
+	w   *bufio.Writer
+	buf []byte
+}
+
+// NewCandumpWriter writes candump lines to w. Call Flush when done.
+func NewCandumpWriter(w io.Writer) *CandumpWriter {
+	return &CandumpWriter{w: bufio.NewWriter(w)}
+}
+
+// Write writes one record. Error frames are skipped.
+func (cw *CandumpWriter) Write(r Record) error {
+	if r.Error {
+		return nil
+	}
+	cw.buf = AppendCandump(cw.buf[:0], r, cw.Direction)
+	cw.buf = append(cw.buf, '\n')
+	_, err := cw.w.Write(cw.buf)
+	return err
+}
+
+// Flush writes buffered lines to the underlying writer.
+func (cw *CandumpWriter) Flush() error {
+	return cw.w.Flush()
+}
+
+// Close flushes; candump logs have no trailer.
+func (cw *CandumpWriter) Close() error {
+	return cw.w.Flush()
+}
+
+// AppendCandump appends the candump -l form of r, without a newline.
+func AppendCandump(b []byte, r Record, direction bool) []byte {
+	ts := r.Time.UnixMicro()
+	b = append(b, '(')
+	b = strconv.AppendInt(b, ts/1e6, 10)
+	b = append(b, '.')
+	b = appendPadded(b, ts%1e6, 6)
+	b = append(b, ") "...)
+	ch := r.Channel
+	if ch == "" {
+		ch = DefaultChannel
+	}
+	b = append(b, ch...)
+	b = append(b, ' ')
+	f := r.Frame
+	if f.Extended {
+		b = appendHexID(b, f.ID, 8)
+	} else {
+		b = appendHexID(b, f.ID, 3)
+	}
+	b = append(b, '#')
+	if f.FD {
+		var flags byte
+		if f.BRS {
+			flags |= 0x01
+		}
+		if f.ESI {
+			flags |= 0x02
+		}
+		b = append(b, '#', hexDigits[flags])
+	}
+	if f.Remote {
+		b = append(b, 'R')
+		if f.Length > 0 {
+			b = append(b, hexDigits[f.Length&0x0F])
+		}
+	} else {
+		for _, c := range f.Bytes() {
+			b = append(b, hexDigits[c>>4], hexDigits[c&0x0F])
+		}
+	}
+	if direction {
+		if r.Tx {
+			b = append(b, " T"...)
+		} else {
+			b = append(b, " R"...)
+		}
+	}
+	return b
+}
+
+const hexDigits = "0123456789ABCDEF"
+
+func appendPadded(b []byte, v int64, width int) []byte {
+	s := strconv.FormatInt(v, 10)
+	for range width - len(s) {
+		b = append(b, '0')
+	}
+	return append(b, s...)
+}
+
+func appendHexID(b []byte, id uint32, width int) []byte {
+	s := strings.ToUpper(strconv.FormatUint(uint64(id), 16))
+	for range width - len(s) {
+		b = append(b, '0')
+	}
+	return append(b, s...)
+}
+
+// CandumpReader reads candump -l log lines.
+type CandumpReader struct {
+	s    *bufio.Scanner
+	line int
+}
+
+// NewCandumpReader reads candump lines from r.
+func NewCandumpReader(r io.Reader) *CandumpReader {
+	return &CandumpReader{s: bufio.NewScanner(r)}
+}
+
+// Read returns the next record, or io.EOF at the end of the log. Blank
+// lines and # comments are skipped.
+func (cr *CandumpReader) Read() (Record, error) {
+	for cr.s.Scan() {
+		cr.line++
+		line := strings.TrimSpace(cr.s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		r, err := ParseCandump(line)
+		if err != nil {
+			return Record{}, fmt.Errorf("candump: line %d: %w", cr.line, err)
+		}
+		return r, nil
+	}
+	if err := cr.s.Err(); err != nil {
+		return Record{}, err
+	}
+	return Record{}, io.EOF
+}
+
+// ParseCandump parses one candump -l line.
+func ParseCandump(line string) (Record, error) {
+	var r Record
+	fields := strings.Fields(line)
+	if len(fields) < 3 || len(fields) > 4 {
+		return r, fmt.Errorf("malformed line %q", line)
+	}
+	ts := fields[0]
+	if len(ts) < 3 || ts[0] != '(' || ts[len(ts)-1] != ')' {
+		return r, fmt.Errorf("malformed timestamp %q", ts)
+	}
+	sec, frac, _ := strings.Cut(ts[1:len(ts)-1], ".")
+	s, err := strconv.ParseInt(sec, 10, 64)
+	if err != nil {
+		return r, fmt.Errorf("malformed timestamp %q", ts)
+	}
+	var ns int64
+	if frac != "" {
+		if len(frac) > 9 {
+			frac = frac[:9]
+		}
+		if ns, err = strconv.ParseInt(frac, 10, 64); err != nil {
+			return r, fmt.Errorf("malformed timestamp %q", ts)
+		}
+		for range 9 - len(frac) {
+			ns *= 10
+		}
+	}
+	r.Time = time.Unix(s, ns)
+	r.Channel = fields[1]
+	if r.Frame, err = parseCandumpFrame(fields[2]); err != nil {
+		return r, err
+	}
+	if len(fields) == 4 {
+		switch fields[3] {
+		case "T":
+			r.Tx = true
+		case "R":
+		default:
+			return r, fmt.Errorf("unknown direction %q", fields[3])
+		}
+	}
+	return r, nil
+}
+
+func parseCandumpFrame(s string) (gocan.Frame, error) {
+	var f gocan.Frame
+	id, data, ok := strings.Cut(s, "#")
+	if !ok || (len(id) != 3 && len(id) != 8) {
+		return f, fmt.Errorf("malformed frame %q", s)
+	}
+	v, err := strconv.ParseUint(id, 16, 32)
+	if err != nil {
+		return f, fmt.Errorf("malformed identifier %q", id)
+	}
+	f.ID, f.Extended = uint32(v), len(id) == 8
+	if f.Extended && f.ID > 0x1FFFFFFF || !f.Extended && f.ID > 0x7FF {
+		return f, fmt.Errorf("identifier %q out of range", id)
+	}
+	maxData := 8
+	if strings.HasPrefix(data, "#") {
+		// CAN FD: a hex flags digit (1 = BRS, 2 = ESI) before the data.
+		if len(data) < 2 {
+			return f, fmt.Errorf("malformed CAN FD frame %q", s)
+		}
+		flags, err := strconv.ParseUint(data[1:2], 16, 8)
+		if err != nil {
+			return f, fmt.Errorf("malformed CAN FD flags %q", s)
+		}
+		f.FD, f.BRS, f.ESI = true, flags&0x01 != 0, flags&0x02 != 0
+		data, maxData = data[2:], gocan.MaxFDLength
+	} else if data != "" && (data[0] == 'R' || data[0] == 'r') {
+		f.Remote = true
+		if len(data) > 1 {
+			n, err := strconv.ParseUint(data[1:2], 16, 8)
+			if err != nil || n > 8 {
+				return f, fmt.Errorf("malformed remote frame %q", s)
+			}
+			f.Length = uint8(n)
+		}
+		return f, nil
+	}
+	data = strings.ReplaceAll(data, ".", "")
+	if len(data)%2 != 0 || len(data) > 2*maxData {
+		return f, fmt.Errorf("malformed data %q", data)
+	}
+	n, err := hex.Decode(f.Data[:], []byte(data))
+	if err != nil {
+		return f, fmt.Errorf("malformed data %q", data)
+	}
+	f.Length = uint8(n)
+	if f.FD {
+		f.Length = gocan.DLCLength(gocan.LengthDLC(n)) // zero padded, as on the wire
+	}
+	return f, nil
+}
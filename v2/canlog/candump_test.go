@@ -0,0 +1,100 @@
+package canlog
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	gocan "github.com/roffe/gocan/v2"
+)
+
+func TestCandumpRoundTrip(t *testing.T) {
+	ts := time.Unix(1436509052, 249713000)
+	remote := gocan.Frame{ID: 0x7DF, Remote: true, Length: 3}
+	for _, tc := range []struct {
+		line string
+		rec  Record
+	}{
+		{"(1436509052.249713) can0 123#DEADBEEF",
+			Record{Time: ts, Channel: "can0", Frame: gocan.NewFrame(0x123, []byte{0xDE, 0xAD, 0xBE, 0xEF})}},
+		{"(1436509052.249713) vcan1 18DAF110#0102030405060708",
+			Record{Time: ts, Channel: "vcan1", Frame: gocan.NewExtendedFrame(0x18DAF110, []byte{1, 2, 3, 4, 5, 6, 7, 8})}},
+		{"(1436509052.249713) can0 7DF#R3",
+			Record{Time: ts, Channel: "can0", Frame: remote}},
+		{"(1436509052.249713) can0 001# T",
+			Record{Time: ts, Channel: "can0", Frame: gocan.NewFrame(0x001, nil), Tx: true}},
+	} {
+		r, err := ParseCandump(tc.line)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.line, err)
+		}
+		if !r.Time.Equal(tc.rec.Time) || r.Channel != tc.rec.Channel || r.Frame != tc.rec.Frame || r.Tx != tc.rec.Tx {
+			t.Errorf("%s: got %+v", tc.line, r)
+		}
+		if got := string(AppendCandump(nil, tc.rec, tc.rec.Tx)); got != tc.line {
+			t.Errorf("format: got %q want %q", got, tc.line)
+		}
+	}
+
+	for _, bad := range []string{
+		"1436509052.249713 can0 123#00",
+		"(1436509052.249713) can0 1234#00",
+		"(1436509052.249713) can0 800#00",
+		"(1436509052.249713) can0 123#0",
+		"(1436509052.249713) can0 123#001122334455667788",
+		"(1436509052.249713) can0 123#00 X",
+	} {
+		if _, err := ParseCandump(bad); err == nil {
+			t.Errorf("accepted %q", bad)
+		}
+	}
+}
+
+func TestCandumpReader(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewCandumpWriter(&buf)
+	for i := range 3 {
+		w.Write(Record{Time: time.Unix(int64(i), 0), Frame: gocan.NewFrame(uint32(i), []byte{byte(i)})})
+	}
+	w.Flush()
+	buf.WriteString("\n# comment\n")
+
+	r := NewCandumpReader(&buf)
+	for i := range 3 {
+		rec, err := r.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec.Frame.ID != uint32(i) || rec.Time.Unix() != int64(i) || rec.Channel != DefaultChannel {
+			t.Fatalf("record %d: %+v", i, rec)
+		}
+	}
+	if _, err := r.Read(); err != io.EOF {
+		t.Fatalf("want EOF, got %v", err)
+	}
+}
+
+// TestCandumpFD reads CAN FD lines as written by newer candump versions,
+// which include the FDF bit in the flags digit.
+func TestCandumpFD(t *testing.T) {
+	r := NewCandumpReader(strings.NewReader("(1.000000) can0 7E0##5000102030405060708\n(2.000000) can0 18DB33F1##2.11.22\n(3.000000) can0 123##1" + strings.Repeat("00", 65) + "\n"))
+	rec, err := r.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := rec.Frame; !f.FD || !f.BRS || f.ESI || f.Length != 12 || f.Data[8] != 8 {
+		t.Fatalf("record 0: %+v", f)
+	}
+	rec, err = r.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := rec.Frame; !f.FD || f.BRS || !f.ESI || !f.Extended || f.Length != 2 {
+		t.Fatalf("record 1: %+v", f)
+	}
+	if _, err := r.Read(); err == nil {
+		t.Fatal("accepted a 65 byte frame")
+	}
+}
@@ -0,0 +1,68 @@
+// Package canlog reads and writes CAN traffic log files and records a live
+// gocan v2 bus to disk.
+//
+// Logs are sequences of Records, read with a Reader and written with a
+// Writer. Formats are kept in a registry and recognized by content, so a
+// log from another tool can be opened without knowing what wrote it:
+//
+//	candump  Linux can-utils candump -l, e.g. "(1436509052.249713) can0 123#DEADBEEF"
+//	asc      Vector ASCII logs (CANalyzer, CANoe)
+//	trc      PEAK-System traces (PCAN-View), versions 1.1, 2.0 and 2.1
+//	csv      SavvyCAN / GVRET comma separated values
+//	blf      Vector binary logs, read and written as a stream
+//	pcapng   Wireshark captures with the SocketCAN link type, one interface per channel
+//	pcap     classic pcap with the SocketCAN link type
+//	mdf      ASAM MDF 4 (CANape, asammdf), frames in the ASAM bus logging layout
+//
+// Open and Create handle files, including gzipped ones:
+//
+//	in, err := canlog.Open("capture.asc")
+//	out, err := canlog.Create("capture.trc", "")
+//	n, err := canlog.Copy(out, in)
+//
+// Timestamps, direction, channel and the extended and remote flags survive
+// conversion. CAN FD frames, with their BRS and ESI flags, are kept by every
+// format except CSV and TRC 1.1, whose writers reject them. Formats that
+// number their channels map channel index i to interface "can<i>" (ASC and
+// TRC count from 1, so their channel 1 is can0).
+//
+// A Recorder attaches to a bus and writes everything it receives (and
+// optionally sends) to a log file, rotating by size or age and compressing
+// with gzip, so it can be left running for a whole drive:
+//
+//	rec, err := canlog.NewRecorder(bus, "drive.log",
+//		canlog.WithSent(), canlog.WithGzip(), canlog.WithRotateSize(64<<20))
+//	defer rec.Close()
+//
+// Recorder.Attach adds more buses to the same file, each under its own
+// channel; in a pcapng capture every bus becomes a Wireshark interface.
+//
+// MDF files can also hold decoded signals next to the raw frames, with
+// their units and scaling, for calibration tools:
+//
+//	w := canlog.NewMDFWriter(f)
+//	engine, err := w.AddMessage(db.Message("Engine"))
+//	...
+//	engine.WriteDecoded(time.Now(), decoded)
+package canlog
+
+import (
+	"time"
+
+	gocan "github.com/roffe/gocan/v2"
+)
+
+// Record is one logged frame.
+type Record struct {
+	Time    time.Time
+	Channel string // interface name, "can0" when the log has none
+	Frame   gocan.Frame
+	Tx      bool // sent by the logging node rather than received
+	// Error marks an error frame. Frame then holds whatever the logger
+	// captured of the damaged frame, often nothing. Formats without error
+	// frames (candump, TRC, CSV) skip these records when writing.
+	Error bool
+}
+
+// DefaultChannel is the interface name used when none is given.
+const DefaultChannel = "can0"
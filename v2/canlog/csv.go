@@ -0,0 +1,201 @@
+package canlog
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterFormat(Format{
+		Name:        "csv",
+		Description: "SavvyCAN / GVRET comma separated values",
+		Extensions:  []string{".csv"},
+		Detect: func(head []byte) bool {
+			return strings.HasPrefix(strings.ToLower(firstLine(head)), "time stamp,")
+		},
+		NewReader: func(r io.Reader) Reader { return NewCSVReader(r) },
+		NewWriter: func(w io.Writer) Writer { return NewCSVWriter(w) },
+	})
+}
+
+// csvHeader is the SavvyCAN column layout, plus an RTR column SavvyCAN
+// ignores.
+var csvHeader = []string{"Time Stamp", "ID", "Extended", "Dir", "Bus", "LEN", "D1", "D2", "D3", "D4", "D5", "D6", "D7", "D8", "RTR"}
+
+// CSVWriter writes SavvyCAN CSV logs. Timestamps are microseconds since the
+// Unix epoch and buses are numbered from 0.
+type CSVWriter struct {
+	w      *csv.Writer
+	header bool
+	row    []string
+}
+
+// NewCSVWriter writes a CSV log to w. Call Close when done.
+func NewCSVWriter(w io.Writer) *CSVWriter {
+	return &CSVWriter{w: csv.NewWriter(w), row: make([]string, len(csvHeader))}
+}
+
+// Write writes one record. Error frames are skipped; CAN FD frames do not
+// fit the eight data columns and are rejected.
+func (cw *CSVWriter) Write(r Record) error {
+	if r.Error {
+		return nil
+	}
+	if r.Frame.FD {
+		return errors.New("csv: CAN FD frames not supported")
+	}
+	if !cw.header {
+		cw.header = true
+		if err := cw.w.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+	f := r.Frame
+	row := cw.row
+	row[0] = strconv.FormatInt(r.Time.UnixMicro(), 10)
+	row[1] = fmt.Sprintf("%08X", f.ID)
+	row[2] = strconv.FormatBool(f.Extended)
+	row[3] = "Rx"
+	if r.Tx {
+		row[3] = "Tx"
+	}
+	row[4] = strconv.Itoa(channelIndex(r.Channel))
+	row[5] = strconv.Itoa(int(f.Length))
+	for i := range 8 {
+		row[6+i] = ""
+		if i < int(f.Length) && !f.Remote {
+			row[6+i] = fmt.Sprintf("%02X", f.Data[i])
+		}
+	}
+	row[14] = strconv.FormatBool(f.Remote)
+	return cw.w.Write(row)
+}
+
+// Flush writes buffered rows to the underlying writer.
+func (cw *CSVWriter) Flush() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// Close writes the header if nothing was written and flushes.
+func (cw *CSVWriter) Close() error {
+	if !cw.header {
+		cw.header = true
+		if err := cw.w.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+	return cw.Flush()
+}
+
+// CSVReader reads SavvyCAN CSV logs. Columns are found by their header
+// names, so older layouts without the Dir column also work.
+type CSVReader struct {
+	r    *csv.Reader
+	cols map[string]int
+}
+
+// NewCSVReader reads a CSV log from r.
+func NewCSVReader(r io.Reader) *CSVReader {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	cr.ReuseRecord = true
+	return &CSVReader{r: cr}
+}
+
+// Read returns the next record, or io.EOF at the end of the log.
+func (cr *CSVReader) Read() (Record, error) {
+	if cr.cols == nil {
+		header, err := cr.r.Read()
+		if err != nil {
+			return Record{}, err
+		}
+		cr.cols = make(map[string]int)
+		for i, name := range header {
+			cr.cols[strings.ToLower(strings.TrimSpace(name))] = i
+		}
+		for _, name := range []string{"time stamp", "id", "len", "d1"} {
+			if _, ok := cr.cols[name]; !ok {
+				return Record{}, fmt.Errorf("csv: no %q column", name)
+			}
+		}
+	}
+	for {
+		row, err := cr.r.Read()
+		if err != nil {
+			return Record{}, err
+		}
+		if len(row) == 1 && row[0] == "" {
+			continue
+		}
+		r, err := cr.parse(row)
+		if err != nil {
+			line, _ := cr.r.FieldPos(0)
+			return Record{}, fmt.Errorf("csv: line %d: %w", line, err)
+		}
+		return r, nil
+	}
+}
+
+// col returns the named column of row, or "" when the log has no such
+// column.
+func (cr *CSVReader) col(row []string, name string) string {
+	if i, ok := cr.cols[name]; ok && i < len(row) {
+		return strings.TrimSpace(row[i])
+	}
+	return ""
+}
+
+func (cr *CSVReader) parse(row []string) (r Record, err error) {
+	ts, err := strconv.ParseInt(cr.col(row, "time stamp"), 10, 64)
+	if err != nil {
+		return r, fmt.Errorf("malformed time stamp %q", cr.col(row, "time stamp"))
+	}
+	r.Time = time.UnixMicro(ts)
+	id := cr.col(row, "id")
+	v, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(id), "0x"), 16, 32)
+	if err != nil {
+		return r, fmt.Errorf("malformed identifier %q", id)
+	}
+	f := &r.Frame
+	f.ID = uint32(v)
+	f.Extended = strings.EqualFold(cr.col(row, "extended"), "true") || v > 0x7FF
+	if v > 0x1FFFFFFF {
+		return r, fmt.Errorf("identifier %q out of range", id)
+	}
+	f.Remote = strings.EqualFold(cr.col(row, "rtr"), "true")
+	r.Tx = strings.EqualFold(cr.col(row, "dir"), "tx")
+	bus := 0
+	if s := cr.col(row, "bus"); s != "" {
+		if bus, err = strconv.Atoi(s); err != nil {
+			return r, fmt.Errorf("malformed bus %q", s)
+		}
+	}
+	r.Channel = channelName(bus)
+	n, err := strconv.Atoi(cr.col(row, "len"))
+	if err != nil || n < 0 || n > 8 {
+		return r, fmt.Errorf("malformed length %q", cr.col(row, "len"))
+	}
+	f.Length = uint8(n)
+	if f.Remote {
+		return r, nil
+	}
+	first := cr.cols["d1"]
+	if len(row) < first+n {
+		return r, fmt.Errorf("want %d data bytes", n)
+	}
+	for i, s := range row[first : first+n] {
+		c, err := strconv.ParseUint(strings.TrimSpace(s), 16, 8)
+		if err != nil {
+			return r, fmt.Errorf("malformed data byte %q", s)
+		}
+		f.Data[i] = byte(c)
+	}
+	return r, nil
+}
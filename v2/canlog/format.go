@@ -0,0 +1,319 @@
+package canlog
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reader reads records from a log.
+type Reader interface {
+	// Read returns the next record, or io.EOF at the end of the log.
+	Read() (Record, error)
+}
+
+// Writer writes records to a log.
+type Writer interface {
+	Write(Record) error
+	// Flush writes buffered records to the underlying writer.
+	Flush() error
+	// Close writes whatever trailer the format needs and flushes. It does
+	// not close the underlying writer.
+	Close() error
+}
+
+// Format describes a registered log format.
+type Format struct {
+	Name        string
+	Description string
+	// Extensions are the file name extensions used for the format, lower
+	// case with the dot. The first is the one to use when creating files.
+	Extensions []string
+	// Detect reports whether head, the first few kilobytes of a log, is in
+	// this format.
+	Detect    func(head []byte) bool
+	NewReader func(io.Reader) Reader
+	NewWriter func(io.Writer) Writer
+}
+
+func (f Format) String() string {
+	return fmt.Sprintf("%s | %s (%s)", f.Name, f.Description, strings.Join(f.Extensions, ", "))
+}
+
+var (
+	formatMu sync.Mutex
+	formats  []Format // in registration order, which is detection order
+)
+
+// RegisterFormat adds a log format to the registry. It fails if the name is
+// already taken.
+func RegisterFormat(f Format) error {
+	formatMu.Lock()
+	defer formatMu.Unlock()
+	for _, g := range formats {
+		if g.Name == f.Name {
+			return fmt.Errorf("canlog: format %s already registered", f.Name)
+		}
+	}
+	formats = append(formats, f)
+	return nil
+}
+
+// Formats returns the registered formats, sorted by name.
+func Formats() []Format {
+	formatMu.Lock()
+	out := append([]Format(nil), formats...)
+	formatMu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// LookupFormat returns the format called name.
+func LookupFormat(name string) (Format, error) {
+	formatMu.Lock()
+	defer formatMu.Unlock()
+	for _, f := range formats {
+		if strings.EqualFold(f.Name, name) {
+			return f, nil
+		}
+	}
+	return Format{}, fmt.Errorf("canlog: unknown format %q", name)
+}
+
+// FormatForPath picks a format by the extension of path, ignoring a trailing
+// ".gz".
+func FormatForPath(path string) (Format, error) {
+	ext := strings.ToLower(filepath.Ext(strings.TrimSuffix(path, ".gz")))
+	formatMu.Lock()
+	defer formatMu.Unlock()
+	for _, f := range formats {
+		for _, e := range f.Extensions {
+			if e == ext {
+				return f, nil
+			}
+		}
+	}
+	return Format{}, fmt.Errorf("canlog: no format for %q", filepath.Base(path))
+}
+
+// DetectFormat identifies the format of a log from its first few kilobytes.
+func DetectFormat(head []byte) (Format, error) {
+	formatMu.Lock()
+	defer formatMu.Unlock()
+	for _, f := range formats {
+		if f.Detect != nil && f.Detect(head) {
+			return f, nil
+		}
+	}
+	return Format{}, errors.New("canlog: unrecognized log format")
+}
+
+// detectSize is how much of a log DetectFormat gets to look at.
+const detectSize = 4096
+
+// NewReader detects the format of the log in r, decompressing gzip, and
+// returns a reader for it.
+func NewReader(r io.Reader) (Reader, Format, error) {
+	br := bufio.NewReaderSize(r, detectSize)
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1F && magic[1] == 0x8B {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, Format{}, fmt.Errorf("canlog: %w", err)
+		}
+		br = bufio.NewReaderSize(zr, detectSize)
+	}
+	head, err := br.Peek(detectSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, Format{}, fmt.Errorf("canlog: %w", err)
+	}
+	f, err := DetectFormat(head)
+	if err != nil {
+		return nil, Format{}, err
+	}
+	return f.NewReader(br), f, nil
+}
+
+// FileReader is a log file opened with Open.
+type FileReader struct {
+	Reader
+	Format Format
+	f      *os.File
+}
+
+// Open opens a log file of any registered format, optionally gzipped,
+// detecting the format from its content.
+func Open(path string) (*FileReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("canlog: %w", err)
+	}
+	r, format, err := NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%w: %s", err, path)
+	}
+	return &FileReader{Reader: r, Format: format, f: f}, nil
+}
+
+func (r *FileReader) Close() error { return r.f.Close() }
+
+// FileWriter is a log file created with Create.
+type FileWriter struct {
+	Writer
+	Format Format
+	f      *os.File
+	gz     *gzip.Writer
+}
+
+// Create creates a log file in the named format, or the one matching the
+// file's extension when format is "". Names ending in ".gz" are gzipped.
+func Create(path, format string) (*FileWriter, error) {
+	var f Format
+	var err error
+	if format != "" {
+		f, err = LookupFormat(format)
+	} else {
+		f, err = FormatForPath(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("canlog: %w", err)
+	}
+	w := &FileWriter{Format: f, f: file}
+	var out io.Writer = file
+	if strings.HasSuffix(path, ".gz") {
+		w.gz = gzip.NewWriter(file)
+		out = w.gz
+	}
+	w.Writer = f.NewWriter(out)
+	return w, nil
+}
+
+// Close finishes the log and closes the file.
+func (w *FileWriter) Close() error {
+	err := w.Writer.Close()
+	if w.gz != nil {
+		err = errors.Join(err, w.gz.Close())
+	}
+	return errors.Join(err, w.f.Close())
+}
+
+// Copy writes every record read from r to w, returning how many were
+// copied. It does not close w.
+func Copy(w Writer, r Reader) (int, error) {
+	var n int
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			return n, w.Flush()
+		}
+		if err != nil {
+			return n, err
+		}
+		if err := w.Write(rec); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// Formats that number their channels (ASC, TRC, CSV) are mapped to and from
+// interface names: channel index i is "can<i>".
+
+// channelIndex returns the trailing number of an interface name, 0 if it has
+// none.
+func channelIndex(name string) int {
+	i := len(name)
+	for i > 0 && name[i-1] >= '0' && name[i-1] <= '9' {
+		i--
+	}
+	n, _ := strconv.Atoi(name[i:])
+	return n
+}
+
+func channelName(index int) string {
+	return "can" + strconv.Itoa(index)
+}
+
+// parseFixed parses a non-negative decimal such as "1059.900" counted in
+// unit, without going through floating point.
+func parseFixed(s string, unit time.Duration) (time.Duration, error) {
+	ip, fp, _ := strings.Cut(s, ".")
+	if ip == "" && fp == "" {
+		return 0, fmt.Errorf("malformed number %q", s)
+	}
+	var d time.Duration
+	if ip != "" {
+		n, err := strconv.ParseUint(ip, 10, 63)
+		if err != nil {
+			return 0, fmt.Errorf("malformed number %q", s)
+		}
+		d = time.Duration(n) * unit
+	}
+	if len(fp) > 9 {
+		fp = fp[:9]
+	}
+	if fp != "" {
+		frac, err := strconv.ParseUint(fp, 10, 63)
+		if err != nil {
+			return 0, fmt.Errorf("malformed number %q", s)
+		}
+		scale := time.Duration(1)
+		for range fp {
+			scale *= 10
+		}
+		d += time.Duration(frac) * unit / scale
+	}
+	return d, nil
+}
+
+// appendFixed appends d counted in unit with the given number of decimals,
+// truncating.
+func appendFixed(b []byte, d, unit time.Duration, decimals int) []byte {
+	b = strconv.AppendInt(b, int64(d/unit), 10)
+	if decimals == 0 {
+		return b
+	}
+	scale := time.Duration(1)
+	for range decimals {
+		scale *= 10
+	}
+	b = append(b, '.')
+	return appendPadded(b, int64((d%unit)*scale/unit), decimals)
+}
+
+// firstLine returns the first line of head that is neither blank nor
+// starts with one of the comment prefixes.
+func firstLine(head []byte, comments ...string) string {
+	for len(head) > 0 {
+		line, rest, _ := bytes.Cut(head, []byte{'\n'})
+		head = rest
+		s := strings.TrimSpace(string(line))
+		if s == "" {
+			continue
+		}
+		skip := false
+		for _, c := range comments {
+			if strings.HasPrefix(s, c) {
+				skip = true
+			}
+		}
+		if !skip {
+			return s
+		}
+	}
+	return ""
+}
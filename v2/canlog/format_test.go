@@ -0,0 +1,266 @@
+package canlog
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	gocan "github.com/roffe/gocan/v2"
+)
+
+func testRecords(start time.Time, step time.Duration, channel string) []Record {
+	return []Record{
+		{Time: start, Channel: channel, Frame: gocan.NewFrame(0x123, []byte{0xDE, 0xAD, 0xBE, 0xEF})},
+		{Time: start.Add(step), Channel: channel, Frame: gocan.NewExtendedFrame(0x18DAF110, []byte{1, 2, 3, 4, 5, 6, 7, 8}), Tx: true},
+		{Time: start.Add(2 * step), Channel: channel, Frame: gocan.Frame{ID: 0x7DF, Remote: true, Length: 3}},
+		{Time: start.Add(3 * step), Channel: channel, Frame: gocan.NewFrame(0x001, nil), Tx: true},
+		{Time: start.Add(4 * step), Channel: channel, Frame: gocan.NewExtendedFrame(0x1FFFFFFF, []byte{0xFF}), Tx: true},
+	}
+}
+
+// withFD adds CAN FD frames, which only some formats keep.
+func withFD(recs []Record, step time.Duration) []Record {
+	last := recs[len(recs)-1]
+	data := make([]byte, 64)
+	for i := range data {
+		data[i] = byte(i * 3)
+	}
+	esi := gocan.NewFDFrame(0x18DB33F1, data)
+	esi.Extended, esi.BRS, esi.ESI = true, false, true
+	return append(recs,
+		Record{Time: last.Time.Add(step), Channel: last.Channel, Frame: gocan.NewFDFrame(0x7E0, data[:17])},
+		Record{Time: last.Time.Add(2 * step), Channel: last.Channel, Frame: esi, Tx: true},
+	)
+}
+
+// withError adds an error frame, which only some formats keep.
+func withError(recs []Record) []Record {
+	last := recs[len(recs)-1]
+	return append(recs, Record{Time: last.Time.Add(time.Millisecond), Channel: last.Channel, Error: true})
+}
+
+func checkRecords(t *testing.T, name string, r Reader, want []Record) {
+	t.Helper()
+	for i, w := range want {
+		got, err := r.Read()
+		if err != nil {
+			t.Fatalf("%s: record %d: %v", name, i, err)
+		}
+		if !got.Time.Equal(w.Time) || got.Channel != w.Channel || got.Frame != w.Frame || got.Tx != w.Tx || got.Error != w.Error {
+			t.Errorf("%s: record %d:\n got %v %s %+v tx=%v error=%v\nwant %v %s %+v tx=%v error=%v", name, i,
+				got.Time, got.Channel, got.Frame, got.Tx, got.Error, w.Time, w.Channel, w.Frame, w.Tx, w.Error)
+		}
+	}
+	if _, err := r.Read(); err != io.EOF {
+		t.Fatalf("%s: want EOF, got %v", name, err)
+	}
+}
+
+func TestFormatRoundTrip(t *testing.T) {
+	start := time.Unix(1436509052, 249713000)
+	for _, tc := range []struct {
+		file    string
+		format  string
+		step    time.Duration
+		channel string
+		errors  bool // the format keeps error frames
+		fd      bool // the format keeps CAN FD frames
+		setup   func(Writer)
+	}{
+		{file: "a.log", format: "candump", step: 1234567 * time.Microsecond, channel: "vcan3", fd: true},
+		{file: "a.asc", format: "asc", step: 1234567 * time.Microsecond, channel: "can1", errors: true, fd: true},
+		{file: "a.asc.gz", format: "asc", step: time.Microsecond, channel: "can0", errors: true},
+		{file: "a.pcapng", format: "pcapng", step: 1234567 * time.Microsecond, channel: "vcan1", errors: true, fd: true},
+		{file: "a.blf", format: "blf", step: 1234567 * time.Microsecond, channel: "can3", errors: true, fd: true},
+		{file: "a.mf4", format: "mdf", step: 1234567 * time.Microsecond, channel: "can2", errors: true, fd: true},
+		{file: "a.trc", format: "trc", step: 1234567 * time.Microsecond, channel: "can1", fd: true},
+		{file: "b.trc", format: "trc", step: 1500 * time.Microsecond, channel: "can0",
+			setup: func(w Writer) { w.(*TRCWriter).Version = "1.1" }},
+		{file: "a.csv", format: "csv", step: 1234567 * time.Microsecond, channel: "can2"},
+		{file: "a.txt", format: "csv", step: time.Second, channel: "can0"},
+	} {
+		path := filepath.Join(t.TempDir(), tc.file)
+		name := tc.file
+		recs := testRecords(start, tc.step, tc.channel)
+		if tc.fd {
+			recs = withFD(recs, tc.step)
+		}
+		if tc.setup != nil {
+			// Version 1.1 offsets are in tenths of a millisecond.
+			for i := range recs {
+				recs[i].Time = start.Truncate(time.Millisecond).Add(time.Duration(i) * tc.step)
+			}
+		}
+
+		format := ""
+		if filepath.Ext(tc.file) == ".txt" {
+			format = tc.format
+		}
+		w, err := Create(path, format)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if w.Format.Name != tc.format {
+			t.Fatalf("%s: created as %s", name, w.Format.Name)
+		}
+		if tc.setup != nil {
+			tc.setup(w.Writer)
+		}
+		written := withError(recs)
+		if tc.errors {
+			recs = written
+		}
+		for _, rec := range written {
+			if err := w.Write(rec); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		r, err := Open(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if r.Format.Name != tc.format {
+			t.Fatalf("%s: detected as %s", name, r.Format.Name)
+		}
+		checkRecords(t, name, r, recs)
+		r.Close()
+	}
+}
+
+func TestReadSamples(t *testing.T) {
+	local := func(y int, mo time.Month, d, h, mi, s, us int) time.Time {
+		return time.Date(y, mo, d, h, mi, s, us*1000, time.Local)
+	}
+	fdSample := gocan.NewFDFrame(0x18FEF100, nil)
+	fdSample.Extended, fdSample.Length = true, 32
+	for i := range 32 {
+		fdSample.Data[i] = byte(i)
+	}
+	for _, tc := range []struct {
+		name   string
+		format string
+		log    string
+		want   []Record
+	}{
+		{"asc", "asc", `date Thu Apr 28 10:44:52.480 am 2022
+base hex  timestamps absolute
+internal events logged
+// version 9.0.0
+Begin Triggerblock Thu Apr 28 10:44:52.480 am 2022
+   0.000000 Start of measurement
+   0.015991 CAN 1 Status:chip status error active
+   1.015991 1  18EBFF00x       Rx   d 8 01 A0 0F A6 60 3B D1 40  Length = 273910 BitCount = 141 ID = 417070848x
+   1.015992 2  7E0             Tx   d 2 01 0C
+   1.015993 1  ErrorFrame
+   1.100000 2  7E8             Rx   r 4
+   1.200000 CANFD   1 Rx    18FEF100x  EngineData   1 0 d 32 00 01 02 03 04 05 06 07 08 09 0A 0B 0C 0D 0E 0F 10 11 12 13 14 15 16 17 18 19 1A 1B 1C 1D 1E 1F  130000  130  303000 b5ec 46500250 4b140250 20011736 2001040d
+   1.300000 CANFD   2 Tx         7E0                0 0 2  2 01 0C  0  0  0 0 0 0 0 0
+End TriggerBlock
+`, []Record{
+			{Time: local(2022, 4, 28, 10, 44, 53, 495991), Channel: "can0", Frame: gocan.NewExtendedFrame(0x18EBFF00, []byte{0x01, 0xA0, 0x0F, 0xA6, 0x60, 0x3B, 0xD1, 0x40})},
+			{Time: local(2022, 4, 28, 10, 44, 53, 495992), Channel: "can1", Frame: gocan.NewFrame(0x7E0, []byte{0x01, 0x0C}), Tx: true},
+			{Time: local(2022, 4, 28, 10, 44, 53, 495993), Channel: "can0", Error: true},
+			{Time: local(2022, 4, 28, 10, 44, 53, 580000), Channel: "can1", Frame: gocan.Frame{ID: 0x7E8, Remote: true, Length: 4}},
+			{Time: local(2022, 4, 28, 10, 44, 53, 680000), Channel: "can0", Frame: fdSample},
+			{Time: local(2022, 4, 28, 10, 44, 53, 780000), Channel: "can1", Frame: gocan.NewFrame(0x7E0, []byte{0x01, 0x0C}), Tx: true},
+		}},
+		{"asc dec relative", "asc", `date Thu Apr 28 22:44:52 2022
+base dec  timestamps relative
+   0.500000 1  291             Rx   d 2 1 255
+   0.250000 1  291             Rx   d 1 16
+`, []Record{
+			{Time: local(2022, 4, 28, 22, 44, 52, 500000), Channel: "can0", Frame: gocan.NewFrame(291, []byte{1, 255})},
+			{Time: local(2022, 4, 28, 22, 44, 52, 750000), Channel: "can0", Frame: gocan.NewFrame(291, []byte{16})},
+		}},
+		{"trc 1.1", "trc", `;$FILEVERSION=1.1
+;$STARTTIME=44424.5
+;
+;   Start time: 16.08.2021 12:00:00.000.0
+;   Message Number
+;   |         Time Offset (ms)
+;---+--   ----+----  --+--  ----+---  +  -+ -- -- -- -- -- -- --
+     1)      1841.0  Rx         0001  8  00 11 22 33 44 55 66 77
+     2)      1842.5  Tx     18EFC000  2  AA BB
+     3)      1843.0  Warng  00000000  4  00 00 00 04 BUSHEAVY
+     4)      1850.3  Rx         0100  4  RTR
+`, []Record{
+			{Time: local(2021, 8, 16, 12, 0, 1, 841000), Channel: "can0", Frame: gocan.NewFrame(0x001, []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77})},
+			{Time: local(2021, 8, 16, 12, 0, 1, 842500), Channel: "can0", Frame: gocan.NewExtendedFrame(0x18EFC000, []byte{0xAA, 0xBB}), Tx: true},
+			{Time: local(2021, 8, 16, 12, 0, 1, 850300), Channel: "can0", Frame: gocan.Frame{ID: 0x100, Remote: true, Length: 4}},
+		}},
+		{"trc 2.0", "trc", `;$FILEVERSION=2.0
+;$STARTTIME=44424.5
+;---+-- ------+------ +- --+----- +- +- +- -- -- -- -- -- -- -- --
+      1      1059.900 DT     0300 Rx 8  00 00 00 00 04 00 00 00
+      2      1283.231 ST          Rx    00 00 00 08
+      3      1300.000 RR     0301 Tx 2
+`, []Record{
+			{Time: local(2021, 8, 16, 12, 0, 1, 59900), Channel: "can0", Frame: gocan.NewFrame(0x300, []byte{0, 0, 0, 0, 4, 0, 0, 0})},
+			{Time: local(2021, 8, 16, 12, 0, 1, 300000), Channel: "can0", Frame: gocan.Frame{ID: 0x301, Remote: true, Length: 2}, Tx: true},
+		}},
+		{"trc 2.1", "trc", `;$FILEVERSION=2.1
+;$STARTTIME=44424.5
+;$COLUMNS=N,O,T,B,I,d,R,L,D
+;
+;---+-- ------+------ +- --+----- +- +- +- +- -- -- -- -- -- -- --
+      1      1059.900 DT  2 18FEF100 Rx -  3    01 02 03
+      2      1060.001 EV  1          Tx -  0
+      3      1061.000 FB  1     07E0 Tx -  9    01 02 03 04 05 06 07 08 09 00 00 00
+`, []Record{
+			{Time: local(2021, 8, 16, 12, 0, 1, 59900), Channel: "can1", Frame: gocan.NewExtendedFrame(0x18FEF100, []byte{1, 2, 3})},
+			{Time: local(2021, 8, 16, 12, 0, 1, 61000), Channel: "can0", Frame: gocan.NewFDFrame(0x7E0, []byte{1, 2, 3, 4, 5, 6, 7, 8, 9}), Tx: true},
+		}},
+		{"savvycan", "csv", `Time Stamp,ID,Extended,Dir,Bus,LEN,D1,D2,D3,D4,D5,D6,D7,D8
+166064000,0000021A,false,Rx,0,8,FE,36,12,FE,69,05,07,AD,
+166065000,18DAF110,true,Tx,1,2,02,10,
+`, []Record{
+			{Time: time.UnixMicro(166064000), Channel: "can0", Frame: gocan.NewFrame(0x21A, []byte{0xFE, 0x36, 0x12, 0xFE, 0x69, 0x05, 0x07, 0xAD})},
+			{Time: time.UnixMicro(166065000), Channel: "can1", Frame: gocan.NewExtendedFrame(0x18DAF110, []byte{0x02, 0x10}), Tx: true},
+		}},
+		{"gvret", "csv", `Time Stamp,ID,Extended,Bus,LEN,D1,D2,D3,D4,D5,D6,D7,D8
+1000,0x7E8,False,0,3,02,41,0C
+`, []Record{
+			{Time: time.UnixMicro(1000), Channel: "can0", Frame: gocan.NewFrame(0x7E8, []byte{0x02, 0x41, 0x0C})},
+		}},
+	} {
+		r, format, err := NewReader(strings.NewReader(tc.log))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if format.Name != tc.format {
+			t.Fatalf("%s: detected as %s", tc.name, format.Name)
+		}
+		checkRecords(t, tc.name, r, tc.want)
+	}
+}
+
+func TestFormatErrors(t *testing.T) {
+	if _, _, err := NewReader(strings.NewReader("hello\n")); err == nil {
+		t.Error("detected a format for garbage")
+	}
+	if _, err := Create(filepath.Join(t.TempDir(), "a.xyz"), ""); err == nil {
+		t.Error("created a log with an unknown extension")
+	}
+	for _, bad := range []string{
+		"date Thu Apr 28 10:44:52.480 am 2022\n 1.0 1 800 Rx d 1 00\n",
+		"date Thu Apr 28 10:44:52.480 am 2022\n 1.0 1 123 Rx d 4 00\n",
+		"date Thu Apr 28 10:44:52.480 am 2022\n 1.0 CANFD 1 Rx 123 1 0 9 12 00 11 22 33 44 55 66 77\n",
+		";$FILEVERSION=3.0\n 1 1.0 DT 1 0123 Rx - 1 00\n",
+		";$FILEVERSION=2.1\n 1 1.0 DT 1 0123 Rx - 2 00\n",
+		"Time Stamp,ID,Extended,Dir,Bus,LEN,D1\n1,123,false,Rx,0,9,00\n",
+	} {
+		r, _, err := NewReader(strings.NewReader(bad))
+		if err == nil {
+			_, err = r.Read()
+		}
+		if err == nil || err == io.EOF {
+			t.Errorf("accepted %q", bad)
+		}
+	}
+}
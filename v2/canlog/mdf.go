@@ -0,0 +1,1475 @@
+package canlog
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	gocan "github.com/roffe/gocan/v2"
+	"github.com/roffe/gocan/v2/dbc"
+)
+
+func init() {
+	RegisterFormat(Format{
+		Name:        "mdf",
+		Description: "ASAM MDF 4 measurement data (CANape, asammdf)",
+		Extensions:  []string{".mf4"},
+		Detect: func(head []byte) bool {
+			return len(head) > 8 && head[8] == '4' &&
+				(bytes.HasPrefix(head, mdfFileID) || bytes.HasPrefix(head, mdfUnfinishedID))
+		},
+		NewReader: func(r io.Reader) Reader { return NewMDFReader(r) },
+		NewWriter: func(w io.Writer) Writer { return NewMDFWriter(w) },
+	})
+}
+
+// MDF 4.1 layout. Every block starts with a 24 byte header (##XX, reserved,
+// length, link count) followed by its links, as file offsets, and its data.
+const (
+	mdfIDSize     = 64
+	mdfHeaderSize = 24
+	mdfVersion    = 410
+
+	// cn_type
+	mdfFixedLength = 0
+	mdfMaster      = 2
+
+	mdfSyncTime = 1 // cn_sync_type
+
+	// cn_data_type
+	mdfUintLE    = 0
+	mdfUintBE    = 1
+	mdfIntLE     = 2
+	mdfIntBE     = 3
+	mdfFloatLE   = 4
+	mdfFloatBE   = 5
+	mdfByteArray = 10
+
+	// cn_flags
+	mdfAllInvalid    = 1 << 0
+	mdfInvalBitValid = 1 << 1
+	mdfBusEvent      = 1 << 10
+
+	// cg_flags
+	mdfCGVLSD          = 1 << 0
+	mdfCGBusEvent      = 1 << 1
+	mdfCGPlainBusEvent = 1 << 2
+
+	// cc_type
+	mdfConvIdentity  = 0
+	mdfConvLinear    = 1
+	mdfConvValueText = 7
+
+	// si_type and si_bus_type
+	mdfSourceBus = 2
+	mdfBusCAN    = 2
+
+	// id_unfin_flags
+	mdfUnfinCycleCounts = 1 << 0
+	mdfUnfinDTLength    = 1 << 2
+
+	// mdfMaxBlock bounds the blocks the reader loads into memory; data in
+	// DT blocks is streamed.
+	mdfMaxBlock = 64 << 20
+)
+
+var (
+	mdfFileID       = []byte("MDF     ")
+	mdfUnfinishedID = []byte("UnFinMF ")
+)
+
+// mdfBusGroups are the bus event channel groups of the ASAM MDF bus logging
+// layout. They take record ids 1 to 4; signal groups follow. CAN FD frames
+// get a CAN_DataFrame group of their own so classic frames keep 8 byte
+// records.
+var mdfBusGroups = []struct {
+	name string
+	data int  // DataBytes length
+	fd   bool // records carry the EDL, BRS and ESI bits
+}{
+	{"CAN_DataFrame", 8, false},
+	{"CAN_RemoteFrame", 0, false},
+	{"CAN_ErrorFrame", 8, false},
+	{"CAN_DataFrame", gocan.MaxFDLength, true},
+}
+
+const (
+	mdfDataFrame = iota
+	mdfRemoteFrame
+	mdfErrorFrame
+	mdfFDDataFrame
+)
+
+// Byte offsets of the bus event fields in a record, after the record id.
+// The timestamp comes first.
+const (
+	mdfBusChannel    = 8
+	mdfBusID         = 9 // 29 bits, IDE in bit 31
+	mdfBusDLC        = 13
+	mdfBusDataLength = 14
+	mdfBusDir        = 15 // bit 0: 0 Rx, 1 Tx; bits 1-3: EDL, BRS, ESI
+	mdfBusData       = 16
+)
+
+// MDFChannel describes a signal channel of an MDF file.
+type MDFChannel struct {
+	Name    string
+	Unit    string
+	Comment string
+	// Factor and Offset convert stored values to physical ones:
+	// raw * Factor + Offset. A zero Factor means values are stored
+	// physical.
+	Factor, Offset float64
+	// Values names raw values, like a DBC value table.
+	Values map[int64]string
+}
+
+// Physical converts a stored value of the channel to its physical value.
+func (c MDFChannel) Physical(raw float64) float64 {
+	if c.Factor == 0 {
+		return raw
+	}
+	return raw*c.Factor + c.Offset
+}
+
+// SignalChannel describes a DBC signal as an MDF channel holding the
+// signal's raw values, with its scaling, unit, comment and value table.
+func SignalChannel(s *dbc.Signal) MDFChannel {
+	return MDFChannel{
+		Name:    s.Name,
+		Unit:    s.Unit,
+		Comment: s.Comment,
+		Factor:  s.Factor,
+		Offset:  s.Offset,
+		Values:  s.Values,
+	}
+}
+
+// signalRaw returns the raw value of a decoded signal as MDF stores it.
+func signalRaw(v dbc.Value) float64 {
+	s := v.Signal
+	switch s.Type {
+	case dbc.Float32:
+		return float64(math.Float32frombits(uint32(v.Raw)))
+	case dbc.Float64:
+		return math.Float64frombits(v.Raw)
+	}
+	if !s.Signed {
+		return float64(v.Raw)
+	}
+	if s.Length < 64 && v.Raw&(1<<(s.Length-1)) != 0 {
+		return float64(int64(v.Raw | ^uint64(0)<<s.Length))
+	}
+	return float64(int64(v.Raw))
+}
+
+// MDFGroup is a group of signal channels sampled together, such as the
+// signals of one DBC message or one round of diagnostic polling.
+type MDFGroup struct {
+	Name     string
+	Channels []MDFChannel
+
+	w     *MDFWriter
+	id    int // index in w.cgs
+	index map[string]int
+}
+
+// Write writes one sample of the group, a stored value per channel in
+// channel order. NaN marks a value as invalid.
+func (g *MDFGroup) Write(t time.Time, raw ...float64) error {
+	mw := g.w
+	if mw == nil {
+		return fmt.Errorf("mdf: group %s is not being written", g.Name)
+	}
+	if len(raw) != len(g.Channels) {
+		return fmt.Errorf("mdf: %s: %d values for %d channels", g.Name, len(raw), len(g.Channels))
+	}
+	if mw.start.IsZero() {
+		if err := mw.begin(t); err != nil {
+			return err
+		}
+	}
+	n := len(raw)
+	rec := mw.record(g.id, t, 8+8*n+(n+7)/8)
+	for i, v := range raw {
+		binary.LittleEndian.PutUint64(rec[1+8+8*i:], math.Float64bits(v))
+		if math.IsNaN(v) {
+			rec[1+8+8*n+i/8] |= 1 << (i % 8)
+		}
+	}
+	return mw.emit(g.id, rec)
+}
+
+// WriteDecoded writes the signals of a decoded frame of the group's DBC
+// message. Signals the frame did not carry, like those of other multiplexer
+// pages, are stored invalid.
+func (g *MDFGroup) WriteDecoded(t time.Time, d dbc.Decoded) error {
+	raw := make([]float64, len(g.Channels))
+	for i := range raw {
+		raw[i] = math.NaN()
+	}
+	for _, v := range d.Values {
+		if i, ok := g.index[v.Signal.Name]; ok {
+			raw[i] = signalRaw(v)
+		}
+	}
+	return g.Write(t, raw...)
+}
+
+// MDFWriter writes ASAM MDF 4.1 files. Frames go into CAN_DataFrame,
+// CAN_RemoteFrame and CAN_ErrorFrame channel groups in the ASAM bus logging
+// layout, which MDF tools decode with a DBC; signal groups added with
+// AddGroup or AddMessage hold values that are already decoded.
+//
+// All groups share one data block, appended to as records come in. The
+// block length and record counts are only known at the end: when the
+// underlying writer can seek (an *os.File), Close fills them in; otherwise
+// the file is left marked unfinalized, which MDF tools know to repair.
+type MDFWriter struct {
+	w      *bufio.Writer
+	seeker io.WriteSeeker
+	base   int64 // offset of the file in seeker
+	groups []*MDFGroup
+	start  time.Time
+	dt     int64    // offset of the DT block
+	cgs    []int64  // offsets of the channel group blocks, by record id - 1
+	counts []uint64 // records written, by record id - 1
+	size   int64    // record bytes written
+	rec    []byte
+}
+
+// NewMDFWriter writes an MDF file to w. Add signal groups before the first
+// record and call Close when done.
+func NewMDFWriter(w io.Writer) *MDFWriter {
+	mw := &MDFWriter{w: bufio.NewWriter(w)}
+	if s, ok := w.(io.WriteSeeker); ok {
+		if pos, err := s.Seek(0, io.SeekCurrent); err == nil {
+			mw.seeker, mw.base = s, pos
+		}
+	}
+	return mw
+}
+
+// AddGroup adds a signal group to the file. Groups must be added before the
+// first record is written.
+func (mw *MDFWriter) AddGroup(name string, channels ...MDFChannel) (*MDFGroup, error) {
+	if !mw.start.IsZero() {
+		return nil, errors.New("mdf: groups must be added before the first record")
+	}
+	if len(channels) == 0 {
+		return nil, fmt.Errorf("mdf: group %s has no channels", name)
+	}
+	id := len(mdfBusGroups) + len(mw.groups)
+	if id >= math.MaxUint8 {
+		return nil, errors.New("mdf: too many groups")
+	}
+	g := &MDFGroup{Name: name, Channels: channels, w: mw, id: id, index: make(map[string]int)}
+	for i, c := range channels {
+		g.index[c.Name] = i
+	}
+	mw.groups = append(mw.groups, g)
+	return g, nil
+}
+
+// AddMessage adds a signal group for a DBC message, with a channel per
+// signal. Write decoded frames to it with WriteDecoded.
+func (mw *MDFWriter) AddMessage(m *dbc.Message) (*MDFGroup, error) {
+	channels := make([]MDFChannel, len(m.Signals))
+	for i, s := range m.Signals {
+		channels[i] = SignalChannel(s)
+	}
+	return mw.AddGroup(m.Name, channels...)
+}
+
+func mdfIdentification(unfinished uint16) []byte {
+	b := make([]byte, mdfIDSize)
+	if unfinished != 0 {
+		copy(b, mdfUnfinishedID)
+	} else {
+		copy(b, mdfFileID)
+	}
+	copy(b[8:], "4.10    ")
+	copy(b[16:], "gocan   ")
+	binary.LittleEndian.PutUint16(b[28:], mdfVersion)
+	binary.LittleEndian.PutUint16(b[60:], unfinished)
+	return b
+}
+
+// begin writes everything up to the data block.
+func (mw *MDFWriter) begin(start time.Time) error {
+	mw.start = start
+	m := mdfBlocks{b: mdfIdentification(mdfUnfinCycleCounts | mdfUnfinDTLength)}
+
+	hd := m.add("HD", 6, make([]byte, 32))
+	binary.LittleEndian.PutUint64(m.data(hd, 6), uint64(start.UnixNano()))
+	fh := m.add("FH", 2, make([]byte, 16))
+	binary.LittleEndian.PutUint64(m.data(fh, 2), uint64(start.UnixNano()))
+	m.link(hd, 1, fh)
+	m.link(fh, 1, m.add("MD", 0, []byte("<FHcomment><TX>Recorded with gocan</TX><tool_id>gocan</tool_id>"+
+		"<tool_vendor>gocan</tool_vendor><tool_version>2</tool_version></FHcomment>\x00")))
+
+	dg := m.add("DG", 4, []byte{1, 0, 0, 0, 0, 0, 0, 0}) // 1 byte record ids
+	m.link(hd, 0, dg)
+	si := m.add("SI", 3, []byte{mdfSourceBus, mdfBusCAN, 0, 0, 0, 0, 0, 0})
+	m.link(si, 0, m.text("CAN"))
+	dir := m.conversion(MDFChannel{Values: map[int64]string{0: "Rx", 1: "Tx"}})
+
+	mw.cgs = mw.cgs[:0]
+	for i, g := range mdfBusGroups {
+		mw.cgs = append(mw.cgs, m.busGroup(uint64(i+1), g.name, g.data, g.fd, si, dir))
+	}
+	for _, g := range mw.groups {
+		mw.cgs = append(mw.cgs, m.signalGroup(uint64(g.id+1), g))
+	}
+	m.chain(dg, 1, mw.cgs)
+	mw.counts = make([]uint64, len(mw.cgs))
+
+	mw.dt = int64(len(m.b))
+	m.link(dg, 2, mw.dt)
+	m.add("DT", 0, nil)
+	_, err := mw.w.Write(m.b)
+	return err
+}
+
+// record returns a zeroed record of group i, with its record id and
+// timestamp filled in.
+func (mw *MDFWriter) record(i int, t time.Time, size int) []byte {
+	mw.rec = slices.Grow(mw.rec[:0], 1+size)[:1+size]
+	clear(mw.rec)
+	mw.rec[0] = byte(i + 1)
+	binary.LittleEndian.PutUint64(mw.rec[1:], math.Float64bits(t.Sub(mw.start).Seconds()))
+	return mw.rec
+}
+
+func (mw *MDFWriter) emit(i int, rec []byte) error {
+	mw.counts[i]++
+	mw.size += int64(len(rec))
+	_, err := mw.w.Write(rec)
+	return err
+}
+
+// Write writes one frame.
+func (mw *MDFWriter) Write(r Record) error {
+	if mw.start.IsZero() {
+		if err := mw.begin(r.Time); err != nil {
+			return err
+		}
+	}
+	f := r.Frame
+	g := mdfDataFrame
+	switch {
+	case r.Error:
+		g = mdfErrorFrame
+	case f.Remote:
+		g = mdfRemoteFrame
+	case f.FD:
+		g = mdfFDDataFrame
+	}
+	size := mdfBusData + mdfBusGroups[g].data
+	rec := mw.record(g, r.Time, size)
+	b := rec[1:]
+	b[mdfBusChannel] = byte(channelIndex(r.Channel) + 1)
+	id := f.ID & 0x1FFFFFFF
+	if f.Extended {
+		id |= 1 << 31
+	}
+	binary.LittleEndian.PutUint32(b[mdfBusID:], id)
+	b[mdfBusDLC] = f.DLC()
+	if r.Tx {
+		b[mdfBusDir] = 1
+	}
+	if g == mdfFDDataFrame {
+		b[mdfBusDir] |= 1 << 1
+		if f.BRS {
+			b[mdfBusDir] |= 1 << 2
+		}
+		if f.ESI {
+			b[mdfBusDir] |= 1 << 3
+		}
+	}
+	if g != mdfRemoteFrame {
+		b[mdfBusDataLength] = f.Length
+		copy(b[mdfBusData:], f.Bytes())
+	}
+	return mw.emit(g, rec)
+}
+
+// Flush writes buffered records to the underlying writer.
+func (mw *MDFWriter) Flush() error {
+	return mw.w.Flush()
+}
+
+// Close flushes and, if the underlying writer can seek, finalizes the file.
+func (mw *MDFWriter) Close() error {
+	if mw.start.IsZero() {
+		if err := mw.begin(time.Now()); err != nil {
+			return err
+		}
+	}
+	if err := mw.w.Flush(); err != nil {
+		return err
+	}
+	if mw.seeker == nil {
+		return nil
+	}
+	end, err := mw.seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	patch := func(off int64, b []byte) error {
+		if _, err := mw.seeker.Seek(mw.base+off, io.SeekStart); err != nil {
+			return err
+		}
+		_, err := mw.seeker.Write(b)
+		return err
+	}
+	le := binary.LittleEndian
+	if err := patch(mw.dt+8, le.AppendUint64(nil, uint64(mdfHeaderSize+mw.size))); err != nil {
+		return err
+	}
+	for i, cg := range mw.cgs {
+		// cg_cycle_count follows the six links and cg_record_id.
+		if err := patch(cg+mdfHeaderSize+6*8+8, le.AppendUint64(nil, mw.counts[i])); err != nil {
+			return err
+		}
+	}
+	// The identification goes last, so a failed Close leaves the file
+	// marked unfinalized.
+	if err := patch(0, mdfIdentification(0)); err != nil {
+		return err
+	}
+	_, err = mw.seeker.Seek(end, io.SeekStart)
+	return err
+}
+
+// mdfBlocks lays out metadata blocks in memory, from the start of the file.
+type mdfBlocks struct {
+	b []byte
+}
+
+// add appends a block with links zeroed and returns its offset.
+func (m *mdfBlocks) add(id string, links int, data []byte) int64 {
+	off := int64(len(m.b))
+	n := mdfHeaderSize + 8*links + len(data)
+	m.b = append(m.b, "##"+id+"\x00\x00\x00\x00"...)
+	m.b = binary.LittleEndian.AppendUint64(m.b, uint64(n))
+	m.b = binary.LittleEndian.AppendUint64(m.b, uint64(links))
+	m.b = append(m.b, make([]byte, 8*links)...)
+	m.b = append(m.b, data...)
+	m.b = append(m.b, make([]byte, -n&7)...) // blocks are 8 byte aligned
+	return off
+}
+
+// link sets link i of block to the block at offset to.
+func (m *mdfBlocks) link(block int64, i int, to int64) {
+	binary.LittleEndian.PutUint64(m.b[block+mdfHeaderSize+8*int64(i):], uint64(to))
+}
+
+// data returns the data of a block with the given number of links.
+func (m *mdfBlocks) data(block int64, links int) []byte {
+	return m.b[block+mdfHeaderSize+8*int64(links):]
+}
+
+// chain links blocks[0] from link i of parent, and each block to the next
+// through its first link.
+func (m *mdfBlocks) chain(parent int64, i int, blocks []int64) {
+	for _, b := range blocks {
+		m.link(parent, i, b)
+		parent, i = b, 0
+	}
+}
+
+// text adds a TX block holding s; "" needs none.
+func (m *mdfBlocks) text(s string) int64 {
+	if s == "" {
+		return 0
+	}
+	return m.add("TX", 0, append([]byte(s), 0))
+}
+
+func (m *mdfBlocks) cc(typ uint8, vals []float64, refs []int64) int64 {
+	d := make([]byte, 24, 24+8*len(vals))
+	d[0] = typ
+	binary.LittleEndian.PutUint16(d[4:], uint16(len(refs)))
+	binary.LittleEndian.PutUint16(d[6:], uint16(len(vals)))
+	for _, v := range vals {
+		d = binary.LittleEndian.AppendUint64(d, math.Float64bits(v))
+	}
+	cc := m.add("CC", 4+len(refs), d)
+	for i, r := range refs {
+		m.link(cc, 4+i, r)
+	}
+	return cc
+}
+
+// conversion adds the conversion of c: linear, value to text with linear
+// as the default, or none.
+func (m *mdfBlocks) conversion(c MDFChannel) int64 {
+	var linear int64
+	if c.Factor != 0 {
+		linear = m.cc(mdfConvLinear, []float64{c.Offset, c.Factor}, nil)
+	}
+	if len(c.Values) == 0 {
+		return linear
+	}
+	keys := slices.Sorted(maps.Keys(c.Values))
+	vals := make([]float64, len(keys))
+	refs := make([]int64, len(keys)+1)
+	for i, k := range keys {
+		vals[i], refs[i] = float64(k), m.text(c.Values[k])
+	}
+	refs[len(keys)] = linear
+	return m.cc(mdfConvValueText, vals, refs)
+}
+
+// mdfChannel is a CN block: where a channel's values sit in a record.
+type mdfChannel struct {
+	MDFChannel
+	typ, sync, dataType, bitOff uint8
+	byteOff, bits, flags        uint32
+	invalPos                    uint32
+	conv                        int64 // CC block, when read
+}
+
+func (m *mdfBlocks) channel(c mdfChannel) int64 {
+	d := make([]byte, 72)
+	d[0], d[1], d[2], d[3] = c.typ, c.sync, c.dataType, c.bitOff
+	binary.LittleEndian.PutUint32(d[4:], c.byteOff)
+	binary.LittleEndian.PutUint32(d[8:], c.bits)
+	binary.LittleEndian.PutUint32(d[12:], c.flags)
+	binary.LittleEndian.PutUint32(d[16:], c.invalPos)
+	cn := m.add("CN", 8, d)
+	m.link(cn, 2, m.text(c.Name))
+	m.link(cn, 4, m.conversion(c.MDFChannel))
+	m.link(cn, 6, m.text(c.Unit))
+	m.link(cn, 7, m.text(c.Comment))
+	return cn
+}
+
+func (m *mdfBlocks) channelGroup(id uint64, name string, flags uint16, dataBytes, invalBytes int) int64 {
+	d := make([]byte, 32)
+	binary.LittleEndian.PutUint64(d, id)
+	binary.LittleEndian.PutUint16(d[16:], flags)
+	binary.LittleEndian.PutUint16(d[18:], '.') // cg_path_separator
+	binary.LittleEndian.PutUint32(d[24:], uint32(dataBytes))
+	binary.LittleEndian.PutUint32(d[28:], uint32(invalBytes))
+	cg := m.add("CG", 6, d)
+	m.link(cg, 2, m.text(name))
+	return cg
+}
+
+func (m *mdfBlocks) timeChannel(name string) int64 {
+	return m.channel(mdfChannel{
+		MDFChannel: MDFChannel{Name: name, Unit: "s"},
+		typ:        mdfMaster, sync: mdfSyncTime, dataType: mdfFloatLE, bits: 64,
+	})
+}
+
+// busGroup adds a bus event channel group: a timestamp and a structure
+// channel whose members are the frame fields.
+func (m *mdfBlocks) busGroup(id uint64, name string, data int, fd bool, si, dir int64) int64 {
+	size := mdfBusData + data
+	cg := m.channelGroup(id, name, mdfCGBusEvent|mdfCGPlainBusEvent, size, 0)
+	m.link(cg, 3, si)
+	field := func(f string, byteOff uint32, bitOff uint8, bits uint32) int64 {
+		return m.channel(mdfChannel{
+			MDFChannel: MDFChannel{Name: name + "." + f},
+			dataType:   mdfUintLE, byteOff: byteOff, bitOff: bitOff, bits: bits,
+		})
+	}
+	fields := []int64{
+		field("BusChannel", mdfBusChannel, 0, 8),
+		field("ID", mdfBusID, 0, 29),
+		field("IDE", mdfBusID+3, 7, 1),
+		field("DLC", mdfBusDLC, 0, 4),
+		field("DataLength", mdfBusDataLength, 0, 8),
+		field("Dir", mdfBusDir, 0, 1),
+	}
+	m.link(fields[5], 4, dir)
+	if fd {
+		fields = append(fields,
+			field("EDL", mdfBusDir, 1, 1),
+			field("BRS", mdfBusDir, 2, 1),
+			field("ESI", mdfBusDir, 3, 1))
+	}
+	if data > 0 {
+		fields = append(fields, m.channel(mdfChannel{
+			MDFChannel: MDFChannel{Name: name + ".DataBytes"},
+			dataType:   mdfByteArray, byteOff: mdfBusData, bits: uint32(data) * 8,
+		}))
+	}
+	frame := m.channel(mdfChannel{
+		MDFChannel: MDFChannel{Name: name},
+		dataType:   mdfByteArray, byteOff: mdfBusChannel, bits: uint32(size-mdfBusChannel) * 8, flags: mdfBusEvent,
+	})
+	m.chain(frame, 1, fields)
+	m.chain(cg, 1, []int64{m.timeChannel("Timestamp"), frame})
+	return cg
+}
+
+// signalGroup adds a channel group of float64 values, followed by their
+// invalidation bits.
+func (m *mdfBlocks) signalGroup(id uint64, g *MDFGroup) int64 {
+	n := len(g.Channels)
+	cg := m.channelGroup(id, g.Name, 0, 8+8*n, (n+7)/8)
+	cns := []int64{m.timeChannel("t")}
+	for i, c := range g.Channels {
+		cns = append(cns, m.channel(mdfChannel{
+			MDFChannel: c,
+			dataType:   mdfFloatLE, byteOff: uint32(8 + 8*i), bits: 64,
+			flags: mdfInvalBitValid, invalPos: uint32(i),
+		}))
+	}
+	m.chain(cg, 1, cns)
+	return cg
+}
+
+// MDFSample is one record of a signal group.
+type MDFSample struct {
+	Group *MDFGroup
+	Time  time.Time
+	// Raw holds the stored value of each of the group's channels, NaN
+	// where the value is invalid.
+	Raw []float64
+}
+
+// Value returns the physical value of the named channel; ok is false when
+// the group has no such channel or its value is invalid.
+func (s MDFSample) Value(name string) (v float64, ok bool) {
+	for i, c := range s.Group.Channels {
+		if c.Name == name && !math.IsNaN(s.Raw[i]) {
+			return c.Physical(s.Raw[i]), true
+		}
+	}
+	return 0, false
+}
+
+// MDFReader reads ASAM MDF 4 files. Read returns the frames of
+// CAN_DataFrame, CAN_RemoteFrame and CAN_ErrorFrame channel groups; the
+// other channel groups are signal groups, listed by Groups and read with
+// ReadSample. Records of different data groups are merged by time.
+//
+// Data may be in DT blocks, DL lists or deflate-compressed DZ blocks, and
+// files left unfinalized are read up to their last complete record.
+// Variable length (VLSD) channels are skipped.
+//
+// MDF blocks link to each other by file offset, so the file is read into
+// memory unless r is an io.ReaderAt that can also seek, like an *os.File.
+type MDFReader struct {
+	r          io.Reader
+	loaded     bool
+	err        error
+	ra         io.ReaderAt
+	size       int64
+	unfinished uint16
+	start      time.Time
+	groups     []*MDFGroup
+	frames     []*mdfCursor
+	samples    []*mdfCursor
+}
+
+// NewMDFReader reads an MDF file from r.
+func NewMDFReader(r io.Reader) *MDFReader {
+	return &MDFReader{r: r}
+}
+
+// Groups returns the signal groups of the file.
+func (mr *MDFReader) Groups() ([]*MDFGroup, error) {
+	if err := mr.load(); err != nil {
+		return nil, err
+	}
+	return mr.groups, nil
+}
+
+// Read returns the next frame, or io.EOF at the end of the file.
+func (mr *MDFReader) Read() (Record, error) {
+	if err := mr.load(); err != nil {
+		return Record{}, err
+	}
+	c, err := mr.next(mr.frames)
+	if err != nil {
+		return Record{}, err
+	}
+	r, err := c.cg.frame(c.rec)
+	if err != nil {
+		return Record{}, fmt.Errorf("mdf: %w", err)
+	}
+	r.Time = c.t
+	c.cg = nil
+	return r, nil
+}
+
+// ReadSample returns the next sample of any signal group, or io.EOF at the
+// end of the file.
+func (mr *MDFReader) ReadSample() (MDFSample, error) {
+	if err := mr.load(); err != nil {
+		return MDFSample{}, err
+	}
+	c, err := mr.next(mr.samples)
+	if err != nil {
+		return MDFSample{}, err
+	}
+	s := MDFSample{Group: c.cg.group, Time: c.t, Raw: make([]float64, len(c.cg.channels))}
+	for i, ch := range c.cg.channels {
+		s.Raw[i] = math.NaN()
+		if c.cg.valid(ch, c.rec) {
+			if v, ok := ch.value(c.rec); ok {
+				s.Raw[i] = v
+			}
+		}
+	}
+	c.cg = nil
+	return s, nil
+}
+
+// next returns the cursor holding the earliest pending record.
+func (mr *MDFReader) next(cursors []*mdfCursor) (*mdfCursor, error) {
+	var best *mdfCursor
+	for _, c := range cursors {
+		if c.cg == nil && !c.done {
+			if err := c.advance(); err == io.EOF {
+				c.done = true
+			} else if err != nil {
+				return nil, fmt.Errorf("mdf: %w", err)
+			}
+		}
+		if c.cg != nil && (best == nil || c.t.Before(best.t)) {
+			best = c
+		}
+	}
+	if best == nil {
+		return nil, io.EOF
+	}
+	return best, nil
+}
+
+func (mr *MDFReader) load() error {
+	if !mr.loaded {
+		mr.loaded = true
+		if err := mr.parse(); err != nil {
+			mr.err = fmt.Errorf("mdf: %w", err)
+		}
+	}
+	return mr.err
+}
+
+func (mr *MDFReader) parse() error {
+	if ra, ok := mr.r.(interface {
+		io.ReaderAt
+		io.Seeker
+	}); ok {
+		size, err := ra.Seek(0, io.SeekEnd)
+		if err != nil {
+			return err
+		}
+		mr.ra, mr.size = ra, size
+	} else {
+		b, err := io.ReadAll(mr.r)
+		if err != nil {
+			return err
+		}
+		mr.ra, mr.size = bytes.NewReader(b), int64(len(b))
+	}
+
+	id := make([]byte, mdfIDSize)
+	if _, err := mr.ra.ReadAt(id, 0); err != nil {
+		return errors.New("not an MDF file")
+	}
+	switch {
+	case bytes.HasPrefix(id, mdfFileID):
+	case bytes.HasPrefix(id, mdfUnfinishedID):
+		mr.unfinished = binary.LittleEndian.Uint16(id[60:])
+	default:
+		return errors.New("not an MDF file")
+	}
+	if v := binary.LittleEndian.Uint16(id[28:]); v < 400 {
+		return fmt.Errorf("version %d not supported", v)
+	}
+
+	hd, err := mr.block(mdfIDSize, "HD")
+	if err != nil {
+		return err
+	}
+	if len(hd.data) < 32 {
+		return errors.New("short HD block")
+	}
+	mr.start = time.Unix(0, int64(binary.LittleEndian.Uint64(hd.data)))
+	if hd.data[12]&1 != 0 { // local time, without a zone
+		t := mr.start.UTC()
+		mr.start = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.Local)
+	}
+	return mr.walk(hd.link(0), "DG", mr.dataGroup)
+}
+
+// mdfBlock is a block with its links and data.
+type mdfBlock struct {
+	id     string
+	off    int64
+	length int64
+	links  []int64
+	data   []byte
+}
+
+func (b *mdfBlock) link(i int) int64 {
+	if i < len(b.links) {
+		return b.links[i]
+	}
+	return 0
+}
+
+// header reads a block's header and links.
+func (mr *MDFReader) header(off int64) (*mdfBlock, error) {
+	var h [mdfHeaderSize]byte
+	if _, err := mr.ra.ReadAt(h[:], off); err != nil || off%8 != 0 || !bytes.HasPrefix(h[:], []byte("##")) {
+		return nil, fmt.Errorf("no block at %#x", off)
+	}
+	b := &mdfBlock{id: string(h[2:4]), off: off}
+	length := binary.LittleEndian.Uint64(h[8:])
+	links := binary.LittleEndian.Uint64(h[16:])
+	if length < mdfHeaderSize || length > uint64(mr.size-off) || links > (length-mdfHeaderSize)/8 {
+		return nil, fmt.Errorf("malformed %s block at %#x", b.id, off)
+	}
+	b.length = int64(length)
+	lb := make([]byte, 8*links)
+	if _, err := mr.ra.ReadAt(lb, off+mdfHeaderSize); err != nil {
+		return nil, err
+	}
+	for i := range int(links) {
+		b.links = append(b.links, int64(binary.LittleEndian.Uint64(lb[8*i:])))
+	}
+	return b, nil
+}
+
+// block reads a whole block, checking it is of type id unless id is "".
+func (mr *MDFReader) block(off int64, id string) (*mdfBlock, error) {
+	b, err := mr.header(off)
+	if err != nil {
+		return nil, err
+	}
+	if id != "" && b.id != id {
+		return nil, fmt.Errorf("block at %#x is %s, want %s", off, b.id, id)
+	}
+	start := int64(mdfHeaderSize + 8*len(b.links))
+	if b.length-start > mdfMaxBlock {
+		return nil, fmt.Errorf("%s block at %#x too large", b.id, off)
+	}
+	b.data = make([]byte, b.length-start)
+	if _, err := mr.ra.ReadAt(b.data, off+start); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// walk calls fn for each block of a list linked through the blocks' first
+// link.
+func (mr *MDFReader) walk(off int64, id string, fn func(*mdfBlock) error) error {
+	seen := make(map[int64]bool)
+	for off != 0 {
+		if seen[off] {
+			return fmt.Errorf("%s list loops at %#x", id, off)
+		}
+		seen[off] = true
+		b, err := mr.block(off, id)
+		if err != nil {
+			return err
+		}
+		if err := fn(b); err != nil {
+			return err
+		}
+		off = b.link(0)
+	}
+	return nil
+}
+
+// text returns the text of a TX block, or the TX element of an MD block.
+func (mr *MDFReader) text(off int64) (string, error) {
+	if off == 0 {
+		return "", nil
+	}
+	b, err := mr.block(off, "")
+	if err != nil {
+		return "", err
+	}
+	s, _, _ := strings.Cut(string(b.data), "\x00")
+	switch b.id {
+	case "TX":
+		return s, nil
+	case "MD":
+		return mdfXMLText(s), nil
+	}
+	return "", fmt.Errorf("block at %#x is %s, want TX or MD", off, b.id)
+}
+
+func mdfXMLText(s string) string {
+	d := xml.NewDecoder(strings.NewReader(s))
+	var text []byte
+	in := false
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return string(text)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			in = t.Name.Local == "TX"
+		case xml.EndElement:
+			if in {
+				return string(text)
+			}
+		case xml.CharData:
+			if in {
+				text = append(text, t...)
+			}
+		}
+	}
+}
+
+// conversion reads the conversion at off into c.
+func (mr *MDFReader) conversion(off int64, c *MDFChannel) error {
+	if off == 0 {
+		return nil
+	}
+	b, err := mr.block(off, "CC")
+	if err != nil {
+		return err
+	}
+	if len(b.data) < 24 {
+		return fmt.Errorf("short CC block at %#x", off)
+	}
+	nvals := int(binary.LittleEndian.Uint16(b.data[6:]))
+	if len(b.data) < 24+8*nvals {
+		return fmt.Errorf("short CC block at %#x", off)
+	}
+	vals := make([]float64, nvals)
+	for i := range vals {
+		vals[i] = math.Float64frombits(binary.LittleEndian.Uint64(b.data[24+8*i:]))
+	}
+	refs := b.links[min(4, len(b.links)):]
+	switch typ := b.data[0]; {
+	case typ == mdfConvIdentity:
+	case typ == mdfConvLinear && nvals == 2:
+		c.Offset, c.Factor = vals[0], vals[1]
+	case typ == mdfConvValueText && len(refs) == nvals+1:
+		c.Values = make(map[int64]string)
+		for i, v := range vals {
+			if c.Values[int64(v)], err = mr.text(refs[i]); err != nil {
+				return err
+			}
+		}
+		if def := refs[nvals]; def != 0 {
+			if h, err := mr.header(def); err == nil && h.id == "CC" {
+				return mr.conversion(def, c)
+			}
+		}
+	default:
+		return fmt.Errorf("channel %s: conversion type %d not supported", c.Name, typ)
+	}
+	return nil
+}
+
+// mdfDataGroup is a data block and the channel groups with records in it.
+type mdfDataGroup struct {
+	recIDSize int
+	groups    map[uint64]*mdfChannelGroup
+	data      int64
+}
+
+// mdfChannelGroup is a channel group: a record layout.
+type mdfChannelGroup struct {
+	size      int // record bytes after the record id
+	dataBytes int
+	vlsd      bool
+	master    *mdfChannel
+	bus       int                    // index in mdfBusGroups, -1 for signal groups
+	fields    map[string]*mdfChannel // bus event fields
+	channels  []*mdfChannel          // signal group channels
+	group     *MDFGroup
+}
+
+func (mr *MDFReader) dataGroup(b *mdfBlock) error {
+	if len(b.data) < 1 {
+		return errors.New("short DG block")
+	}
+	dg := &mdfDataGroup{recIDSize: int(b.data[0]), groups: make(map[uint64]*mdfChannelGroup), data: b.link(2)}
+	switch dg.recIDSize {
+	case 0, 1, 2, 4, 8:
+	default:
+		return fmt.Errorf("DG block at %#x: record id size %d", b.off, dg.recIDSize)
+	}
+	var bus, signals bool
+	err := mr.walk(b.link(1), "CG", func(b *mdfBlock) error {
+		cg, id, err := mr.channelGroup(b)
+		if err != nil {
+			return err
+		}
+		if dg.recIDSize == 0 && len(dg.groups) > 0 {
+			return fmt.Errorf("DG block at %#x: several groups without record ids", b.off)
+		}
+		dg.groups[id] = cg
+		switch {
+		case cg.vlsd:
+		case cg.bus >= 0:
+			bus = true
+		case len(cg.channels) > 0:
+			signals = true
+			mr.groups = append(mr.groups, cg.group)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if bus {
+		mr.frames = append(mr.frames, &mdfCursor{mr: mr, dg: dg, want: func(cg *mdfChannelGroup) bool { return cg.bus >= 0 }})
+	}
+	if signals {
+		mr.samples = append(mr.samples, &mdfCursor{mr: mr, dg: dg, want: func(cg *mdfChannelGroup) bool { return cg.group != nil }})
+	}
+	return nil
+}
+
+func (mr *MDFReader) channelGroup(b *mdfBlock) (*mdfChannelGroup, uint64, error) {
+	if len(b.data) < 32 {
+		return nil, 0, fmt.Errorf("short CG block at %#x", b.off)
+	}
+	d := b.data
+	id := binary.LittleEndian.Uint64(d)
+	flags := binary.LittleEndian.Uint16(d[16:])
+	dataBytes := int(binary.LittleEndian.Uint32(d[24:]))
+	cg := &mdfChannelGroup{
+		size:      dataBytes + int(binary.LittleEndian.Uint32(d[28:])),
+		dataBytes: dataBytes,
+		vlsd:      flags&mdfCGVLSD != 0,
+		bus:       -1,
+	}
+	if cg.vlsd {
+		return cg, id, nil
+	}
+	name, err := mr.text(b.link(2))
+	if err != nil {
+		return nil, 0, err
+	}
+	group := &MDFGroup{Name: name}
+	err = mr.walk(b.link(1), "CN", func(b *mdfBlock) error {
+		c, err := mr.channel(b)
+		if err != nil {
+			return err
+		}
+		base := c.Name[strings.LastIndexByte(c.Name, '.')+1:]
+		switch {
+		case c.typ == mdfMaster:
+			cg.master = c
+		case b.link(1) != 0:
+			for i, g := range mdfBusGroups {
+				if g.name == base {
+					cg.bus = i
+					cg.fields = make(map[string]*mdfChannel)
+					return mr.walk(b.link(1), "CN", func(b *mdfBlock) error {
+						f, err := mr.channel(b)
+						if err != nil {
+							return err
+						}
+						cg.fields[f.Name[strings.LastIndexByte(f.Name, '.')+1:]] = f
+						return nil
+					})
+				}
+			}
+		case c.typ == mdfFixedLength && c.dataType <= mdfFloatBE:
+			cg.channels = append(cg.channels, c)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	if cg.bus >= 0 {
+		if f := cg.fields["DataBytes"]; f != nil && f.typ != mdfFixedLength {
+			return nil, 0, fmt.Errorf("%s: variable length data bytes not supported", mdfBusGroups[cg.bus].name)
+		}
+	} else if len(cg.channels) > 0 {
+		for _, c := range cg.channels {
+			if err := mr.conversion(c.conv, &c.MDFChannel); err != nil {
+				return nil, 0, err
+			}
+			group.Channels = append(group.Channels, c.MDFChannel)
+		}
+		cg.group = group
+	}
+	if cg.master != nil {
+		if err := mr.conversion(cg.master.conv, &cg.master.MDFChannel); err != nil {
+			return nil, 0, err
+		}
+	}
+	return cg, id, nil
+}
+
+func (mr *MDFReader) channel(b *mdfBlock) (*mdfChannel, error) {
+	d := b.data
+	if len(d) < 20 {
+		return nil, fmt.Errorf("short CN block at %#x", b.off)
+	}
+	c := &mdfChannel{
+		typ:      d[0],
+		sync:     d[1],
+		dataType: d[2],
+		bitOff:   d[3],
+		byteOff:  binary.LittleEndian.Uint32(d[4:]),
+		bits:     binary.LittleEndian.Uint32(d[8:]),
+		flags:    binary.LittleEndian.Uint32(d[12:]),
+		invalPos: binary.LittleEndian.Uint32(d[16:]),
+		conv:     b.link(4),
+	}
+	var err error
+	if c.Name, err = mr.text(b.link(2)); err != nil {
+		return nil, err
+	}
+	if c.Unit, err = mr.text(b.link(6)); err != nil {
+		return nil, err
+	}
+	if c.Comment, err = mr.text(b.link(7)); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// bytes returns the bytes of a byte array channel in rec.
+func (c *mdfChannel) bytes(rec []byte) []byte {
+	end := int64(c.byteOff) + int64(c.bits/8)
+	if end > int64(len(rec)) {
+		return nil
+	}
+	return rec[c.byteOff:end]
+}
+
+// value returns the numeric value of the channel in rec, the record after
+// its id; ok is false when the channel does not fit the record or has a
+// layout the reader does not support.
+func (c *mdfChannel) value(rec []byte) (v float64, ok bool) {
+	n := (int(c.bitOff) + int(c.bits) + 7) / 8
+	if c.bits == 0 || n > 8 || int64(c.byteOff)+int64(n) > int64(len(rec)) {
+		return 0, false
+	}
+	b := rec[c.byteOff : int(c.byteOff)+n]
+	var u uint64
+	switch c.dataType {
+	case mdfUintLE, mdfIntLE, mdfFloatLE:
+		for i := n - 1; i >= 0; i-- {
+			u = u<<8 | uint64(b[i])
+		}
+	case mdfUintBE, mdfIntBE, mdfFloatBE:
+		for _, x := range b {
+			u = u<<8 | uint64(x)
+		}
+	default:
+		return 0, false
+	}
+	u >>= c.bitOff
+	if c.bits < 64 {
+		u &= 1<<c.bits - 1
+	}
+	switch c.dataType {
+	case mdfUintLE, mdfUintBE:
+		return float64(u), true
+	case mdfIntLE, mdfIntBE:
+		if c.bits < 64 && u&(1<<(c.bits-1)) != 0 {
+			u |= ^uint64(0) << c.bits
+		}
+		return float64(int64(u)), true
+	}
+	switch c.bits {
+	case 32:
+		return float64(math.Float32frombits(uint32(u))), true
+	case 64:
+		return math.Float64frombits(u), true
+	}
+	return 0, false
+}
+
+// valid reports whether the channel's value in rec is valid.
+func (cg *mdfChannelGroup) valid(c *mdfChannel, rec []byte) bool {
+	if c.flags&mdfAllInvalid != 0 {
+		return false
+	}
+	if c.flags&mdfInvalBitValid == 0 {
+		return true
+	}
+	i := cg.dataBytes + int(c.invalPos/8)
+	return i < len(rec) && rec[i]&(1<<(c.invalPos%8)) == 0
+}
+
+// frame decodes a bus event record.
+func (cg *mdfChannelGroup) frame(rec []byte) (r Record, err error) {
+	field := func(name string) (uint64, bool) {
+		if c := cg.fields[name]; c != nil {
+			v, ok := c.value(rec)
+			return uint64(v), ok
+		}
+		return 0, false
+	}
+	r.Channel = DefaultChannel
+	if ch, ok := field("BusChannel"); ok && ch > 0 {
+		r.Channel = channelName(int(ch) - 1)
+	}
+	dir, _ := field("Dir")
+	r.Tx = dir == 1
+	r.Error = cg.bus == mdfErrorFrame
+
+	f := &r.Frame
+	id, ok := field("ID")
+	if !ok && !r.Error {
+		return r, fmt.Errorf("%s: no ID", mdfBusGroups[cg.bus].name)
+	}
+	f.ID = uint32(id) & 0x1FFFFFFF
+	ide, _ := field("IDE")
+	f.Extended = ide != 0 || id&(1<<31) != 0 || f.ID > 0x7FF
+	dlc, _ := field("DLC")
+	if cg.bus == mdfRemoteFrame {
+		f.Remote, f.Length = true, uint8(min(dlc, 8))
+		return r, nil
+	}
+	if edl, _ := field("EDL"); edl != 0 {
+		brs, _ := field("BRS")
+		esi, _ := field("ESI")
+		f.FD, f.BRS, f.ESI = true, brs != 0, esi != 0
+	}
+	n, ok := field("DataLength")
+	if !ok {
+		n = dlc
+		if f.FD {
+			n = uint64(gocan.DLCLength(uint8(min(dlc, 15))))
+		}
+	}
+	if n > 8 && !f.FD || n > gocan.MaxFDLength {
+		return r, fmt.Errorf("%s: bad data length %d", mdfBusGroups[cg.bus].name, n)
+	}
+	f.Length = uint8(n)
+	var data []byte
+	if c := cg.fields["DataBytes"]; c != nil {
+		data = c.bytes(rec)
+	}
+	if len(data) < int(n) && !r.Error {
+		return r, fmt.Errorf("%s: %d data bytes, want %d", mdfBusGroups[cg.bus].name, len(data), n)
+	}
+	copy(f.Data[:n], data)
+	return r, nil
+}
+
+// mdfCursor walks the records of one data group, stopping at those of the
+// channel groups it wants.
+type mdfCursor struct {
+	mr   *MDFReader
+	dg   *mdfDataGroup
+	want func(*mdfChannelGroup) bool
+	r    *bufio.Reader
+	buf  []byte
+	done bool
+
+	// The pending record, when cg is not nil.
+	cg  *mdfChannelGroup
+	rec []byte
+	t   time.Time
+}
+
+func (c *mdfCursor) advance() error {
+	if c.r == nil {
+		r, err := c.mr.data(c.dg.data)
+		if err != nil {
+			return err
+		}
+		c.r = bufio.NewReaderSize(r, 64<<10)
+	}
+	// Past the record id, the end of the data cuts a record short.
+	short := func(err error) error {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return c.eof(err)
+	}
+	for {
+		var cg *mdfChannelGroup
+		var n int
+		if c.dg.recIDSize == 0 {
+			for _, g := range c.dg.groups {
+				cg = g
+			}
+			if cg == nil {
+				return io.EOF
+			}
+			n = cg.size
+		} else {
+			var id [8]byte
+			if _, err := io.ReadFull(c.r, id[:c.dg.recIDSize]); err != nil {
+				return c.eof(err)
+			}
+			if cg = c.dg.groups[binary.LittleEndian.Uint64(id[:])]; cg == nil {
+				return fmt.Errorf("unknown record id %d", binary.LittleEndian.Uint64(id[:]))
+			}
+			n = cg.size
+			if cg.vlsd {
+				var size [4]byte
+				if _, err := io.ReadFull(c.r, size[:]); err != nil {
+					return short(err)
+				}
+				n = int(binary.LittleEndian.Uint32(size[:]))
+			}
+		}
+		if !cg.vlsd && c.want(cg) {
+			c.buf = slices.Grow(c.buf[:0], n)[:n]
+			if _, err := io.ReadFull(c.r, c.buf); err != nil {
+				if c.dg.recIDSize == 0 {
+					return c.eof(err)
+				}
+				return short(err)
+			}
+			c.cg, c.rec, c.t = cg, c.buf, c.mr.start
+			if m := cg.master; m != nil {
+				if v, ok := m.value(c.buf); ok {
+					c.t = c.t.Add(time.Duration(math.Round(m.Physical(v) * 1e9)))
+				}
+			}
+			return nil
+		}
+		if _, err := c.r.Discard(n); err != nil {
+			return short(err)
+		}
+	}
+}
+
+// eof maps the end of the data to io.EOF. A record cut short is an error,
+// except at the end of an unfinalized file.
+func (c *mdfCursor) eof(err error) error {
+	if err == io.ErrUnexpectedEOF && c.mr.unfinished&mdfUnfinDTLength != 0 {
+		return io.EOF
+	}
+	if err == io.ErrUnexpectedEOF {
+		return errors.New("truncated data")
+	}
+	return err
+}
+
+// data returns the records of a data group: a DT block, a DZ block, or a
+// DL list of those, possibly under an HL block.
+func (mr *MDFReader) data(off int64) (io.Reader, error) {
+	var parts []io.Reader
+	if err := mr.dataBlocks(off, &parts); err != nil {
+		return nil, err
+	}
+	return io.MultiReader(parts...), nil
+}
+
+func (mr *MDFReader) dataBlocks(off int64, parts *[]io.Reader) error {
+	if off == 0 {
+		return nil
+	}
+	b, err := mr.header(off)
+	if err != nil {
+		return err
+	}
+	switch b.id {
+	case "DT":
+		n := b.length - mdfHeaderSize
+		if n == 0 && mr.unfinished&mdfUnfinDTLength != 0 {
+			n = mr.size - off - mdfHeaderSize
+		}
+		*parts = append(*parts, io.NewSectionReader(mr.ra, off+mdfHeaderSize, n))
+	case "DZ":
+		*parts = append(*parts, &mdfLazyReader{open: func() (io.Reader, error) { return mr.dz(off) }})
+	case "DL":
+		return mr.walk(off, "DL", func(b *mdfBlock) error {
+			for _, l := range b.links[1:] {
+				if err := mr.dataBlocks(l, parts); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	case "HL":
+		return mr.dataBlocks(b.link(0), parts)
+	default:
+		return fmt.Errorf("block at %#x is %s, want data", off, b.id)
+	}
+	return nil
+}
+
+// dz inflates a DZ block.
+func (mr *MDFReader) dz(off int64) (io.Reader, error) {
+	b, err := mr.block(off, "DZ")
+	if err != nil {
+		return nil, err
+	}
+	d := b.data
+	if len(d) < 24 {
+		return nil, fmt.Errorf("short DZ block at %#x", off)
+	}
+	if string(d[:2]) != "DT" {
+		return nil, fmt.Errorf("DZ block at %#x: compressed %s blocks not supported", off, d[:2])
+	}
+	size := binary.LittleEndian.Uint64(d[8:])
+	zsize := binary.LittleEndian.Uint64(d[16:])
+	if zsize > uint64(len(d)-24) || size > mdfMaxBlock {
+		return nil, fmt.Errorf("malformed DZ block at %#x", off)
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(d[24 : 24+zsize]))
+	if err != nil {
+		return nil, fmt.Errorf("DZ block at %#x: %w", off, err)
+	}
+	out := make([]byte, size)
+	if _, err := io.ReadFull(zr, out); err != nil {
+		return nil, fmt.Errorf("DZ block at %#x: %w", off, err)
+	}
+	switch d[2] {
+	case 0: // deflate
+	case 1: // transposition + deflate
+		cols := int(binary.LittleEndian.Uint32(d[4:]))
+		if cols == 0 {
+			return nil, fmt.Errorf("malformed DZ block at %#x", off)
+		}
+		out = mdfUntranspose(out, cols)
+	default:
+		return nil, fmt.Errorf("DZ block at %#x: zip type %d not supported", off, d[2])
+	}
+	return bytes.NewReader(out), nil
+}
+
+// mdfUntranspose undoes the byte transposition of DZ blocks: the whole
+// records of b, cols bytes each, are stored column by column, and the
+// remainder as is.
+func mdfUntranspose(b []byte, cols int) []byte {
+	rows := len(b) / cols
+	out := make([]byte, len(b))
+	copy(out[rows*cols:], b[rows*cols:])
+	for r := range rows {
+		for c := range cols {
+			out[r*cols+c] = b[c*rows+r]
+		}
+	}
+	return out
+}
+
+// mdfLazyReader opens its reader on first use, so DZ blocks are inflated
+// one at a time.
+type mdfLazyReader struct {
+	open func() (io.Reader, error)
+	r    io.Reader
+}
+
+func (l *mdfLazyReader) Read(p []byte) (int, error) {
+	if l.r == nil {
+		r, err := l.open()
+		if err != nil {
+			return 0, err
+		}
+		l.r = r
+	}
+	return l.r.Read(p)
+}
@@ -0,0 +1,194 @@
+package canlog
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+	"math"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	gocan "github.com/roffe/gocan/v2"
+	"github.com/roffe/gocan/v2/dbc"
+)
+
+const mdfTestDBC = `VERSION ""
+
+BO_ 1512 Engine: 8 ECM
+ SG_ Page M : 0|8@1+ (1,0) [0|255] "" Vector__XXX
+ SG_ RPM m0 : 8|16@1+ (0.25,0) [0|16383.75] "rpm" Vector__XXX
+ SG_ Coolant m1 : 8|8@1+ (1,-40) [-40|215] "degC" Vector__XXX
+ SG_ Gear : 56|4@1- (1,0) [-8|7] "" Vector__XXX
+
+CM_ SG_ 1512 RPM "Crankshaft speed";
+VAL_ 1512 Gear -1 "R" 0 "N" 1 "D1" ;
+`
+
+func TestMDFSignals(t *testing.T) {
+	db, err := dbc.Parse([]byte(mdfTestDBC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := db.Message("Engine")
+
+	// A bytes.Buffer cannot seek, so the file stays unfinalized.
+	var buf bytes.Buffer
+	w := NewMDFWriter(&buf)
+	eg, err := w.AddMessage(engine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	obd, err := w.AddGroup("OBD", MDFChannel{Name: "Vehicle speed", Unit: "km/h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	var want []Record
+	for i, f := range []gocan.Frame{
+		gocan.NewFrame(0x5E8, []byte{0, 0x40, 0x1F, 0, 0, 0, 0, 0x0F}), // page 0: 2000 rpm, gear R
+		gocan.NewFrame(0x5E8, []byte{1, 0x7B, 0, 0, 0, 0, 0, 0x01}),    // page 1: 83 degC, gear D1
+	} {
+		rec := Record{Time: start.Add(time.Duration(i) * 10 * time.Millisecond), Channel: "can0", Frame: f}
+		want = append(want, rec)
+		if err := w.Write(rec); err != nil {
+			t.Fatal(err)
+		}
+		d := dbc.Decoded{Message: engine, Frame: f, Values: engine.Decode(f.Data[:f.Length])}
+		if err := eg.WriteDecoded(rec.Time, d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := obd.Write(start.Add(15*time.Millisecond), 42); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.AddGroup("late", MDFChannel{Name: "x"}); err == nil {
+		t.Error("AddGroup after the first record succeeded")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), mdfUnfinishedID) {
+		t.Errorf("file starts %q, want it unfinalized", buf.Bytes()[:8])
+	}
+
+	r := NewMDFReader(bytes.NewReader(buf.Bytes()))
+	groups, err := r.Groups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 2 || groups[0].Name != "Engine" || groups[1].Name != "OBD" {
+		t.Fatalf("groups %v", groups)
+	}
+	if !reflect.DeepEqual(groups[0].Channels, eg.Channels) || !reflect.DeepEqual(groups[1].Channels, obd.Channels) {
+		t.Errorf("channels\n got %+v %+v\nwant %+v %+v", groups[0].Channels, groups[1].Channels, eg.Channels, obd.Channels)
+	}
+
+	nan := math.NaN()
+	for i, w := range []struct {
+		group  *MDFGroup
+		offset time.Duration
+		raw    []float64
+	}{
+		{groups[0], 0, []float64{0, 8000, nan, -1}},
+		{groups[0], 10 * time.Millisecond, []float64{1, nan, 123, 1}},
+		{groups[1], 15 * time.Millisecond, []float64{42}},
+	} {
+		s, err := r.ReadSample()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Group != w.group || !s.Time.Equal(start.Add(w.offset)) || !slices.EqualFunc(s.Raw, w.raw, func(a, b float64) bool {
+			return a == b || math.IsNaN(a) && math.IsNaN(b)
+		}) {
+			t.Errorf("sample %d: %s %v %v, want %s %v %v", i, s.Group.Name, s.Time, s.Raw, w.group.Name, start.Add(w.offset), w.raw)
+		}
+	}
+	if _, err := r.ReadSample(); err != io.EOF {
+		t.Fatalf("want EOF, got %v", err)
+	}
+	checkRecords(t, "frames", r, want)
+
+	r = NewMDFReader(bytes.NewReader(buf.Bytes()))
+	r.ReadSample()
+	s, _ := r.ReadSample()
+	if v, ok := s.Value("Coolant"); !ok || v != 83 {
+		t.Errorf("Coolant = %v, %v", v, ok)
+	}
+	if _, ok := s.Value("RPM"); ok {
+		t.Error("RPM valid on page 1")
+	}
+	if label := s.Group.Channels[3].Values[int64(s.Raw[3])]; label != "D1" {
+		t.Errorf("Gear label %q", label)
+	}
+}
+
+// TestMDFCompressed moves the data of a file into a DL list of two DZ
+// blocks, one of them transposed, as other tools write them.
+func TestMDFCompressed(t *testing.T) {
+	want := withError(testRecords(time.Unix(1436509052, 249713000), 1234567*time.Microsecond, "can1"))
+	var buf bytes.Buffer
+	w := NewMDFWriter(&buf)
+	for _, rec := range want {
+		if err := w.Write(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	file := buf.Bytes()
+
+	// An unfinalized file cut short reads up to its last whole record.
+	checkRecords(t, "cut", NewMDFReader(bytes.NewReader(file[:len(file)-5])), want[:len(want)-1])
+
+	le := binary.LittleEndian
+	dg := int64(le.Uint64(file[mdfIDSize+mdfHeaderSize:]))
+	dt := int64(le.Uint64(file[dg+mdfHeaderSize+16:]))
+	data := file[dt+mdfHeaderSize:]
+	m := mdfBlocks{b: append(mdfIdentification(0), file[mdfIDSize:dt]...)}
+
+	dz := func(part []byte, cols int) int64 {
+		zip := 0
+		if cols > 0 {
+			zip = 1
+			rows := len(part) / cols
+			t := bytes.Clone(part)
+			for r := range rows {
+				for c := range cols {
+					t[c*rows+r] = part[r*cols+c]
+				}
+			}
+			part = t
+		}
+		var z bytes.Buffer
+		zw := zlib.NewWriter(&z)
+		zw.Write(part)
+		zw.Close()
+		body := []byte{'D', 'T', byte(zip), 0}
+		body = le.AppendUint32(body, uint32(cols))
+		body = le.AppendUint64(body, uint64(len(part)))
+		body = le.AppendUint64(body, uint64(z.Len()))
+		return m.add("DZ", 0, append(body, z.Bytes()...))
+	}
+	half := len(data) / 2
+	first, second := dz(data[:half], 0), dz(data[half:], 25)
+	dlData := []byte{0, 0, 0, 0, 2, 0, 0, 0}
+	dlData = le.AppendUint64(dlData, 0)
+	dlData = le.AppendUint64(dlData, uint64(half))
+	dl := m.add("DL", 3, dlData)
+	m.link(dl, 1, first)
+	m.link(dl, 2, second)
+	m.link(dg, 2, dl)
+
+	r, format, err := NewReader(bytes.NewReader(m.b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format.Name != "mdf" {
+		t.Fatalf("detected as %s", format.Name)
+	}
+	checkRecords(t, "compressed", r, want)
+}
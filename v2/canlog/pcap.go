@@ -0,0 +1,577 @@
+package canlog
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	gocan "github.com/roffe/gocan/v2"
+)
+
+func init() {
+	RegisterFormat(Format{
+		Name:        "pcapng",
+		Description: "pcapng with SocketCAN link type (Wireshark, tcpdump)",
+		Extensions:  []string{".pcapng"},
+		Detect: func(head []byte) bool {
+			return bytes.HasPrefix(head, []byte{0x0A, 0x0D, 0x0D, 0x0A})
+		},
+		NewReader: func(r io.Reader) Reader { return NewPcapngReader(r) },
+		NewWriter: func(w io.Writer) Writer { return NewPcapngWriter(w) },
+	})
+	RegisterFormat(Format{
+		Name:        "pcap",
+		Description: "classic pcap with SocketCAN link type",
+		Extensions:  []string{".pcap"},
+		Detect: func(head []byte) bool {
+			_, _, err := pcapMagic(head)
+			return err == nil
+		},
+		NewReader: func(r io.Reader) Reader { return NewPcapReader(r) },
+		NewWriter: func(w io.Writer) Writer { return NewPcapWriter(w) },
+	})
+}
+
+const (
+	linkTypeSocketCAN = 227 // LINKTYPE_CAN_SOCKETCAN
+
+	// SocketCAN can_id flags.
+	canEFFFlag = 0x80000000
+	canRTRFlag = 0x40000000
+	canERRFlag = 0x20000000
+	canFDBRS   = 0x01 // canfd_frame.flags: bit rate switch
+	canFDESI   = 0x02 // canfd_frame.flags: error state indicator
+	canFDF     = 0x04 // canfd_frame.flags: this is a CAN FD frame
+	canFDMTU   = 72   // sizeof(struct canfd_frame)
+
+	pcapngSHB = 0x0A0D0D0A
+	pcapngIDB = 1
+	pcapngPB  = 2 // obsolete packet block
+	pcapngEPB = 6
+	pcapngBOM = 0x1A2B3C4D
+
+	optEnd      = 0
+	optIfName   = 2
+	optIfTsres  = 9
+	optIfTsoff  = 14
+	optEpbFlags = 2
+)
+
+// appendSocketCAN appends r as a SocketCAN frame: a big-endian can_id with
+// the EFF/RTR/ERR flags, the payload length, three flag/reserved bytes and
+// the data. CAN FD frames are padded to the full struct canfd_frame, which
+// older readers rely on to tell them apart.
+func appendSocketCAN(b []byte, r Record) []byte {
+	f := r.Frame
+	id := f.ID
+	switch {
+	case r.Error:
+		id = id&0x1FFFFFFF | canERRFlag
+	case f.Extended:
+		id |= canEFFFlag
+	}
+	if f.Remote {
+		id |= canRTRFlag
+	}
+	b = binary.BigEndian.AppendUint32(b, id)
+	if f.FD && !r.Error {
+		flags := byte(canFDF)
+		if f.BRS {
+			flags |= canFDBRS
+		}
+		if f.ESI {
+			flags |= canFDESI
+		}
+		b = append(b, f.Length, flags, 0, 0)
+		return append(b, f.Data[:]...)
+	}
+	b = append(b, f.Length, 0, 0, 0)
+	if r.Error {
+		return append(b, f.Data[:8]...) // error frames always carry 8 bytes
+	}
+	if f.Remote {
+		return b
+	}
+	return append(b, f.Data[:f.Length]...)
+}
+
+func parseSocketCAN(r *Record, b []byte) error {
+	if len(b) < 8 {
+		return fmt.Errorf("short SocketCAN frame (%d bytes)", len(b))
+	}
+	id := binary.BigEndian.Uint32(b)
+	n := int(b[4])
+	f := &r.Frame
+	if b[5]&canFDF != 0 || len(b) == canFDMTU {
+		f.FD = true
+		f.BRS = b[5]&canFDBRS != 0
+		f.ESI = b[5]&canFDESI != 0
+	}
+	if n > 8 && !f.FD || n > gocan.MaxFDLength {
+		return fmt.Errorf("bad SocketCAN frame length %d", n)
+	}
+	f.Extended = id&canEFFFlag != 0
+	f.Remote = id&canRTRFlag != 0
+	r.Error = id&canERRFlag != 0
+	f.ID = id & 0x1FFFFFFF
+	if !f.Extended && !r.Error {
+		f.ID &= 0x7FF
+	}
+	f.Length = uint8(n)
+	if r.Error {
+		copy(f.Data[:], b[8:])
+	} else if !f.Remote {
+		if len(b) < 8+n {
+			return fmt.Errorf("short SocketCAN frame (%d bytes, length %d)", len(b), n)
+		}
+		copy(f.Data[:n], b[8:])
+	}
+	return nil
+}
+
+// PcapngWriter writes pcapng files for Wireshark. Every channel gets its own
+// interface description block, named after the channel, so traffic from
+// several buses can share a file. Timestamps have nanosecond resolution and
+// each packet records its direction.
+type PcapngWriter struct {
+	w      *bufio.Writer
+	ifaces map[string]uint32
+	buf    []byte
+	pkt    []byte
+}
+
+// NewPcapngWriter writes a pcapng file to w. Call Close when done.
+func NewPcapngWriter(w io.Writer) *PcapngWriter {
+	return &PcapngWriter{w: bufio.NewWriter(w)}
+}
+
+// block writes a block of type typ around body, which must be padded to 32
+// bits.
+func (pw *PcapngWriter) block(typ uint32, body []byte) error {
+	n := uint32(12 + len(body))
+	b := pw.buf[:0]
+	b = binary.LittleEndian.AppendUint32(b, typ)
+	b = binary.LittleEndian.AppendUint32(b, n)
+	b = append(b, body...)
+	b = binary.LittleEndian.AppendUint32(b, n)
+	pw.buf = b
+	_, err := pw.w.Write(b)
+	return err
+}
+
+func appendOption(b []byte, code uint16, value []byte) []byte {
+	b = binary.LittleEndian.AppendUint16(b, code)
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(value)))
+	b = append(b, value...)
+	return appendPad(b, len(value))
+}
+
+func appendPad(b []byte, n int) []byte {
+	for range (4 - n%4) % 4 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+func (pw *PcapngWriter) iface(channel string) (uint32, error) {
+	if channel == "" {
+		channel = DefaultChannel
+	}
+	if id, ok := pw.ifaces[channel]; ok {
+		return id, nil
+	}
+	if pw.ifaces == nil {
+		pw.ifaces = make(map[string]uint32)
+		var shb []byte
+		shb = binary.LittleEndian.AppendUint32(shb, pcapngBOM)
+		shb = binary.LittleEndian.AppendUint16(shb, 1)
+		shb = binary.LittleEndian.AppendUint16(shb, 0)
+		shb = binary.LittleEndian.AppendUint64(shb, math.MaxUint64) // section length unknown
+		shb = binary.LittleEndian.AppendUint32(shb, optEnd)
+		if err := pw.block(pcapngSHB, shb); err != nil {
+			return 0, err
+		}
+	}
+	var idb []byte
+	idb = binary.LittleEndian.AppendUint16(idb, linkTypeSocketCAN)
+	idb = binary.LittleEndian.AppendUint16(idb, 0)
+	idb = binary.LittleEndian.AppendUint32(idb, 0) // no snap length
+	idb = appendOption(idb, optIfName, []byte(channel))
+	idb = appendOption(idb, optIfTsres, []byte{9})
+	idb = binary.LittleEndian.AppendUint32(idb, optEnd)
+	if err := pw.block(pcapngIDB, idb); err != nil {
+		return 0, err
+	}
+	id := uint32(len(pw.ifaces))
+	pw.ifaces[channel] = id
+	return id, nil
+}
+
+// Write writes one record as an enhanced packet block.
+func (pw *PcapngWriter) Write(r Record) error {
+	id, err := pw.iface(r.Channel)
+	if err != nil {
+		return err
+	}
+	data := appendSocketCAN(pw.pkt[:0], r)
+	ts := uint64(r.Time.UnixNano())
+	b := make([]byte, 0, 20+len(data)+16)
+	b = binary.LittleEndian.AppendUint32(b, id)
+	b = binary.LittleEndian.AppendUint32(b, uint32(ts>>32))
+	b = binary.LittleEndian.AppendUint32(b, uint32(ts))
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(data)))
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(data)))
+	b = append(b, data...)
+	b = appendPad(b, len(data))
+	dir := uint32(1) // inbound
+	if r.Tx {
+		dir = 2
+	}
+	b = appendOption(b, optEpbFlags, binary.LittleEndian.AppendUint32(nil, dir))
+	b = binary.LittleEndian.AppendUint32(b, optEnd)
+	pw.pkt = data
+	return pw.block(pcapngEPB, b)
+}
+
+// Flush writes buffered blocks to the underlying writer.
+func (pw *PcapngWriter) Flush() error {
+	return pw.w.Flush()
+}
+
+// Close flushes. A file with no records still gets its section header.
+func (pw *PcapngWriter) Close() error {
+	if pw.ifaces == nil {
+		if _, err := pw.iface(DefaultChannel); err != nil {
+			return err
+		}
+	}
+	return pw.w.Flush()
+}
+
+type pcapngIface struct {
+	name     string
+	linkType uint16
+	unit     float64 // seconds per timestamp tick
+	ns       uint64  // nanoseconds per tick when a whole number, else 0
+	offset   int64   // seconds added to every timestamp
+}
+
+// PcapngReader reads SocketCAN packets from pcapng files, such as Wireshark
+// or tcpdump captures of Linux CAN interfaces. Packets on interfaces with
+// other link types are skipped. Channels are named after the capturing
+// interface.
+type PcapngReader struct {
+	r      io.Reader
+	order  binary.ByteOrder
+	ifaces []pcapngIface
+	buf    []byte
+}
+
+// NewPcapngReader reads a pcapng file from r.
+func NewPcapngReader(r io.Reader) *PcapngReader {
+	return &PcapngReader{r: r}
+}
+
+// Read returns the next record, or io.EOF at the end of the file.
+func (pr *PcapngReader) Read() (Record, error) {
+	for {
+		typ, body, err := pr.next()
+		if err != nil {
+			return Record{}, err
+		}
+		var r Record
+		var ok bool
+		switch typ {
+		case pcapngIDB:
+			err = pr.parseIDB(body)
+		case pcapngEPB, pcapngPB:
+			r, ok, err = pr.parsePacket(typ, body)
+		}
+		if err != nil {
+			return Record{}, fmt.Errorf("pcapng: %w", err)
+		}
+		if ok {
+			return r, nil
+		}
+	}
+}
+
+// next reads one block, returning its type and body.
+func (pr *PcapngReader) next() (uint32, []byte, error) {
+	var h [12]byte
+	if _, err := io.ReadFull(pr.r, h[:8]); err != nil {
+		if err == io.EOF {
+			return 0, nil, io.EOF
+		}
+		return 0, nil, fmt.Errorf("pcapng: %w", err)
+	}
+	if binary.LittleEndian.Uint32(h[:]) == pcapngSHB {
+		// A new section; its byte order mark decides how to read it.
+		if _, err := io.ReadFull(pr.r, h[8:12]); err != nil {
+			return 0, nil, fmt.Errorf("pcapng: %w", err)
+		}
+		switch binary.LittleEndian.Uint32(h[8:]) {
+		case pcapngBOM:
+			pr.order = binary.LittleEndian
+		case 0x4D3C2B1A:
+			pr.order = binary.BigEndian
+		default:
+			return 0, nil, errors.New("pcapng: bad byte order mark")
+		}
+		pr.ifaces = pr.ifaces[:0]
+		n := pr.order.Uint32(h[4:])
+		if n < 28 || n%4 != 0 {
+			return 0, nil, fmt.Errorf("pcapng: section header length %d", n)
+		}
+		_, err := io.CopyN(io.Discard, pr.r, int64(n-12))
+		if err != nil {
+			return 0, nil, fmt.Errorf("pcapng: %w", io.ErrUnexpectedEOF)
+		}
+		return pcapngSHB, nil, nil
+	}
+	if pr.order == nil {
+		return 0, nil, errors.New("pcapng: no section header")
+	}
+	typ, n := pr.order.Uint32(h[:]), pr.order.Uint32(h[4:])
+	if n < 12 || n%4 != 0 || n > 1<<24 {
+		return 0, nil, fmt.Errorf("pcapng: block length %d", n)
+	}
+	if cap(pr.buf) < int(n-8) {
+		pr.buf = make([]byte, n-8)
+	}
+	b := pr.buf[:n-8]
+	if _, err := io.ReadFull(pr.r, b); err != nil {
+		return 0, nil, fmt.Errorf("pcapng: %w", io.ErrUnexpectedEOF)
+	}
+	return typ, b[:len(b)-4], nil
+}
+
+// options calls fn for each option in b.
+func (pr *PcapngReader) options(b []byte, fn func(code uint16, value []byte)) {
+	for len(b) >= 4 {
+		code, n := pr.order.Uint16(b), int(pr.order.Uint16(b[2:]))
+		if code == optEnd || 4+n > len(b) {
+			return
+		}
+		fn(code, b[4:4+n])
+		b = b[4+n+(4-n%4)%4:]
+	}
+}
+
+func (pr *PcapngReader) parseIDB(b []byte) error {
+	if len(b) < 8 {
+		return errors.New("short interface description block")
+	}
+	ifc := pcapngIface{
+		name:     channelName(len(pr.ifaces)),
+		linkType: pr.order.Uint16(b),
+		unit:     1e-6,
+		ns:       1000,
+	}
+	pr.options(b[8:], func(code uint16, v []byte) {
+		switch {
+		case code == optIfName && len(v) > 0:
+			ifc.name = string(bytes.TrimRight(v, "\x00"))
+		case code == optIfTsres && len(v) == 1:
+			if v[0]&0x80 != 0 {
+				ifc.unit = math.Pow(2, -float64(v[0]&0x7F))
+			} else {
+				ifc.unit = math.Pow(10, -float64(v[0]))
+			}
+			ifc.ns = 0
+			if v[0]&0x80 == 0 && v[0] <= 9 {
+				ifc.ns = uint64(math.Pow10(9 - int(v[0])))
+			}
+		case code == optIfTsoff && len(v) == 8:
+			ifc.offset = int64(pr.order.Uint64(v))
+		}
+	})
+	pr.ifaces = append(pr.ifaces, ifc)
+	return nil
+}
+
+func (pr *PcapngReader) parsePacket(typ uint32, b []byte) (r Record, ok bool, err error) {
+	if len(b) < 20 {
+		return r, false, errors.New("short packet block")
+	}
+	var id uint32
+	if typ == pcapngPB {
+		id = uint32(pr.order.Uint16(b))
+	} else {
+		id = pr.order.Uint32(b)
+	}
+	if int(id) >= len(pr.ifaces) {
+		return r, false, fmt.Errorf("packet on undeclared interface %d", id)
+	}
+	ifc := pr.ifaces[id]
+	if ifc.linkType != linkTypeSocketCAN {
+		return r, false, nil
+	}
+	ts := uint64(pr.order.Uint32(b[4:]))<<32 | uint64(pr.order.Uint32(b[8:]))
+	if ifc.ns > 0 {
+		r.Time = time.Unix(ifc.offset, 0).Add(time.Duration(ts * ifc.ns))
+	} else {
+		sec := float64(ts) * ifc.unit
+		r.Time = time.Unix(ifc.offset+int64(sec), int64((sec-math.Floor(sec))*1e9))
+	}
+	n := int(pr.order.Uint32(b[12:]))
+	if 20+n > len(b) {
+		return r, false, errors.New("packet overruns its block")
+	}
+	r.Channel = ifc.name
+	if err := parseSocketCAN(&r, b[20:20+n]); err != nil {
+		return r, false, err
+	}
+	if typ == pcapngEPB {
+		pr.options(b[20+n+(4-n%4)%4:], func(code uint16, v []byte) {
+			if code == optEpbFlags && len(v) == 4 {
+				r.Tx = pr.order.Uint32(v)&3 == 2
+			}
+		})
+	}
+	return r, true, nil
+}
+
+// pcapMagic returns the byte order and timestamp resolution of a classic
+// pcap file from its magic number.
+func pcapMagic(head []byte) (binary.ByteOrder, time.Duration, error) {
+	if len(head) < 4 {
+		return nil, 0, errors.New("pcap: short file header")
+	}
+	switch binary.LittleEndian.Uint32(head) {
+	case 0xA1B2C3D4:
+		return binary.LittleEndian, time.Microsecond, nil
+	case 0xA1B23C4D:
+		return binary.LittleEndian, time.Nanosecond, nil
+	case 0xD4C3B2A1:
+		return binary.BigEndian, time.Microsecond, nil
+	case 0x4D3CB2A1:
+		return binary.BigEndian, time.Nanosecond, nil
+	}
+	return nil, 0, errors.New("pcap: not a pcap file")
+}
+
+// PcapWriter writes classic pcap files with nanosecond timestamps. The
+// format has no interfaces or packet direction, so channel and Tx are lost;
+// use pcapng to keep them.
+type PcapWriter struct {
+	w      *bufio.Writer
+	header bool
+	buf    []byte
+}
+
+// NewPcapWriter writes a pcap file to w. Call Close when done.
+func NewPcapWriter(w io.Writer) *PcapWriter {
+	return &PcapWriter{w: bufio.NewWriter(w)}
+}
+
+func (pw *PcapWriter) writeHeader() error {
+	pw.header = true
+	var h []byte
+	h = binary.LittleEndian.AppendUint32(h, 0xA1B23C4D)
+	h = binary.LittleEndian.AppendUint16(h, 2)
+	h = binary.LittleEndian.AppendUint16(h, 4)
+	h = binary.LittleEndian.AppendUint64(h, 0) // zone, sigfigs
+	h = binary.LittleEndian.AppendUint32(h, 0xFFFF)
+	h = binary.LittleEndian.AppendUint32(h, linkTypeSocketCAN)
+	_, err := pw.w.Write(h)
+	return err
+}
+
+// Write writes one record.
+func (pw *PcapWriter) Write(r Record) error {
+	if !pw.header {
+		if err := pw.writeHeader(); err != nil {
+			return err
+		}
+	}
+	b := pw.buf[:0]
+	b = binary.LittleEndian.AppendUint32(b, uint32(r.Time.Unix()))
+	b = binary.LittleEndian.AppendUint32(b, uint32(r.Time.Nanosecond()))
+	b = append(b, make([]byte, 8)...)
+	b = appendSocketCAN(b, r)
+	binary.LittleEndian.PutUint32(b[8:], uint32(len(b)-16))
+	binary.LittleEndian.PutUint32(b[12:], uint32(len(b)-16))
+	pw.buf = b
+	_, err := pw.w.Write(b)
+	return err
+}
+
+// Flush writes buffered packets to the underlying writer.
+func (pw *PcapWriter) Flush() error {
+	return pw.w.Flush()
+}
+
+// Close writes the header if nothing was written and flushes.
+func (pw *PcapWriter) Close() error {
+	if !pw.header {
+		if err := pw.writeHeader(); err != nil {
+			return err
+		}
+	}
+	return pw.w.Flush()
+}
+
+// PcapReader reads SocketCAN packets from classic pcap files. Every record
+// is on DefaultChannel and received.
+type PcapReader struct {
+	r      io.Reader
+	order  binary.ByteOrder
+	unit   time.Duration
+	header bool
+	buf    []byte
+}
+
+// NewPcapReader reads a pcap file from r.
+func NewPcapReader(r io.Reader) *PcapReader {
+	return &PcapReader{r: r}
+}
+
+// Read returns the next record, or io.EOF at the end of the file.
+func (pr *PcapReader) Read() (Record, error) {
+	if !pr.header {
+		var h [24]byte
+		if _, err := io.ReadFull(pr.r, h[:]); err != nil {
+			return Record{}, fmt.Errorf("pcap: file header: %w", err)
+		}
+		var err error
+		if pr.order, pr.unit, err = pcapMagic(h[:]); err != nil {
+			return Record{}, err
+		}
+		if lt := pr.order.Uint32(h[20:]) & 0xFFFF; lt != linkTypeSocketCAN {
+			return Record{}, fmt.Errorf("pcap: link type %d is not SocketCAN", lt)
+		}
+		pr.header = true
+	}
+	var h [16]byte
+	if _, err := io.ReadFull(pr.r, h[:]); err != nil {
+		if err == io.EOF {
+			return Record{}, io.EOF
+		}
+		return Record{}, fmt.Errorf("pcap: %w", err)
+	}
+	n := pr.order.Uint32(h[8:])
+	if n > 1<<16 {
+		return Record{}, fmt.Errorf("pcap: packet length %d", n)
+	}
+	if cap(pr.buf) < int(n) {
+		pr.buf = make([]byte, n)
+	}
+	b := pr.buf[:n]
+	if _, err := io.ReadFull(pr.r, b); err != nil {
+		return Record{}, fmt.Errorf("pcap: %w", io.ErrUnexpectedEOF)
+	}
+	r := Record{
+		Time:    time.Unix(int64(pr.order.Uint32(h[:])), int64(pr.order.Uint32(h[4:]))*int64(pr.unit)),
+		Channel: DefaultChannel,
+	}
+	if err := parseSocketCAN(&r, b); err != nil {
+		return Record{}, fmt.Errorf("pcap: %w", err)
+	}
+	return r, nil
+}
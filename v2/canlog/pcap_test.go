@@ -0,0 +1,160 @@
+package canlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	gocan "github.com/roffe/gocan/v2"
+)
+
+func TestPcapngRecorderAttach(t *testing.T) {
+	hs, err := gocan.Open(t.Context(), "loopback", gocan.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hs.Close()
+	ls, err := gocan.Open(t.Context(), "loopback", gocan.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ls.Close()
+
+	path := filepath.Join(t.TempDir(), "gateway.pcapng")
+	rec, err := NewRecorder(hs, path, WithChannel("hscan"), WithSent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	detach := rec.Attach(ls, "lscan")
+	hs.Send(t.Context(), gocan.NewFrame(0x7E0, []byte{0x02, 0x10, 0x03}))
+	ls.Send(t.Context(), gocan.NewExtendedFrame(0x10242040, []byte{0x01}))
+	detach()
+	ls.Send(t.Context(), gocan.NewFrame(0x001, nil))
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var got []Record
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, rec)
+	}
+	// Loopback delivers the frame before Send returns, so each Send logs
+	// an Rx then a Tx record.
+	if len(got) != 4 {
+		t.Fatalf("read %d records, want 4: %+v", len(got), got)
+	}
+	for i, want := range []struct {
+		channel string
+		id      uint32
+		tx      bool
+	}{{"hscan", 0x7E0, false}, {"hscan", 0x7E0, true}, {"lscan", 0x10242040, false}, {"lscan", 0x10242040, true}} {
+		if got[i].Channel != want.channel || got[i].Frame.ID != want.id || got[i].Tx != want.tx {
+			t.Errorf("record %d: %s %v tx=%v, want %s %#x tx=%v", i, got[i].Channel, got[i].Frame, got[i].Tx, want.channel, want.id, want.tx)
+		}
+	}
+}
+
+// TestPcapngForeign reads a big-endian capture with microsecond timestamps,
+// a timestamp offset and a non-CAN interface, as other tools write them.
+func TestPcapngForeign(t *testing.T) {
+	be := binary.BigEndian
+	var file []byte
+	block := func(typ uint32, body []byte) {
+		body = appendPad(body, len(body))
+		n := uint32(12 + len(body))
+		file = be.AppendUint32(file, typ)
+		file = be.AppendUint32(file, n)
+		file = append(file, body...)
+		file = be.AppendUint32(file, n)
+	}
+	option := func(b []byte, code uint16, v []byte) []byte {
+		b = be.AppendUint16(b, code)
+		b = be.AppendUint16(b, uint16(len(v)))
+		return appendPad(append(b, v...), len(v))
+	}
+	var shb []byte
+	shb = be.AppendUint32(shb, pcapngBOM)
+	shb = be.AppendUint16(shb, 1)
+	shb = be.AppendUint16(shb, 0)
+	shb = be.AppendUint64(shb, ^uint64(0))
+	block(pcapngSHB, shb)
+
+	eth := []byte{0, 1, 0, 0, 0, 0, 0, 0}
+	block(pcapngIDB, eth)
+	can := []byte{0, linkTypeSocketCAN, 0, 0, 0, 0, 0, 0}
+	can = option(can, optIfName, []byte("vcan0"))
+	can = option(can, optIfTsoff, be.AppendUint64(nil, 1_700_000_000))
+	can = be.AppendUint32(can, 0)
+	block(pcapngIDB, can)
+
+	packet := func(iface uint32, ts uint64, data []byte, flags uint32) {
+		var b []byte
+		b = be.AppendUint32(b, iface)
+		b = be.AppendUint32(b, uint32(ts>>32))
+		b = be.AppendUint32(b, uint32(ts))
+		b = be.AppendUint32(b, uint32(len(data)))
+		b = be.AppendUint32(b, uint32(len(data)))
+		b = appendPad(append(b, data...), len(data))
+		if flags != 0 {
+			b = option(b, optEpbFlags, be.AppendUint32(nil, flags))
+		}
+		block(pcapngEPB, b)
+	}
+	packet(0, 5, make([]byte, 60), 0)
+	// A Linux CAN_MTU frame, padded to 16 bytes.
+	packet(1, 1_500_000, []byte{0x00, 0x00, 0x07, 0xE8, 3, 0, 0, 0, 0x02, 0x50, 0x03, 0, 0, 0, 0, 0}, 2)
+	packet(1, 2_000_001, []byte{0xC0, 0x00, 0x01, 0x23, 2, 0, 0, 0}, 1)
+
+	r, format, err := NewReader(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format.Name != "pcapng" {
+		t.Fatalf("detected as %s", format.Name)
+	}
+	base := time.Unix(1_700_000_000, 0)
+	checkRecords(t, "foreign", r, []Record{
+		{Time: base.Add(1500 * time.Millisecond), Channel: "vcan0", Frame: gocan.NewFrame(0x7E8, []byte{0x02, 0x50, 0x03}), Tx: true},
+		{Time: base.Add(2000001 * time.Microsecond), Channel: "vcan0", Frame: gocan.Frame{ID: 0x123, Extended: true, Remote: true, Length: 2}},
+	})
+}
+
+func TestPcap(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewPcapWriter(&buf)
+	want := testRecords(time.Unix(1436509052, 249713123), 1234567*time.Microsecond, DefaultChannel)
+	for _, rec := range want {
+		if err := w.Write(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, format, err := NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format.Name != "pcap" {
+		t.Fatalf("detected as %s", format.Name)
+	}
+	for i := range want {
+		want[i].Tx = false // pcap has no direction
+	}
+	checkRecords(t, "pcap", r, want)
+}
@@ -0,0 +1,365 @@
+package canlog
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	gocan "github.com/roffe/gocan/v2"
+)
+
+// RecorderOption configures a Recorder.
+type RecorderOption func(*Recorder)
+
+// WithChannel sets the interface name written for every frame (default
+// "can0").
+func WithChannel(name string) RecorderOption {
+	return func(r *Recorder) { r.channel = name }
+}
+
+// WithSent also records the frames sent through Bus.Send. Lines then carry
+// the candump -x direction field so sent and received frames can be told
+// apart.
+func WithSent() RecorderOption {
+	return func(r *Recorder) { r.sent = true }
+}
+
+// WithFormat writes the named log format (see Formats) instead of the one
+// matching the file extension. Files with unknown extensions are written in
+// candump format.
+func WithFormat(name string) RecorderOption {
+	return func(r *Recorder) { r.formatName = name }
+}
+
+// WithGzip compresses the log files; ".gz" is appended to their names.
+func WithGzip() RecorderOption {
+	return func(r *Recorder) { r.gzip = true }
+}
+
+// WithRotateSize starts a new file once n bytes of log data have been
+// written to the current one. With gzip, n counts the uncompressed data.
+func WithRotateSize(n int64) RecorderOption {
+	return func(r *Recorder) { r.rotateSize = n }
+}
+
+// WithRotateInterval starts a new file every d.
+func WithRotateInterval(d time.Duration) RecorderOption {
+	return func(r *Recorder) { r.rotateEvery = d }
+}
+
+// recorderBuffer is the number of frames queued between the bus and the
+// file, riding out disk stalls.
+const recorderBuffer = 8192
+
+// flushInterval bounds how much is lost if the process dies.
+const flushInterval = time.Second
+
+// Recorder writes a bus's traffic to log files. Received frames keep the
+// adapter's receive timestamp; sent frames are stamped when they reach the
+// recorder.
+type Recorder struct {
+	bus         *gocan.Bus
+	path        string
+	channel     string
+	sent        bool
+	gzip        bool
+	rotateSize  int64
+	rotateEvery time.Duration
+	formatName  string
+	format      Format
+
+	in      chan Record
+	stop    chan struct{}
+	done    chan struct{}
+	dropped atomic.Uint64
+	once    sync.Once
+
+	mu     sync.Mutex
+	err    error
+	files  []string
+	untap  []func()
+	closed bool
+
+	// Owned by the writer goroutine.
+	file    *os.File
+	counter *countingWriter
+	gz      *gzip.Writer
+	w       Writer
+	opened  time.Time
+}
+
+// NewRecorder opens the first log file and starts recording bus. With
+// rotation enabled every file name gets a timestamp before the extension,
+// e.g. drive-20261017-153000.log; otherwise path is used as is.
+func NewRecorder(bus *gocan.Bus, path string, opts ...RecorderOption) (*Recorder, error) {
+	r := &Recorder{
+		bus:     bus,
+		path:    path,
+		channel: DefaultChannel,
+		in:      make(chan Record, recorderBuffer),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	var err error
+	if r.formatName != "" {
+		r.format, err = LookupFormat(r.formatName)
+	} else if r.format, err = FormatForPath(path); err != nil {
+		r.format, err = LookupFormat("candump")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := r.open(time.Now()); err != nil {
+		return nil, err
+	}
+
+	r.Attach(bus, r.channel)
+	go func() {
+		defer close(r.done)
+		r.run()
+	}()
+	return r, nil
+}
+
+// Attach records another bus into the same file, under the given channel
+// name, so e.g. a gateway's two sides end up in one capture. The returned
+// function stops recording bus; Close stops all of them.
+func (r *Recorder) Attach(bus *gocan.Bus, channel string) (detach func()) {
+	untaps := []func(){bus.OnReceive(func(f gocan.Frame) {
+		r.queue(Record{Time: f.Timestamp, Channel: channel, Frame: f})
+	})}
+	if r.sent {
+		untaps = append(untaps, bus.OnSend(func(f gocan.Frame) {
+			r.queue(Record{Time: time.Now(), Channel: channel, Frame: f, Tx: true})
+		}))
+	}
+	var once sync.Once
+	detach = func() {
+		once.Do(func() {
+			for _, untap := range untaps {
+				untap()
+			}
+		})
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		detach()
+		return func() {}
+	}
+	r.untap = append(r.untap, detach)
+	return detach
+}
+
+func (r *Recorder) queue(rec Record) {
+	select {
+	case r.in <- rec:
+	default:
+		r.dropped.Add(1)
+	}
+}
+
+// Dropped returns how many frames were lost because the file could not keep
+// up.
+func (r *Recorder) Dropped() uint64 { return r.dropped.Load() }
+
+// Files returns the names of the log files written so far.
+func (r *Recorder) Files() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.files...)
+}
+
+// Close stops recording, writes out the queued frames and closes the file.
+// It returns the first write error.
+func (r *Recorder) Close() error {
+	r.once.Do(func() {
+		r.mu.Lock()
+		r.closed = true
+		untaps := r.untap
+		r.mu.Unlock()
+		for _, untap := range untaps {
+			untap()
+		}
+		close(r.stop)
+		<-r.done
+	})
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+func (r *Recorder) run() {
+	tick := time.NewTicker(flushInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case rec := <-r.in:
+			r.write(rec)
+		case now := <-tick.C:
+			if r.rotateEvery > 0 && now.Sub(r.opened) >= r.rotateEvery {
+				r.rotate(now)
+			} else {
+				r.flush()
+			}
+		case <-r.stop:
+			for {
+				select {
+				case rec := <-r.in:
+					r.write(rec)
+				default:
+					r.fail(r.closeFile())
+					return
+				}
+			}
+		}
+	}
+}
+
+func (r *Recorder) write(rec Record) {
+	if r.w == nil {
+		return // a previous error closed the file
+	}
+	if err := r.w.Write(rec); err != nil {
+		r.fail(err)
+		return
+	}
+	if r.rotateSize > 0 && r.counter.n >= r.rotateSize {
+		r.rotate(time.Now())
+	}
+}
+
+func (r *Recorder) rotate(now time.Time) {
+	if r.w == nil {
+		return
+	}
+	if err := r.closeFile(); err != nil {
+		r.fail(err)
+		return
+	}
+	r.fail(r.open(now))
+}
+
+// fail records the first error and reports it on the bus.
+func (r *Recorder) fail(err error) {
+	if err == nil {
+		return
+	}
+	r.mu.Lock()
+	if r.err == nil {
+		r.err = err
+	}
+	r.mu.Unlock()
+	r.bus.Emit(gocan.Event{Type: gocan.EventTypeError, Details: "canlog: recording failed: " + err.Error(), Err: err})
+	if r.file != nil {
+		r.file.Close()
+		r.file, r.w, r.gz = nil, nil, nil
+	}
+}
+
+func (r *Recorder) flush() {
+	if r.w == nil {
+		return
+	}
+	err := r.w.Flush()
+	if err == nil && r.gz != nil {
+		err = r.gz.Flush()
+	}
+	r.fail(err)
+}
+
+func (r *Recorder) closeFile() error {
+	if r.w == nil {
+		return nil
+	}
+	err := r.w.Close()
+	if r.gz != nil {
+		err = errors.Join(err, r.gz.Close())
+	}
+	err = errors.Join(err, r.file.Close())
+	r.file, r.w, r.gz = nil, nil, nil
+	return err
+}
+
+func (r *Recorder) open(now time.Time) error {
+	path := r.path
+	if r.gzip {
+		path = strings.TrimSuffix(path, ".gz")
+	}
+	rotating := r.rotateSize > 0 || r.rotateEvery > 0
+	var f *os.File
+	var err error
+	if !rotating {
+		if r.gzip {
+			path += ".gz"
+		}
+		f, err = os.Create(path)
+	} else {
+		ext := filepath.Ext(path)
+		stem := strings.TrimSuffix(path, ext) + "-" + now.Format("20060102-150405")
+		if r.gzip {
+			ext += ".gz"
+		}
+		for i := 0; ; i++ {
+			path = stem + ext
+			if i > 0 {
+				path = stem + "-" + strconv.Itoa(i) + ext
+			}
+			f, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+			if !errors.Is(err, fs.ErrExist) {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("canlog: %w", err)
+	}
+	r.file, r.opened = f, now
+	var w io.Writer = f
+	if r.gzip {
+		r.gz = gzip.NewWriter(f)
+		w = r.gz
+	}
+	r.counter = &countingWriter{w: w}
+	r.w = r.format.NewWriter(r.counter)
+	if cw, ok := r.w.(*CandumpWriter); ok {
+		cw.Direction = r.sent
+	}
+	r.mu.Lock()
+	r.files = append(r.files, path)
+	r.mu.Unlock()
+	return nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Seek lets formats that complete their header on Close (BLF, MDF) reach an
+// uncompressed file.
+func (c *countingWriter) Seek(offset int64, whence int) (int64, error) {
+	s, ok := c.w.(io.Seeker)
+	if !ok {
+		return 0, errors.New("canlog: log is not seekable")
+	}
+	return s.Seek(offset, whence)
+}
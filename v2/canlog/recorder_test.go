@@ -0,0 +1,120 @@
+package canlog
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	gocan "github.com/roffe/gocan/v2"
+)
+
+func TestRecorderRotateGzip(t *testing.T) {
+	bus, err := gocan.Open(t.Context(), "loopback", gocan.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bus.Close()
+
+	rec, err := NewRecorder(bus, filepath.Join(t.TempDir(), "drive.log"),
+		WithSent(), WithGzip(), WithRotateSize(1024), WithChannel("vcan0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const n = 500
+	for i := range n {
+		bus.Send(t.Context(), gocan.NewFrame(0x100+uint32(i%16), []byte{byte(i), 1, 2, 3, 4, 5, 6, 7}))
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files := rec.Files()
+	if len(files) < 2 {
+		t.Fatalf("want rotation, got files %v", files)
+	}
+	var tx, rx int
+	for _, name := range files {
+		if filepath.Ext(name) != ".gz" {
+			t.Errorf("%s is not gzipped", name)
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := NewCandumpReader(zr)
+		for {
+			rec, err := r.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rec.Channel != "vcan0" {
+				t.Fatalf("channel %q", rec.Channel)
+			}
+			if rec.Tx {
+				tx++
+			} else {
+				rx++
+			}
+		}
+		f.Close()
+	}
+	if tx != n || rx != n || rec.Dropped() != 0 {
+		t.Fatalf("tx %d rx %d dropped %d, want %d each", tx, rx, rec.Dropped(), n)
+	}
+}
+
+func TestRecorderFormat(t *testing.T) {
+	bus, err := gocan.Open(t.Context(), "loopback", gocan.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bus.Close()
+
+	for _, name := range []string{"asc", "blf"} {
+		path := filepath.Join(t.TempDir(), "drive."+name)
+		rec, err := NewRecorder(bus, path, WithSent())
+		if err != nil {
+			t.Fatal(err)
+		}
+		bus.Send(t.Context(), gocan.NewExtendedFrame(0x18DAF110, []byte{0x02, 0x10, 0x03}))
+		if err := rec.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		r, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Format.Name != name {
+			t.Fatalf("recorded %s, want %s", r.Format.Name, name)
+		}
+		var n int
+		for {
+			_, err := r.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			n++
+		}
+		r.Close()
+		if n != 2 {
+			t.Fatalf("%s: read %d records, want 2", name, n)
+		}
+	}
+
+	if _, err := NewRecorder(bus, filepath.Join(t.TempDir(), "x.log"), WithFormat("nope")); err == nil {
+		t.Fatal("accepted unknown format")
+	}
+}
@@ -0,0 +1,380 @@
+package canlog
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	gocan "github.com/roffe/gocan/v2"
+)
+
+func init() {
+	RegisterFormat(Format{
+		Name:        "trc",
+		Description: "PEAK-System trace (PCAN-View), versions 1.1 and 2.x",
+		Extensions:  []string{".trc"},
+		Detect: func(head []byte) bool {
+			head = bytes.TrimSpace(head)
+			return bytes.HasPrefix(head, []byte(";$FILEVERSION=")) ||
+				bytes.HasPrefix(head, []byte(";")) && bytes.Contains(head, []byte("Message Number"))
+		},
+		NewReader: func(r io.Reader) Reader { return NewTRCReader(r) },
+		NewWriter: func(w io.Writer) Writer { return NewTRCWriter(w) },
+	})
+}
+
+// oleEpoch is day zero of the OLE automation dates PEAK uses for
+// $STARTTIME.
+var oleEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// fromOLE converts an OLE date, which holds local wall-clock time.
+func fromOLE(days float64) time.Time {
+	whole := math.Floor(days)
+	us := math.Round((days - whole) * float64(24*time.Hour/time.Microsecond))
+	t := oleEpoch.AddDate(0, 0, int(whole)).Add(time.Duration(us) * time.Microsecond)
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.Local)
+}
+
+func toOLE(t time.Time) float64 {
+	t = t.Local()
+	d := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC).Sub(oleEpoch)
+	const day = 24 * time.Hour
+	return float64(d/day) + float64(d%day)/float64(day)
+}
+
+// TRCWriter writes PEAK trace files with offsets from the first record.
+type TRCWriter struct {
+	// Version is the file version to write: "2.1" (the default) or "1.1".
+	// Version 1.1 has no bus column and stores offsets in tenths of a
+	// millisecond.
+	Version string
+
+	w     *bufio.Writer
+	start time.Time // zero until the header is written
+	n     int
+	buf   []byte
+}
+
+// NewTRCWriter writes a version 2.1 trace to w. Call Close when done.
+func NewTRCWriter(w io.Writer) *TRCWriter {
+	return &TRCWriter{Version: "2.1", w: bufio.NewWriter(w)}
+}
+
+const trcRule = ";-------------------------------------------------------------------------------\n"
+
+func (tw *TRCWriter) header(start time.Time) error {
+	if tw.Version != "1.1" && tw.Version != "2.1" {
+		return fmt.Errorf("trc: cannot write version %q", tw.Version)
+	}
+	tw.start = start.Truncate(time.Millisecond)
+	fmt.Fprintf(tw.w, ";$FILEVERSION=%s\n;$STARTTIME=%s\n", tw.Version, strconv.FormatFloat(toOLE(tw.start), 'f', -1, 64))
+	if tw.Version == "2.1" {
+		tw.w.WriteString(";$COLUMNS=N,O,T,B,I,d,R,L,D\n")
+	}
+	fmt.Fprintf(tw.w, ";\n;   Start time: %s.0\n;   Generated by gocan\n", tw.start.Local().Format("02.01.2006 15:04:05.000"))
+	tw.w.WriteString(trcRule)
+	var err error
+	if tw.Version == "1.1" {
+		_, err = tw.w.WriteString(";   Message Number\n" +
+			";   |         Time Offset (ms)\n" +
+			";   |         |        Type\n" +
+			";   |         |        |        ID (hex)\n" +
+			";   |         |        |        |     Data Length Code\n" +
+			";   |         |        |        |     |   Data Bytes (hex) ...\n" +
+			";   |         |        |        |     |   |\n" +
+			";---+--   ----+----  --+--  ----+---  +  -+ -- -- -- -- -- -- --\n")
+	} else {
+		_, err = tw.w.WriteString(";   Message   Time    Type ID     Rx/Tx\n" +
+			";   Number    Offset  |    Bus    [hex]  |  Reserved\n" +
+			";   |         [ms]    |    |      |      |  |  Data Length Code\n" +
+			";   |         |       |    |      |      |  |  |    Data [hex] ...\n" +
+			";   |         |       |    |      |      |  |  |    |\n" +
+			";---+-- ------+------ +- --+----- +- +- +- +- -- -- -- -- -- -- --\n")
+	}
+	return err
+}
+
+// Write writes one record. Error frames are skipped.
+func (tw *TRCWriter) Write(r Record) error {
+	if r.Error {
+		return nil
+	}
+	if tw.start.IsZero() {
+		if err := tw.header(r.Time); err != nil {
+			return err
+		}
+	}
+	tw.n++
+	f := r.Frame
+	offset := max(r.Time.Sub(tw.start), 0)
+	id := fmt.Sprintf("%04X", f.ID)
+	if f.Extended {
+		id = fmt.Sprintf("%08X", f.ID)
+	}
+	dir := "Rx"
+	if r.Tx {
+		dir = "Tx"
+	}
+	b := tw.buf[:0]
+	if tw.Version == "1.1" && f.FD {
+		return fmt.Errorf("trc: version 1.1 has no CAN FD frames")
+	}
+	if tw.Version == "1.1" {
+		b = fmt.Appendf(b, "%6d)%12s  %s %12s  %d", tw.n, appendFixed(nil, offset, time.Millisecond, 1), dir, id, f.Length)
+		if f.Remote {
+			b = append(b, "  RTR"...)
+		} else {
+			b = append(b, ' ')
+		}
+	} else {
+		typ := "DT"
+		switch {
+		case f.Remote:
+			typ = "RR"
+		case f.FD:
+			typ = trcFDTypes[trcFDType(f.BRS, f.ESI)]
+		}
+		b = fmt.Appendf(b, "%7d %13s %s %2d %s %s - %2d", tw.n, appendFixed(nil, offset, time.Millisecond, 3),
+			typ, channelIndex(r.Channel)+1, id, dir, f.DLC())
+		if !f.Remote {
+			b = append(b, "   "...)
+		}
+	}
+	if !f.Remote {
+		for _, c := range f.Bytes() {
+			b = append(b, ' ', hexDigits[c>>4], hexDigits[c&0x0F])
+		}
+	}
+	b = append(b, '\n')
+	tw.buf = b
+	_, err := tw.w.Write(b)
+	return err
+}
+
+// Flush writes buffered lines to the underlying writer.
+func (tw *TRCWriter) Flush() error {
+	return tw.w.Flush()
+}
+
+// Close writes the header if nothing was written and flushes.
+func (tw *TRCWriter) Close() error {
+	if tw.start.IsZero() {
+		if err := tw.header(time.Now()); err != nil {
+			return err
+		}
+	}
+	return tw.w.Flush()
+}
+
+// trcFDTypes are the 2.x CAN FD message types, indexed by trcFDType.
+var trcFDTypes = [4]string{"FD", "FB", "FE", "BI"}
+
+func trcFDType(brs, esi bool) int {
+	i := 0
+	if brs {
+		i |= 1
+	}
+	if esi {
+		i |= 2
+	}
+	return i
+}
+
+// TRCReader reads PEAK trace files, versions 1.1, 2.0 and 2.1. CAN and
+// CAN FD data and remote frames are returned; status and error events are
+// skipped.
+type TRCReader struct {
+	s       *bufio.Scanner
+	line    int
+	version string
+	start   time.Time
+	columns string // 2.x column letters, e.g. "NOTBIdRLD"
+}
+
+// NewTRCReader reads a trace from r.
+func NewTRCReader(r io.Reader) *TRCReader {
+	return &TRCReader{s: bufio.NewScanner(r), start: time.Unix(0, 0)}
+}
+
+// Read returns the next record, or io.EOF at the end of the trace.
+func (tr *TRCReader) Read() (Record, error) {
+	for tr.s.Scan() {
+		tr.line++
+		line := strings.TrimSpace(tr.s.Text())
+		if line == "" {
+			continue
+		}
+		if line[0] == ';' {
+			if err := tr.directive(line); err != nil {
+				return Record{}, fmt.Errorf("trc: line %d: %w", tr.line, err)
+			}
+			continue
+		}
+		var r Record
+		var ok bool
+		var err error
+		switch tr.version {
+		case "1.1":
+			r, ok, err = tr.parse11(strings.Fields(line))
+		case "2.0", "2.1":
+			r, ok, err = tr.parse2(strings.Fields(line))
+		case "":
+			err = fmt.Errorf("no $FILEVERSION; version 1.0 traces are not supported")
+		default:
+			err = fmt.Errorf("unsupported file version %q", tr.version)
+		}
+		if err != nil {
+			return Record{}, fmt.Errorf("trc: line %d: %w", tr.line, err)
+		}
+		if ok {
+			return r, nil
+		}
+	}
+	if err := tr.s.Err(); err != nil {
+		return Record{}, err
+	}
+	return Record{}, io.EOF
+}
+
+func (tr *TRCReader) directive(line string) error {
+	key, value, ok := strings.Cut(strings.TrimPrefix(line, ";$"), "=")
+	if !ok || !strings.HasPrefix(line, ";$") {
+		return nil // comment
+	}
+	switch key {
+	case "FILEVERSION":
+		tr.version = value
+		switch value {
+		case "2.0":
+			tr.columns = "NOTIdlD"
+		case "2.1":
+			tr.columns = "NOTBIdRLD"
+		}
+	case "STARTTIME":
+		days, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("malformed start time %q", value)
+		}
+		tr.start = fromOLE(days)
+	case "COLUMNS":
+		tr.columns = strings.ReplaceAll(value, ",", "")
+	}
+	return nil
+}
+
+// parse11 parses "     1)      1841.0  Rx         0001  8  00 11 ...".
+func (tr *TRCReader) parse11(fields []string) (r Record, ok bool, err error) {
+	if len(fields) < 5 {
+		return r, false, fmt.Errorf("malformed line")
+	}
+	switch fields[2] {
+	case "Rx":
+	case "Tx":
+		r.Tx = true
+	default:
+		return r, false, nil // Warng, Error
+	}
+	at, err := parseFixed(fields[1], time.Millisecond)
+	if err != nil {
+		return r, false, err
+	}
+	r.Time, r.Channel = tr.start.Add(at), DefaultChannel
+	data := fields[5:]
+	if len(data) > 0 && data[0] == "RTR" {
+		r.Frame.Remote, data = true, nil
+	}
+	r.Frame, err = trcFrame(r.Frame, fields[3], fields[4], data)
+	return r, err == nil, err
+}
+
+// parse2 parses a 2.x line according to the $COLUMNS layout.
+func (tr *TRCReader) parse2(fields []string) (r Record, ok bool, err error) {
+	var typ, id, length string
+	var data []string
+	var dlc bool // length is a data length code
+	bus := 1
+	for i, col := range tr.columns {
+		if i >= len(fields) {
+			break
+		}
+		v := fields[i]
+		switch col {
+		case 'O':
+			at, err := parseFixed(v, time.Millisecond)
+			if err != nil {
+				return r, false, err
+			}
+			r.Time = tr.start.Add(at)
+		case 'T':
+			typ = v
+		case 'B':
+			if bus, err = strconv.Atoi(v); err != nil {
+				return r, false, fmt.Errorf("malformed bus %q", v)
+			}
+		case 'I':
+			id = v
+		case 'd':
+			r.Tx = v == "Tx"
+		case 'l', 'L':
+			length, dlc = v, col == 'L'
+		case 'D':
+			data = fields[i:]
+		}
+	}
+	switch typ {
+	case "DT":
+	case "RR":
+		r.Frame.Remote, data = true, nil
+	case "FD", "FB", "FE", "BI":
+		i := slices.Index(trcFDTypes[:], typ)
+		r.Frame.FD, r.Frame.BRS, r.Frame.ESI = true, i&1 != 0, i&2 != 0
+		if dlc {
+			code, err := strconv.ParseUint(length, 10, 8)
+			if err != nil || code > 15 {
+				return r, false, fmt.Errorf("malformed DLC %q", length)
+			}
+			length = strconv.Itoa(int(gocan.DLCLength(uint8(code))))
+		}
+	default:
+		return r, false, nil // status, error and event records
+	}
+	r.Channel = channelName(bus - 1)
+	r.Frame, err = trcFrame(r.Frame, id, length, data)
+	return r, err == nil, err
+}
+
+func trcFrame(f gocan.Frame, id, length string, data []string) (gocan.Frame, error) {
+	v, err := strconv.ParseUint(id, 16, 32)
+	if err != nil {
+		return f, fmt.Errorf("malformed identifier %q", id)
+	}
+	f.ID, f.Extended = uint32(v), len(id) > 4
+	if f.Extended && v > 0x1FFFFFFF || !f.Extended && v > 0x7FF {
+		return f, fmt.Errorf("identifier %q out of range", id)
+	}
+	n, err := strconv.Atoi(length)
+	if err != nil || n < 0 || n > 8 && !f.FD || n > gocan.MaxFDLength {
+		return f, fmt.Errorf("malformed length %q", length)
+	}
+	f.Length = uint8(n)
+	if f.Remote {
+		return f, nil
+	}
+	if len(data) < n {
+		return f, fmt.Errorf("want %d data bytes", n)
+	}
+	for i, s := range data[:n] {
+		c, err := strconv.ParseUint(s, 16, 8)
+		if err != nil {
+			return f, fmt.Errorf("malformed data byte %q", s)
+		}
+		f.Data[i] = byte(c)
+	}
+	return f, nil
+}
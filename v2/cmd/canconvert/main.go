@@ -0,0 +1,86 @@
+// Command canconvert converts CAN logs between the formats canlog knows
+// (candump, Vector ASC and BLF, PEAK TRC, SavvyCAN CSV, pcap and pcapng,
+// ASAM MDF 4). The input format is detected from its content; the output
+// format follows the output file's extension unless -to is given. "-" reads
+// stdin or writes stdout.
+//
+//	canconvert -list
+//	canconvert capture.asc capture.trc
+//	canconvert -to candump capture.csv.gz - | canplayer
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/roffe/gocan/v2/canlog"
+)
+
+func main() {
+	to := flag.String("to", "", "output format (see -list); default from the output file extension")
+	list := flag.Bool("list", false, "list log formats and exit")
+	flag.Parse()
+
+	if *list {
+		for _, f := range canlog.Formats() {
+			fmt.Println(f)
+		}
+		return
+	}
+	if flag.NArg() != 2 {
+		log.Fatal("usage: canconvert [-to format] input output")
+	}
+	if err := convert(flag.Arg(0), flag.Arg(1), *to); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func convert(in, out, to string) error {
+	var r canlog.Reader
+	var from canlog.Format
+	if in == "-" {
+		var err error
+		if r, from, err = canlog.NewReader(os.Stdin); err != nil {
+			return err
+		}
+	} else {
+		f, err := canlog.Open(in)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r, from = f, f.Format
+	}
+
+	var w canlog.Writer
+	var format canlog.Format
+	if out == "-" {
+		if to == "" {
+			return errors.New("-to is required when writing to stdout")
+		}
+		var err error
+		if format, err = canlog.LookupFormat(to); err != nil {
+			return err
+		}
+		w = format.NewWriter(os.Stdout)
+	} else {
+		f, err := canlog.Create(out, to)
+		if err != nil {
+			return err
+		}
+		w, format = f, f.Format
+	}
+
+	n, err := canlog.Copy(w, r)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%d frames, %s -> %s\n", n, from.Name, format.Name)
+	return nil
+}
@@ -0,0 +1,42 @@
+// Command cangateway shares the gocan v2 adapters of this machine over the
+// gRPC Gocan service, on a Unix socket (a named pipe on Windows), so several
+// tools can use one adapter at once through the "gateway" adapter or the v1
+// GWClient. It runs until interrupted.
+//
+//	cangateway
+//	cangateway -address /run/cangateway.sock -v
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+
+	gocan "github.com/roffe/gocan/v2"
+	_ "github.com/roffe/gocan/v2/adapters/all"
+	"github.com/roffe/gocan/v2/server"
+)
+
+func main() {
+	address := flag.String("address", server.DefaultAddress, "socket or named pipe to listen on")
+	verbose := flag.Bool("v", false, "list the adapters on offer at startup")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	lis, err := server.Listen(*address)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *verbose {
+		for _, info := range gocan.Adapters() {
+			log.Println(info)
+		}
+	}
+	log.Println("listening on", *address)
+	if err := server.New().Serve(ctx, lis); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,116 @@
+package dbc
+
+import (
+	"context"
+	"fmt"
+
+	gocan "github.com/roffe/gocan/v2"
+)
+
+// Decoded is a received frame with its message and signal values.
+type Decoded struct {
+	Message *Message
+	Frame   gocan.Frame
+	Values  []Value
+}
+
+// Value returns the decoded value of the named signal; ok is false when the
+// frame did not carry it.
+func (d Decoded) Value(signal string) (Value, bool) {
+	for _, v := range d.Values {
+		if v.Signal.Name == signal {
+			return v, true
+		}
+	}
+	return Value{}, false
+}
+
+// Subscribe delivers every frame of the named messages (no names = every
+// message in the database), decoded. Frames the database does not describe
+// are not delivered. The channel is closed when ctx is cancelled or the bus
+// terminates; like Bus.Subscribe, a consumer that stops draining loses
+// frames.
+func (db *Database) Subscribe(ctx context.Context, bus *gocan.Bus, messages ...string) (<-chan Decoded, error) {
+	var msgs []*Message
+	if len(messages) == 0 {
+		msgs = db.Messages
+	}
+	for _, name := range messages {
+		m := db.byName[name]
+		if m == nil {
+			return nil, fmt.Errorf("dbc: no message %q", name)
+		}
+		msgs = append(msgs, m)
+	}
+	in := bus.Subscribe(ctx, messageIDs(msgs)...)
+	out := make(chan Decoded, cap(in))
+	go func() {
+		defer close(out)
+		for f := range in {
+			m := db.MessageByID(f.ID, f.Extended)
+			if m == nil {
+				continue // same identifier, other format
+			}
+			select {
+			case out <- Decoded{Message: m, Frame: f, Values: m.Decode(f.Bytes())}:
+			default:
+			}
+		}
+	}()
+	return out, nil
+}
+
+// SubscribeSignals delivers the values of the named signals, each as
+// "Message.Signal" or as a bare signal name when that is unique. A frame
+// yields one Value per requested signal it carries; multiplexed signals
+// only arrive with their multiplexor value.
+func (db *Database) SubscribeSignals(ctx context.Context, bus *gocan.Bus, signals ...string) (<-chan Value, error) {
+	if len(signals) == 0 {
+		return nil, fmt.Errorf("dbc: no signals to subscribe to")
+	}
+	want := make(map[*Signal]bool)
+	var msgs []*Message
+	for _, name := range signals {
+		s, err := db.lookupSignal(name)
+		if err != nil {
+			return nil, err
+		}
+		if !want[s] {
+			want[s] = true
+			msgs = append(msgs, s.message)
+		}
+	}
+	in := bus.Subscribe(ctx, messageIDs(msgs)...)
+	out := make(chan Value, cap(in))
+	go func() {
+		defer close(out)
+		for f := range in {
+			m := db.MessageByID(f.ID, f.Extended)
+			if m == nil {
+				continue
+			}
+			for _, v := range m.Decode(f.Bytes()) {
+				if !want[v.Signal] {
+					continue
+				}
+				select {
+				case out <- v:
+				default:
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+func messageIDs(msgs []*Message) []uint32 {
+	ids := make([]uint32, 0, len(msgs))
+	seen := make(map[uint32]bool)
+	for _, m := range msgs {
+		if !seen[m.ID] {
+			seen[m.ID] = true
+			ids = append(ids, m.ID)
+		}
+	}
+	return ids
+}
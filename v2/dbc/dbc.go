@@ -0,0 +1,183 @@
+// Package dbc reads Vector CAN database (DBC) files and decodes gocan v2
+// frames into physical signal values.
+//
+//	db, err := dbc.ParseFile("body.dbc")
+//	msg, vals, err := db.Decode(frame)
+//	for _, v := range vals {
+//		fmt.Println(v) // "EngineSpeed = 1726 rpm"
+//	}
+//
+// Messages and signals can also be subscribed to by name on a bus, see
+// Database.Subscribe and Database.SubscribeSignals. Going the other way,
+// Encode packs physical values into a frame ready for Bus.Send:
+//
+//	f, err := db.Encode("Engine", map[string]float64{"EngineSpeed": 850})
+//
+// Supported: messages with standard and extended identifiers, Intel and
+// Motorola signals of up to 64 bits, signedness, IEEE float signals
+// (SIG_VALTYPE_), factor/offset, ranges, units, value tables (VAL_ and
+// VAL_TABLE_), simple multiplexing, comments and attribute values.
+package dbc
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Database is a parsed DBC file.
+type Database struct {
+	Version     string
+	Nodes       []string
+	Messages    []*Message // in file order
+	ValueTables map[string]map[int64]string
+	// Attributes holds the network-level attribute values (BA_ "name" v;)
+	// and AttributeDefaults the defaults of every attribute (BA_DEF_DEF_).
+	Attributes        map[string]string
+	AttributeDefaults map[string]string
+
+	byID   map[msgKey]*Message
+	byName map[string]*Message
+}
+
+type msgKey struct {
+	id       uint32
+	extended bool
+}
+
+// Message is a frame definition (BO_).
+type Message struct {
+	ID         uint32
+	Extended   bool
+	Name       string
+	Length     uint8
+	Sender     string
+	Signals    []*Signal // in file order
+	Comment    string
+	Attributes map[string]string
+
+	db          *Database
+	multiplexer *Signal
+}
+
+// ByteOrder is the bit layout of a signal.
+type ByteOrder int
+
+const (
+	LittleEndian ByteOrder = iota // Intel, @1: start bit is the LSB
+	BigEndian                     // Motorola, @0: start bit is the MSB
+)
+
+// ValueType is how a signal's raw bits are interpreted.
+type ValueType int
+
+const (
+	Integer ValueType = iota
+	Float32
+	Float64
+)
+
+// Signal is a field of a message (SG_).
+type Signal struct {
+	Name      string
+	StartBit  int
+	Length    int
+	ByteOrder ByteOrder
+	Signed    bool
+	Type      ValueType
+	Factor    float64
+	Offset    float64
+	Min, Max  float64
+	Unit      string
+	Receivers []string
+	Comment   string
+	// Values maps raw values to their descriptions (VAL_).
+	Values     map[int64]string
+	Attributes map[string]string
+
+	// IsMultiplexer marks the multiplexor switch (M) of its message.
+	IsMultiplexer bool
+	// Multiplexed signals (mN) are only present when the multiplexor's raw
+	// value equals MuxValue.
+	Multiplexed bool
+	MuxValue    uint64
+
+	message *Message
+}
+
+// Message returns the message the signal belongs to.
+func (s *Signal) Message() *Message { return s.message }
+
+// Message returns the message called name, or nil.
+func (db *Database) Message(name string) *Message { return db.byName[name] }
+
+// MessageByID returns the message with the given identifier, or nil.
+func (db *Database) MessageByID(id uint32, extended bool) *Message {
+	return db.byID[msgKey{id, extended}]
+}
+
+// Signal returns the signal called name, or nil.
+func (m *Message) Signal(name string) *Signal {
+	for _, s := range m.Signals {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// Multiplexer returns the message's multiplexor switch, or nil.
+func (m *Message) Multiplexer() *Signal { return m.multiplexer }
+
+// Attribute returns the value of a message attribute, falling back to the
+// database default; ok is false when neither is set.
+func (m *Message) Attribute(name string) (string, bool) {
+	if v, ok := m.Attributes[name]; ok {
+		return v, true
+	}
+	v, ok := m.db.AttributeDefaults[name]
+	return v, ok
+}
+
+// CycleTime returns the GenMsgCycleTime attribute in milliseconds, or 0 for
+// messages that are not sent periodically.
+func (m *Message) CycleTime() int {
+	v, _ := m.Attribute("GenMsgCycleTime")
+	n, _ := strconv.Atoi(v)
+	return n
+}
+
+func (m *Message) String() string {
+	if m.Extended {
+		return fmt.Sprintf("%s (0x%08X)", m.Name, m.ID)
+	}
+	return fmt.Sprintf("%s (0x%03X)", m.Name, m.ID)
+}
+
+// lookupSignal resolves "Message.Signal", or a bare signal name that is
+// unique across the database.
+func (db *Database) lookupSignal(name string) (*Signal, error) {
+	for i := len(name) - 1; i > 0; i-- {
+		if name[i] != '.' {
+			continue
+		}
+		if m := db.byName[name[:i]]; m != nil {
+			if s := m.Signal(name[i+1:]); s != nil {
+				return s, nil
+			}
+		}
+		break
+	}
+	var found *Signal
+	for _, m := range db.Messages {
+		if s := m.Signal(name); s != nil {
+			if found != nil {
+				return nil, fmt.Errorf("dbc: signal %q is ambiguous (%s, %s); use Message.Signal", name, found.message.Name, m.Name)
+			}
+			found = s
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("dbc: no signal %q", name)
+	}
+	return found, nil
+}
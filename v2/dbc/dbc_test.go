@@ -0,0 +1,266 @@
+package dbc
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	gocan "github.com/roffe/gocan/v2"
+)
+
+const testDBC = `VERSION "1.0"
+
+NS_ :
+	NS_DESC_
+	CM_
+	BA_DEF_
+	VAL_
+
+BS_:
+
+BU_: ECM TCM Cluster
+
+VAL_TABLE_ GearTable 0 "P" 1 "R" 2 "N" 3 "D" ;
+
+BO_ 256 Engine: 8 ECM
+ SG_ EngineSpeed : 0|16@1+ (0.25,0) [0|16383.75] "rpm" TCM,Cluster
+ SG_ CoolantTemp : 16|8@1+ (1,-40) [-40|215] "degC" Cluster
+ SG_ Torque : 24|12@1- (0.5,0) [-1024|1023.5] "Nm" TCM
+
+BO_ 512 Transmission: 8 TCM
+ SG_ Gear : 7|4@0+ (1,0) [0|15] "" Cluster
+ SG_ OutputSpeed : 3|12@0+ (1,0) [0|4095] "rpm" Cluster
+ SG_ OilTemp : 23|16@0- (0.1,0) [-3276.8|3276.7] "degC" Cluster
+
+BO_ 2566844672 Diag: 8 Cluster
+ SG_ Page M : 0|8@1+ (1,0) [0|255] "" ECM
+ SG_ Odometer m0 : 8|32@1+ (0.1,0) [0|429496729.5] "km" ECM
+ SG_ Fuel m1 : 8|8@1+ (0.5,0) [0|100] "%" ECM
+ SG_ Ratio m1 : 32|32@1+ (1,0) [0|0] "" ECM
+
+BO_ 3221225472 VECTOR__INDEPENDENT_SIG_MSG: 0 Vector__XXX
+ SG_ Orphan : 0|8@1+ (1,0) [0|0] "" Vector__XXX
+
+CM_ "Test database";
+CM_ BO_ 256 "Engine status, 10 ms";
+CM_ SG_ 256 EngineSpeed "Crankshaft speed
+over two lines";
+BA_DEF_ BO_ "GenMsgCycleTime" INT 0 65535;
+BA_DEF_DEF_ "GenMsgCycleTime" 0;
+BA_ "GenMsgCycleTime" BO_ 256 10;
+VAL_ 512 Gear 0 "P" 1 "R" 2 "N" 3 "D" ;
+SIG_VALTYPE_ 2566844672 Ratio : 1;
+`
+
+func parseTest(t *testing.T) *Database {
+	t.Helper()
+	db, err := Parse([]byte(testDBC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestParse(t *testing.T) {
+	db := parseTest(t)
+	if db.Version != "1.0" || len(db.Nodes) != 3 || len(db.Messages) != 3 {
+		t.Fatalf("version %q nodes %v messages %d", db.Version, db.Nodes, len(db.Messages))
+	}
+	eng := db.Message("Engine")
+	if eng == nil || eng.ID != 0x100 || eng.Extended || eng.Sender != "ECM" {
+		t.Fatalf("Engine: %+v", eng)
+	}
+	if eng.Comment != "Engine status, 10 ms" || eng.CycleTime() != 10 || db.Message("Transmission").CycleTime() != 0 {
+		t.Errorf("comment %q cycle %d", eng.Comment, eng.CycleTime())
+	}
+	rpm := eng.Signal("EngineSpeed")
+	if rpm.Factor != 0.25 || rpm.Unit != "rpm" || len(rpm.Receivers) != 2 || rpm.Comment != "Crankshaft speed\nover two lines" {
+		t.Errorf("EngineSpeed: %+v", rpm)
+	}
+	diag := db.MessageByID(0x18FEF100, true)
+	if diag == nil || diag.Multiplexer().Name != "Page" || diag.Signal("Ratio").Type != Float32 {
+		t.Fatalf("Diag: %+v", diag)
+	}
+	if db.ValueTables["GearTable"][3] != "D" {
+		t.Errorf("value table: %v", db.ValueTables)
+	}
+	if db.MessageByID(0, true) != nil {
+		t.Error("independent signal message was kept")
+	}
+}
+
+func TestDecode(t *testing.T) {
+	db := parseTest(t)
+	ratio := math.Float32bits(2.5)
+	for _, tc := range []struct {
+		name  string
+		frame gocan.Frame
+		want  map[string]float64
+	}{
+		{"intel", gocan.NewFrame(0x100, []byte{0xE0, 0x1A, 0x7B, 0x10, 0x08, 0, 0, 0}),
+			map[string]float64{"EngineSpeed": 1720, "CoolantTemp": 83, "Torque": -1016}},
+		// Gear 3 in the high nibble of byte 0, OutputSpeed 0x123 across
+		// bytes 0-1, OilTemp -12.3 in bytes 2-3.
+		{"motorola", gocan.NewFrame(0x200, []byte{0x31, 0x23, 0xFF, 0x85, 0, 0, 0, 0}),
+			map[string]float64{"Gear": 3, "OutputSpeed": 0x123, "OilTemp": -12.3}},
+		{"mux page 0", gocan.NewExtendedFrame(0x18FEF100, []byte{0, 0x10, 0x27, 0, 0, 0, 0, 0}),
+			map[string]float64{"Page": 0, "Odometer": 1000}},
+		{"mux page 1", gocan.NewExtendedFrame(0x18FEF100, []byte{1, 0x64, 0, 0, byte(ratio), byte(ratio >> 8), byte(ratio >> 16), byte(ratio >> 24)}),
+			map[string]float64{"Page": 1, "Fuel": 50, "Ratio": 2.5}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, vals, err := db.Decode(tc.frame)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(vals) != len(tc.want) {
+				t.Fatalf("got %v", vals)
+			}
+			for _, v := range vals {
+				if w, ok := tc.want[v.Signal.Name]; !ok || math.Abs(v.Value-w) > 1e-9 {
+					t.Errorf("%s = %v, want %v", v.Signal.Name, v.Value, w)
+				}
+			}
+		})
+	}
+
+	if _, _, err := db.Decode(gocan.NewFrame(0x100|0x1000, nil)); err == nil {
+		t.Error("unknown identifier decoded")
+	}
+	_, vals, _ := db.Decode(gocan.NewFrame(0x200, []byte{0x20}))
+	if len(vals) != 1 || vals[0].String() != "Gear = N" {
+		t.Errorf("short frame: %v", vals)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, src := range []string{
+		"BO_ 1 A: 8 X\n SG_ S : 0|65@1+ (1,0) [0|0] \"\" X\n",
+		"BO_ 1 A: 8 X\n SG_ S : 0|8@2+ (1,0) [0|0] \"\" X\n",
+		"BO_ 1 A: 8 X\n SG_ S m1 : 0|8@1+ (1,0) [0|0] \"\" X\n",
+		"BO_ 1 A: 8 X\nBO_ 1 B: 8 X\n",
+		" SG_ S : 0|8@1+ (1,0) [0|0] \"\" X\n",
+	} {
+		if _, err := Parse([]byte(src)); err == nil {
+			t.Errorf("accepted %q", src)
+		}
+	}
+}
+
+func TestSubscribeSignals(t *testing.T) {
+	db := parseTest(t)
+	bus, err := gocan.Open(t.Context(), "loopback", gocan.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bus.Close()
+
+	if _, err := db.SubscribeSignals(t.Context(), bus, "Nope"); err == nil {
+		t.Fatal("unknown signal accepted")
+	}
+	vals, err := db.SubscribeSignals(t.Context(), bus, "Engine.CoolantTemp", "Fuel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := db.Subscribe(t.Context(), bus, "Transmission")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus.Send(t.Context(), gocan.NewFrame(0x100, []byte{0, 0, 0x7B, 0, 0, 0, 0, 0}))
+	bus.Send(t.Context(), gocan.NewExtendedFrame(0x18FEF100, []byte{0, 0, 0, 0, 0, 0, 0, 0})) // page 0: no Fuel
+	bus.Send(t.Context(), gocan.NewExtendedFrame(0x18FEF100, []byte{1, 0x64, 0, 0, 0, 0, 0, 0}))
+	bus.Send(t.Context(), gocan.NewFrame(0x200, []byte{0x20, 0, 0, 0, 0, 0, 0, 0}))
+
+	for _, want := range []string{"CoolantTemp = 83 degC", "Fuel = 50 %"} {
+		select {
+		case v := <-vals:
+			if v.String() != want {
+				t.Errorf("got %q want %q", v, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("missing %s", want)
+		}
+	}
+	select {
+	case d := <-msgs:
+		if g, ok := d.Value("Gear"); d.Message.Name != "Transmission" || !ok || g.Label() != "N" {
+			t.Errorf("got %+v", d)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("missing Transmission")
+	}
+}
+
+func TestEncode(t *testing.T) {
+	db := parseTest(t)
+	for _, tc := range []struct {
+		msg    string
+		values map[string]float64
+		want   gocan.Frame
+	}{
+		{"Engine", map[string]float64{"EngineSpeed": 1720, "CoolantTemp": 83, "Torque": -1016},
+			gocan.NewFrame(0x100, []byte{0xE0, 0x1A, 0x7B, 0x10, 0x08, 0, 0, 0})},
+		{"Transmission", map[string]float64{"Gear": 3, "OutputSpeed": 0x123, "OilTemp": -12.3},
+			gocan.NewFrame(0x200, []byte{0x31, 0x23, 0xFF, 0x85, 0, 0, 0, 0})},
+		// Page 1 is implied by Fuel.
+		{"Diag", map[string]float64{"Fuel": 50},
+			gocan.NewExtendedFrame(0x18FEF100, []byte{1, 0x64, 0, 0, 0, 0, 0, 0})},
+		{"Diag", map[string]float64{"Fuel": 50, "Ratio": 2.5},
+			gocan.NewExtendedFrame(0x18FEF100, []byte{1, 0x64, 0, 0, 0x00, 0x00, 0x20, 0x40})},
+		{"Diag", map[string]float64{"Odometer": 1000},
+			gocan.NewExtendedFrame(0x18FEF100, []byte{0, 0x10, 0x27, 0, 0, 0, 0, 0})},
+	} {
+		f, err := db.Encode(tc.msg, tc.values)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.msg, err)
+		}
+		if f != tc.want {
+			t.Errorf("%s:\n got %s\nwant %s", tc.msg, f, tc.want)
+		}
+		// And back again.
+		_, vals, _ := db.Decode(f)
+		for _, v := range vals {
+			if w, ok := tc.values[v.Signal.Name]; ok && math.Abs(v.Value-w) > 1e-9 {
+				t.Errorf("%s: %s decoded as %v, want %v", tc.msg, v.Signal.Name, v.Value, w)
+			}
+		}
+	}
+
+	for _, tc := range []struct {
+		msg    string
+		values map[string]float64
+		want   error
+	}{
+		{"Engine", map[string]float64{"CoolantTemp": 216}, ErrOutOfRange},
+		{"Engine", map[string]float64{"EngineSpeed": -1}, ErrOutOfRange},
+		{"Diag", map[string]float64{"Page": 0, "Fuel": 10}, nil},
+		{"Diag", map[string]float64{"Odometer": 1, "Fuel": 10}, nil},
+		{"Engine", map[string]float64{"Nope": 1}, nil},
+		{"Nope", nil, nil},
+	} {
+		_, err := db.Encode(tc.msg, tc.values)
+		if err == nil || tc.want != nil && !errors.Is(err, tc.want) {
+			t.Errorf("%s %v: got %v", tc.msg, tc.values, err)
+		}
+	}
+}
+
+func TestEncodeFD(t *testing.T) {
+	db, err := Parse([]byte(`BO_ 1024 Battery: 20 BMS
+ SG_ CellVoltage : 144|16@1+ (0.001,0) [0|65.535] "V" Vector__XXX
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := db.Encode("Battery", map[string]float64{"CellVoltage": 3.7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.FD || !f.BRS || f.Length != 20 || f.Data[18] != 0x74 || f.Data[19] != 0x0E {
+		t.Fatalf("got %+v", f)
+	}
+	if _, vals, _ := db.Decode(f); len(vals) != 1 || math.Abs(vals[0].Value-3.7) > 1e-9 {
+		t.Fatalf("decoded %v", vals)
+	}
+}
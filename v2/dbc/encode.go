@@ -0,0 +1,152 @@
+package dbc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	gocan "github.com/roffe/gocan/v2"
+)
+
+// ErrOutOfRange is returned when a value lies outside its signal's
+// [Min, Max] range or does not fit the signal's bits.
+var ErrOutOfRange = errors.New("dbc: value out of range")
+
+// RawValue converts a physical value to the signal's raw bits: (v - Offset)
+// / Factor, rounded to the nearest integer. It fails with ErrOutOfRange when
+// v lies outside [Min, Max] (unless both are 0, which DBC uses for "no
+// range") or the raw value does not fit Length bits.
+func (s *Signal) RawValue(v float64) (uint64, error) {
+	if math.IsNaN(v) || (s.Min != 0 || s.Max != 0) && (v < s.Min || v > s.Max) {
+		return 0, fmt.Errorf("%w: %s = %v, range [%v, %v]", ErrOutOfRange, s.Name, v, s.Min, s.Max)
+	}
+	r := (v - s.Offset) / s.Factor
+	switch s.Type {
+	case Float32:
+		return uint64(math.Float32bits(float32(r))), nil
+	case Float64:
+		return math.Float64bits(r), nil
+	}
+	r = math.Round(r)
+	lo, hi := 0.0, math.Ldexp(1, s.Length)-1
+	if s.Signed {
+		lo, hi = -math.Ldexp(1, s.Length-1), math.Ldexp(1, s.Length-1)-1
+	}
+	if r < lo || r > hi {
+		return 0, fmt.Errorf("%w: %s = %v does not fit %d bits", ErrOutOfRange, s.Name, v, s.Length)
+	}
+	if s.Signed {
+		return uint64(int64(r)) & (^uint64(0) >> (64 - s.Length)), nil
+	}
+	return uint64(r), nil
+}
+
+// SetRaw writes raw bits into a payload, which must be long enough to hold
+// the signal.
+func (s *Signal) SetRaw(data []byte, raw uint64) {
+	i := s.Length - 1
+	s.positions(func(p int) {
+		bit := byte(1) << (p % 8)
+		if raw>>i&1 != 0 {
+			data[p/8] |= bit
+		} else {
+			data[p/8] &^= bit
+		}
+		i--
+	})
+}
+
+// startRaw is the raw value of a signal left out of Encode: its
+// GenSigStartValue attribute, or 0.
+func (s *Signal) startRaw() uint64 {
+	v, ok := s.Attributes["GenSigStartValue"]
+	if !ok {
+		v = s.message.db.AttributeDefaults["GenSigStartValue"]
+	}
+	f, _ := strconv.ParseFloat(v, 64)
+	if s.Signed {
+		return uint64(int64(f)) & (^uint64(0) >> (64 - s.Length))
+	}
+	return uint64(f)
+}
+
+// Encode builds a frame from physical signal values. Signals left out take
+// their GenSigStartValue. For multiplexed messages the multiplexor may be
+// left out when the given multiplexed signals agree on its value; given
+// signals that the multiplexor value does not select are an error, as are
+// unknown signal names and out-of-range values. Messages longer than 8
+// bytes are encoded as CAN FD frames with bit rate switching.
+func (m *Message) Encode(values map[string]float64) (gocan.Frame, error) {
+	if m.Length > gocan.MaxFDLength {
+		return gocan.Frame{}, fmt.Errorf("dbc: %s is %d bytes, more than a CAN FD frame holds", m.Name, m.Length)
+	}
+	for name := range values {
+		if m.Signal(name) == nil {
+			return gocan.Frame{}, fmt.Errorf("dbc: %s has no signal %q", m.Name, name)
+		}
+	}
+
+	var mux uint64
+	var haveMux bool
+	if mx := m.multiplexer; mx != nil {
+		if v, ok := values[mx.Name]; ok {
+			raw, err := mx.RawValue(v)
+			if err != nil {
+				return gocan.Frame{}, err
+			}
+			mux, haveMux = raw, true
+		}
+		for _, s := range m.Signals {
+			if _, ok := values[s.Name]; !ok || !s.Multiplexed {
+				continue
+			}
+			if !haveMux {
+				mux, haveMux = s.MuxValue, true
+			}
+			if s.MuxValue != mux {
+				return gocan.Frame{}, fmt.Errorf("dbc: %s.%s needs %s = %d, not %d", m.Name, s.Name, mx.Name, s.MuxValue, mux)
+			}
+		}
+		if !haveMux {
+			mux = mx.startRaw()
+		}
+	}
+
+	data := make([]byte, m.Length)
+	for _, s := range m.Signals {
+		if s.Multiplexed && s.MuxValue != mux {
+			continue
+		}
+		if n, _ := s.span(); n > len(data) {
+			return gocan.Frame{}, fmt.Errorf("dbc: %s.%s does not fit %d bytes", m.Name, s.Name, m.Length)
+		}
+		raw := s.startRaw()
+		if v, ok := values[s.Name]; ok {
+			var err error
+			if raw, err = s.RawValue(v); err != nil {
+				return gocan.Frame{}, fmt.Errorf("%s: %w", m.Name, err)
+			}
+		} else if s == m.multiplexer {
+			raw = mux
+		}
+		s.SetRaw(data, raw)
+	}
+	var f gocan.Frame
+	if len(data) > 8 {
+		f = gocan.NewFDFrame(m.ID, data)
+	} else {
+		f = gocan.NewFrame(m.ID, data)
+	}
+	f.Extended = m.Extended
+	return f, nil
+}
+
+// Encode builds a frame of the named message; see Message.Encode.
+func (db *Database) Encode(message string, values map[string]float64) (gocan.Frame, error) {
+	m := db.byName[message]
+	if m == nil {
+		return gocan.Frame{}, fmt.Errorf("dbc: no message %q", message)
+	}
+	return m.Encode(values)
+}
@@ -0,0 +1,656 @@
+package dbc
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// independentSignals is the pseudo message Vector tools park unassigned
+// signals in; it is never on the bus.
+const independentSignals = "VECTOR__INDEPENDENT_SIG_MSG"
+
+// ParseFile reads and parses the DBC file at path.
+func ParseFile(path string) (*Database, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	db, err := Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return db, nil
+}
+
+// ParseReader parses a DBC file from r.
+func ParseReader(r io.Reader) (*Database, error) {
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(src)
+}
+
+// Parse parses the contents of a DBC file. Statements the decoder has no use
+// for (environment variables, signal groups, attribute definitions…) are
+// skipped; references to unknown messages or signals are ignored, as
+// Vector tools do.
+func Parse(src []byte) (*Database, error) {
+	p := &parser{toks: tokenize(src)}
+	db := &Database{
+		ValueTables:       make(map[string]map[int64]string),
+		Attributes:        make(map[string]string),
+		AttributeDefaults: make(map[string]string),
+		byID:              make(map[msgKey]*Message),
+		byName:            make(map[string]*Message),
+	}
+	if err := p.parse(db); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+type token struct {
+	text string
+	str  bool // quoted string
+	line int
+	bol  bool // first token of its line, in column 0
+}
+
+func isPunct(c byte) bool {
+	return strings.IndexByte(":;,|@()[]", c) >= 0
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+func tokenize(src []byte) []token {
+	src = bytes.TrimPrefix(src, []byte("\xEF\xBB\xBF"))
+	var toks []token
+	line, lineStart := 1, 0
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line, lineStart = line+1, i+1
+			i++
+			continue
+		case isSpace(c):
+			i++
+			continue
+		}
+		t := token{line: line, bol: i == lineStart}
+		start := i
+		switch {
+		case c == '"':
+			var sb strings.Builder
+			for i++; i < len(src) && src[i] != '"'; i++ {
+				if src[i] == '\\' && i+1 < len(src) {
+					i++
+				}
+				if src[i] == '\n' {
+					line, lineStart = line+1, i+1
+				}
+				sb.WriteByte(src[i])
+			}
+			i++ // closing quote
+			t.text, t.str = sb.String(), true
+		case isPunct(c):
+			i++
+			t.text = string(c)
+		default:
+			for i < len(src) && !isSpace(src[i]) && !isPunct(src[i]) && src[i] != '"' {
+				i++
+			}
+			t.text = string(src[start:i])
+		}
+		toks = append(toks, t)
+	}
+	return toks
+}
+
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func (p *parser) eof() bool { return p.pos >= len(p.toks) }
+
+func (p *parser) peek() token {
+	if p.eof() {
+		return token{}
+	}
+	return p.toks[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *parser) line() int {
+	if p.eof() {
+		if len(p.toks) == 0 {
+			return 1
+		}
+		return p.toks[len(p.toks)-1].line
+	}
+	return p.toks[p.pos].line
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("dbc: line %d: %s", p.line(), fmt.Sprintf(format, args...))
+}
+
+func (p *parser) expect(text string) error {
+	if t := p.peek(); t.str || t.text != text {
+		return p.errorf("expected %q, got %q", text, t.text)
+	}
+	p.pos++
+	return nil
+}
+
+// accept consumes the next token if it is text.
+func (p *parser) accept(text string) bool {
+	if t := p.peek(); !t.str && t.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) ident() (string, error) {
+	t := p.peek()
+	if t.str || t.text == "" || isPunct(t.text[0]) {
+		return "", p.errorf("expected a name, got %q", t.text)
+	}
+	p.pos++
+	return t.text, nil
+}
+
+func (p *parser) str() (string, error) {
+	t := p.peek()
+	if !t.str {
+		return "", p.errorf("expected a string, got %q", t.text)
+	}
+	p.pos++
+	return t.text, nil
+}
+
+func (p *parser) uint(bits int) (uint64, error) {
+	t := p.peek()
+	n, err := strconv.ParseUint(t.text, 10, bits)
+	if t.str || err != nil {
+		return 0, p.errorf("expected an unsigned integer, got %q", t.text)
+	}
+	p.pos++
+	return n, nil
+}
+
+func (p *parser) int() (int64, error) {
+	t := p.peek()
+	n, err := strconv.ParseInt(t.text, 10, 64)
+	if t.str || err != nil {
+		// Value descriptions sometimes carry raw values written as floats.
+		f, ferr := strconv.ParseFloat(t.text, 64)
+		if t.str || ferr != nil {
+			return 0, p.errorf("expected an integer, got %q", t.text)
+		}
+		n = int64(f)
+	}
+	p.pos++
+	return n, nil
+}
+
+func (p *parser) float() (float64, error) {
+	t := p.peek()
+	f, err := strconv.ParseFloat(t.text, 64)
+	if t.str || err != nil {
+		return 0, p.errorf("expected a number, got %q", t.text)
+	}
+	p.pos++
+	return f, nil
+}
+
+// value reads an attribute value: a string or a bare number/enum.
+func (p *parser) value() (string, error) {
+	t := p.next()
+	if !t.str && (t.text == "" || isPunct(t.text[0])) {
+		p.pos--
+		return "", p.errorf("expected a value, got %q", t.text)
+	}
+	return t.text, nil
+}
+
+// skipStatement skips to just past the next ';'.
+func (p *parser) skipStatement() {
+	for !p.eof() {
+		if t := p.next(); !t.str && t.text == ";" {
+			return
+		}
+	}
+}
+
+// skipLine skips the remaining tokens on line.
+func (p *parser) skipLine(line int) {
+	for !p.eof() && p.peek().line == line {
+		p.pos++
+	}
+}
+
+func (p *parser) parse(db *Database) error {
+	for !p.eof() {
+		kw := p.next()
+		if kw.str {
+			return p.errorf("unexpected string %q", kw.text)
+		}
+		var err error
+		switch kw.text {
+		case "VERSION":
+			db.Version, err = p.str()
+		case "NS_":
+			// The new-symbols list is indented; it ends at the next
+			// statement in column 0.
+			err = p.expect(":")
+			for !p.eof() && !p.peek().bol {
+				p.pos++
+			}
+		case "BS_":
+			p.skipLine(kw.line)
+		case "BU_":
+			if err = p.expect(":"); err == nil {
+				for !p.eof() && p.peek().line == kw.line {
+					db.Nodes = append(db.Nodes, p.next().text)
+				}
+			}
+		case "BO_":
+			err = p.message(db)
+		case "CM_":
+			err = p.comment(db)
+		case "VAL_TABLE_":
+			err = p.valueTable(db)
+		case "VAL_":
+			err = p.values(db)
+		case "BA_DEF_DEF_":
+			err = p.attributeDefault(db)
+		case "BA_":
+			err = p.attribute(db)
+		case "SIG_VALTYPE_":
+			err = p.signalType(db)
+		case "SG_":
+			return p.errorf("signal outside a message")
+		default:
+			p.skipStatement()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for _, m := range db.Messages {
+		if err := m.link(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *parser) message(db *Database) error {
+	id, err := p.uint(32)
+	if err != nil {
+		return err
+	}
+	m := &Message{db: db, Attributes: make(map[string]string)}
+	if m.Name, err = p.ident(); err != nil {
+		return err
+	}
+	if err := p.expect(":"); err != nil {
+		return err
+	}
+	dlc, err := p.uint(8)
+	if err != nil {
+		return err
+	}
+	m.Length = uint8(dlc)
+	if m.Sender, err = p.ident(); err != nil {
+		return err
+	}
+	m.ID = uint32(id) & 0x1FFFFFFF
+	m.Extended = id&0x80000000 != 0
+	for p.accept("SG_") {
+		s, err := p.signal()
+		if err != nil {
+			return err
+		}
+		s.message = m
+		m.Signals = append(m.Signals, s)
+	}
+	if m.Name == independentSignals {
+		return nil
+	}
+	key := msgKey{m.ID, m.Extended}
+	if prev := db.byID[key]; prev != nil {
+		return p.errorf("message %s reuses the identifier of %s", m.Name, prev.Name)
+	}
+	if prev := db.byName[m.Name]; prev != nil {
+		return p.errorf("duplicate message name %s", m.Name)
+	}
+	db.Messages = append(db.Messages, m)
+	db.byID[key] = m
+	db.byName[m.Name] = m
+	return nil
+}
+
+func (p *parser) signal() (*Signal, error) {
+	line := p.line()
+	s := &Signal{Attributes: make(map[string]string)}
+	var err error
+	if s.Name, err = p.ident(); err != nil {
+		return nil, err
+	}
+	if t := p.peek(); !t.str && t.text != ":" {
+		if err := s.parseMux(t.text); err != nil {
+			return nil, p.errorf("signal %s: %v", s.Name, err)
+		}
+		p.pos++
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	start, err := p.uint(16)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("|"); err != nil {
+		return nil, err
+	}
+	length, err := p.uint(8)
+	if err != nil {
+		return nil, err
+	}
+	s.StartBit, s.Length = int(start), int(length)
+	if err := p.expect("@"); err != nil {
+		return nil, err
+	}
+	switch t := p.next(); t.text {
+	case "1+":
+	case "1-":
+		s.Signed = true
+	case "0+":
+		s.ByteOrder = BigEndian
+	case "0-":
+		s.ByteOrder, s.Signed = BigEndian, true
+	default:
+		p.pos--
+		return nil, p.errorf("signal %s: bad byte order/sign %q", s.Name, t.text)
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	if s.Factor, err = p.float(); err != nil {
+		return nil, err
+	}
+	if err := p.expect(","); err != nil {
+		return nil, err
+	}
+	if s.Offset, err = p.float(); err != nil {
+		return nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	if err := p.expect("["); err != nil {
+		return nil, err
+	}
+	if s.Min, err = p.float(); err != nil {
+		return nil, err
+	}
+	if err := p.expect("|"); err != nil {
+		return nil, err
+	}
+	if s.Max, err = p.float(); err != nil {
+		return nil, err
+	}
+	if err := p.expect("]"); err != nil {
+		return nil, err
+	}
+	if s.Unit, err = p.str(); err != nil {
+		return nil, err
+	}
+	for !p.eof() && p.peek().line == line {
+		if t := p.next(); t.text != "," {
+			s.Receivers = append(s.Receivers, t.text)
+		}
+	}
+	if s.Length < 1 || s.Length > 64 {
+		return nil, fmt.Errorf("dbc: line %d: signal %s: length %d out of range 1-64", line, s.Name, s.Length)
+	}
+	return s, nil
+}
+
+// parseMux reads a multiplex indicator: M, mN or mNM.
+func (s *Signal) parseMux(ind string) error {
+	if ind == "M" {
+		s.IsMultiplexer = true
+		return nil
+	}
+	if len(ind) < 2 || ind[0] != 'm' {
+		return fmt.Errorf("bad multiplex indicator %q", ind)
+	}
+	ind = ind[1:]
+	if strings.HasSuffix(ind, "M") {
+		s.IsMultiplexer = true
+		ind = ind[:len(ind)-1]
+	}
+	v, err := strconv.ParseUint(ind, 10, 64)
+	if err != nil {
+		return fmt.Errorf("bad multiplex indicator %q", "m"+ind)
+	}
+	s.Multiplexed, s.MuxValue = true, v
+	return nil
+}
+
+// link checks the message's signal layout and finds its multiplexor.
+func (m *Message) link() error {
+	var muxed bool
+	for _, s := range m.Signals {
+		if s.IsMultiplexer && !s.Multiplexed && m.multiplexer == nil {
+			m.multiplexer = s
+		}
+		muxed = muxed || s.Multiplexed
+		if s.Type != Integer && s.Length != s.Type.bits() {
+			return fmt.Errorf("dbc: %s.%s: float signal of %d bits", m.Name, s.Name, s.Length)
+		}
+		if _, ok := s.span(); !ok {
+			return fmt.Errorf("dbc: %s.%s: bits %d|%d do not fit a 64 byte frame", m.Name, s.Name, s.StartBit, s.Length)
+		}
+	}
+	if muxed && m.multiplexer == nil {
+		return fmt.Errorf("dbc: %s has multiplexed signals but no multiplexor", m.Name)
+	}
+	return nil
+}
+
+func (p *parser) comment(db *Database) error {
+	var dst *string
+	switch t := p.peek(); {
+	case t.str:
+	case t.text == "BU_" || t.text == "EV_":
+		p.pos += 2
+	case t.text == "BO_":
+		p.pos++
+		m, err := p.messageRef(db)
+		if err != nil {
+			return err
+		}
+		if m != nil {
+			dst = &m.Comment
+		}
+	case t.text == "SG_":
+		p.pos++
+		s, err := p.signalRef(db)
+		if err != nil {
+			return err
+		}
+		if s != nil {
+			dst = &s.Comment
+		}
+	default:
+		return p.errorf("bad comment target %q", t.text)
+	}
+	text, err := p.str()
+	if err != nil {
+		return err
+	}
+	if dst != nil {
+		*dst = text
+	}
+	return p.expect(";")
+}
+
+// messageRef reads a message identifier; unknown messages yield nil.
+func (p *parser) messageRef(db *Database) (*Message, error) {
+	id, err := p.uint(32)
+	if err != nil {
+		return nil, err
+	}
+	return db.byID[msgKey{uint32(id) & 0x1FFFFFFF, id&0x80000000 != 0}], nil
+}
+
+// signalRef reads a message identifier and signal name; unknown ones yield
+// nil.
+func (p *parser) signalRef(db *Database) (*Signal, error) {
+	m, err := p.messageRef(db)
+	if err != nil {
+		return nil, err
+	}
+	name, err := p.ident()
+	if err != nil || m == nil {
+		return nil, err
+	}
+	return m.Signal(name), nil
+}
+
+// descriptions reads "raw "text"" pairs up to the closing ';'.
+func (p *parser) descriptions() (map[int64]string, error) {
+	out := make(map[int64]string)
+	for !p.accept(";") {
+		if p.eof() {
+			return nil, p.errorf("unterminated value descriptions")
+		}
+		v, err := p.int()
+		if err != nil {
+			return nil, err
+		}
+		if out[v], err = p.str(); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func (p *parser) valueTable(db *Database) error {
+	name, err := p.ident()
+	if err != nil {
+		return err
+	}
+	db.ValueTables[name], err = p.descriptions()
+	return err
+}
+
+func (p *parser) values(db *Database) error {
+	if _, err := strconv.ParseUint(p.peek().text, 10, 32); err != nil {
+		p.skipStatement() // environment variable descriptions
+		return nil
+	}
+	s, err := p.signalRef(db)
+	if err != nil {
+		return err
+	}
+	vals, err := p.descriptions()
+	if err != nil {
+		return err
+	}
+	if s != nil {
+		s.Values = vals
+	}
+	return nil
+}
+
+func (p *parser) attributeDefault(db *Database) error {
+	name, err := p.str()
+	if err != nil {
+		return err
+	}
+	if db.AttributeDefaults[name], err = p.value(); err != nil {
+		return err
+	}
+	return p.expect(";")
+}
+
+func (p *parser) attribute(db *Database) error {
+	name, err := p.str()
+	if err != nil {
+		return err
+	}
+	dst := db.Attributes
+	switch p.peek().text {
+	case "BU_", "EV_":
+		p.pos += 2
+		dst = nil
+	case "BO_":
+		p.pos++
+		m, err := p.messageRef(db)
+		if err != nil {
+			return err
+		}
+		dst = nil
+		if m != nil {
+			dst = m.Attributes
+		}
+	case "SG_":
+		p.pos++
+		s, err := p.signalRef(db)
+		if err != nil {
+			return err
+		}
+		dst = nil
+		if s != nil {
+			dst = s.Attributes
+		}
+	}
+	v, err := p.value()
+	if err != nil {
+		return err
+	}
+	if dst != nil {
+		dst[name] = v
+	}
+	return p.expect(";")
+}
+
+func (p *parser) signalType(db *Database) error {
+	s, err := p.signalRef(db)
+	if err != nil {
+		return err
+	}
+	p.accept(":")
+	n, err := p.uint(8)
+	if err != nil {
+		return err
+	}
+	if s != nil {
+		switch n {
+		case 1:
+			s.Type = Float32
+		case 2:
+			s.Type = Float64
+		}
+	}
+	return p.expect(";")
+}
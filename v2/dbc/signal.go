@@ -0,0 +1,159 @@
+package dbc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	gocan "github.com/roffe/gocan/v2"
+)
+
+// ErrUnknownMessage is returned when a frame's identifier is not in the
+// database.
+var ErrUnknownMessage = errors.New("dbc: unknown message")
+
+// maxFrameBytes bounds signal layouts: the largest CAN FD payload.
+const maxFrameBytes = 64
+
+func (t ValueType) bits() int {
+	switch t {
+	case Float32:
+		return 32
+	case Float64:
+		return 64
+	}
+	return 0
+}
+
+// positions calls fn with the frame bit position of every signal bit, most
+// significant first. A position p is bit p%8 of byte p/8.
+func (s *Signal) positions(fn func(p int)) {
+	if s.ByteOrder == LittleEndian {
+		for p := s.StartBit + s.Length - 1; p >= s.StartBit; p-- {
+			fn(p)
+		}
+		return
+	}
+	// Motorola: the start bit is the MSB; bits run down within a byte and
+	// continue at bit 7 of the next byte.
+	p := s.StartBit
+	for range s.Length {
+		fn(p)
+		if p%8 == 0 {
+			p += 15
+		} else {
+			p--
+		}
+	}
+}
+
+// span returns how many payload bytes the signal needs; ok is false when it
+// does not fit the largest frame.
+func (s *Signal) span() (n int, ok bool) {
+	s.positions(func(p int) { n = max(n, p/8+1) })
+	return n, n <= maxFrameBytes
+}
+
+// Raw extracts the signal's raw bits from a payload; ok is false when the
+// payload is too short to hold them.
+func (s *Signal) Raw(data []byte) (raw uint64, ok bool) {
+	if n, _ := s.span(); n > len(data) {
+		return 0, false
+	}
+	s.positions(func(p int) {
+		raw = raw<<1 | uint64(data[p/8]>>(p%8)&1)
+	})
+	return raw, true
+}
+
+// signedRaw sign-extends raw for signed signals.
+func (s *Signal) signedRaw(raw uint64) int64 {
+	if s.Signed && s.Length < 64 && raw&(1<<(s.Length-1)) != 0 {
+		return int64(raw | ^uint64(0)<<s.Length)
+	}
+	return int64(raw)
+}
+
+// Physical scales a raw value: raw * Factor + Offset.
+func (s *Signal) Physical(raw uint64) float64 {
+	var v float64
+	switch s.Type {
+	case Float32:
+		v = float64(math.Float32frombits(uint32(raw)))
+	case Float64:
+		v = math.Float64frombits(raw)
+	default:
+		if s.Signed {
+			v = float64(s.signedRaw(raw))
+		} else {
+			v = float64(raw)
+		}
+	}
+	return v*s.Factor + s.Offset
+}
+
+// Decode extracts and scales the signal from a payload; ok is false when the
+// payload is too short.
+func (s *Signal) Decode(data []byte) (v float64, ok bool) {
+	raw, ok := s.Raw(data)
+	if !ok {
+		return 0, false
+	}
+	return s.Physical(raw), true
+}
+
+// Value is a decoded signal.
+type Value struct {
+	Signal *Signal
+	Raw    uint64
+	Value  float64 // physical value
+}
+
+// Label returns the value description of the raw value, or "".
+func (v Value) Label() string {
+	return v.Signal.Values[v.Signal.signedRaw(v.Raw)]
+}
+
+func (v Value) String() string {
+	if l := v.Label(); l != "" {
+		return v.Signal.Name + " = " + l
+	}
+	s := v.Signal.Name + " = " + strconv.FormatFloat(v.Value, 'g', -1, 64)
+	if v.Signal.Unit != "" {
+		s += " " + v.Signal.Unit
+	}
+	return s
+}
+
+// Decode decodes every signal present in a payload. Multiplexed signals are
+// only included when the multiplexor selects them, and signals that do not
+// fit a short payload are left out.
+func (m *Message) Decode(data []byte) []Value {
+	var mux uint64
+	var haveMux bool
+	if m.multiplexer != nil {
+		mux, haveMux = m.multiplexer.Raw(data)
+	}
+	out := make([]Value, 0, len(m.Signals))
+	for _, s := range m.Signals {
+		if s.Multiplexed && (!haveMux || mux != s.MuxValue) {
+			continue
+		}
+		raw, ok := s.Raw(data)
+		if !ok {
+			continue
+		}
+		out = append(out, Value{Signal: s, Raw: raw, Value: s.Physical(raw)})
+	}
+	return out
+}
+
+// Decode looks up the frame's message and decodes its signals.
+func (db *Database) Decode(f gocan.Frame) (*Message, []Value, error) {
+	m := db.MessageByID(f.ID, f.Extended)
+	if m == nil {
+		return nil, nil, fmt.Errorf("%w: 0x%X", ErrUnknownMessage, f.ID)
+	}
+	return m, m.Decode(f.Bytes()), nil
+}
@@ -0,0 +1,122 @@
+package gocan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// DetectRates are the bit rates DetectBitrate tries by default, in kbit/s
+// and in this order: the common rates first, then the Saab ones (615.384
+// for Trionic 5, 47.619 for the I-bus, 33.3 for SWCAN), then the rest.
+var DetectRates = []float64{500, 250, 125, 1000, 615.384, 47.619, 33.3, 800, 100, 83.333, 50, 20, 10}
+
+// ErrNoBitrate is returned by DetectBitrate when no candidate rate saw
+// error-free traffic.
+var ErrNoBitrate = errors.New("gocan: no bit rate detected")
+
+// DetectConfig configures DetectBitrate.
+type DetectConfig struct {
+	Rates     []float64     // candidates in the order tried, kbit/s; DetectRates if empty
+	Listen    time.Duration // how long to listen at each rate; 500ms if zero
+	MinFrames int           // error-free frames that confirm a rate; 3 if zero
+}
+
+// DetectBitrate finds the bit rate of the bus the named adapter is plugged
+// into. It opens the adapter listen-only at each candidate rate in turn,
+// so it never ACKs or disturbs traffic, and returns the first rate that
+// receives MinFrames frames without any error frames or error state
+// changes. Rates the adapter can't be set to are skipped. cfg supplies
+// everything else (port, baud rate, ...).
+//
+// A quiet bus can't be detected: something on it must be transmitting.
+// The adapter must support listen-only mode (Capabilities.ListenOnly).
+func DetectBitrate(ctx context.Context, adapterName string, cfg Config, dc DetectConfig) (float64, error) {
+	info, err := lookupAdapter(adapterName)
+	if err != nil {
+		return 0, err
+	}
+	if !info.Capabilities.ListenOnly {
+		return 0, fmt.Errorf("gocan: %s has no listen-only mode to detect the bit rate with", adapterName)
+	}
+	rates := dc.Rates
+	if len(rates) == 0 {
+		rates = DetectRates
+	}
+	if dc.Listen <= 0 {
+		dc.Listen = 500 * time.Millisecond
+	}
+	if dc.MinFrames <= 0 {
+		dc.MinFrames = 3
+	}
+	cfg.CANDataRate, cfg.ListenOnly = 0, true
+
+	var tried []string
+	for _, rate := range rates {
+		cfg.CANRate = rate
+		frames, errs, err := listenAt(ctx, info, cfg, dc)
+		switch {
+		case ctx.Err() != nil:
+			return 0, ctx.Err()
+		case err != nil:
+			tried = append(tried, fmt.Sprintf("%g: %v", rate, err))
+		case errs == 0 && frames >= dc.MinFrames:
+			return rate, nil
+		default:
+			tried = append(tried, fmt.Sprintf("%g: %d frames, %d errors", rate, frames, errs))
+		}
+	}
+	return 0, fmt.Errorf("%w (%s)", ErrNoBitrate, strings.Join(tried, "; "))
+}
+
+// listenAt opens the adapter at cfg.CANRate and counts frames and bus
+// errors until MinFrames frames arrive or the listen window ends.
+func listenAt(ctx context.Context, info AdapterInfo, cfg Config, dc DetectConfig) (frames, errs int, err error) {
+	adapter, err := info.New(cfg)
+	if err != nil {
+		return 0, 0, err
+	}
+	var nframes, nerrs atomic.Int64
+	enough := make(chan struct{})
+	bus, err := open(ctx, info.Name, adapter, WithListenOnly(), WithHostFiltering(), WithEventFunc(func(e Event) {
+		if busError(e) {
+			nerrs.Add(1)
+		}
+	}))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer bus.Close()
+	bus.OnReceive(func(Frame) {
+		if nframes.Add(1) == int64(dc.MinFrames) {
+			close(enough)
+		}
+	})
+	timer := time.NewTimer(dc.Listen)
+	defer timer.Stop()
+	select {
+	case <-enough:
+	case <-timer.C:
+	case <-ctx.Done():
+	case <-bus.Done():
+		return 0, 0, bus.Err()
+	}
+	return int(nframes.Load()), int(nerrs.Load()), nil
+}
+
+// busError reports whether e says the controller is seeing errors, as it
+// does when listening at the wrong rate.
+func busError(e Event) bool {
+	switch e.Kind {
+	case EventKindErrorFrame:
+		return true
+	case EventKindBusState:
+		return e.Status.State > BusStateErrorActive
+	case EventKindErrorCounters:
+		return e.Status.RxErrors > 0
+	}
+	return e.IsFatal()
+}
@@ -0,0 +1,69 @@
+package gocan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// sniffer emulates a listen-only controller on a 250 kbit/s bus: traffic
+// at the right rate, error frames at the others.
+type sniffer struct {
+	cfg Config
+}
+
+func init() {
+	Register(AdapterInfo{
+		Name:         "detect test",
+		Capabilities: Capabilities{ListenOnly: true},
+		New: func(cfg Config) (Adapter, error) {
+			if cfg.CANRate == 125 {
+				return nil, fmt.Errorf("unsupported CAN rate: %g kbit/s", cfg.CANRate)
+			}
+			return &sniffer{cfg}, nil
+		},
+	})
+}
+
+func (s *sniffer) Open(ctx context.Context, bus *Bus) error {
+	if !s.cfg.ListenOnly {
+		return errors.New("not listen-only")
+	}
+	go func() {
+		tick := time.NewTicker(time.Millisecond)
+		defer tick.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-tick.C:
+			}
+			if s.cfg.CANRate == 250 {
+				bus.Deliver(NewFrame(0x1A0, []byte{1, 2}))
+			} else {
+				bus.Emit(BusEvent(EventKindErrorFrame, BusStatus{Errors: BusErrorCRC}))
+			}
+		}
+	}()
+	return nil
+}
+
+func (s *sniffer) Send(context.Context, Frame) error { return errors.New("listen-only") }
+func (s *sniffer) Close() error                      { return nil }
+
+func TestDetectBitrate(t *testing.T) {
+	ctx := context.Background()
+	rate, err := DetectBitrate(ctx, "detect test", Config{}, DetectConfig{Listen: 50 * time.Millisecond})
+	if err != nil || rate != 250 {
+		t.Fatalf("want 250, got %v %v", rate, err)
+	}
+	_, err = DetectBitrate(ctx, "detect test", Config{}, DetectConfig{Rates: []float64{500, 125}, Listen: 20 * time.Millisecond})
+	if !errors.Is(err, ErrNoBitrate) {
+		t.Fatalf("want ErrNoBitrate, got %v", err)
+	}
+	if _, err := DetectBitrate(ctx, "loopback", Config{}, DetectConfig{}); err == nil {
+		t.Fatal("detected with an adapter that can't listen only")
+	}
+}
@@ -3,6 +3,7 @@ package gocan
 import (
 	"fmt"
 	"log/slog"
+	"strings"
 )
 
 // EventType orders event severities from least to most severe.
@@ -51,13 +52,18 @@ func (et EventType) Level() slog.Level {
 }
 
 // Event is an out-of-band notification from an adapter: connection progress,
-// recoverable errors, or the final fatal failure.
+// recoverable errors, bus state changes, or the final fatal failure.
 type Event struct {
 	Type    EventType
 	Details string
 	// Err holds the underlying error for error and fatal events. It may be
 	// nil for events raised from a plain message.
 	Err error
+	// Kind says what a bus event reports, so tools can react to it without
+	// parsing Details; Status holds its structured details. Plain
+	// notifications are EventKindMessage with a zero Status.
+	Kind   EventKind
+	Status BusStatus
 }
 
 func (e Event) String() string {
@@ -68,3 +74,158 @@ func (e Event) String() string {
 func (e Event) IsFatal() bool {
 	return e.Type == EventTypeFatal
 }
+
+// EventKind classifies events by what they report.
+type EventKind uint8
+
+const (
+	// EventKindMessage is a plain notification; only Details is set.
+	EventKindMessage EventKind = iota
+	// EventKindBusState reports the controller entering Status.State.
+	EventKindBusState
+	// EventKindErrorCounters reports Status.TxErrors and Status.RxErrors.
+	EventKindErrorCounters
+	// EventKindArbitrationLost reports a transmission that lost arbitration
+	// to a higher priority frame. It is retried automatically.
+	EventKindArbitrationLost
+	// EventKindOverrun reports received frames lost because a controller,
+	// adapter or driver queue overflowed.
+	EventKindOverrun
+	// EventKindErrorFrame reports an error frame on the bus; Status.Errors
+	// holds the protocol errors the adapter could tell apart.
+	EventKindErrorFrame
+	// EventKindFrameDropped reports a received frame the bus dropped for a
+	// subscriber that fell behind.
+	EventKindFrameDropped
+	// EventKindReconnecting reports a lost adapter, or a failed attempt to
+	// reopen it, on a bus opened WithReconnect; Err holds the reason.
+	EventKindReconnecting
+	// EventKindReconnected reports the adapter reopened after a loss.
+	EventKindReconnected
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventKindMessage:
+		return "message"
+	case EventKindBusState:
+		return "bus state"
+	case EventKindErrorCounters:
+		return "error counters"
+	case EventKindArbitrationLost:
+		return "arbitration lost"
+	case EventKindOverrun:
+		return "overrun"
+	case EventKindErrorFrame:
+		return "error frame"
+	case EventKindFrameDropped:
+		return "frame dropped"
+	case EventKindReconnecting:
+		return "reconnecting"
+	case EventKindReconnected:
+		return "reconnected"
+	default:
+		return "unknown"
+	}
+}
+
+// BusState is a CAN controller's fault confinement state.
+type BusState uint8
+
+const (
+	BusStateUnknown BusState = iota
+	// BusStateErrorActive is normal operation, both error counters under 96.
+	BusStateErrorActive
+	// BusStateErrorWarning means an error counter reached 96.
+	BusStateErrorWarning
+	// BusStateErrorPassive means an error counter reached 128; the
+	// controller may no longer signal errors with active error frames.
+	BusStateErrorPassive
+	// BusStateBusOff means the transmit error counter passed 255 and the
+	// controller has left the bus until it is restarted.
+	BusStateBusOff
+)
+
+func (s BusState) String() string {
+	switch s {
+	case BusStateErrorActive:
+		return "error-active"
+	case BusStateErrorWarning:
+		return "error-warning"
+	case BusStateErrorPassive:
+		return "error-passive"
+	case BusStateBusOff:
+		return "bus-off"
+	default:
+		return "unknown"
+	}
+}
+
+// BusError is a set of CAN protocol errors.
+type BusError uint8
+
+const (
+	BusErrorBit   BusError = 1 << iota // a transmitted bit read back wrong
+	BusErrorStuff                      // more than five equal bits in a row
+	BusErrorForm                       // a fixed-form field held an illegal bit
+	BusErrorCRC                        // checksum mismatch
+	BusErrorAck                        // no node acknowledged a transmitted frame
+)
+
+var busErrorNames = []string{"bit", "stuff", "form", "crc", "ack"}
+
+func (e BusError) String() string {
+	var names []string
+	for i, name := range busErrorNames {
+		if e&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// BusStatus is the structured payload of bus events. Adapters fill in what
+// their hardware reports and leave the rest zero.
+type BusStatus struct {
+	State    BusState // controller state, BusStateUnknown if not reported
+	Counters bool     // TxErrors and RxErrors were reported
+	TxErrors int      // transmit error counter (TEC)
+	RxErrors int      // receive error counter (REC)
+	Errors   BusError // protocol errors seen in an error frame
+}
+
+func (s BusStatus) String() string {
+	var parts []string
+	if s.State != BusStateUnknown {
+		parts = append(parts, s.State.String())
+	}
+	if s.Errors != 0 {
+		parts = append(parts, s.Errors.String())
+	}
+	if s.Counters {
+		parts = append(parts, fmt.Sprintf("TEC %d, REC %d", s.TxErrors, s.RxErrors))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// BusEvent builds the event reporting s as kind, with a severity to match:
+// bus-off is an error, error-passive, error-warning, overruns and error
+// frames are warnings, and the rest is informational or debug.
+func BusEvent(kind EventKind, s BusStatus) Event {
+	e := Event{Type: EventTypeWarning, Kind: kind, Status: s, Details: kind.String()}
+	if st := s.String(); st != "" {
+		e.Details += ": " + st
+	}
+	switch kind {
+	case EventKindBusState:
+		switch s.State {
+		case BusStateBusOff:
+			e.Type = EventTypeError
+		case BusStateErrorActive, BusStateUnknown:
+			e.Type = EventTypeInfo
+		}
+	case EventKindErrorCounters, EventKindArbitrationLost:
+		e.Type = EventTypeDebug
+	}
+	return e
+}
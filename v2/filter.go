@@ -0,0 +1,149 @@
+package gocan
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Filter selects the frames a filtered subscription receives (see
+// Bus.SubscribeFilter). Build one with MatchID, MatchMask, MatchRange or
+// MatchFunc, then narrow it with Standard, Extended or Where. The zero
+// Filter matches identifier 0 only.
+//
+// Subscriptions made only of MatchID filters are dispatched by identifier
+// lookup like Subscribe; the others are checked frame by frame.
+type Filter struct {
+	id, last uint32 // inclusive identifier range, or the id for a mask
+	mask     uint32
+	masked   bool
+	format   idFormat
+	where    []func(Frame) bool
+}
+
+type idFormat uint8
+
+const (
+	anyID idFormat = iota
+	standardID
+	extendedID
+)
+
+// MatchID matches frames carrying identifier id.
+func MatchID(id uint32) Filter {
+	return Filter{id: id, last: id}
+}
+
+// MatchMask matches frames whose identifier equals id in the bits set in
+// mask, like an acceptance filter: MatchMask(0x7E8, 0x7F8) matches 0x7E8
+// through 0x7EF, and MatchMask(0, 0) matches everything.
+func MatchMask(id, mask uint32) Filter {
+	return Filter{id: id & mask, mask: mask, masked: true}
+}
+
+// MatchRange matches frames with identifiers from first through last.
+func MatchRange(first, last uint32) Filter {
+	return Filter{id: first, last: last}
+}
+
+// MatchFunc matches every frame fn returns true for. fn runs on the
+// adapter's receive goroutine while deliveries are serialized: keep it
+// quick and don't call back into the bus.
+func MatchFunc(fn func(Frame) bool) Filter {
+	return MatchMask(0, 0).Where(fn)
+}
+
+// Standard narrows the filter to 11-bit identifiers.
+func (f Filter) Standard() Filter {
+	f.format = standardID
+	return f
+}
+
+// Extended narrows the filter to 29-bit identifiers.
+func (f Filter) Extended() Filter {
+	f.format = extendedID
+	return f
+}
+
+// Where narrows the filter to frames fn also returns true for, e.g. negative
+// responses in a range of diagnostic replies:
+//
+//	gocan.MatchRange(0x7E8, 0x7EF).Where(func(f gocan.Frame) bool {
+//		return f.Length > 0 && f.Data[0] == 0x7F
+//	})
+//
+// fn runs under the same rules as with MatchFunc.
+func (f Filter) Where(fn func(Frame) bool) Filter {
+	f.where = append(f.where[:len(f.where):len(f.where)], fn)
+	return f
+}
+
+// Match reports whether fr passes the filter.
+func (f Filter) Match(fr Frame) bool {
+	return f.match(&fr)
+}
+
+func (f *Filter) match(fr *Frame) bool {
+	switch f.format {
+	case standardID:
+		if fr.Extended {
+			return false
+		}
+	case extendedID:
+		if !fr.Extended {
+			return false
+		}
+	}
+	if f.masked {
+		if fr.ID&f.mask != f.id {
+			return false
+		}
+	} else if fr.ID < f.id || fr.ID > f.last {
+		return false
+	}
+	for _, fn := range f.where {
+		if !fn(*fr) {
+			return false
+		}
+	}
+	return true
+}
+
+// exact reports whether the filter matches one identifier in either format
+// and nothing else, so identifier lookup can stand in for it.
+func (f *Filter) exact() bool {
+	return !f.masked && f.id == f.last && f.format == anyID && len(f.where) == 0
+}
+
+func (f Filter) String() string {
+	var b strings.Builder
+	switch {
+	case f.masked && f.mask == 0:
+		b.WriteString("any")
+	case f.masked:
+		fmt.Fprintf(&b, "0x%03X/0x%03X", f.id, f.mask)
+	case f.id == f.last:
+		fmt.Fprintf(&b, "0x%03X", f.id)
+	default:
+		fmt.Fprintf(&b, "0x%03X-0x%03X", f.id, f.last)
+	}
+	switch f.format {
+	case standardID:
+		b.WriteString(" std")
+	case extendedID:
+		b.WriteString(" ext")
+	}
+	if len(f.where) > 0 {
+		b.WriteString(" where func")
+	}
+	return b.String()
+}
+
+// match reports whether f passes any of the subscription's filters.
+func (s *sub) match(f *Frame) bool {
+	for i := range s.filters {
+		if s.filters[i].match(f) {
+			return true
+		}
+	}
+	return false
+}
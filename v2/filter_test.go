@@ -0,0 +1,121 @@
+package gocan
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFilterMatch(t *testing.T) {
+	negative := func(f Frame) bool { return f.Length > 0 && f.Data[0] == 0x7F }
+	for _, tc := range []struct {
+		filter Filter
+		frame  Frame
+		want   bool
+	}{
+		{MatchID(0x7E8), NewFrame(0x7E8, nil), true},
+		{MatchID(0x7E8), NewExtendedFrame(0x7E8, nil), true},
+		{MatchID(0x7E8), NewFrame(0x7E9, nil), false},
+		{MatchMask(0x7E8, 0x7F8), NewFrame(0x7EF, nil), true},
+		{MatchMask(0x7E8, 0x7F8), NewFrame(0x7F0, nil), false},
+		{MatchMask(0, 0), NewExtendedFrame(0x18DAF110, nil), true},
+		{MatchRange(0x7E8, 0x7EF), NewFrame(0x7E8, nil), true},
+		{MatchRange(0x7E8, 0x7EF), NewFrame(0x7EF, nil), true},
+		{MatchRange(0x7E8, 0x7EF), NewFrame(0x7E7, nil), false},
+		{MatchID(0x100).Standard(), NewExtendedFrame(0x100, nil), false},
+		{MatchID(0x100).Extended(), NewExtendedFrame(0x100, nil), true},
+		{MatchMask(0, 0).Extended(), NewFrame(0x100, nil), false},
+		{MatchFunc(negative), NewFrame(0x123, []byte{0x7F, 0x10, 0x11}), true},
+		{MatchFunc(negative), NewFrame(0x123, nil), false},
+		{MatchRange(0x7E8, 0x7EF).Where(negative), NewFrame(0x7E9, []byte{0x7F}), true},
+		{MatchRange(0x7E8, 0x7EF).Where(negative), NewFrame(0x7E9, []byte{0x50}), false},
+		{MatchRange(0x7E8, 0x7EF).Where(negative), NewFrame(0x123, []byte{0x7F}), false},
+	} {
+		if got := tc.filter.Match(tc.frame); got != tc.want {
+			t.Errorf("%v matching %v: got %v", tc.filter, tc.frame, got)
+		}
+	}
+}
+
+func TestFilterString(t *testing.T) {
+	for _, tc := range []struct {
+		filter Filter
+		want   string
+	}{
+		{MatchID(0x7E8), "0x7E8"},
+		{MatchMask(0x7E8, 0x7F8), "0x7E8/0x7F8"},
+		{MatchRange(0x7E8, 0x7EF).Extended(), "0x7E8-0x7EF ext"},
+		{MatchFunc(func(Frame) bool { return true }), "any where func"},
+	} {
+		if got := tc.filter.String(); got != tc.want {
+			t.Errorf("got %q, want %q", got, tc.want)
+		}
+	}
+}
+
+func TestSubscribeFilter(t *testing.T) {
+	bus := openLoopback(t)
+	ctx := context.Background()
+
+	replies := bus.SubscribeFilter(ctx, MatchRange(0x7E8, 0x7EF), MatchID(0x100))
+	negative := bus.SubscribeFilter(ctx, MatchFunc(func(f Frame) bool { return f.Data[0] == 0x7F }))
+	exact := bus.SubscribeFilter(ctx, MatchID(0x7E8))
+
+	for _, f := range []Frame{
+		NewFrame(0x7E0, []byte{0x7F}),
+		NewFrame(0x7E8, []byte{0x50}),
+		NewFrame(0x100, []byte{1}),
+		NewFrame(0x7F0, []byte{1}),
+	} {
+		if err := bus.Send(ctx, f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, want := range []uint32{0x7E8, 0x100} {
+		if f := <-replies; f.ID != want {
+			t.Fatalf("range sub: want 0x%03X, got %s", want, f)
+		}
+	}
+	if f := <-negative; f.ID != 0x7E0 {
+		t.Fatalf("predicate sub got %s", f)
+	}
+	if f := <-exact; f.ID != 0x7E8 {
+		t.Fatalf("exact sub got %s", f)
+	}
+	for name, ch := range map[string]<-chan Frame{"range": replies, "predicate": negative, "exact": exact} {
+		select {
+		case f := <-ch:
+			t.Fatalf("%s sub got extra frame %s", name, f)
+		default:
+		}
+	}
+
+	st := bus.Stats()
+	if len(st.Subscribers) != 3 {
+		t.Fatalf("want 3 subscribers, got %+v", st.Subscribers)
+	}
+	// The MatchID-only subscription is dispatched by identifier.
+	if len(bus.filterSubs) != 2 || len(bus.submap[0x7E8]) != 1 {
+		t.Fatalf("want 2 filtered and 1 keyed subscription, got %d and %d", len(bus.filterSubs), len(bus.submap[0x7E8]))
+	}
+}
+
+func TestRequestFilter(t *testing.T) {
+	bus := openLoopback(t)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	reply, err := bus.RequestFilter(ctx, NewFrame(0x7EA, []byte{0x02, 0x10, 0x03}), MatchMask(0x7E8, 0x7F8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.ID != 0x7EA {
+		t.Fatalf("unexpected reply %s", reply)
+	}
+
+	short, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	go bus.Send(context.Background(), NewFrame(0x7E9, nil))
+	if _, err := bus.RecvFilter(short, MatchRange(0x7E8, 0x7EF).Extended()); err == nil {
+		t.Fatal("standard frame passed an extended filter")
+	}
+}
@@ -1,36 +1,112 @@
 package gocan
 
 import (
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 )
 
-// Frame is a single classic CAN frame. It is a plain value: copy it freely,
-// reuse it across sends and share it between goroutines without locking.
+// MaxFDLength is the largest CAN FD payload.
+const MaxFDLength = 64
+
+// fdLengths maps the CAN FD DLC codes 9..15 to payload lengths; codes 0..8
+// are the length itself.
+var fdLengths = [...]uint8{12, 16, 20, 24, 32, 48, 64}
+
+// Frame is a single classic CAN or CAN FD frame. It is a plain value: copy it
+// freely, reuse it across sends and share it between goroutines without
+// locking.
 type Frame struct {
 	ID       uint32
 	Extended bool // 29-bit identifier
-	Remote   bool // remote transmission request
+	Remote   bool // remote transmission request, classic CAN only
+	FD       bool // CAN FD frame
+	BRS      bool // CAN FD bit rate switch: data phase at the data bitrate
+	ESI      bool // CAN FD error state indicator: sender is error passive
 	Length   uint8
-	Data     [8]byte
+	Data     [MaxFDLength]byte
+
+	// Timestamp is when a received frame came off the bus, as precisely as
+	// the adapter can tell; TimestampSource says which clock took it. Both
+	// are zero on frames built for sending; Bus.Send clears them.
+	Timestamp       time.Time
+	TimestampSource TimestampSource
 }
 
-// NewFrame builds an 11-bit frame carrying data. Data beyond 8 bytes is
-// truncated; classic CAN cannot carry more.
+// NewFrame builds an 11-bit classic frame carrying data. Data beyond 8 bytes
+// is truncated; classic CAN cannot carry more.
 func NewFrame(id uint32, data []byte) Frame {
 	f := Frame{ID: id}
-	f.Length = uint8(copy(f.Data[:], data))
+	f.Length = uint8(copy(f.Data[:8], data))
 	return f
 }
 
-// NewExtendedFrame builds a 29-bit frame carrying data. Data beyond 8 bytes
-// is truncated.
+// NewExtendedFrame builds a 29-bit classic frame carrying data. Data beyond
+// 8 bytes is truncated.
 func NewExtendedFrame(id uint32, data []byte) Frame {
 	f := NewFrame(id, data)
 	f.Extended = true
 	return f
 }
 
+// NewFDFrame builds an 11-bit CAN FD frame with bit rate switching carrying
+// data. Data beyond 64 bytes is truncated, and lengths between the valid FD
+// sizes are padded with zeros up to the next one (e.g. 9 bytes to 12).
+func NewFDFrame(id uint32, data []byte) Frame {
+	f := Frame{ID: id, FD: true, BRS: true}
+	n := copy(f.Data[:], data)
+	f.Length = DLCLength(LengthDLC(n))
+	return f
+}
+
+// DLCLength returns the payload length a CAN FD data length code stands
+// for. Codes above 15 are treated as 15.
+func DLCLength(dlc uint8) uint8 {
+	if dlc <= 8 {
+		return dlc
+	}
+	return fdLengths[min(dlc, 15)-9]
+}
+
+// LengthDLC returns the smallest data length code whose payload holds n
+// bytes. Lengths above 64 give 15.
+func LengthDLC(n int) uint8 {
+	if n <= 8 {
+		return uint8(max(n, 0))
+	}
+	for i, l := range fdLengths {
+		if n <= int(l) {
+			return uint8(9 + i)
+		}
+	}
+	return 15
+}
+
+// DLC returns the frame's data length code.
+func (f *Frame) DLC() uint8 {
+	return LengthDLC(int(f.Length))
+}
+
+// Validate reports frames no bus can carry: classic frames over 8 bytes, FD
+// lengths without a DLC code, FD remote frames, and BRS or ESI set on a
+// classic frame.
+func (f *Frame) Validate() error {
+	switch {
+	case f.Length > MaxFDLength:
+		return fmt.Errorf("gocan: frame length %d exceeds %d bytes", f.Length, MaxFDLength)
+	case !f.FD && f.Length > 8:
+		return fmt.Errorf("gocan: classic CAN frame length %d exceeds 8 bytes", f.Length)
+	case !f.FD && (f.BRS || f.ESI):
+		return errors.New("gocan: BRS and ESI are only valid on CAN FD frames")
+	case f.FD && f.Remote:
+		return errors.New("gocan: CAN FD has no remote frames")
+	case f.FD && DLCLength(f.DLC()) != f.Length:
+		return fmt.Errorf("gocan: %d is not a valid CAN FD length", f.Length)
+	}
+	return nil
+}
+
 // Bytes returns the payload as a slice over the frame's Data array.
 func (f *Frame) Bytes() []byte {
 	return f.Data[:f.Length]
@@ -40,14 +116,14 @@ func (f Frame) String() string {
 	var out strings.Builder
 	fmt.Fprintf(&out, "0x%03X || %d || ", f.ID, f.Length)
 	var hexView strings.Builder
-	for i, b := range f.Data[:f.Length] {
+	for i, b := range f.Bytes() {
 		if i > 0 {
 			hexView.WriteString(" ")
 		}
 		fmt.Fprintf(&hexView, "%02X", b)
 	}
 	fmt.Fprintf(&out, "%-23s || ", hexView.String())
-	for _, b := range f.Data[:f.Length] {
+	for _, b := range f.Bytes() {
 		if b < 32 || b > 127 {
 			out.WriteString("·")
 		} else {
@@ -0,0 +1,43 @@
+package gocan
+
+import "testing"
+
+func TestDLCMapping(t *testing.T) {
+	for _, tc := range []struct {
+		n   int
+		dlc uint8
+		len uint8
+	}{
+		{0, 0, 0}, {8, 8, 8}, {9, 9, 12}, {12, 9, 12}, {13, 10, 16},
+		{20, 11, 20}, {24, 12, 24}, {25, 13, 32}, {33, 14, 48}, {49, 15, 64}, {64, 15, 64},
+	} {
+		if dlc := LengthDLC(tc.n); dlc != tc.dlc || DLCLength(dlc) != tc.len {
+			t.Errorf("%d bytes: dlc %d (%d bytes), want %d (%d bytes)", tc.n, dlc, DLCLength(dlc), tc.dlc, tc.len)
+		}
+	}
+	if f := NewFDFrame(0x100, make([]byte, 70)); f.Length != 64 || !f.FD || !f.BRS {
+		t.Fatalf("oversized FD frame: %+v", f)
+	}
+	if f := NewFrame(0x100, make([]byte, 12)); f.Length != 8 || f.FD {
+		t.Fatalf("oversized classic frame: %+v", f)
+	}
+}
+
+func TestFrameValidate(t *testing.T) {
+	for name, f := range map[string]Frame{
+		"classic over 8": {Length: 12},
+		"FD remote":      {FD: true, Remote: true},
+		"FD length":      {FD: true, Length: 13},
+		"BRS on classic": {BRS: true},
+		"over 64":        {FD: true, Length: 65},
+	} {
+		if f.Validate() == nil {
+			t.Errorf("%s: want error", name)
+		}
+	}
+	for _, f := range []Frame{NewFrame(1, []byte{1}), NewFDFrame(1, make([]byte, 13)), {FD: true, ESI: true, Length: 64}} {
+		if err := f.Validate(); err != nil {
+			t.Errorf("%v: %v", f, err)
+		}
+	}
+}
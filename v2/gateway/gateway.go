@@ -0,0 +1,280 @@
+// Package gateway bridges two or more gocan v2 buses, routing frames
+// between them by declarative rules: forward or drop, to some or all of the
+// other buses, with identifier remapping, payload rewriting and rate
+// limiting. It works on any registered adapters, for example to join the
+// HS-CAN side of a bench harness to a CANUSB on the SWCAN side, or to sit
+// between an ECU and the car and block one message.
+//
+//	gw, err := gateway.New(map[string]*gocan.Bus{"ecu": ecu, "car": car},
+//		gateway.Rule{Name: "no immo", From: "car", Match: []gocan.Filter{gocan.MatchID(0x3E0)}, Drop: true},
+//		gateway.Rule{Name: "rest"},
+//	)
+//	err = gw.Run(ctx)
+//
+// Each frame a bus receives is checked against the rules in order and the
+// first match decides what happens to it; frames no rule matches are
+// dropped, so a trailing zero Rule forwards everything else everywhere.
+// Frames a gateway sends are not received back on adapters that don't echo
+// their own frames, which is all hardware; a looping adapter such as
+// loopback would send them round again.
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	gocan "github.com/roffe/gocan/v2"
+)
+
+// queueLen bounds the frames waiting for each destination bus; frames
+// beyond it are dropped and counted as overflows.
+const queueLen = 1024
+
+// Rule says what to do with the frames it matches.
+type Rule struct {
+	Name  string         // for Stats; defaults to "rule N", counting from 1
+	From  string         // source bus, "" for any
+	To    []string       // destination buses, none for every bus but the source
+	Match []gocan.Filter // frames the rule applies to, none for all
+	Drop  bool           // drop matching frames instead of forwarding them
+	// Remap changes identifiers on the way through, keeping their format
+	// unless the new identifier needs 29 bits; identifiers not in it pass
+	// unchanged.
+	Remap map[uint32]uint32
+	// Rewrite, when set, edits a copy of each forwarded frame after Remap;
+	// returning false drops it. It runs on the source bus's receive
+	// goroutine: keep it quick.
+	Rewrite func(f *gocan.Frame) bool
+	// RateLimit forwards each identifier at most once per interval of
+	// wall time, dropping the frames in between. Frame timestamps aren't
+	// used: a looping replay sends them backwards.
+	RateLimit time.Duration
+}
+
+// RuleStats counts what a rule did. Forwarded and Errors count sends, so a
+// frame forwarded to two buses counts twice.
+type RuleStats struct {
+	Name        string
+	Matched     uint64 // frames the rule decided on
+	Forwarded   uint64 // sends that succeeded
+	Dropped     uint64 // dropped by Drop or Rewrite
+	RateLimited uint64 // dropped by RateLimit
+	Overflows   uint64 // dropped because a destination fell behind
+	Errors      uint64 // sends that failed
+}
+
+// Stats is a snapshot of a gateway's counters.
+type Stats struct {
+	Rules     []RuleStats // in rule order
+	Unmatched uint64      // frames no rule matched
+}
+
+// Gateway routes frames between buses. Build one with New and start it
+// with Run.
+type Gateway struct {
+	buses     map[string]*gocan.Bus
+	names     []string // sorted, so destinations are visited in a fixed order
+	rules     []*rule
+	unmatched atomic.Uint64
+	running   atomic.Bool
+}
+
+// rule is a Rule with its counters and rate limit state.
+type rule struct {
+	Rule
+	to []string
+
+	matched, forwarded, dropped, limited, overflows, errors atomic.Uint64
+
+	mu   sync.Mutex
+	last map[limitKey]time.Time // when the last frame was forwarded, by identifier
+}
+
+type limitKey struct {
+	id       uint32
+	extended bool
+}
+
+// queued is a frame on its way to a destination bus.
+type queued struct {
+	f    gocan.Frame
+	rule *rule
+}
+
+// New returns a gateway between the named buses, routing by rules. It
+// fails if a rule names a bus that isn't there.
+func New(buses map[string]*gocan.Bus, rules ...Rule) (*Gateway, error) {
+	if len(buses) < 2 {
+		return nil, errors.New("gateway: need at least two buses")
+	}
+	g := &Gateway{buses: buses}
+	for name := range buses {
+		g.names = append(g.names, name)
+	}
+	slices.Sort(g.names)
+	for i, r := range rules {
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule %d", i+1)
+		}
+		if _, ok := buses[r.From]; r.From != "" && !ok {
+			return nil, fmt.Errorf("gateway: %s: unknown bus %q", r.Name, r.From)
+		}
+		for _, to := range r.To {
+			if _, ok := buses[to]; !ok {
+				return nil, fmt.Errorf("gateway: %s: unknown bus %q", r.Name, to)
+			}
+		}
+		g.rules = append(g.rules, &rule{Rule: r, to: slices.Clone(r.To), last: make(map[limitKey]time.Time)})
+	}
+	return g, nil
+}
+
+// Run routes frames until ctx is done, returning nil, or one of the buses
+// terminates or is closed, returning why. A gateway runs once at a time.
+func (g *Gateway) Run(ctx context.Context) error {
+	if !g.running.CompareAndSwap(false, true) {
+		return errors.New("gateway: already running")
+	}
+	defer g.running.Store(false)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	queues := make(map[string]chan queued, len(g.buses))
+	var wg sync.WaitGroup
+	for name, bus := range g.buses {
+		q := make(chan queued, queueLen)
+		queues[name] = q
+		wg.Go(func() { g.send(ctx, bus, q) })
+	}
+	for name, bus := range g.buses {
+		stop := bus.OnReceive(func(f gocan.Frame) { g.route(name, f, queues) })
+		defer stop()
+	}
+
+	dead := make(chan error, len(g.buses))
+	for name, bus := range g.buses {
+		go func() {
+			select {
+			case <-bus.Done():
+				dead <- fmt.Errorf("gateway: bus %s: %w", name, context.Cause(bus.Context()))
+			case <-ctx.Done():
+			}
+		}()
+	}
+	var err error
+	select {
+	case <-ctx.Done():
+	case err = <-dead:
+	}
+	cancel()
+	wg.Wait()
+	return err
+}
+
+// route applies the first matching rule to a frame received on bus from.
+// It runs on that bus's receive goroutine and never blocks.
+func (g *Gateway) route(from string, f gocan.Frame, queues map[string]chan queued) {
+	r := g.match(from, &f)
+	if r == nil {
+		g.unmatched.Add(1)
+		return
+	}
+	r.matched.Add(1)
+	if r.Drop {
+		r.dropped.Add(1)
+		return
+	}
+	if r.RateLimit > 0 && !r.allow(&f) {
+		r.limited.Add(1)
+		return
+	}
+	if id, ok := r.Remap[f.ID]; ok {
+		f.ID = id
+		f.Extended = f.Extended || id > 0x7FF
+	}
+	if r.Rewrite != nil && !r.Rewrite(&f) {
+		r.dropped.Add(1)
+		return
+	}
+	to := r.to
+	if len(to) == 0 {
+		to = g.names
+	}
+	for _, name := range to {
+		if name == from {
+			continue
+		}
+		select {
+		case queues[name] <- queued{f, r}:
+		default:
+			r.overflows.Add(1)
+		}
+	}
+}
+
+func (g *Gateway) match(from string, f *gocan.Frame) *rule {
+	for _, r := range g.rules {
+		if r.From != "" && r.From != from {
+			continue
+		}
+		if len(r.Match) == 0 || slices.ContainsFunc(r.Match, func(m gocan.Filter) bool { return m.Match(*f) }) {
+			return r
+		}
+	}
+	return nil
+}
+
+// allow reports whether the rate limit lets f through, and if so starts
+// the next interval.
+func (r *rule) allow(f *gocan.Frame) bool {
+	key := limitKey{f.ID, f.Extended}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	if last, ok := r.last[key]; ok && now.Sub(last) < r.RateLimit {
+		return false
+	}
+	r.last[key] = now
+	return true
+}
+
+// send writes queued frames to bus until ctx is done.
+func (g *Gateway) send(ctx context.Context, bus *gocan.Bus, q <-chan queued) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-q:
+			if err := bus.Send(ctx, e.f); err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				e.rule.errors.Add(1)
+				continue
+			}
+			e.rule.forwarded.Add(1)
+		}
+	}
+}
+
+// Stats returns the gateway's counters. They carry over between runs.
+func (g *Gateway) Stats() Stats {
+	st := Stats{Unmatched: g.unmatched.Load()}
+	for _, r := range g.rules {
+		st.Rules = append(st.Rules, RuleStats{
+			Name:        r.Name,
+			Matched:     r.matched.Load(),
+			Forwarded:   r.forwarded.Load(),
+			Dropped:     r.dropped.Load(),
+			RateLimited: r.limited.Load(),
+			Overflows:   r.overflows.Load(),
+			Errors:      r.errors.Load(),
+		})
+	}
+	return st
+}
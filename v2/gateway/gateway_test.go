@@ -0,0 +1,170 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	gocan "github.com/roffe/gocan/v2"
+)
+
+// pair opens two nodes on a private virtual network: one for the test, one
+// for the gateway.
+func pair(t *testing.T) (node, side *gocan.Bus) {
+	t.Helper()
+	n := gocan.NewVirtualNetwork()
+	var buses [2]*gocan.Bus
+	for i := range buses {
+		bus, err := gocan.OpenAdapter(context.Background(), n.Node(gocan.VirtualNodeConfig{}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { bus.Close() })
+		buses[i] = bus
+	}
+	return buses[0], buses[1]
+}
+
+func TestGateway(t *testing.T) {
+	ecu, ecuSide := pair(t)
+	car, carSide := pair(t)
+	gw, err := New(map[string]*gocan.Bus{"ecu": ecuSide, "car": carSide},
+		Rule{Name: "block", From: "car", Match: []gocan.Filter{gocan.MatchID(0x3E0)}, Drop: true},
+		Rule{Name: "remap", From: "ecu", Match: []gocan.Filter{gocan.MatchID(0x100)}, Remap: map[uint32]uint32{0x100: 0x101},
+			Rewrite: func(f *gocan.Frame) bool { f.Data[0] ^= 0xFF; return f.Data[1] == 0 }},
+		Rule{Name: "limit", Match: []gocan.Filter{gocan.MatchID(0x200)}, RateLimit: time.Hour},
+		Rule{Name: "car to ecu", From: "car", To: []string{"ecu"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- gw.Run(ctx) }()
+	waitRunning(t, gw)
+
+	rctx, rcancel := context.WithTimeout(ctx, time.Second)
+	defer rcancel()
+	atECU := ecu.Subscribe(rctx)
+	atCar := car.Subscribe(rctx)
+
+	car.Send(ctx, gocan.NewFrame(0x3E0, nil)) // blocked
+	car.Send(ctx, gocan.NewFrame(0x200, nil)) // limited after the first
+	car.Send(ctx, gocan.NewFrame(0x200, nil))
+	car.Send(ctx, gocan.NewFrame(0x7E0, nil))
+	for _, want := range []uint32{0x200, 0x7E0} {
+		if f := <-atECU; f.ID != want {
+			t.Fatalf("ecu: want 0x%03X, got %s", want, f)
+		}
+	}
+
+	ecu.Send(ctx, gocan.NewFrame(0x100, []byte{0x0F, 1})) // rewrite drops it
+	ecu.Send(ctx, gocan.NewFrame(0x100, []byte{0x0F, 0}))
+	ecu.Send(ctx, gocan.NewFrame(0x300, nil)) // unmatched
+	if f := <-atCar; f.ID != 0x101 || f.Data[0] != 0xF0 {
+		t.Fatalf("car: want rewritten 0x101, got %s", f)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	st := gw.Stats()
+	want := []RuleStats{
+		{Name: "block", Matched: 1, Dropped: 1},
+		{Name: "remap", Matched: 2, Forwarded: 1, Dropped: 1},
+		{Name: "limit", Matched: 2, Forwarded: 1, RateLimited: 1},
+		{Name: "car to ecu", Matched: 1, Forwarded: 1},
+	}
+	for i, r := range st.Rules {
+		if r != want[i] {
+			t.Errorf("want %+v, got %+v", want[i], r)
+		}
+	}
+	if st.Unmatched != 1 {
+		t.Errorf("want 1 unmatched, got %d", st.Unmatched)
+	}
+}
+
+func TestRemapToExtended(t *testing.T) {
+	ecu, ecuSide := pair(t)
+	car, carSide := pair(t)
+	gw, err := New(map[string]*gocan.Bus{"ecu": ecuSide, "car": carSide},
+		Rule{From: "ecu", Remap: map[uint32]uint32{0x7E8: 0x18DAF110}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- gw.Run(ctx) }()
+	waitRunning(t, gw)
+
+	rctx, rcancel := context.WithTimeout(ctx, time.Second)
+	defer rcancel()
+	atCar := car.Subscribe(rctx)
+	ecu.Send(ctx, gocan.NewFrame(0x7E8, nil))
+	if f := <-atCar; f.ID != 0x18DAF110 || !f.Extended {
+		t.Fatalf("car: want extended 0x18DAF110, got %s", f)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGatewayBusDies(t *testing.T) {
+	_, a := pair(t)
+	_, b := pair(t)
+	gw, err := New(map[string]*gocan.Bus{"a": a, "b": b}, Rule{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() { done <- gw.Run(context.Background()) }()
+	waitRunning(t, gw)
+	b.Close()
+	select {
+	case err := <-done:
+		if !errors.Is(err, gocan.ErrClosed) {
+			t.Fatalf("want the bus's error, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("gateway outlived a bus")
+	}
+
+	if _, err := New(map[string]*gocan.Bus{"a": a, "b": b}, Rule{To: []string{"c"}}); err == nil {
+		t.Fatal("rule to an unknown bus accepted")
+	}
+}
+
+func waitRunning(t *testing.T, gw *Gateway) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !gw.running.Load() {
+		if time.Now().After(deadline) {
+			t.Fatal("gateway didn't start")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond) // taps are registered just after the flag
+}
+
+// TestRateLimitTimestampsBackwards checks that a log looping back to its
+// start doesn't block an identifier.
+func TestRateLimitTimestampsBackwards(t *testing.T) {
+	r := &rule{Rule: Rule{RateLimit: 20 * time.Millisecond}, last: make(map[limitKey]time.Time)}
+	f := gocan.NewFrame(0x200, nil)
+	f.Timestamp = time.Unix(1000, 0)
+	if !r.allow(&f) {
+		t.Fatal("first frame limited")
+	}
+	if r.allow(&f) {
+		t.Fatal("second frame within the interval allowed")
+	}
+	time.Sleep(30 * time.Millisecond)
+	f.Timestamp = time.Unix(1, 0) // the replay looped
+	if !r.allow(&f) {
+		t.Fatal("frame after the interval limited")
+	}
+}
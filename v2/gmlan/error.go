@@ -20,7 +20,7 @@ func CheckErr(frame gocan.Frame) error {
 	if frame.Data[1] == 0x7F {
 		return &GMError{TranslateServiceCode(frame.Data[2]), TranslateErrorCode(frame.Data[3])}
 	}
-	if bytes.Equal(frame.Data[:], []byte{0x01, 0x60, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}) {
+	if bytes.Equal(frame.Data[:8], []byte{0x01, 0x60, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}) {
 		return errors.New("busy, repeat request")
 	}
 	return nil
@@ -35,7 +35,27 @@ func isBusyReply(service byte, frame gocan.Frame) bool {
 		return true
 	}
 	return service != RETURN_TO_NORMAL_MODE &&
-		bytes.Equal(frame.Data[:], []byte{0x01, 0x60, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00})
+		bytes.Equal(frame.Data[:8], []byte{0x01, 0x60, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00})
+}
+
+// checkPDU is CheckErr for a response reassembled by ISO-TP, which carries
+// no PCI byte or padding.
+func checkPDU(resp []byte) error {
+	if len(resp) >= 3 && resp[0] == 0x7F {
+		return &GMError{TranslateServiceCode(resp[1]), TranslateErrorCode(resp[2])}
+	}
+	if bytes.Equal(resp, []byte{0x60}) {
+		return errors.New("busy, repeat request")
+	}
+	return nil
+}
+
+// isBusyPDU is isBusyReply for a response reassembled by ISO-TP.
+func isBusyPDU(service byte, resp []byte) bool {
+	if len(resp) >= 3 && resp[0] == 0x7F && resp[1] == service && resp[2] == 0x21 {
+		return true
+	}
+	return service != RETURN_TO_NORMAL_MODE && bytes.Equal(resp, []byte{0x60})
 }
 
 func TranslateServiceCode(p byte) string {
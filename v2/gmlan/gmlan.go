@@ -8,12 +8,12 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
-	"io"
 	"log"
 	"strings"
 	"time"
 
 	gocan "github.com/roffe/gocan/v2"
+	"github.com/roffe/gocan/v2/isotp"
 )
 
 type GMLanOption func(*Client)
@@ -126,6 +126,58 @@ func (cl *Client) recv(ctx context.Context, timeout time.Duration) (gocan.Frame,
 	return cl.c.Recv(rctx, cl.recvID...)
 }
 
+// exchange sends pdu on txID over ISO-TP and returns the response PDU read
+// on any of the recvIDs, so multi-frame transfers in either direction run with
+// the receiver's flow control. Like request, busyRepeatRequest replies are
+// retried; responsePending replies are waited out.
+func (cl *Client) exchange(ctx context.Context, txID uint32, extended bool, pdu []byte) ([]byte, error) {
+	if len(cl.recvID) == 0 {
+		return nil, errors.New("no response ID set")
+	}
+	opts := []isotp.Option{isotp.WithTimeout(cl.defaultTimeout), isotp.WithAlternateRxIDs(cl.recvID[1:]...)}
+	if extended {
+		opts = append(opts, isotp.WithExtendedID())
+	}
+	tp := isotp.New(cl.c, txID, cl.recvID[0], opts...)
+	for attempt := 0; ; attempt++ {
+		resp, err := cl.exchangeOnce(ctx, tp, pdu)
+		if err != nil || !isBusyPDU(pdu[0], resp) || attempt >= busyRetries {
+			return resp, err
+		}
+		select {
+		case <-time.After(busyRetryDelay):
+		case <-ctx.Done():
+			return resp, ctx.Err()
+		}
+	}
+}
+
+// exchangeOnce runs one request/response on tp. The subscription is held
+// across responsePending replies so the final response cannot slip through
+// between receives.
+func (cl *Client) exchangeOnce(ctx context.Context, tp *isotp.Conn, pdu []byte) ([]byte, error) {
+	sctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ch := cl.c.Subscribe(sctx, cl.recvID...)
+	if err := tp.Send(gocan.WithExpectedResponses(ctx, 1), pdu); err != nil {
+		return nil, err
+	}
+	timeout := cl.defaultTimeout
+	for {
+		tctx, tcancel := context.WithTimeout(ctx, timeout)
+		resp, err := tp.RecvFrom(tctx, ch)
+		tcancel()
+		if err != nil {
+			return nil, err
+		}
+		if len(resp) >= 3 && resp[0] == 0x7F && resp[1] == pdu[0] && resp[2] == 0x78 {
+			timeout = 5 * time.Second
+			continue
+		}
+		return resp, nil
+	}
+}
+
 /*
 8.1 ClearDiagnosticInformation ($04) Service. The ClearDiagnosticInformation service is used by the tester
 to clear diagnostic information in one or multiple nodes’ memory. The ClearDiagnosticInformation service is
@@ -233,98 +285,28 @@ func (cl *Client) ReadDataByIdentifier(ctx context.Context, pid byte) ([]byte, e
 }
 
 func (cl *Client) ReadDataByIdentifierFrame(ctx context.Context, frame gocan.Frame) ([]byte, error) {
-	rctx, cancel := context.WithTimeout(ctx, cl.defaultTimeout)
-	defer cancel()
-	resp, err := cl.c.Request(rctx, frame, cl.recvID...)
-	if err != nil {
-		return nil, fmt.Errorf("ReadDataByIdentifier[1]: %w", err)
+	d := frame.Bytes()
+	if len(d) < 2 || d[0]&0xF0 != 0 || int(d[0]) > len(d)-1 {
+		return nil, fmt.Errorf("ReadDataByIdentifier[1]: request is not a single frame [% 02X]", d)
 	}
-	if err := CheckErr(resp); err != nil {
+	resp, err := cl.exchange(ctx, frame.ID, frame.Extended, d[1:1+d[0]])
+	if err != nil {
 		return nil, fmt.Errorf("ReadDataByIdentifier[2]: %w", err)
 	}
-	d := resp.Bytes()
-	if len(d) == 8 && bytes.Equal(d, []byte{0x01, 0x60, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}) {
+	if bytes.Equal(resp, []byte{0x60}) {
 		return nil, fmt.Errorf("ReadDataByIdentifier[3]: busy, try again")
 	}
-	if len(d) >= 4 && bytes.HasPrefix(d, []byte{0x02, 0x1A, 0x18, 0x00}) {
+	if bytes.Equal(resp, []byte{0x1A, 0x18}) {
 		return nil, fmt.Errorf("ReadDataByIdentifier[4]: busy, try again")
 	}
-	// Single-frame positive response (len, 0x5A, DID, data...)
-	if len(d) >= 3 && d[1] == 0x5A {
-		payloadLen := int(d[0]) - 2 // exclude SID+ID
-		start := 3
-		end := start + payloadLen
-		if payloadLen < 0 || end > len(d) {
-			return nil, errors.New("ReadDataByIdentifier[5]: malformed single-frame response")
-		}
-		return d[start:end], nil
+	if err := checkPDU(resp); err != nil {
+		return nil, fmt.Errorf("ReadDataByIdentifier[5]: %w", err)
 	}
-	// First frame of a multi-frame response
-	if len(d) >= 5 && d[0] == 0x10 {
-		total := int(d[1]) - 2 // bytes to return (exclude SID+ID)
-		if total < 0 {
-			return nil, errors.New("ReadDataByIdentifier[6]: negative payload length in first frame")
-		}
-		buf := make([]byte, total)
-		w := copy(buf, d[4:]) // up to 4 bytes already in first frame
-		left := max(0, total-w)
-		// How many consecutive frames we expect (7 data bytes per CF)
-		framesToReceive := (left + 6) / 7
-		sctx, cancel := context.WithCancel(ctx)
-		defer cancel()
-		dataChan := cl.c.Subscribe(sctx, cl.recvID...)
-		// Send Flow Control: Continue to send (CTS), no block size, no separation time
-		fcCtx := gocan.WithExpectedResponses(ctx, framesToReceive)
-		if err := cl.c.Send(fcCtx, gocan.NewFrame(cl.canID, []byte{0x30, 0x00, 0x00})); err != nil {
-			return nil, fmt.Errorf("ReadDataByIdentifier[7]: %w", err)
-		}
-		// Expect consecutive frames starting at 0x21 .. 0x2F, then wrap to 0x20, etc.
-		seq := byte(0x21)
-		// Reusable timer (less GC churn than time.After in a loop)
-		timer := time.NewTimer(cl.defaultTimeout)
-		defer timer.Stop()
-		for framesToReceive > 0 {
-			if !timer.Stop() {
-				select {
-				case <-timer.C:
-				default:
-				}
-			}
-			timer.Reset(cl.defaultTimeout)
-			select {
-			case response, ok := <-dataChan:
-				if !ok {
-					return nil, errors.New("ReadDataByIdentifier[8]: subscription closed")
-				}
-				fd := response.Bytes()
-				if len(fd) < 2 {
-					return nil, fmt.Errorf("ReadDataByIdentifier[8]: short consecutive frame")
-				}
-				// If not a CF (0x2n), check for error frame
-				if (fd[0] & 0x20) != 0x20 {
-					if err := CheckErr(response); err != nil {
-						return nil, fmt.Errorf("ReadDataByIdentifier[9]: %w", err)
-					}
-				}
-				if fd[0] != seq {
-					return nil, fmt.Errorf("ReadDataByIdentifier[10]: frame sequence out of order, expected 0x%X got 0x%X", seq, fd[0])
-				}
-				n := copy(buf[w:], fd[1:]) // copy up to 7 bytes
-				w += n
-				left -= n
-				if left < 0 {
-					left = 0
-				}
-				// Wrap sequence number without branches: 0x21..0x2F -> 0x20 -> 0x21...
-				seq = 0x20 | ((seq + 1) & 0x0F)
-				framesToReceive--
-			case <-timer.C:
-				return nil, fmt.Errorf("ReadDataByIdentifier[11]: timeout waiting for multi-frame response")
-			}
-		}
-		return buf, nil
+	// Positive response: 0x5A, DID, data...
+	if len(resp) < 2 || resp[0] != 0x5A {
+		return nil, fmt.Errorf("ReadDataByIdentifier[6]: unknown response [% 02X]", resp)
 	}
-	return nil, fmt.Errorf("ReadDataByIdentifier[12]: unknown response [% 02X]", resp.Bytes())
+	return resp[2:], nil
 }
 
 /*
@@ -356,99 +338,22 @@ service
 */
 
 func (cl *Client) ReadMemoryByAddress(ctx context.Context, address, length uint32) ([]byte, error) {
-	resp, err := cl.request(ctx, []byte{0x06, READ_MEMORY_BY_ADDRESS, byte(address >> 16), byte(address >> 8), byte(address), byte(length >> 8), byte(length)}, cl.defaultTimeout)
+	resp, err := cl.exchange(ctx, cl.canID, false, []byte{READ_MEMORY_BY_ADDRESS, byte(address >> 16), byte(address >> 8), byte(address), byte(length >> 8), byte(length)})
 	if err != nil {
 		return nil, fmt.Errorf("ReadMemoryByAddress[1]: %w", err)
 	}
-	if err := CheckErr(resp); err != nil {
+	if err := checkPDU(resp); err != nil {
 		return nil, fmt.Errorf("ReadMemoryByAddress[2]: %w", err)
 	}
-	d := resp.Bytes()
-
-	// single-frame positive response: [len][SID+0x40][addrH][addrM][addrL][data...]
-	if len(d) >= 5 && d[1] == READ_MEMORY_BY_ADDRESS+0x40 && d[0] < 0x10 {
-		want := int(length)
-		if want < 0 {
-			return nil, errors.New("ReadMemoryByAddress[3]: invalid requested length")
-		}
-		start := 5
-		end := start + want
-		if end > len(d) {
-			return nil, errors.New("ReadMemoryByAddress[4]: malformed single-frame response (too short)")
-		}
-		return d[start:end], nil
+	// Positive response: SID+0x40, addrH, addrM, addrL, data...
+	if len(resp) < 4 || resp[0] != READ_MEMORY_BY_ADDRESS+0x40 {
+		return nil, fmt.Errorf("ReadMemoryByAddress[3]: unhandled response [% 02X]", resp)
 	}
-
-	// first frame (multi-frame): [0x10][totalLen][SID+0x40][addrH][addrM][addrL][data0][data1]
-	if len(d) >= 7 && d[0] == 0x10 && d[2] == READ_MEMORY_BY_ADDRESS+0x40 {
-		// effective data bytes = totalLen - 4 (excluding SID+addr(3)),
-		// clamped with the requested length.
-		totalFF := int(d[1]) - 4
-		total := min(int(length), max(0, totalFF))
-
-		buf := make([]byte, total)
-		w := copy(buf, d[6:min(6+2, len(d))]) // up to 2 bytes already in the FF
-		left := max(0, total-w)
-
-		framesToReceive := (left + 6) / 7 // ceil(left/7)
-
-		// Subscribe before FC to avoid missing CFs
-		sctx, cancel := context.WithCancel(ctx)
-		defer cancel()
-		dataChan := cl.c.Subscribe(sctx, cl.recvID...)
-
-		// FC: CTS, BS=0, STmin=0
-		fcCtx := gocan.WithExpectedResponses(ctx, framesToReceive)
-		if err := cl.c.Send(fcCtx, gocan.NewFrame(cl.canID, []byte{0x30, 0x00, 0x00})); err != nil {
-			return nil, fmt.Errorf("ReadMemoryByAddress[4]: %w", err)
-		}
-
-		seq := byte(0x21)
-		timer := time.NewTimer(cl.defaultTimeout)
-		defer timer.Stop()
-		for framesToReceive > 0 {
-			if !timer.Stop() {
-				select {
-				case <-timer.C:
-				default:
-				}
-			}
-			timer.Reset(cl.defaultTimeout)
-
-			select {
-			case r, ok := <-dataChan:
-				if !ok {
-					return nil, errors.New("ReadMemoryByAddress[5]: subscription closed")
-				}
-				fd := r.Bytes()
-				if len(fd) < 2 {
-					return nil, errors.New("ReadMemoryByAddress[5]: short consecutive frame")
-				}
-				// if not CF (0x2n), validate as error frame
-				if (fd[0] & 0x20) != 0x20 {
-					if err := CheckErr(r); err != nil {
-						return nil, err
-					}
-				}
-				if fd[0] != seq {
-					return nil, fmt.Errorf("ReadMemoryByAddress[6]: frame sequence out of order, expected 0x%X got 0x%X", seq, fd[0])
-				}
-
-				n := copy(buf[w:], fd[1:]) // up to 7 bytes
-				w += n
-				left = max(0, left-n)
-
-				// wrap 0x21..0x2F -> 0x20 -> 0x21...
-				seq = 0x20 | ((seq + 1) & 0x0F)
-				framesToReceive--
-
-			case <-timer.C:
-				return nil, errors.New("ReadMemoryByAddress[7]: timeout waiting for response")
-			}
-		}
-		return buf, nil
+	data := resp[4:]
+	if len(data) < int(length) {
+		return nil, fmt.Errorf("ReadMemoryByAddress[4]: short response, want %d bytes got %d", length, len(data))
 	}
-	return nil, errors.New("ReadMemoryByAddress[8]: unhandled response")
+	return data[:length], nil
 }
 
 // 8.8 SecurityAccess ($27) Service.
@@ -769,67 +674,11 @@ func (cl *Client) WriteDataByAddress2(ctx context.Context, address uint32, data
 }
 
 func (cl *Client) writeDataByIdentifierMultiframe(ctx context.Context, pid byte, data []byte) error {
-	r := bytes.NewReader(data)
-	firstPart := make([]byte, 4)
-	_, err := r.Read(firstPart)
-	if err != nil {
-		if err == io.EOF {
-			// do nothing
-		} else {
-			return err
-		}
-	}
-	leng := byte(len(data)) + 2
-	payload := append([]byte{0x10, leng, WRITE_DATA_BY_IDENTIFIER, pid}, firstPart...)
-	resp, err := cl.request(ctx, payload, cl.defaultTimeout)
+	resp, err := cl.exchange(ctx, cl.canID, false, append([]byte{WRITE_DATA_BY_IDENTIFIER, pid}, data...))
 	if err != nil {
-		return err
-	}
-	if err := CheckErr(resp); err != nil {
-		return err
-	}
-
-	if resp.Data[0] != 0x30 || resp.Data[1] > 0x01 {
-		log.Println(resp.String())
-		return errors.New("invalid response to initial writeDataByIdentifier")
-	}
-
-	delay := resp.Data[2]
-
-	var seq byte = 0x21
-	for r.Len() > 0 {
-		pkg := []byte{seq}
-	inner:
-		for i := 1; i < 8; i++ {
-			b, err := r.ReadByte()
-			if err != nil {
-				if err == io.EOF {
-					break inner
-				}
-				return err
-			}
-			pkg = append(pkg, b)
-		}
-
-		if r.Len() > 0 {
-			cl.c.Send(ctx, gocan.NewFrame(cl.canID, pkg))
-			time.Sleep(time.Duration(delay) * time.Millisecond)
-		} else {
-			resp, err := cl.request(ctx, pkg, cl.defaultTimeout)
-			if err != nil {
-				return err
-			}
-			if err := CheckErr(resp); err != nil {
-				return err
-			}
-		}
-
-		seq++
-		if seq == 0x30 {
-			seq = 0x20
-		}
+		return fmt.Errorf("WriteDataByIdentifier: %w", err)
 	}
-	return nil
+	return checkPDU(resp)
 }
 
 // 8.15 TesterPresent ($3E) Service
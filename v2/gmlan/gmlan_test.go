@@ -0,0 +1,101 @@
+package gmlan
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	gocan "github.com/roffe/gocan/v2"
+	"github.com/roffe/gocan/v2/internal/ecutest"
+	"github.com/roffe/gocan/v2/isotp"
+)
+
+// fakeECU answers every request PDU on 0x7E0 with handle's reply on 0x7E8,
+// over ISO-TP with the given block size.
+func fakeECU(t *testing.T, bus *gocan.Bus, blockSize byte, handle func(req []byte) []byte) {
+	t.Helper()
+	ecutest.Serve(t, bus, 0x7E8, 0x7E0, func(req []byte) [][]byte {
+		return [][]byte{handle(req)}
+	}, isotp.WithBlockSize(blockSize))
+}
+
+func TestReadMemoryByAddressMultiFrame(t *testing.T) {
+	bus := ecutest.Loopback(t)
+	want := make([]byte, 100)
+	for i := range want {
+		want[i] = byte(i)
+	}
+	fakeECU(t, bus, 4, func(req []byte) []byte {
+		if req[0] != READ_MEMORY_BY_ADDRESS {
+			return []byte{0x7F, req[0], 0x11}
+		}
+		return append([]byte{READ_MEMORY_BY_ADDRESS + 0x40, req[1], req[2], req[3]}, want...)
+	})
+
+	ctx, cancel := context.WithTimeout(t.Context(), 2*time.Second)
+	defer cancel()
+	got, err := New(bus, 0x7E0, 0x7E8).ReadMemoryByAddress(ctx, 0x123456, uint32(len(want)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("got % X, want % X", got, want)
+	}
+}
+
+func TestReadDataByIdentifierMultiFrame(t *testing.T) {
+	bus := ecutest.Loopback(t)
+	vin := []byte("W0L0XCF0814000000")
+	fakeECU(t, bus, 0, func(req []byte) []byte {
+		return append([]byte{READ_DATA_BY_IDENTIFIER + 0x40, req[1]}, vin...)
+	})
+
+	ctx, cancel := context.WithTimeout(t.Context(), 2*time.Second)
+	defer cancel()
+	got, err := New(bus, 0x7E0, 0x7E8).ReadDataByIdentifierString(ctx, 0x90)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(vin) {
+		t.Fatalf("got %q, want %q", got, vin)
+	}
+}
+
+func TestWriteDataByIdentifierMultiFrame(t *testing.T) {
+	bus := ecutest.Loopback(t)
+	data := []byte("0123456789ABCDEF")
+	got := make(chan []byte, 1)
+	fakeECU(t, bus, 1, func(req []byte) []byte {
+		got <- req
+		return []byte{WRITE_DATA_BY_IDENTIFIER + 0x40, req[1]}
+	})
+
+	ctx, cancel := context.WithTimeout(t.Context(), 2*time.Second)
+	defer cancel()
+	if err := New(bus, 0x7E0, 0x7E8).WriteDataByIdentifier(ctx, 0x90, data); err != nil {
+		t.Fatal(err)
+	}
+	req := <-got
+	if want := append([]byte{WRITE_DATA_BY_IDENTIFIER, 0x90}, data...); !bytes.Equal(req, want) {
+		t.Fatalf("ECU got % X, want % X", req, want)
+	}
+}
+
+func TestSecondRecvID(t *testing.T) {
+	bus := ecutest.Loopback(t)
+	vin := []byte("W0L0XCF0814000000")
+	fakeECU(t, bus, 0, func(req []byte) []byte {
+		return append([]byte{READ_DATA_BY_IDENTIFIER + 0x40, req[1]}, vin...)
+	})
+
+	ctx, cancel := context.WithTimeout(t.Context(), 2*time.Second)
+	defer cancel()
+	got, err := New(bus, 0x7E0, 0x5E8, 0x7E8).ReadDataByIdentifierString(ctx, 0x90)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != string(vin) {
+		t.Fatalf("got %q, want %q", got, vin)
+	}
+}
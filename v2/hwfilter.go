@@ -0,0 +1,412 @@
+package gocan
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"math/bits"
+	"slices"
+	"time"
+)
+
+// HardwareFilter is implemented by adapters whose hardware (or driver) can
+// drop unwanted frames before they reach the host, and be reprogrammed while
+// open. The Bus programs it from the union of its subscriptions, so frames
+// nobody asked for never cross the USB or serial link; it still filters on
+// the host, so a hardware filter may pass more than it is asked to.
+type HardwareFilter interface {
+	// FilterCaps reports what the filter can express.
+	FilterCaps() FilterCaps
+	// SetAcceptanceFilters programs the filter to pass the frames matching
+	// any of entries, or every frame when entries is nil. Entries always
+	// fit FilterCaps. It is called concurrently with Send. An error wrapping
+	// errors.ErrUnsupported (e.g. old firmware) makes the Bus stop trying.
+	SetAcceptanceFilters(entries []AcceptanceFilter) error
+}
+
+// FilterCaps describes a hardware acceptance filter.
+type FilterCaps struct {
+	MaxEntries int  // entries the filter holds, 0 for no practical limit
+	Mask       bool // entries are ID/mask pairs; otherwise exact identifiers
+	// Extended is set when 29-bit identifiers can be filtered. Without it
+	// entries are 11-bit only, and what the filter does with 29-bit frames
+	// is up to the hardware.
+	Extended bool
+}
+
+// AcceptanceFilter is one hardware filter entry. A frame passes when it has
+// the entry's format and its identifier equals ID in the bits set in Mask.
+// ID has no bits outside Mask, and Mask none outside the 11 or 29 identifier
+// bits.
+type AcceptanceFilter struct {
+	ID, Mask uint32
+	Extended bool
+}
+
+func (a AcceptanceFilter) String() string {
+	if a.Extended {
+		return fmt.Sprintf("0x%08X/0x%08X ext", a.ID, a.Mask)
+	}
+	return fmt.Sprintf("0x%03X/0x%03X", a.ID, a.Mask)
+}
+
+// covers reports whether every frame e passes also passes a.
+func (a AcceptanceFilter) covers(e AcceptanceFilter) bool {
+	return a.Extended == e.Extended && a.Mask&^e.Mask == 0 && e.ID&a.Mask == a.ID
+}
+
+const (
+	standardMask = 0x7FF
+	extendedMask = 0x1FFFFFFF
+)
+
+func idMask(extended bool) uint32 {
+	if extended {
+		return extendedMask
+	}
+	return standardMask
+}
+
+// maxFilterExpansion bounds how many exact identifiers a mask or range is
+// expanded into for list-only filters without an entry limit.
+const maxFilterExpansion = 256
+
+// filterTightenDelay is how long the Bus waits after subscriptions go away
+// before narrowing the hardware filter, so back-to-back requests for the
+// same replies don't reprogram it every time.
+const filterTightenDelay = 2 * time.Second
+
+// WithHostFiltering leaves an adapter's hardware filter alone, filtering on
+// the host only. Open implies it when Config.CANFilter is set.
+func WithHostFiltering() Option {
+	return func(b *Bus) { b.hw = nil }
+}
+
+// acceptanceEntries returns the hardware filter entries passing the frames
+// of id/mask in the given format, or ok false when caps cannot express
+// them. Predicates are left to the host.
+func acceptanceEntries(id, mask uint32, format idFormat, caps FilterCaps) (entries []AcceptanceFilter, ok bool) {
+	id &= mask
+	std := format != extendedID && id&^standardMask == 0
+	ext := format != standardID
+	if std {
+		entries = append(entries, AcceptanceFilter{ID: id, Mask: mask & standardMask})
+	}
+	if ext {
+		switch {
+		case caps.Extended:
+			entries = append(entries, AcceptanceFilter{ID: id & extendedMask, Mask: mask & extendedMask, Extended: true})
+		case format == extendedID || !std:
+			return nil, false // only 29-bit frames are wanted
+		}
+	}
+	return entries, true
+}
+
+// entries returns the hardware filter entries covering filter f.
+func (f Filter) entries(caps FilterCaps) ([]AcceptanceFilter, bool) {
+	if f.masked {
+		return acceptanceEntries(f.id, f.mask, f.format, caps)
+	}
+	if f.id > f.last {
+		return nil, true
+	}
+	// The smallest mask block holding the range.
+	mask := ^uint32(0) << bits.Len32(f.id^f.last)
+	if !caps.Mask && f.last-f.id < maxFilterExpansion {
+		var out []AcceptanceFilter
+		for id := f.id; ; id++ {
+			e, ok := acceptanceEntries(id, ^uint32(0), f.format, caps)
+			if !ok {
+				return nil, false
+			}
+			out = append(out, e...)
+			if id == f.last {
+				return out, true
+			}
+		}
+	}
+	return acceptanceEntries(f.id, mask, f.format, caps)
+}
+
+// entries returns the hardware filter entries covering the subscription, or
+// ok false when it needs every frame.
+func (s *sub) entries(caps FilterCaps) (out []AcceptanceFilter, ok bool) {
+	if s.ids == nil && s.filters == nil {
+		return nil, false
+	}
+	for id := range s.ids {
+		e, ok := acceptanceEntries(id, ^uint32(0), anyID, caps)
+		if !ok {
+			return nil, false
+		}
+		out = append(out, e...)
+	}
+	for i := range s.filters {
+		e, ok := s.filters[i].entries(caps)
+		if !ok {
+			return nil, false
+		}
+		out = append(out, e...)
+	}
+	return out, true
+}
+
+// fitFilter reduces entries to what caps can hold, widening them where
+// needed, or returns ok false when only passing everything will do.
+func fitFilter(entries []AcceptanceFilter, caps FilterCaps) (out []AcceptanceFilter, ok bool) {
+	for _, e := range entries {
+		e.Mask &= idMask(e.Extended)
+		e.ID &= e.Mask
+		if caps.Mask || e.Mask == idMask(e.Extended) {
+			out = append(out, e)
+			continue
+		}
+		// List-only filter: spell the mask out as identifiers.
+		free := idMask(e.Extended) &^ e.Mask
+		n := 1 << bits.OnesCount32(free)
+		limit := caps.MaxEntries
+		if limit == 0 {
+			limit = maxFilterExpansion
+		}
+		if n > limit {
+			return nil, false
+		}
+		for i := range n {
+			out = append(out, AcceptanceFilter{ID: e.ID | pdep(uint32(i), free), Mask: e.Mask | free, Extended: e.Extended})
+		}
+	}
+	out = pruneFilter(out)
+	for caps.MaxEntries > 0 && len(out) > caps.MaxEntries {
+		if !caps.Mask {
+			return nil, false
+		}
+		// Merge the pair that keeps the most identifier bits significant.
+		bi, bj, best := -1, -1, -1
+		for i := range out {
+			for j := i + 1; j < len(out); j++ {
+				if out[i].Extended != out[j].Extended {
+					continue
+				}
+				if n := bits.OnesCount32(mergeFilter(out[i], out[j]).Mask); n > best {
+					bi, bj, best = i, j, n
+				}
+			}
+		}
+		if bi < 0 {
+			return nil, false
+		}
+		out[bi] = mergeFilter(out[bi], out[bj])
+		out = pruneFilter(slices.Delete(out, bj, bj+1))
+	}
+	return out, true
+}
+
+func mergeFilter(a, b AcceptanceFilter) AcceptanceFilter {
+	mask := a.Mask & b.Mask &^ (a.ID ^ b.ID)
+	return AcceptanceFilter{ID: a.ID & mask, Mask: mask, Extended: a.Extended}
+}
+
+// pruneFilter sorts entries and drops those another one covers.
+func pruneFilter(entries []AcceptanceFilter) []AcceptanceFilter {
+	// Wider entries first, so they are kept over the ones they cover.
+	slices.SortFunc(entries, func(a, b AcceptanceFilter) int {
+		if a.Extended != b.Extended {
+			if a.Extended {
+				return 1
+			}
+			return -1
+		}
+		if c := cmp.Compare(bits.OnesCount32(a.Mask), bits.OnesCount32(b.Mask)); c != 0 {
+			return c
+		}
+		return cmp.Or(cmp.Compare(a.ID, b.ID), cmp.Compare(a.Mask, b.Mask))
+	})
+	var out []AcceptanceFilter
+	for _, e := range entries {
+		if !slices.ContainsFunc(out, func(k AcceptanceFilter) bool { return k.covers(e) }) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// pdep scatters the low bits of v into the set bits of mask.
+func pdep(v, mask uint32) uint32 {
+	var out uint32
+	for mask != 0 {
+		low := mask & -mask
+		if v&1 != 0 {
+			out |= low
+		}
+		v >>= 1
+		mask &^= low
+	}
+	return out
+}
+
+// hwFilterCovers reports whether the programmed entries pass every frame
+// of want; nil programmed entries pass everything.
+func hwFilterCovers(programmed, want []AcceptanceFilter) bool {
+	if programmed == nil {
+		return true
+	}
+	for _, e := range want {
+		if !slices.ContainsFunc(programmed, func(p AcceptanceFilter) bool { return p.covers(e) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// wantedFilter returns the entries passing every live subscription's
+// frames, or all true when some subscriber or receive tap takes all
+// traffic.
+func (b *Bus) wantedFilter(caps FilterCaps) (entries []AcceptanceFilter, all bool) {
+	b.tapMu.Lock()
+	taps := len(b.recvTaps)
+	b.tapMu.Unlock()
+	if taps > 0 {
+		return nil, true
+	}
+	b.subMu.Lock()
+	defer b.subMu.Unlock()
+	if len(b.globalSubs) > 0 {
+		return nil, true
+	}
+	for id := range b.submap {
+		e, ok := acceptanceEntries(id, ^uint32(0), anyID, caps)
+		if !ok {
+			return nil, true
+		}
+		entries = append(entries, e...)
+	}
+	for _, s := range b.filterSubs {
+		e, ok := s.entries(caps)
+		if !ok {
+			return nil, true
+		}
+		entries = append(entries, e...)
+	}
+	return entries, false
+}
+
+// widenFilter makes sure the hardware filter passes s's frames (every
+// frame when s is nil, for a receive tap), reprogramming it at once if
+// not, and schedules narrowing it back to what is still wanted.
+func (b *Bus) widenFilter(s *sub) {
+	if b.hw == nil {
+		return
+	}
+	b.filterError(b.widen(s))
+	b.scheduleTighten()
+}
+
+func (b *Bus) widen(s *sub) error {
+	caps := b.hw.FilterCaps()
+	var want []AcceptanceFilter
+	all := s == nil
+	if !all {
+		var ok bool
+		if want, ok = s.entries(caps); ok {
+			want, ok = fitFilter(want, caps)
+		}
+		all = !ok
+	}
+	b.hwMu.Lock()
+	defer b.hwMu.Unlock()
+	if b.hwKnown && (b.hwEntries == nil || !all && hwFilterCovers(b.hwEntries, want)) {
+		return nil
+	}
+	if all {
+		return b.programFilter(nil)
+	}
+	// Keep what is programmed: the tightening pass drops it if it is no
+	// longer wanted.
+	live, liveAll := b.wantedFilter(caps)
+	entries, ok := fitFilter(slices.Concat(live, b.hwEntries, want), caps)
+	if liveAll || !ok {
+		entries = nil
+	}
+	return b.programFilter(entries)
+}
+
+func (b *Bus) scheduleTighten() {
+	if b.hw == nil || b.alive() != nil {
+		return
+	}
+	b.hwMu.Lock()
+	defer b.hwMu.Unlock()
+	if b.hwTimer == nil {
+		b.hwTimer = time.AfterFunc(filterTightenDelay, b.tightenFilter)
+	} else {
+		b.hwTimer.Reset(filterTightenDelay)
+	}
+}
+
+// tightenFilter narrows the hardware filter to the live subscriptions.
+// With none left it is kept as it is, ready for the next request.
+func (b *Bus) tightenFilter() {
+	if b.alive() == nil {
+		b.filterError(b.tighten())
+	}
+}
+
+func (b *Bus) tighten() error {
+	caps := b.hw.FilterCaps()
+	b.hwMu.Lock()
+	defer b.hwMu.Unlock()
+	live, all := b.wantedFilter(caps)
+	if !all && len(live) == 0 {
+		return nil
+	}
+	entries, ok := fitFilter(live, caps)
+	if all || !ok {
+		entries = nil
+	}
+	if b.hwKnown && slices.Equal(entries, b.hwEntries) && (entries == nil) == (b.hwEntries == nil) {
+		return nil
+	}
+	return b.programFilter(entries)
+}
+
+// programFilter hands entries to the adapter. Call with hwMu held.
+func (b *Bus) programFilter(entries []AcceptanceFilter) error {
+	if b.hwUnsupported {
+		return nil
+	}
+	if err := b.hw.SetAcceptanceFilters(entries); err != nil {
+		if errors.Is(err, errors.ErrUnsupported) {
+			// Nothing was filtered to begin with.
+			b.hwUnsupported = true
+			b.hwEntries, b.hwKnown = nil, true
+			return nil
+		}
+		// Whatever the hardware passes now, the next subscription retries.
+		b.hwKnown = false
+		return err
+	}
+	b.hwEntries, b.hwKnown = entries, true
+	return nil
+}
+
+// filterError reports a failure to program the hardware filter. It is
+// emitted outside hwMu so a sink may subscribe.
+func (b *Bus) filterError(err error) {
+	if err != nil {
+		b.Emit(Event{Type: EventTypeError, Details: fmt.Sprintf("failed to set hardware filter: %v", err), Err: err})
+	}
+}
+
+// AcceptanceFilters returns the entries last programmed into the adapter's
+// hardware filter, with ok false when the bus is not managing one (the
+// adapter has none, WithHostFiltering was given, or nothing has been
+// programmed yet). Nil entries pass every frame.
+func (b *Bus) AcceptanceFilters() (entries []AcceptanceFilter, ok bool) {
+	if b.hw == nil {
+		return nil, false
+	}
+	b.hwMu.Lock()
+	defer b.hwMu.Unlock()
+	return slices.Clone(b.hwEntries), b.hwKnown && !b.hwUnsupported
+}
@@ -0,0 +1,171 @@
+package gocan
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// filtering is a loopback with an emulated hardware filter.
+type filtering struct {
+	Loopback
+	caps FilterCaps
+	err  error
+
+	mu       sync.Mutex
+	entries  []AcceptanceFilter
+	programs int
+}
+
+func (f *filtering) FilterCaps() FilterCaps { return f.caps }
+
+func (f *filtering) SetAcceptanceFilters(entries []AcceptanceFilter) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.entries = entries
+	f.programs++
+	return nil
+}
+
+func (f *filtering) Send(_ context.Context, fr Frame) error {
+	f.mu.Lock()
+	pass := f.entries == nil || slices.ContainsFunc(f.entries, func(e AcceptanceFilter) bool {
+		return e.Extended == fr.Extended && fr.ID&e.Mask == e.ID
+	})
+	f.mu.Unlock()
+	if pass {
+		f.bus.Deliver(fr)
+	}
+	return nil
+}
+
+func (f *filtering) state() ([]AcceptanceFilter, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.entries, f.programs
+}
+
+func TestHardwareFilter(t *testing.T) {
+	hw := &filtering{caps: FilterCaps{MaxEntries: 1, Mask: true}}
+	bus, err := OpenAdapter(context.Background(), hw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bus.Close()
+	if _, ok := bus.AcceptanceFilters(); ok {
+		t.Fatal("filter programmed before any subscription")
+	}
+
+	ctx := context.Background()
+	bus.Subscribe(ctx, 0x7E8)
+	if got, _ := hw.state(); !slices.Equal(got, []AcceptanceFilter{{ID: 0x7E8, Mask: 0x7FF}}) {
+		t.Fatalf("want 0x7E8 only, got %v", got)
+	}
+	// One entry: the range and 0x7E8 merge into the block holding both.
+	bus.SubscribeFilter(ctx, MatchRange(0x7E0, 0x7E7))
+	want := []AcceptanceFilter{{ID: 0x7E0, Mask: 0x7F0}}
+	if got, _ := hw.state(); !slices.Equal(got, want) {
+		t.Fatalf("want %v, got %v", want, got)
+	}
+	_, programs := hw.state()
+	if _, err := bus.Request(ctx, NewFrame(0x7E9, nil), 0x7E9); err != nil {
+		t.Fatal(err)
+	}
+	if _, n := hw.state(); n != programs {
+		t.Fatal("filter reprogrammed for a reply it already passes")
+	}
+
+	// Taps see everything.
+	stop := bus.OnReceive(func(Frame) {})
+	if got, _ := hw.state(); got != nil {
+		t.Fatalf("want pass-all for a receive tap, got %v", got)
+	}
+	stop()
+	if err := bus.tighten(); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := bus.AcceptanceFilters(); !slices.Equal(got, want) {
+		t.Fatalf("want %v after the tap went, got %v", want, got)
+	}
+
+	// Frames outside the filter never reach the host.
+	rx := bus.Stats().RxFrames
+	bus.Send(ctx, NewFrame(0x100, nil))
+	if bus.Stats().RxFrames != rx {
+		t.Fatal("frame passed the hardware filter")
+	}
+	bus.Subscribe(ctx, 0x100)
+	if got, _ := hw.state(); !slices.Equal(got, []AcceptanceFilter{{ID: 0x100, Mask: 0x110}}) {
+		t.Fatalf("want 0x100 and 0x7E0-0x7EF merged, got %v", got)
+	}
+}
+
+func TestHardwareFilterUnsupported(t *testing.T) {
+	hw := &filtering{caps: FilterCaps{MaxEntries: 1, Mask: true}, err: errors.ErrUnsupported}
+	var events []Event
+	bus, err := OpenAdapter(context.Background(), hw, WithEventFunc(func(e Event) { events = append(events, e) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bus.Close()
+	if _, err := bus.Request(context.Background(), NewFrame(0x7E8, nil), 0x7E8); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := bus.AcceptanceFilters(); ok || len(events) != 0 {
+		t.Fatalf("unsupported filter should be left alone quietly, got %v", events)
+	}
+}
+
+func TestWithHostFiltering(t *testing.T) {
+	hw := &filtering{caps: FilterCaps{MaxEntries: 1, Mask: true}}
+	bus, err := OpenAdapter(context.Background(), hw, WithHostFiltering())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bus.Close()
+	bus.Subscribe(context.Background(), 0x7E8)
+	if _, n := hw.state(); n != 0 {
+		t.Fatal("hardware filter programmed with host filtering")
+	}
+}
+
+func TestFitFilter(t *testing.T) {
+	block := AcceptanceFilter{ID: 0x7E8, Mask: 0x7F8}
+
+	// List-only hardware gets the block spelled out.
+	got, ok := fitFilter([]AcceptanceFilter{block}, FilterCaps{MaxEntries: 8})
+	if !ok || len(got) != 8 || got[0] != (AcceptanceFilter{ID: 0x7E8, Mask: 0x7FF}) || got[7].ID != 0x7EF {
+		t.Fatalf("expanded block: %v %v", got, ok)
+	}
+	if _, ok := fitFilter([]AcceptanceFilter{block}, FilterCaps{MaxEntries: 4}); ok {
+		t.Fatal("block of 8 fit into 4 exact entries")
+	}
+
+	// Covered entries are dropped; formats never merge.
+	got, ok = fitFilter([]AcceptanceFilter{
+		{ID: 0x7E9, Mask: 0x7FF}, block,
+		{ID: 0x7E8, Mask: 0x1FFFFFFF, Extended: true},
+	}, FilterCaps{MaxEntries: 2, Mask: true, Extended: true})
+	if !ok || len(got) != 2 || got[0] != block || !got[1].Extended {
+		t.Fatalf("pruned: %v %v", got, ok)
+	}
+	if _, ok := fitFilter(got, FilterCaps{MaxEntries: 1, Mask: true, Extended: true}); ok {
+		t.Fatal("11- and 29-bit entries merged")
+	}
+
+	// 29-bit frames can't be asked of an 11-bit filter.
+	if _, ok := MatchID(0x18DAF110).entries(FilterCaps{Mask: true}); ok {
+		t.Fatal("29-bit identifier on an 11-bit filter")
+	}
+	if e, ok := MatchID(0x7E8).entries(FilterCaps{Mask: true}); !ok || len(e) != 1 || e[0].Extended {
+		t.Fatalf("low identifier on an 11-bit filter: %v %v", e, ok)
+	}
+	if e, _ := MatchID(0x7E8).entries(FilterCaps{Mask: true, Extended: true}); len(e) != 2 {
+		t.Fatalf("want both formats, got %v", e)
+	}
+}
@@ -0,0 +1,40 @@
+// Package ecutest holds the loopback bus and ISO-TP ECU fixtures shared by
+// the diagnostic protocol tests.
+package ecutest
+
+import (
+	"testing"
+
+	gocan "github.com/roffe/gocan/v2"
+	"github.com/roffe/gocan/v2/isotp"
+)
+
+// Loopback opens a loopback bus that is closed when the test ends.
+func Loopback(t testing.TB) *gocan.Bus {
+	t.Helper()
+	bus, err := gocan.Open(t.Context(), "loopback", gocan.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { bus.Close() })
+	return bus
+}
+
+// Serve runs an ISO-TP node that receives requests on rx and sends every
+// reply handle returns on tx, until the test ends.
+func Serve(t testing.TB, bus *gocan.Bus, tx, rx uint32, handle func(req []byte) [][]byte, opts ...isotp.Option) {
+	t.Helper()
+	ecu := isotp.New(bus, tx, rx, opts...)
+	ch := bus.Subscribe(t.Context(), rx)
+	go func() {
+		for {
+			req, err := ecu.RecvFrom(t.Context(), ch)
+			if err != nil {
+				return
+			}
+			for _, resp := range handle(req) {
+				ecu.Send(t.Context(), resp)
+			}
+		}
+	}()
+}
@@ -0,0 +1,514 @@
+// Package isotp implements the ISO 15765-2 transport protocol (ISO-TP) on a
+// gocan v2 bus: segmentation of arbitrary-length PDUs into single, first and
+// consecutive frames, with flow control (block size, STmin, wait frames),
+// padding and normal, extended or mixed addressing on 11- or 29-bit
+// identifiers.
+//
+// A Conn is one logical link between a tester and a node:
+//
+//	tp := isotp.New(bus, 0x7E0, 0x7E8, isotp.WithPadding(0xAA))
+//	resp, err := tp.Request(ctx, []byte{0x22, 0xF1, 0x90})
+//
+// Diagnostic protocols (uds, kwp, ...) build on it instead of hand-rolling
+// multi-frame handling.
+package isotp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	gocan "github.com/roffe/gocan/v2"
+)
+
+// Protocol control information, the high nibble of the first PCI byte.
+const (
+	pciSingle      = 0x00
+	pciFirst       = 0x10
+	pciConsecutive = 0x20
+	pciFlowControl = 0x30
+)
+
+// Flow status values carried in a flow control frame.
+const (
+	FlowContinue = 0x00 // ContinueToSend
+	FlowWait     = 0x01 // Wait
+	FlowOverflow = 0x02 // Overflow / abort
+)
+
+var (
+	// ErrOverflow is returned by Send when the receiver answers the first
+	// frame with an overflow flow control: the PDU is larger than it can
+	// buffer.
+	ErrOverflow = errors.New("isotp: receiver overflow")
+	// ErrWaitLimit is returned by Send when the receiver sends more
+	// consecutive FC.WAIT frames than allowed (see WithMaxWait).
+	ErrWaitLimit = errors.New("isotp: too many flow control wait frames")
+	// ErrSequence is returned by Recv when a consecutive frame arrives out of
+	// order.
+	ErrSequence = errors.New("isotp: consecutive frame out of sequence")
+	// ErrTooLarge is returned by Send for a PDU longer than ISO-TP can carry
+	// and by Recv when the announced length exceeds the receive limit.
+	ErrTooLarge = errors.New("isotp: message too large")
+)
+
+// Option configures a Conn.
+type Option func(*Conn)
+
+// Conn is an ISO-TP link: PDUs sent go out on txID, PDUs are received on
+// rxID. A Conn holds no receive state between calls, so it is safe to use
+// from several goroutines as long as only one exchange runs at a time.
+type Conn struct {
+	bus   *gocan.Bus
+	txID  uint32
+	rxID  uint32
+	rxIDs []uint32 // rxID and any WithAlternateRxIDs
+
+	extendedID bool
+	txAddr     int // extended/mixed addressing prefix sent, -1 for none
+	rxAddr     int // extended/mixed addressing prefix expected, -1 for none
+
+	padding    bool
+	padByte    byte
+	blockSize  byte
+	stMin      byte
+	timeout    time.Duration
+	maxWait    int
+	maxRecvLen int
+}
+
+// New creates a Conn sending on txID and receiving on rxID, using normal
+// addressing, 11-bit identifiers, no padding, BS=0, STmin=0 and a 1 s
+// N_Bs/N_Cr timeout unless overridden by opts.
+func New(bus *gocan.Bus, txID, rxID uint32, opts ...Option) *Conn {
+	c := &Conn{
+		bus:        bus,
+		txID:       txID,
+		rxID:       rxID,
+		rxIDs:      []uint32{rxID},
+		txAddr:     -1,
+		rxAddr:     -1,
+		timeout:    time.Second,
+		maxWait:    10,
+		maxRecvLen: maxFirstFrameLength,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WithExtendedID sends 29-bit frames (normal fixed addressing, e.g.
+// 0x18DA10F1 / 0x18DAF110).
+func WithExtendedID() Option {
+	return func(c *Conn) { c.extendedID = true }
+}
+
+// WithExtendedAddressing prefixes every frame sent with the target address
+// txAddr and only accepts frames whose first byte is rxAddr (ISO 15765-2
+// extended addressing, as used by BMW and on gateways).
+func WithExtendedAddressing(txAddr, rxAddr byte) Option {
+	return func(c *Conn) {
+		c.txAddr = int(txAddr)
+		c.rxAddr = int(rxAddr)
+	}
+}
+
+// WithMixedAddressing prefixes every frame with the address extension ae in
+// both directions (ISO 15765-2 mixed addressing).
+func WithMixedAddressing(ae byte) Option {
+	return WithExtendedAddressing(ae, ae)
+}
+
+// WithPadding pads every frame sent to 8 bytes with b. Many ECUs ignore
+// frames with a short DLC; 0x00, 0x55 and 0xAA are common fillers.
+func WithPadding(b byte) Option {
+	return func(c *Conn) {
+		c.padding = true
+		c.padByte = b
+	}
+}
+
+// WithBlockSize sets the block size advertised in flow control frames sent
+// while receiving: the number of consecutive frames the sender may send
+// before waiting for the next flow control. 0 means no limit.
+func WithBlockSize(bs byte) Option {
+	return func(c *Conn) { c.blockSize = bs }
+}
+
+// WithSTmin sets the minimum separation time between consecutive frames
+// advertised while receiving. It is rounded to the nearest encodable value:
+// 100–900 µs in 100 µs steps, or 1–127 ms.
+func WithSTmin(d time.Duration) Option {
+	return func(c *Conn) { c.stMin = encodeSTmin(d) }
+}
+
+// WithTimeout sets how long to wait for each flow control frame while
+// sending (N_Bs) and each consecutive frame while receiving (N_Cr).
+func WithTimeout(d time.Duration) Option {
+	return func(c *Conn) { c.timeout = d }
+}
+
+// WithAlternateRxIDs also accepts frames on ids, for nodes answering on
+// more than one identifier. The frames of one message are expected on a
+// single identifier; Conn does not check that they are.
+func WithAlternateRxIDs(ids ...uint32) Option {
+	return func(c *Conn) { c.rxIDs = append(c.rxIDs, ids...) }
+}
+
+// WithMaxWait sets how many consecutive FC.WAIT frames Send tolerates
+// before giving up (N_WFTmax). The default is 10.
+func WithMaxWait(n int) Option {
+	return func(c *Conn) { c.maxWait = n }
+}
+
+// WithMaxReceiveLength caps the message length Recv accepts; longer first
+// frames are answered with an overflow flow control. The default is 4095,
+// the longest length a classic first frame can announce without the escape
+// sequence.
+func WithMaxReceiveLength(n int) Option {
+	return func(c *Conn) { c.maxRecvLen = n }
+}
+
+const (
+	maxFirstFrameLength = 0xFFF
+	maxEscapedLength    = 0xFFFFFFFF
+)
+
+// Bus returns the bus the Conn runs on.
+func (c *Conn) Bus() *gocan.Bus { return c.bus }
+
+// TxID returns the identifier PDUs are sent on.
+func (c *Conn) TxID() uint32 { return c.txID }
+
+// RxID returns the identifier PDUs are received on.
+func (c *Conn) RxID() uint32 { return c.rxID }
+
+// Request sends pdu and returns the next PDU received. The receive
+// subscription is set up before sending, so a fast reply is never missed.
+func (c *Conn) Request(ctx context.Context, pdu []byte) ([]byte, error) {
+	sctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ch := c.bus.Subscribe(sctx, c.rxIDs...)
+	if err := c.send(ctx, pdu, 1); err != nil {
+		return nil, err
+	}
+	return c.recv(ctx, ch)
+}
+
+// Send transmits pdu, segmenting it and honouring the receiver's flow
+// control when it does not fit a single frame.
+func (c *Conn) Send(ctx context.Context, pdu []byte) error {
+	return c.send(ctx, pdu, 0)
+}
+
+// Recv waits for the next PDU on rxID, sending flow control as needed. Bound
+// the wait for the first frame with a context deadline.
+func (c *Conn) Recv(ctx context.Context) ([]byte, error) {
+	sctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	return c.recv(ctx, c.bus.Subscribe(sctx, c.rxIDs...))
+}
+
+// RecvFrom is Recv on a subscription the caller already holds, for
+// protocols that need to listen before triggering the transfer. ch must
+// deliver frames on rxID (and any alternate receive identifiers).
+func (c *Conn) RecvFrom(ctx context.Context, ch <-chan gocan.Frame) ([]byte, error) {
+	return c.recv(ctx, ch)
+}
+
+// prefixLen is the number of bytes the addressing mode takes from each frame.
+func (c *Conn) prefixLen() int {
+	if c.txAddr >= 0 {
+		return 1
+	}
+	return 0
+}
+
+// frame builds a frame on txID carrying the addressing prefix and data,
+// padded when configured.
+func (c *Conn) frame(data ...byte) gocan.Frame {
+	var buf [8]byte
+	n := 0
+	if c.txAddr >= 0 {
+		buf[0] = byte(c.txAddr)
+		n = 1
+	}
+	n += copy(buf[n:], data)
+	if c.padding {
+		for i := n; i < len(buf); i++ {
+			buf[i] = c.padByte
+		}
+		n = len(buf)
+	}
+	if c.extendedID {
+		return gocan.NewExtendedFrame(c.txID, buf[:n])
+	}
+	return gocan.NewFrame(c.txID, buf[:n])
+}
+
+// payload strips the addressing prefix from a received frame, reporting
+// false for frames addressed to someone else.
+func (c *Conn) payload(f gocan.Frame) ([]byte, bool) {
+	d := f.Bytes()
+	if c.rxAddr < 0 {
+		return d, len(d) > 0
+	}
+	if len(d) < 2 || d[0] != byte(c.rxAddr) {
+		return nil, false
+	}
+	return d[1:], true
+}
+
+// send transmits pdu. hint is the expected-responses hint stamped on the
+// final frame for buffered adapters (1 when a reply PDU is expected).
+func (c *Conn) send(ctx context.Context, pdu []byte, hint int) error {
+	if len(pdu) == 0 {
+		return errors.New("isotp: empty message")
+	}
+	if uint64(len(pdu)) > maxEscapedLength {
+		return ErrTooLarge
+	}
+	lastCtx := ctx
+	if hint > 0 {
+		lastCtx = gocan.WithExpectedResponses(ctx, hint)
+	}
+
+	sfMax := 7 - c.prefixLen()
+	if len(pdu) <= sfMax {
+		return c.bus.Send(lastCtx, c.frame(append([]byte{pciSingle | byte(len(pdu))}, pdu...)...))
+	}
+
+	// Listen for flow control before the first frame goes out.
+	sctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	fcCh := c.bus.Subscribe(sctx, c.rxIDs...)
+
+	var ff []byte
+	if len(pdu) <= maxFirstFrameLength {
+		ff = []byte{pciFirst | byte(len(pdu)>>8), byte(len(pdu))}
+	} else {
+		n := uint32(len(pdu))
+		ff = []byte{pciFirst, 0x00, byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)}
+	}
+	off := min(8-c.prefixLen()-len(ff), len(pdu))
+	ff = append(ff, pdu[:off]...)
+	if err := c.bus.Send(gocan.WithExpectedResponses(ctx, 1), c.frame(ff...)); err != nil {
+		return fmt.Errorf("isotp: first frame: %w", err)
+	}
+
+	cfMax := 7 - c.prefixLen()
+	seq := byte(1)
+	for off < len(pdu) {
+		bs, stMin, err := c.waitFlowControl(ctx, fcCh)
+		if err != nil {
+			return err
+		}
+		for sent := 0; off < len(pdu) && (bs == 0 || sent < int(bs)); sent++ {
+			if sent > 0 {
+				if err := sleepCtx(ctx, stMin); err != nil {
+					return err
+				}
+			}
+			n := min(cfMax, len(pdu)-off)
+			fctx := ctx
+			switch {
+			case off+n == len(pdu):
+				fctx = lastCtx
+			case bs != 0 && sent == int(bs)-1:
+				fctx = gocan.WithExpectedResponses(ctx, 1) // next flow control
+			}
+			if err := c.bus.Send(fctx, c.frame(append([]byte{pciConsecutive | seq&0x0F}, pdu[off:off+n]...)...)); err != nil {
+				return fmt.Errorf("isotp: consecutive frame: %w", err)
+			}
+			off += n
+			seq++
+		}
+	}
+	return nil
+}
+
+// waitFlowControl waits for a CTS flow control, tolerating up to maxWait
+// FC.WAIT frames, and returns the receiver's block size and STmin. The
+// N_Bs deadline is set when the wait starts and only an FC.WAIT extends
+// it, so other frames on rxID cannot keep the sender waiting.
+func (c *Conn) waitFlowControl(ctx context.Context, ch <-chan gocan.Frame) (byte, time.Duration, error) {
+	waits := 0
+	deadline := time.Now().Add(c.timeout)
+	for {
+		tctx, cancel := context.WithDeadline(ctx, deadline)
+		d, err := c.nextCtx(tctx, ch)
+		cancel()
+		if err != nil {
+			return 0, 0, fmt.Errorf("isotp: waiting for flow control: %w", err)
+		}
+		if len(d) < 3 || d[0]&0xF0 != pciFlowControl {
+			continue
+		}
+		switch d[0] & 0x0F {
+		case FlowContinue:
+			return d[1], decodeSTmin(d[2]), nil
+		case FlowWait:
+			waits++
+			if waits > c.maxWait {
+				return 0, 0, ErrWaitLimit
+			}
+			deadline = time.Now().Add(c.timeout)
+		case FlowOverflow:
+			return 0, 0, ErrOverflow
+		default:
+			return 0, 0, fmt.Errorf("isotp: invalid flow status 0x%02X", d[0]&0x0F)
+		}
+	}
+}
+
+// nextCtx returns the payload of the next frame on ch addressed to us.
+func (c *Conn) nextCtx(ctx context.Context, ch <-chan gocan.Frame) ([]byte, error) {
+	for {
+		select {
+		case f, ok := <-ch:
+			if !ok {
+				if cause := context.Cause(ctx); cause != nil && c.bus.Context().Err() == nil {
+					return nil, cause
+				}
+				return nil, gocan.ErrClosed
+			}
+			if d, ok := c.payload(f); ok {
+				return d, nil
+			}
+		case <-ctx.Done():
+			return nil, context.Cause(ctx)
+		}
+	}
+}
+
+func (c *Conn) recv(ctx context.Context, ch <-chan gocan.Frame) ([]byte, error) {
+	for {
+		d, err := c.nextCtx(ctx, ch)
+		if err != nil {
+			return nil, err
+		}
+		switch d[0] & 0xF0 {
+		case pciSingle:
+			n := int(d[0] & 0x0F)
+			if n == 0 || n > len(d)-1 {
+				continue // malformed (or CAN FD escape), not for us
+			}
+			return append([]byte(nil), d[1:1+n]...), nil
+		case pciFirst:
+			return c.recvMulti(ctx, ch, d)
+		}
+		// Stray consecutive or flow control frames belong to someone else's
+		// exchange; keep waiting for the start of a message.
+	}
+}
+
+func (c *Conn) recvMulti(ctx context.Context, ch <-chan gocan.Frame, ff []byte) ([]byte, error) {
+	if len(ff) < 2 {
+		return nil, errors.New("isotp: short first frame")
+	}
+	total := int(ff[0]&0x0F)<<8 | int(ff[1])
+	data := ff[2:]
+	if total == 0 {
+		if len(ff) < 6 {
+			return nil, errors.New("isotp: short escaped first frame")
+		}
+		total = int(uint32(ff[2])<<24 | uint32(ff[3])<<16 | uint32(ff[4])<<8 | uint32(ff[5]))
+		data = ff[6:]
+		if total <= maxFirstFrameLength {
+			return nil, fmt.Errorf("isotp: escaped first frame announcing %d bytes", total)
+		}
+	} else if total <= 7-c.prefixLen() {
+		// A PDU that fits a single frame must not be segmented.
+		return nil, fmt.Errorf("isotp: first frame announcing %d bytes", total)
+	}
+	if total > c.maxRecvLen {
+		c.bus.Send(ctx, c.frame(pciFlowControl|FlowOverflow, 0, 0))
+		return nil, fmt.Errorf("%w: %d bytes announced", ErrTooLarge, total)
+	}
+	buf := make([]byte, 0, total)
+	buf = append(buf, data[:min(len(data), total)]...)
+
+	cfMax := 7 - c.prefixLen()
+	seq := byte(1)
+	for len(buf) < total {
+		// Flow control: clear the sender for the next block.
+		frames := (total - len(buf) + cfMax - 1) / cfMax
+		if c.blockSize != 0 {
+			frames = min(frames, int(c.blockSize))
+		}
+		fcCtx := gocan.WithExpectedResponses(ctx, frames)
+		if err := c.bus.Send(fcCtx, c.frame(pciFlowControl|FlowContinue, c.blockSize, c.stMin)); err != nil {
+			return nil, fmt.Errorf("isotp: flow control: %w", err)
+		}
+		for i := 0; i < frames; i++ {
+			d, err := c.nextConsecutive(ctx, ch)
+			if err != nil {
+				return nil, fmt.Errorf("isotp: waiting for consecutive frame: %w", err)
+			}
+			if d[0]&0x0F != seq&0x0F {
+				return nil, fmt.Errorf("%w: expected %X got %X", ErrSequence, seq&0x0F, d[0]&0x0F)
+			}
+			buf = append(buf, d[1:min(len(d), 1+total-len(buf))]...)
+			seq++
+		}
+	}
+	return buf, nil
+}
+
+// nextConsecutive returns the next consecutive frame, skipping anything else
+// addressed to us. The N_Cr deadline is fixed when the wait starts, so a
+// stream of stray frames cannot extend it.
+func (c *Conn) nextConsecutive(ctx context.Context, ch <-chan gocan.Frame) ([]byte, error) {
+	tctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	for {
+		d, err := c.nextCtx(tctx, ch)
+		if err != nil {
+			return nil, err
+		}
+		if d[0]&0xF0 == pciConsecutive {
+			return d, nil
+		}
+	}
+}
+
+// decodeSTmin converts an STmin byte to a duration. Reserved values are
+// treated as the maximum, 127 ms, as ISO 15765-2 requires.
+func decodeSTmin(b byte) time.Duration {
+	switch {
+	case b <= 0x7F:
+		return time.Duration(b) * time.Millisecond
+	case b >= 0xF1 && b <= 0xF9:
+		return time.Duration(b-0xF0) * 100 * time.Microsecond
+	default:
+		return 127 * time.Millisecond
+	}
+}
+
+func encodeSTmin(d time.Duration) byte {
+	switch {
+	case d <= 0:
+		return 0
+	case d < time.Millisecond:
+		us := (d + 50*time.Microsecond) / (100 * time.Microsecond)
+		return 0xF0 + byte(max(1, min(9, us)))
+	default:
+		return byte(min(127, (d+time.Millisecond/2)/time.Millisecond))
+	}
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
@@ -0,0 +1,243 @@
+package isotp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	gocan "github.com/roffe/gocan/v2"
+)
+
+func openLoopback(t *testing.T) *gocan.Bus {
+	t.Helper()
+	bus, err := gocan.Open(t.Context(), "loopback", gocan.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { bus.Close() })
+	return bus
+}
+
+// echo runs an ECU side on the bus that answers every PDU with the same
+// PDU, until ctx is done.
+func echo(ctx context.Context, ecu *Conn) {
+	ch := ecu.Bus().Subscribe(ctx, ecu.RxID())
+	for {
+		pdu, err := ecu.RecvFrom(ctx, ch)
+		if err != nil {
+			return
+		}
+		ecu.Send(ctx, pdu)
+	}
+}
+
+func payload(n int) []byte {
+	out := make([]byte, n)
+	for i := range out {
+		out[i] = byte(i)
+	}
+	return out
+}
+
+// TestRoundTrip sends PDUs of every segmentation shape through a tester and
+// an echoing ECU sharing one loopback bus.
+func TestRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		opts    []Option
+		ecuOpts []Option // defaults to opts
+		length  int
+	}{
+		{"single", nil, nil, 7},
+		{"first+one", nil, nil, 8},
+		{"multi", nil, nil, 100},
+		{"wrap sequence", nil, nil, 300},
+		{"escaped length", []Option{WithMaxReceiveLength(5000), WithBlockSize(32)}, nil, 4200},
+		{"block size", []Option{WithBlockSize(3), WithSTmin(500 * time.Microsecond)}, nil, 64},
+		{"padding", []Option{WithPadding(0xAA)}, nil, 20},
+		{"extended addressing", []Option{WithExtendedAddressing(0x10, 0xF1)}, []Option{WithExtendedAddressing(0xF1, 0x10)}, 40},
+		{"mixed addressing", []Option{WithMixedAddressing(0x42)}, nil, 40},
+		{"29-bit", []Option{WithExtendedID()}, nil, 40},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			bus := openLoopback(t)
+			ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+			defer cancel()
+
+			ecuOpts := tc.ecuOpts
+			if ecuOpts == nil {
+				ecuOpts = tc.opts
+			}
+			tester := New(bus, 0x7E0, 0x7E8, tc.opts...)
+			ecu := New(bus, 0x7E8, 0x7E0, ecuOpts...)
+			go echo(ctx, ecu)
+			time.Sleep(10 * time.Millisecond) // let the ECU subscribe
+
+			want := payload(tc.length)
+			got, err := tester.Request(ctx, want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Fatalf("got % X, want % X", got, want)
+			}
+		})
+	}
+}
+
+func TestPadding(t *testing.T) {
+	bus := openLoopback(t)
+	all := bus.Subscribe(t.Context())
+	tp := New(bus, 0x7E0, 0x7E8, WithPadding(0x55))
+	if err := tp.Send(t.Context(), []byte{0x3E, 0x00}); err != nil {
+		t.Fatal(err)
+	}
+	f := <-all
+	if f.Length != 8 || f.Data != [gocan.MaxFDLength]byte{0x02, 0x3E, 0x00, 0x55, 0x55, 0x55, 0x55, 0x55} {
+		t.Fatalf("unexpected frame %s", f)
+	}
+}
+
+func TestOverflow(t *testing.T) {
+	bus := openLoopback(t)
+	ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+	defer cancel()
+
+	ecu := New(bus, 0x7E8, 0x7E0, WithMaxReceiveLength(16))
+	go ecu.Recv(ctx)
+	time.Sleep(10 * time.Millisecond)
+
+	err := New(bus, 0x7E0, 0x7E8).Send(ctx, payload(32))
+	if !errors.Is(err, ErrOverflow) {
+		t.Fatalf("want ErrOverflow, got %v", err)
+	}
+}
+
+func TestFlowControlWait(t *testing.T) {
+	bus := openLoopback(t)
+	ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+	defer cancel()
+
+	// A receiver that only ever answers FC.WAIT.
+	go func() {
+		for f := range bus.Frames(ctx, 0x7E0) {
+			if f.Data[0]&0xF0 == pciFirst {
+				for range 3 {
+					bus.Send(ctx, gocan.NewFrame(0x7E8, []byte{pciFlowControl | FlowWait, 0, 0}))
+				}
+			}
+		}
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	err := New(bus, 0x7E0, 0x7E8, WithMaxWait(2)).Send(ctx, payload(32))
+	if !errors.Is(err, ErrWaitLimit) {
+		t.Fatalf("want ErrWaitLimit, got %v", err)
+	}
+}
+
+// TestConsecutiveTimeout checks that stray frames between consecutive frames
+// do not push back the N_Cr deadline.
+func TestConsecutiveTimeout(t *testing.T) {
+	bus := openLoopback(t)
+	ctx, cancel := context.WithTimeout(t.Context(), 2*time.Second)
+	defer cancel()
+
+	ch := bus.Subscribe(ctx, 0x7E8)
+	// A sender that starts a message and then only ever sends flow control
+	// frames, which the receiver must skip while it waits.
+	go func() {
+		bus.Send(ctx, gocan.NewFrame(0x7E8, []byte{pciFirst, 20, 1, 2, 3, 4, 5, 6}))
+		tick := time.NewTicker(10 * time.Millisecond)
+		defer tick.Stop()
+		for {
+			select {
+			case <-tick.C:
+				bus.Send(ctx, gocan.NewFrame(0x7E8, []byte{pciFlowControl | FlowContinue, 0, 0}))
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	start := time.Now()
+	_, err := New(bus, 0x7E0, 0x7E8, WithTimeout(100*time.Millisecond)).RecvFrom(ctx, ch)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want deadline exceeded, got %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("N_Cr extended by stray frames: waited %v", d)
+	}
+}
+
+// TestFlowControlTimeout checks that frames other than flow control do not
+// push back the N_Bs deadline.
+func TestFlowControlTimeout(t *testing.T) {
+	bus := openLoopback(t)
+	ctx, cancel := context.WithTimeout(t.Context(), 2*time.Second)
+	defer cancel()
+
+	// A receiver that never clears the sender, only chatters on its ID.
+	go func() {
+		tick := time.NewTicker(10 * time.Millisecond)
+		defer tick.Stop()
+		for {
+			select {
+			case <-tick.C:
+				bus.Send(ctx, gocan.NewFrame(0x7E8, []byte{0x02, 0x7E, 0x00}))
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	start := time.Now()
+	err := New(bus, 0x7E0, 0x7E8, WithTimeout(100*time.Millisecond)).Send(ctx, payload(32))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want deadline exceeded, got %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("N_Bs extended by stray frames: waited %v", d)
+	}
+}
+
+func TestMalformedFirstFrame(t *testing.T) {
+	for _, ff := range [][]byte{
+		{pciFirst, 0x05, 1, 2, 3, 4, 5, 6},       // fits a single frame
+		{pciFirst, 0x00, 0, 0, 0x00, 0x00, 1, 2}, // escaped, zero length
+		{pciFirst, 0x00, 0, 0, 0x0F, 0xFF, 1, 2}, // escaped, fits the short form
+	} {
+		bus := openLoopback(t)
+		ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+		ch := bus.Subscribe(ctx, 0x7E8)
+		bus.Send(ctx, gocan.NewFrame(0x7E8, ff))
+		pdu, err := New(bus, 0x7E0, 0x7E8).RecvFrom(ctx, ch)
+		cancel()
+		if err == nil || errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("% X: want a malformed first frame error, got %v (% X)", ff, err, pdu)
+		}
+	}
+}
+
+func TestSTminCoding(t *testing.T) {
+	for _, tc := range []struct {
+		d time.Duration
+		b byte
+	}{
+		{0, 0x00},
+		{100 * time.Microsecond, 0xF1},
+		{900 * time.Microsecond, 0xF9},
+		{5 * time.Millisecond, 0x05},
+		{127 * time.Millisecond, 0x7F},
+		{time.Second, 0x7F},
+	} {
+		if got := encodeSTmin(tc.d); got != tc.b {
+			t.Errorf("encodeSTmin(%v) = %#02x, want %#02x", tc.d, got, tc.b)
+		}
+	}
+	if got := decodeSTmin(0xFA); got != 127*time.Millisecond {
+		t.Errorf("reserved STmin should decode as 127 ms, got %v", got)
+	}
+}
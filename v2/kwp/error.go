@@ -0,0 +1,163 @@
+package kwp
+
+import (
+	"errors"
+	"fmt"
+)
+
+// KWPError is a negative response (0x7F) from the ECU.
+type KWPError struct {
+	Service byte
+	Code    byte
+}
+
+func (e *KWPError) Error() string {
+	return fmt.Sprintf("%s - %s (0x%02X)", TranslateServiceCode(e.Service), TranslateErrorCode(e.Code), e.Code)
+}
+
+// IsCode reports whether err is a negative response carrying code.
+func IsCode(err error, code byte) bool {
+	var ke *KWPError
+	return errors.As(err, &ke) && ke.Code == code
+}
+
+// ErrInvalidResponse is returned when a positive response does not match the
+// request.
+var ErrInvalidResponse = errors.New("kwp: invalid response")
+
+// Negative response codes.
+const (
+	GeneralReject                         = 0x10
+	ServiceNotSupported                   = 0x11
+	SubFunctionNotSupported               = 0x12
+	BusyRepeatRequest                     = 0x21
+	ConditionsNotCorrect                  = 0x22
+	RoutineNotComplete                    = 0x23
+	RequestOutOfRange                     = 0x31
+	SecurityAccessDenied                  = 0x33
+	InvalidKey                            = 0x35
+	ExceedNumberOfAttempts                = 0x36
+	RequiredTimeDelayNotExpired           = 0x37
+	DownloadNotAccepted                   = 0x40
+	ImproperDownloadType                  = 0x41
+	CantDownloadToSpecifiedAddress        = 0x42
+	CantDownloadNumberOfBytesRequested    = 0x43
+	UploadNotAccepted                     = 0x50
+	ImproperUploadType                    = 0x51
+	CantUploadFromSpecifiedAddress        = 0x52
+	CantUploadNumberOfBytesRequested      = 0x53
+	TransferSuspended                     = 0x71
+	TransferAborted                       = 0x72
+	IllegalAddressInBlockTransfer         = 0x74
+	IllegalByteCountInBlockTransfer       = 0x75
+	IllegalBlockTransferType              = 0x76
+	BlockTransferDataChecksumError        = 0x77
+	ResponsePending                       = 0x78
+	IncorrectByteCountDuringBlockTransfer = 0x79
+	ServiceNotSupportedInActiveSession    = 0x80
+)
+
+func TranslateServiceCode(p byte) string {
+	switch p {
+	case START_DIAGNOSTIC_SESSION:
+		return "StartDiagnosticSession"
+	case ECU_RESET:
+		return "ECUReset"
+	case READ_ECU_IDENTIFICATION:
+		return "ReadECUIdentification"
+	case CLEAR_DIAGNOSTIC_INFORMATION:
+		return "ClearDiagnosticInformation"
+	case READ_DTC_BY_STATUS:
+		return "ReadDiagnosticTroubleCodesByStatus"
+	case READ_DATA_BY_LOCAL_IDENTIFIER:
+		return "ReadDataByLocalIdentifier"
+	case READ_MEMORY_BY_ADDRESS:
+		return "ReadMemoryByAddress"
+	case SECURITY_ACCESS:
+		return "SecurityAccess"
+	case START_ROUTINE_BY_LOCAL_IDENTIFIER:
+		return "StartRoutineByLocalIdentifier"
+	case REQUEST_DOWNLOAD:
+		return "RequestDownload"
+	case REQUEST_UPLOAD:
+		return "RequestUpload"
+	case TRANSFER_DATA:
+		return "TransferData"
+	case REQUEST_TRANSFER_EXIT:
+		return "RequestTransferExit"
+	case WRITE_DATA_BY_LOCAL_IDENTIFIER:
+		return "WriteDataByLocalIdentifier"
+	case WRITE_MEMORY_BY_ADDRESS:
+		return "WriteMemoryByAddress"
+	case TESTER_PRESENT:
+		return "TesterPresent"
+	case START_COMMUNICATION:
+		return "StartCommunication"
+	case STOP_COMMUNICATION:
+		return "StopCommunication"
+	default:
+		return "Unknown"
+	}
+}
+
+func TranslateErrorCode(p byte) string {
+	switch p {
+	case GeneralReject:
+		return "General reject"
+	case ServiceNotSupported:
+		return "Service not supported"
+	case SubFunctionNotSupported:
+		return "SubFunction not supported - invalid format"
+	case BusyRepeatRequest:
+		return "Busy, repeat request"
+	case ConditionsNotCorrect:
+		return "Conditions not correct or request sequence error"
+	case RoutineNotComplete:
+		return "Routine not complete"
+	case RequestOutOfRange:
+		return "Request out of range"
+	case SecurityAccessDenied:
+		return "Security access denied"
+	case InvalidKey:
+		return "Invalid key"
+	case ExceedNumberOfAttempts:
+		return "Exceeded number of attempts"
+	case RequiredTimeDelayNotExpired:
+		return "Required time delay not expired"
+	case DownloadNotAccepted:
+		return "Download not accepted"
+	case ImproperDownloadType:
+		return "Improper download type"
+	case CantDownloadToSpecifiedAddress:
+		return "Can't download to specified address"
+	case CantDownloadNumberOfBytesRequested:
+		return "Can't download number of bytes requested"
+	case UploadNotAccepted:
+		return "Upload not accepted"
+	case ImproperUploadType:
+		return "Improper upload type"
+	case CantUploadFromSpecifiedAddress:
+		return "Can't upload from specified address"
+	case CantUploadNumberOfBytesRequested:
+		return "Can't upload number of bytes requested"
+	case TransferSuspended:
+		return "Transfer suspended"
+	case TransferAborted:
+		return "Transfer aborted"
+	case IllegalAddressInBlockTransfer:
+		return "Illegal address in block transfer"
+	case IllegalByteCountInBlockTransfer:
+		return "Illegal byte count in block transfer"
+	case IllegalBlockTransferType:
+		return "Illegal block transfer type"
+	case BlockTransferDataChecksumError:
+		return "Block transfer data checksum error"
+	case ResponsePending:
+		return "Response pending"
+	case IncorrectByteCountDuringBlockTransfer:
+		return "Incorrect byte count during block transfer"
+	case ServiceNotSupportedInActiveSession:
+		return "Service not supported in active diagnostic session"
+	}
+	return "Unknown error"
+}
@@ -0,0 +1,424 @@
+// Package kwp implements the KWP2000 (ISO 14230-3) diagnostic services over
+// CAN on a gocan v2 bus, as spoken by Saab Trionic 7-era ECUs.
+//
+// By default requests use the Trionic 7 framing: sessions are opened on
+// 0x220 (answered on 0x238), requests go out on 0x240 in rows of
+// [row, 0xA1, ...], responses arrive on 0x258 and every response row is
+// acknowledged on 0x266. WithTransport switches to plain ISO-TP for ECUs
+// that carry KWP2000 the ISO 15765 way.
+package kwp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	gocan "github.com/roffe/gocan/v2"
+	"github.com/roffe/gocan/v2/isotp"
+)
+
+const (
+	START_DIAGNOSTIC_SESSION          = 0x10
+	ECU_RESET                         = 0x11
+	READ_ECU_IDENTIFICATION           = 0x1A
+	CLEAR_DIAGNOSTIC_INFORMATION      = 0x14
+	READ_DTC_BY_STATUS                = 0x18
+	READ_DATA_BY_LOCAL_IDENTIFIER     = 0x21
+	READ_MEMORY_BY_ADDRESS            = 0x23
+	SECURITY_ACCESS                   = 0x27
+	START_ROUTINE_BY_LOCAL_IDENTIFIER = 0x31
+	REQUEST_DOWNLOAD                  = 0x34
+	REQUEST_UPLOAD                    = 0x35
+	TRANSFER_DATA                     = 0x36
+	REQUEST_TRANSFER_EXIT             = 0x37
+	WRITE_DATA_BY_LOCAL_IDENTIFIER    = 0x3B
+	WRITE_MEMORY_BY_ADDRESS           = 0x3D
+	TESTER_PRESENT                    = 0x3E
+	START_COMMUNICATION               = 0x81
+	STOP_COMMUNICATION                = 0x82
+)
+
+// Diagnostic modes for StartDiagnosticSession.
+const (
+	SessionDefault     = 0x81
+	SessionProgramming = 0x85
+	SessionDevelopment = 0x86
+)
+
+// Reset modes for ECUReset.
+const (
+	ResetPowerOn = 0x01
+)
+
+// Trionic 7 identifiers.
+const (
+	T7SessionRequestID  = 0x220
+	T7SessionResponseID = 0x238
+	T7RequestID         = 0x240
+	T7ResponseID        = 0x258
+	T7AckID             = 0x266
+)
+
+const (
+	t7TesterAddr = 0xA1 // second byte of tester rows and acks
+	t7ECUAddr    = 0xBF // second byte of ECU rows
+	rowFirst     = 0x40 // row byte flag: first row of a message
+	rowCount     = 0x3F // row byte mask: rows still to come
+)
+
+type KWPOption func(*Client)
+
+type Client struct {
+	c              *gocan.Bus
+	tp             *isotp.Conn // nil for Trionic 7 framing
+	defaultTimeout time.Duration
+	pendingTimeout time.Duration
+	requestID      uint32
+	responseID     uint32
+	ackID          uint32
+}
+
+// New creates a client using the Trionic 7 identifiers and framing.
+func New(c *gocan.Bus, opts ...KWPOption) *Client {
+	cl := &Client{
+		c:              c,
+		defaultTimeout: 250 * time.Millisecond,
+		pendingTimeout: 5 * time.Second,
+		requestID:      T7RequestID,
+		responseID:     T7ResponseID,
+		ackID:          T7AckID,
+	}
+	for _, opt := range opts {
+		opt(cl)
+	}
+	return cl
+}
+
+func WithDefaultTimeout(timeout time.Duration) KWPOption {
+	return func(cl *Client) {
+		cl.defaultTimeout = timeout
+	}
+}
+
+// WithPendingTimeout sets how long to wait for the final response after a
+// responsePending ($78) reply. The default is 5 s.
+func WithPendingTimeout(timeout time.Duration) KWPOption {
+	return func(cl *Client) {
+		cl.pendingTimeout = timeout
+	}
+}
+
+// WithIDs overrides the Trionic 7 request, response and acknowledge
+// identifiers.
+func WithIDs(request, response, ack uint32) KWPOption {
+	return func(cl *Client) {
+		cl.requestID = request
+		cl.responseID = response
+		cl.ackID = ack
+	}
+}
+
+// WithTransport carries requests over the given ISO-TP link instead of the
+// Trionic 7 row framing.
+func WithTransport(tp *isotp.Conn) KWPOption {
+	return func(cl *Client) {
+		cl.tp = tp
+	}
+}
+
+// StartSession opens a Trionic 7 diagnostic session: the KWP2000
+// StartCommunication handshake on 0x220, answered on 0x238. It is not used
+// with WithTransport.
+func (cl *Client) StartSession(ctx context.Context) error {
+	rctx, cancel := context.WithTimeout(ctx, cl.defaultTimeout)
+	defer cancel()
+	frame := gocan.NewFrame(T7SessionRequestID, []byte{0x3F, START_COMMUNICATION, 0x00, 0x11, 0x02, 0x40, 0x00, 0x00})
+	resp, err := cl.c.Request(rctx, frame, T7SessionResponseID)
+	if err != nil {
+		return fmt.Errorf("StartSession: %w", err)
+	}
+	if resp.Data[0] != rowFirst || resp.Data[3] != START_COMMUNICATION+0x40 {
+		return fmt.Errorf("StartSession: %w", ErrInvalidResponse)
+	}
+	return nil
+}
+
+// Request sends a raw KWP2000 request (SID first) and returns the positive
+// response, SID included. Negative responses are returned as *KWPError;
+// responsePending is waited out.
+func (cl *Client) Request(ctx context.Context, req []byte) ([]byte, error) {
+	if len(req) == 0 {
+		return nil, errors.New("kwp: empty request")
+	}
+	sctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ch := cl.c.Subscribe(sctx, cl.rxID())
+	if err := cl.send(gocan.WithExpectedResponses(ctx, 1), req); err != nil {
+		return nil, fmt.Errorf("%s: %w", TranslateServiceCode(req[0]), err)
+	}
+	timeout := cl.defaultTimeout
+	for {
+		tctx, tcancel := context.WithTimeout(ctx, timeout)
+		resp, err := cl.recv(tctx, ch)
+		tcancel()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", TranslateServiceCode(req[0]), err)
+		}
+		if len(resp) >= 3 && resp[0] == 0x7F && resp[1] == req[0] {
+			if resp[2] == ResponsePending {
+				timeout = cl.pendingTimeout
+				continue
+			}
+			return nil, &KWPError{Service: req[0], Code: resp[2]}
+		}
+		if len(resp) == 0 || resp[0] != req[0]+0x40 {
+			continue
+		}
+		return resp, nil
+	}
+}
+
+func (cl *Client) rxID() uint32 {
+	if cl.tp != nil {
+		return cl.tp.RxID()
+	}
+	return cl.responseID
+}
+
+// send transmits one request, split into Trionic 7 rows: the first row
+// carries [0x40|rows-1, 0xA1, length, 5 bytes], the following rows
+// [rows-left, 0xA1, 6 bytes].
+func (cl *Client) send(ctx context.Context, req []byte) error {
+	if cl.tp != nil {
+		return cl.tp.Send(ctx, req)
+	}
+	if len(req) > 0xFF {
+		return fmt.Errorf("request too long: %d bytes", len(req))
+	}
+	rows := 1
+	if len(req) > 5 {
+		rows += (len(req) - 5 + 5) / 6
+	}
+	if rows > rowCount+1 {
+		return fmt.Errorf("request too long: %d rows", rows)
+	}
+	rest := req
+	for i := range rows {
+		left := byte(rows - 1 - i)
+		var d []byte
+		if i == 0 {
+			d = []byte{rowFirst | left, t7TesterAddr, byte(len(req))}
+		} else {
+			d = []byte{left, t7TesterAddr}
+		}
+		n := min(8-len(d), len(rest))
+		d = append(d, rest[:n]...)
+		rest = rest[n:]
+		var pad [8]byte
+		copy(pad[:], d)
+		fctx := ctx
+		if left > 0 {
+			fctx = gocan.WithExpectedResponses(ctx, 0)
+		}
+		if err := cl.c.Send(fctx, gocan.NewFrame(cl.requestID, pad[:])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recv reads one response message, acknowledging every Trionic 7 row.
+func (cl *Client) recv(ctx context.Context, ch <-chan gocan.Frame) ([]byte, error) {
+	if cl.tp != nil {
+		return cl.tp.RecvFrom(ctx, ch)
+	}
+	var (
+		buf   []byte
+		total int
+		next  = -1 // row count expected next, -1 until the first row
+	)
+	for {
+		var f gocan.Frame
+		select {
+		case fr, ok := <-ch:
+			if !ok {
+				if err := context.Cause(ctx); err != nil {
+					return nil, err
+				}
+				return nil, gocan.ErrClosed
+			}
+			f = fr
+		case <-ctx.Done():
+			return nil, context.Cause(ctx)
+		}
+		row := f.Data[0]
+		if f.Data[1] != t7ECUAddr {
+			continue
+		}
+		if next < 0 {
+			if row&rowFirst == 0 {
+				continue // tail of a message we never saw start
+			}
+			total = int(f.Data[2])
+			buf = make([]byte, 0, total)
+			buf = append(buf, f.Data[3:min(8, 3+total)]...)
+		} else {
+			if row&rowCount != byte(next) || row&rowFirst != 0 {
+				return nil, fmt.Errorf("row out of sequence: expected %d got 0x%02X", next, row)
+			}
+			buf = append(buf, f.Data[2:min(8, 2+total-len(buf))]...)
+		}
+		next = int(row & rowCount)
+		ackCtx := gocan.WithExpectedResponses(ctx, 0)
+		if next > 0 {
+			ackCtx = gocan.WithExpectedResponses(ctx, 1)
+		}
+		ack := gocan.NewFrame(cl.ackID, []byte{0x40, t7TesterAddr, 0x3F, row &^ rowFirst, 0x00, 0x00, 0x00, 0x00})
+		if err := cl.c.Send(ackCtx, ack); err != nil {
+			return nil, fmt.Errorf("ack: %w", err)
+		}
+		if next == 0 {
+			if len(buf) == 0 {
+				return nil, ErrInvalidResponse
+			}
+			return buf, nil
+		}
+		next--
+	}
+}
+
+// StartDiagnosticSession ($10) switches the ECU into the given diagnostic
+// mode.
+func (cl *Client) StartDiagnosticSession(ctx context.Context, mode byte) error {
+	_, err := cl.Request(ctx, []byte{START_DIAGNOSTIC_SESSION, mode})
+	return err
+}
+
+// StopCommunication ($82) ends the diagnostic session.
+func (cl *Client) StopCommunication(ctx context.Context) error {
+	_, err := cl.Request(ctx, []byte{STOP_COMMUNICATION})
+	return err
+}
+
+// ECUReset ($11) resets the ECU.
+func (cl *Client) ECUReset(ctx context.Context, mode byte) error {
+	_, err := cl.Request(ctx, []byte{ECU_RESET, mode})
+	return err
+}
+
+// TesterPresent ($3E) keeps the diagnostic session alive.
+func (cl *Client) TesterPresent(ctx context.Context) error {
+	_, err := cl.Request(ctx, []byte{TESTER_PRESENT})
+	return err
+}
+
+// SecurityAccessRequestSeed ($27, odd level) requests the seed for level.
+func (cl *Client) SecurityAccessRequestSeed(ctx context.Context, level byte) ([]byte, error) {
+	resp, err := cl.Request(ctx, []byte{SECURITY_ACCESS, level})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) < 2 || resp[1] != level {
+		return nil, fmt.Errorf("SecurityAccessRequestSeed: %w", ErrInvalidResponse)
+	}
+	return resp[2:], nil
+}
+
+// SecurityAccessSendKey ($27, even level) sends the key for the odd seed
+// level.
+func (cl *Client) SecurityAccessSendKey(ctx context.Context, level byte, key []byte) error {
+	resp, err := cl.Request(ctx, append([]byte{SECURITY_ACCESS, level + 1}, key...))
+	if err != nil {
+		return err
+	}
+	if len(resp) < 2 || resp[1] != level+1 {
+		return fmt.Errorf("SecurityAccessSendKey: %w", ErrInvalidResponse)
+	}
+	return nil
+}
+
+// RequestSecurityAccess runs the seed/key exchange for level, computing the
+// key with keyfunc. An all-zero seed means the ECU is already unlocked.
+func (cl *Client) RequestSecurityAccess(ctx context.Context, level byte, keyfunc func(seed []byte, level byte) []byte) error {
+	seed, err := cl.SecurityAccessRequestSeed(ctx, level)
+	if err != nil {
+		return err
+	}
+	zero := true
+	for _, b := range seed {
+		zero = zero && b == 0
+	}
+	if zero {
+		return nil
+	}
+	return cl.SecurityAccessSendKey(ctx, level, keyfunc(seed, level))
+}
+
+// ReadDataByLocalIdentifier ($21) reads the record stored under id.
+func (cl *Client) ReadDataByLocalIdentifier(ctx context.Context, id byte) ([]byte, error) {
+	resp, err := cl.Request(ctx, []byte{READ_DATA_BY_LOCAL_IDENTIFIER, id})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) < 2 || resp[1] != id {
+		return nil, fmt.Errorf("ReadDataByLocalIdentifier: %w", ErrInvalidResponse)
+	}
+	return resp[2:], nil
+}
+
+// WriteDataByLocalIdentifier ($3B) writes data to the record stored under
+// id.
+func (cl *Client) WriteDataByLocalIdentifier(ctx context.Context, id byte, data []byte) error {
+	resp, err := cl.Request(ctx, append([]byte{WRITE_DATA_BY_LOCAL_IDENTIFIER, id}, data...))
+	if err != nil {
+		return err
+	}
+	if len(resp) < 2 || resp[1] != id {
+		return fmt.Errorf("WriteDataByLocalIdentifier: %w", ErrInvalidResponse)
+	}
+	return nil
+}
+
+// ReadMemoryByAddress ($23) reads length bytes (at most 0xFF) from the
+// 24-bit address.
+func (cl *Client) ReadMemoryByAddress(ctx context.Context, address uint32, length byte) ([]byte, error) {
+	resp, err := cl.Request(ctx, []byte{READ_MEMORY_BY_ADDRESS, byte(address >> 16), byte(address >> 8), byte(address), length})
+	if err != nil {
+		return nil, err
+	}
+	data := resp[1:]
+	// Trionic 7 echoes the address after the data, ISO 14230 does not.
+	if len(data) > int(length) {
+		data = data[:length]
+	}
+	return data, nil
+}
+
+// RequestDownload ($34) prepares the ECU to receive size bytes at the
+// 24-bit address. dataFormat is the compression/encryption method, 0x00 for
+// plain data.
+func (cl *Client) RequestDownload(ctx context.Context, address uint32, dataFormat byte, size uint32) error {
+	_, err := cl.Request(ctx, []byte{
+		REQUEST_DOWNLOAD,
+		byte(address >> 16), byte(address >> 8), byte(address),
+		dataFormat,
+		byte(size >> 16), byte(size >> 8), byte(size),
+	})
+	return err
+}
+
+// TransferData ($36) sends one block of download data.
+func (cl *Client) TransferData(ctx context.Context, data []byte) ([]byte, error) {
+	resp, err := cl.Request(ctx, append([]byte{TRANSFER_DATA}, data...))
+	if err != nil {
+		return nil, err
+	}
+	return resp[1:], nil
+}
+
+// RequestTransferExit ($37) ends a download.
+func (cl *Client) RequestTransferExit(ctx context.Context) error {
+	_, err := cl.Request(ctx, []byte{REQUEST_TRANSFER_EXIT})
+	return err
+}
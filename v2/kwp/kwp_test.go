@@ -0,0 +1,116 @@
+package kwp
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	gocan "github.com/roffe/gocan/v2"
+	"github.com/roffe/gocan/v2/internal/ecutest"
+)
+
+// fakeT7 reassembles Trionic 7 request rows on 0x240 and answers with the
+// rows of every message handle returns, on 0x258.
+func fakeT7(t *testing.T, bus *gocan.Bus, handle func(req []byte) [][]byte) {
+	t.Helper()
+	ch := bus.Subscribe(t.Context(), T7RequestID)
+	go func() {
+		var req []byte
+		var total int
+		for f := range ch {
+			if f.Data[0]&rowFirst != 0 {
+				total = int(f.Data[2])
+				req = append([]byte(nil), f.Data[3:min(8, 3+total)]...)
+			} else {
+				req = append(req, f.Data[2:min(8, 2+total-len(req))]...)
+			}
+			if f.Data[0]&rowCount != 0 {
+				continue
+			}
+			for _, resp := range handle(req) {
+				rows := 1 + (max(0, len(resp)-5)+5)/6
+				rest := resp
+				for i := range rows {
+					left := byte(rows - 1 - i)
+					d := []byte{0x80 | left, t7ECUAddr}
+					if i == 0 {
+						d = []byte{0x80 | rowFirst | left, t7ECUAddr, byte(len(resp))}
+					}
+					n := min(8-len(d), len(rest))
+					d = append(d, rest[:n]...)
+					rest = rest[n:]
+					bus.Send(t.Context(), gocan.NewFrame(T7ResponseID, d))
+				}
+			}
+		}
+	}()
+}
+
+func TestReadDataByLocalIdentifierMultiRow(t *testing.T) {
+	bus := ecutest.Loopback(t)
+	vin := []byte("YS3FD49YX41012345")
+	fakeT7(t, bus, func(req []byte) [][]byte {
+		if bytes.Equal(req, []byte{READ_DATA_BY_LOCAL_IDENTIFIER, 0x90}) {
+			return [][]byte{append([]byte{0x61, 0x90}, vin...)}
+		}
+		return [][]byte{{0x7F, req[0], RequestOutOfRange}}
+	})
+	acks := bus.Subscribe(t.Context(), T7AckID)
+
+	cl := New(bus)
+	got, err := cl.ReadDataByLocalIdentifier(t.Context(), 0x90)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, vin) {
+		t.Fatalf("got %q want %q", got, vin)
+	}
+	// 19 bytes: first row carries 5, then two rows of 6 and one of 2.
+	want := []byte{0x83, 0x82, 0x81, 0x80}
+	for i, row := range want {
+		select {
+		case f := <-acks:
+			if f.Data[0] != 0x40 || f.Data[1] != t7TesterAddr || f.Data[2] != 0x3F || f.Data[3] != row {
+				t.Fatalf("ack %d: %s", i, f)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("missing ack %d", i)
+		}
+	}
+
+	if _, err := cl.ReadDataByLocalIdentifier(t.Context(), 0x01); !IsCode(err, RequestOutOfRange) {
+		t.Fatalf("want requestOutOfRange, got %v", err)
+	}
+}
+
+func TestMultiRowRequestAndPending(t *testing.T) {
+	bus := ecutest.Loopback(t)
+	var got []byte
+	fakeT7(t, bus, func(req []byte) [][]byte {
+		got = req
+		return [][]byte{{0x7F, req[0], ResponsePending}, {0x7B, req[1]}}
+	})
+	data := []byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+	defer cancel()
+	if err := New(bus).WriteDataByLocalIdentifier(ctx, 0x42, data); err != nil {
+		t.Fatal(err)
+	}
+	if want := append([]byte{WRITE_DATA_BY_LOCAL_IDENTIFIER, 0x42}, data...); !bytes.Equal(got, want) {
+		t.Fatalf("ECU saw % X, want % X", got, want)
+	}
+}
+
+func TestStartSession(t *testing.T) {
+	bus := ecutest.Loopback(t)
+	go func() {
+		for range bus.Frames(t.Context(), T7SessionRequestID) {
+			bus.Send(t.Context(), gocan.NewFrame(T7SessionResponseID, []byte{0x40, 0xBF, 0x21, 0xC1, 0x00, 0x11, 0x02, 0x58}))
+		}
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if err := New(bus).StartSession(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+}
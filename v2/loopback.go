@@ -4,9 +4,10 @@ import "context"
 
 func init() {
 	Register(AdapterInfo{
-		Name:        "loopback",
-		Description: "virtual adapter that echoes sent frames back, for testing",
-		New:         func(Config) (Adapter, error) { return &Loopback{}, nil },
+		Name:         "loopback",
+		Description:  "virtual adapter that echoes sent frames back, for testing",
+		Capabilities: Capabilities{FD: true},
+		New:          func(Config) (Adapter, error) { return &Loopback{}, nil },
 	})
 }
 
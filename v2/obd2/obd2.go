@@ -0,0 +1,262 @@
+// Package obd2 implements the SAE J1979 / ISO 15031-5 OBD-II services
+// (modes $01–$0A) on a gocan v2 bus, over ISO 15765-4 CAN.
+//
+// Requests are sent to the functional address (0x7DF, or 0x18DB33F1 with
+// WithExtendedID) and every ECU that answers within the response window is
+// collected, each reassembled on its own ISO-TP link:
+//
+//	cl := obd2.New(bus)
+//	vals, err := cl.CurrentData(ctx, obd2.PIDEngineRPM)
+//	for _, v := range vals {
+//		fmt.Printf("%03X %s = %.0f %s\n", v.ECU, v.Name, v.Value, v.Unit)
+//	}
+package obd2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	gocan "github.com/roffe/gocan/v2"
+	"github.com/roffe/gocan/v2/isotp"
+)
+
+// Service modes.
+const (
+	ModeCurrentData        = 0x01
+	ModeFreezeFrame        = 0x02
+	ModeStoredDTC          = 0x03
+	ModeClearDTC           = 0x04
+	ModeOxygenSensor       = 0x05
+	ModeTestResults        = 0x06
+	ModePendingDTC         = 0x07
+	ModeControl            = 0x08
+	ModeVehicleInformation = 0x09
+	ModePermanentDTC       = 0x0A
+)
+
+// Functional request and physical response identifiers (ISO 15765-4).
+const (
+	FunctionalID         = 0x7DF
+	FirstResponseID      = 0x7E8
+	LastResponseID       = 0x7EF
+	FunctionalIDExtended = 0x18DB33F1
+	responseBaseExtended = 0x18DAF100 // + ECU address
+)
+
+const (
+	responsePending = 0x78
+	// pendingTimeout bounds each wait for a reply after responsePending.
+	pendingTimeout = 5 * time.Second
+)
+
+// ErrNoResponse is returned when no ECU answers a request within the
+// response window.
+var ErrNoResponse = errors.New("obd2: no response")
+
+type Option func(*Client)
+
+// Client sends OBD-II requests and collects the replies of every ECU.
+type Client struct {
+	bus            *gocan.Bus
+	extended       bool
+	defaultTimeout time.Duration
+	tpOpts         []isotp.Option
+}
+
+// New creates a client using 11-bit identifiers.
+func New(bus *gocan.Bus, opts ...Option) *Client {
+	cl := &Client{
+		bus:            bus,
+		defaultTimeout: 100 * time.Millisecond,
+	}
+	for _, opt := range opts {
+		opt(cl)
+	}
+	return cl
+}
+
+// WithExtendedID uses 29-bit identifiers: requests on 0x18DB33F1, replies
+// on 0x18DAF1xx.
+func WithExtendedID() Option {
+	return func(cl *Client) { cl.extended = true }
+}
+
+// WithDefaultTimeout sets the response window: how long to keep collecting
+// replies after a request (P2CAN, 50 ms in J1979; the default of 100 ms
+// leaves room for adapter latency).
+func WithDefaultTimeout(timeout time.Duration) Option {
+	return func(cl *Client) { cl.defaultTimeout = timeout }
+}
+
+// WithTransportOptions passes options (typically padding) to the ISO-TP
+// links used for requests and multi-frame replies.
+func WithTransportOptions(opts ...isotp.Option) Option {
+	return func(cl *Client) { cl.tpOpts = append(cl.tpOpts, opts...) }
+}
+
+// Response is one ECU's positive reply to a request.
+type Response struct {
+	ECU  uint32 // response identifier, 0x7E8 for the engine ECU
+	Data []byte // reply with the mode byte stripped
+}
+
+// NegativeResponseError is a negative response ($7F) from an ECU.
+type NegativeResponseError struct {
+	ECU  uint32
+	Mode byte
+	Code byte
+}
+
+func (e *NegativeResponseError) Error() string {
+	return fmt.Sprintf("obd2: ECU 0x%03X rejected mode $%02X with code $%02X", e.ECU, e.Mode, e.Code)
+}
+
+func (cl *Client) responseIDs() []uint32 {
+	var out []uint32
+	if cl.extended {
+		for ecu := range uint32(0x100) {
+			out = append(out, responseBaseExtended|ecu)
+		}
+		return out
+	}
+	for id := uint32(FirstResponseID); id <= LastResponseID; id++ {
+		out = append(out, id)
+	}
+	return out
+}
+
+// physicalID returns the request identifier of the ECU answering on rx, the
+// target of its flow control frames.
+func physicalID(rx uint32) uint32 {
+	if rx > 0x7FF {
+		// 0x18DAF1xx -> 0x18DAxxF1
+		return rx&0xFFFF0000 | (rx&0xFF)<<8 | (rx>>8)&0xFF
+	}
+	return rx - 8
+}
+
+// Request sends a raw functional request (mode first) and returns every
+// positive reply collected within the response window, sorted by ECU. It
+// returns the first negative response as a *NegativeResponseError when no
+// ECU answered positively, and ErrNoResponse when none answered at all.
+func (cl *Client) Request(ctx context.Context, req []byte) ([]Response, error) {
+	if len(req) == 0 || len(req) > 7 {
+		return nil, fmt.Errorf("obd2: functional requests carry 1-7 bytes, got %d", len(req))
+	}
+	rx := cl.responseIDs()
+	sctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	in := cl.bus.Subscribe(sctx, rx...)
+
+	txID := uint32(FunctionalID)
+	tpOpts := cl.tpOpts
+	if cl.extended {
+		txID = FunctionalIDExtended
+		tpOpts = append([]isotp.Option{isotp.WithExtendedID()}, tpOpts...)
+	}
+	// Buffered adapters: hint one reply per possible ECU, bounded by the
+	// window rather than the count.
+	hctx := gocan.WithResponseTimeout(gocan.WithExpectedResponses(ctx, len(rx)), cl.defaultTimeout)
+	if err := isotp.New(cl.bus, txID, 0, tpOpts...).Send(hctx, req); err != nil {
+		return nil, fmt.Errorf("obd2: mode $%02X: %w", req[0], err)
+	}
+
+	window, wcancel := context.WithTimeout(ctx, cl.defaultTimeout)
+	defer wcancel()
+
+	var (
+		mu    sync.Mutex
+		out   []Response
+		nrc   error
+		wg    sync.WaitGroup
+		links = make(map[uint32]chan gocan.Frame)
+	)
+	// collect reassembles one ECU's reply. It is started by the reply's
+	// first frame, so each receive completes within the ISO-TP timeouts;
+	// only a responsePending reply makes it wait for another one.
+	collect := func(id uint32, ch chan gocan.Frame) {
+		defer wg.Done()
+		tp := isotp.New(cl.bus, physicalID(id), id, tpOpts...)
+		for {
+			rctx, rcancel := context.WithTimeout(sctx, pendingTimeout)
+			pdu, err := tp.RecvFrom(rctx, ch)
+			rcancel()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			pending := len(pdu) >= 3 && pdu[0] == 0x7F && pdu[1] == req[0] && pdu[2] == responsePending
+			switch {
+			case pending:
+			case len(pdu) >= 3 && pdu[0] == 0x7F && pdu[1] == req[0]:
+				if nrc == nil {
+					nrc = &NegativeResponseError{ECU: id, Mode: req[0], Code: pdu[2]}
+				}
+			case len(pdu) > 0 && pdu[0] == req[0]+0x40:
+				out = append(out, Response{ECU: id, Data: pdu[1:]})
+			}
+			mu.Unlock()
+			if !pending {
+				return
+			}
+		}
+	}
+
+	// Demultiplex replies per ECU. New ECUs are accepted while the window
+	// is open; afterwards frames keep flowing to the replies already in
+	// progress until they complete.
+	var allDone chan struct{}
+	windowDone := window.Done()
+	for {
+		select {
+		case f, ok := <-in:
+			if !ok {
+				if err := context.Cause(ctx); err != nil {
+					return nil, err
+				}
+				return nil, gocan.ErrClosed
+			}
+			ch, ok := links[f.ID]
+			if !ok {
+				if allDone != nil || f.Length == 0 || f.Data[0]&0xE0 != 0 {
+					continue // window closed, or not the start of a message
+				}
+				ch = make(chan gocan.Frame, 64)
+				links[f.ID] = ch
+				wg.Add(1)
+				go collect(f.ID, ch)
+			}
+			select {
+			case ch <- f:
+			default:
+			}
+			continue
+		case <-windowDone:
+			windowDone = nil
+			allDone = make(chan struct{})
+			go func() {
+				wg.Wait()
+				close(allDone)
+			}()
+			continue
+		case <-allDone:
+		}
+		break
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ECU < out[j].ECU })
+	if len(out) == 0 {
+		if nrc != nil {
+			return nil, nrc
+		}
+		return nil, ErrNoResponse
+	}
+	return out, nil
+}
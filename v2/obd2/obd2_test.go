@@ -0,0 +1,164 @@
+package obd2
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	gocan "github.com/roffe/gocan/v2"
+	"github.com/roffe/gocan/v2/internal/ecutest"
+	"github.com/roffe/gocan/v2/isotp"
+)
+
+// fakeECU answers functional requests on its physical response identifier
+// with whatever handle returns; nil means stay silent.
+func fakeECU(t *testing.T, bus *gocan.Bus, id uint32, handle func(req []byte) []byte) {
+	t.Helper()
+	ch := bus.Subscribe(t.Context(), FunctionalID)
+	tp := isotp.New(bus, id, physicalID(id))
+	go func() {
+		for f := range ch {
+			n := int(f.Data[0] & 0x0F)
+			if f.Data[0]&0xF0 != 0 || n == 0 || n > 7 {
+				continue
+			}
+			if resp := handle(f.Data[1 : 1+n]); resp != nil {
+				tp.Send(t.Context(), resp)
+			}
+		}
+	}()
+}
+
+func TestCurrentDataMultipleECUs(t *testing.T) {
+	bus := ecutest.Loopback(t)
+	fakeECU(t, bus, 0x7E8, func(req []byte) []byte {
+		if bytes.Equal(req, []byte{0x01, PIDEngineRPM, PIDCoolantTemp}) {
+			return []byte{0x41, PIDEngineRPM, 0x1A, 0xF8, PIDCoolantTemp, 0x7B}
+		}
+		return []byte{0x7F, req[0], 0x12}
+	})
+	fakeECU(t, bus, 0x7E9, func(req []byte) []byte {
+		if req[0] == 0x01 {
+			return []byte{0x41, PIDCoolantTemp, 0x7A}
+		}
+		return nil
+	})
+
+	vals, err := New(bus).CurrentData(t.Context(), PIDEngineRPM, PIDCoolantTemp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Value{
+		{ECU: 0x7E8, PID: PIDEngineRPM, Value: 1726, Unit: "rpm"},
+		{ECU: 0x7E8, PID: PIDCoolantTemp, Value: 83, Unit: "°C"},
+		{ECU: 0x7E9, PID: PIDCoolantTemp, Value: 82, Unit: "°C"},
+	}
+	if len(vals) != len(want) {
+		t.Fatalf("got %v", vals)
+	}
+	for i, w := range want {
+		g := vals[i]
+		if g.ECU != w.ECU || g.PID != w.PID || g.Value != w.Value || g.Unit != w.Unit {
+			t.Errorf("value %d: got %+v want %+v", i, g, w)
+		}
+	}
+}
+
+func TestVINMultiFrame(t *testing.T) {
+	bus := ecutest.Loopback(t)
+	vin := "1G1JC5444R7252367"
+	fakeECU(t, bus, 0x7E8, func(req []byte) []byte {
+		if bytes.Equal(req, []byte{0x09, InfoVIN}) {
+			return append([]byte{0x49, InfoVIN, 0x01}, vin...)
+		}
+		return nil
+	})
+	got, err := New(bus).VIN(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != vin {
+		t.Fatalf("got %q want %q", got, vin)
+	}
+}
+
+func TestSupportedPIDsChained(t *testing.T) {
+	bus := ecutest.Loopback(t)
+	fakeECU(t, bus, 0x7E8, func(req []byte) []byte {
+		switch req[1] {
+		case 0x00:
+			return []byte{0x41, 0x00, 0x18, 0x00, 0x00, 0x01} // $04, $05, more
+		case 0x20:
+			return []byte{0x41, 0x20, 0x00, 0x00, 0x00, 0x00} // none, stop
+		}
+		t.Errorf("unexpected request % X", req)
+		return nil
+	})
+	got, err := New(bus).SupportedPIDs(t.Context(), ModeCurrentData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0x04, 0x05, 0x20}; !bytes.Equal(got[0x7E8], want) {
+		t.Fatalf("got % X want % X", got[0x7E8], want)
+	}
+}
+
+func TestDTCs(t *testing.T) {
+	bus := ecutest.Loopback(t)
+	fakeECU(t, bus, 0x7E8, func(req []byte) []byte {
+		switch req[0] {
+		case ModeStoredDTC:
+			return []byte{0x43, 0x03, 0x04, 0x20, 0x41, 0x23, 0xC1, 0x00}
+		case ModeClearDTC:
+			return []byte{0x7F, 0x04, 0x22}
+		}
+		return nil
+	})
+	cl := New(bus)
+	dtcs, err := cl.StoredDTCs(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range dtcs {
+		got = append(got, d.String())
+	}
+	if want := "P0420 C0123 U0100"; strings.Join(got, " ") != want {
+		t.Fatalf("got %v want %s", got, want)
+	}
+
+	var nrc *NegativeResponseError
+	if err := cl.ClearDTCs(t.Context()); !errors.As(err, &nrc) || nrc.Code != 0x22 {
+		t.Fatalf("want conditionsNotCorrect, got %v", err)
+	}
+	if _, err := cl.PendingDTCs(t.Context()); !errors.Is(err, ErrNoResponse) {
+		t.Fatalf("want ErrNoResponse, got %v", err)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	for _, tc := range []struct {
+		pid  byte
+		data []byte
+		want float64
+	}{
+		{PIDEngineLoad, []byte{0xFF}, 100},
+		{PIDShortTermFuelTrimBank1, []byte{0x80}, 0},
+		{PIDVehicleSpeed, []byte{0x64}, 100},
+		{PIDMAFAirFlowRate, []byte{0x01, 0xF4}, 5},
+		{PIDControlModuleVoltage, []byte{0x36, 0xB0}, 14},
+		{PIDTimingAdvance, []byte{0x80}, 0},
+	} {
+		v, err := Decode(tc.pid, tc.data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.Value != tc.want {
+			t.Errorf("PID $%02X: got %v want %v", tc.pid, v.Value, tc.want)
+		}
+	}
+	if _, err := Decode(PIDEngineRPM, []byte{0x01}); err == nil {
+		t.Error("short data accepted")
+	}
+}
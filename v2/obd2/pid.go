@@ -0,0 +1,181 @@
+package obd2
+
+import "fmt"
+
+// Standard mode $01/$02 parameter identifiers (SAE J1979 Annex B).
+const (
+	PIDSupported01_20           = 0x00
+	PIDMonitorStatus            = 0x01
+	PIDFreezeDTC                = 0x02
+	PIDFuelSystemStatus         = 0x03
+	PIDEngineLoad               = 0x04
+	PIDCoolantTemp              = 0x05
+	PIDShortTermFuelTrimBank1   = 0x06
+	PIDLongTermFuelTrimBank1    = 0x07
+	PIDShortTermFuelTrimBank2   = 0x08
+	PIDLongTermFuelTrimBank2    = 0x09
+	PIDFuelPressure             = 0x0A
+	PIDIntakeManifoldPressure   = 0x0B
+	PIDEngineRPM                = 0x0C
+	PIDVehicleSpeed             = 0x0D
+	PIDTimingAdvance            = 0x0E
+	PIDIntakeAirTemp            = 0x0F
+	PIDMAFAirFlowRate           = 0x10
+	PIDThrottlePosition         = 0x11
+	PIDOBDStandard              = 0x1C
+	PIDRunTimeSinceStart        = 0x1F
+	PIDSupported21_40           = 0x20
+	PIDDistanceWithMIL          = 0x21
+	PIDFuelRailPressure         = 0x22
+	PIDFuelRailGaugePressure    = 0x23
+	PIDCommandedEGR             = 0x2C
+	PIDEGRError                 = 0x2D
+	PIDCommandedEvapPurge       = 0x2E
+	PIDFuelTankLevel            = 0x2F
+	PIDWarmUpsSinceClear        = 0x30
+	PIDDistanceSinceClear       = 0x31
+	PIDBarometricPressure       = 0x33
+	PIDCatalystTempB1S1         = 0x3C
+	PIDCatalystTempB2S1         = 0x3D
+	PIDCatalystTempB1S2         = 0x3E
+	PIDCatalystTempB2S2         = 0x3F
+	PIDSupported41_60           = 0x40
+	PIDControlModuleVoltage     = 0x42
+	PIDAbsoluteLoad             = 0x43
+	PIDCommandedEquivRatio      = 0x44
+	PIDRelativeThrottlePosition = 0x45
+	PIDAmbientAirTemp           = 0x46
+	PIDAbsoluteThrottleB        = 0x47
+	PIDAcceleratorPedalD        = 0x49
+	PIDAcceleratorPedalE        = 0x4A
+	PIDCommandedThrottle        = 0x4C
+	PIDTimeWithMIL              = 0x4D
+	PIDTimeSinceClear           = 0x4E
+	PIDFuelType                 = 0x51
+	PIDEthanolPercent           = 0x52
+	PIDOilTemp                  = 0x5C
+	PIDFuelInjectionTiming      = 0x5D
+	PIDEngineFuelRate           = 0x5E
+	PIDSupported61_80           = 0x60
+	PIDDemandedTorque           = 0x61
+	PIDActualTorque             = 0x62
+	PIDReferenceTorque          = 0x63
+)
+
+// PID describes how to decode a standard parameter.
+type PID struct {
+	PID    byte
+	Name   string
+	Unit   string
+	Bytes  int                  // data bytes in the reply
+	Decode func([]byte) float64 // scaled physical value from Bytes data bytes
+}
+
+func u16(d []byte) float64 { return float64(uint16(d[0])<<8 | uint16(d[1])) }
+
+func percent(d []byte) float64   { return float64(d[0]) * 100 / 255 }
+func temp(d []byte) float64      { return float64(d[0]) - 40 }
+func trim(d []byte) float64      { return float64(d[0])*100/128 - 100 }
+func raw8(d []byte) float64      { return float64(d[0]) }
+func raw16(d []byte) float64     { return u16(d) }
+func catTemp(d []byte) float64   { return u16(d)/10 - 40 }
+func torquePct(d []byte) float64 { return float64(d[0]) - 125 }
+
+// PIDs is the table of standard parameters Decode knows, keyed by PID.
+var PIDs = map[byte]PID{
+	PIDEngineLoad:               {PIDEngineLoad, "Calculated engine load", "%", 1, percent},
+	PIDCoolantTemp:              {PIDCoolantTemp, "Engine coolant temperature", "°C", 1, temp},
+	PIDShortTermFuelTrimBank1:   {PIDShortTermFuelTrimBank1, "Short term fuel trim bank 1", "%", 1, trim},
+	PIDLongTermFuelTrimBank1:    {PIDLongTermFuelTrimBank1, "Long term fuel trim bank 1", "%", 1, trim},
+	PIDShortTermFuelTrimBank2:   {PIDShortTermFuelTrimBank2, "Short term fuel trim bank 2", "%", 1, trim},
+	PIDLongTermFuelTrimBank2:    {PIDLongTermFuelTrimBank2, "Long term fuel trim bank 2", "%", 1, trim},
+	PIDFuelPressure:             {PIDFuelPressure, "Fuel pressure", "kPa", 1, func(d []byte) float64 { return 3 * float64(d[0]) }},
+	PIDIntakeManifoldPressure:   {PIDIntakeManifoldPressure, "Intake manifold absolute pressure", "kPa", 1, raw8},
+	PIDEngineRPM:                {PIDEngineRPM, "Engine speed", "rpm", 2, func(d []byte) float64 { return u16(d) / 4 }},
+	PIDVehicleSpeed:             {PIDVehicleSpeed, "Vehicle speed", "km/h", 1, raw8},
+	PIDTimingAdvance:            {PIDTimingAdvance, "Timing advance", "° before TDC", 1, func(d []byte) float64 { return float64(d[0])/2 - 64 }},
+	PIDIntakeAirTemp:            {PIDIntakeAirTemp, "Intake air temperature", "°C", 1, temp},
+	PIDMAFAirFlowRate:           {PIDMAFAirFlowRate, "MAF air flow rate", "g/s", 2, func(d []byte) float64 { return u16(d) / 100 }},
+	PIDThrottlePosition:         {PIDThrottlePosition, "Throttle position", "%", 1, percent},
+	PIDOBDStandard:              {PIDOBDStandard, "OBD standard", "", 1, raw8},
+	PIDRunTimeSinceStart:        {PIDRunTimeSinceStart, "Run time since engine start", "s", 2, raw16},
+	PIDDistanceWithMIL:          {PIDDistanceWithMIL, "Distance traveled with MIL on", "km", 2, raw16},
+	PIDFuelRailPressure:         {PIDFuelRailPressure, "Fuel rail pressure (relative to manifold vacuum)", "kPa", 2, func(d []byte) float64 { return u16(d) * 0.079 }},
+	PIDFuelRailGaugePressure:    {PIDFuelRailGaugePressure, "Fuel rail gauge pressure", "kPa", 2, func(d []byte) float64 { return u16(d) * 10 }},
+	PIDCommandedEGR:             {PIDCommandedEGR, "Commanded EGR", "%", 1, percent},
+	PIDEGRError:                 {PIDEGRError, "EGR error", "%", 1, trim},
+	PIDCommandedEvapPurge:       {PIDCommandedEvapPurge, "Commanded evaporative purge", "%", 1, percent},
+	PIDFuelTankLevel:            {PIDFuelTankLevel, "Fuel tank level input", "%", 1, percent},
+	PIDWarmUpsSinceClear:        {PIDWarmUpsSinceClear, "Warm-ups since codes cleared", "", 1, raw8},
+	PIDDistanceSinceClear:       {PIDDistanceSinceClear, "Distance traveled since codes cleared", "km", 2, raw16},
+	PIDBarometricPressure:       {PIDBarometricPressure, "Absolute barometric pressure", "kPa", 1, raw8},
+	PIDCatalystTempB1S1:         {PIDCatalystTempB1S1, "Catalyst temperature bank 1 sensor 1", "°C", 2, catTemp},
+	PIDCatalystTempB2S1:         {PIDCatalystTempB2S1, "Catalyst temperature bank 2 sensor 1", "°C", 2, catTemp},
+	PIDCatalystTempB1S2:         {PIDCatalystTempB1S2, "Catalyst temperature bank 1 sensor 2", "°C", 2, catTemp},
+	PIDCatalystTempB2S2:         {PIDCatalystTempB2S2, "Catalyst temperature bank 2 sensor 2", "°C", 2, catTemp},
+	PIDControlModuleVoltage:     {PIDControlModuleVoltage, "Control module voltage", "V", 2, func(d []byte) float64 { return u16(d) / 1000 }},
+	PIDAbsoluteLoad:             {PIDAbsoluteLoad, "Absolute load value", "%", 2, func(d []byte) float64 { return u16(d) * 100 / 255 }},
+	PIDCommandedEquivRatio:      {PIDCommandedEquivRatio, "Commanded air-fuel equivalence ratio", "λ", 2, func(d []byte) float64 { return u16(d) * 2 / 65536 }},
+	PIDRelativeThrottlePosition: {PIDRelativeThrottlePosition, "Relative throttle position", "%", 1, percent},
+	PIDAmbientAirTemp:           {PIDAmbientAirTemp, "Ambient air temperature", "°C", 1, temp},
+	PIDAbsoluteThrottleB:        {PIDAbsoluteThrottleB, "Absolute throttle position B", "%", 1, percent},
+	PIDAcceleratorPedalD:        {PIDAcceleratorPedalD, "Accelerator pedal position D", "%", 1, percent},
+	PIDAcceleratorPedalE:        {PIDAcceleratorPedalE, "Accelerator pedal position E", "%", 1, percent},
+	PIDCommandedThrottle:        {PIDCommandedThrottle, "Commanded throttle actuator", "%", 1, percent},
+	PIDTimeWithMIL:              {PIDTimeWithMIL, "Time run with MIL on", "min", 2, raw16},
+	PIDTimeSinceClear:           {PIDTimeSinceClear, "Time since trouble codes cleared", "min", 2, raw16},
+	PIDFuelType:                 {PIDFuelType, "Fuel type", "", 1, raw8},
+	PIDEthanolPercent:           {PIDEthanolPercent, "Ethanol fuel", "%", 1, percent},
+	PIDOilTemp:                  {PIDOilTemp, "Engine oil temperature", "°C", 1, temp},
+	PIDFuelInjectionTiming:      {PIDFuelInjectionTiming, "Fuel injection timing", "°", 2, func(d []byte) float64 { return u16(d)/128 - 210 }},
+	PIDEngineFuelRate:           {PIDEngineFuelRate, "Engine fuel rate", "L/h", 2, func(d []byte) float64 { return u16(d) / 20 }},
+	PIDDemandedTorque:           {PIDDemandedTorque, "Driver's demand engine torque", "%", 1, torquePct},
+	PIDActualTorque:             {PIDActualTorque, "Actual engine torque", "%", 1, torquePct},
+	PIDReferenceTorque:          {PIDReferenceTorque, "Engine reference torque", "Nm", 2, raw16},
+}
+
+// Value is a decoded parameter from one ECU.
+type Value struct {
+	ECU   uint32
+	PID   byte
+	Name  string
+	Value float64
+	Unit  string
+	Raw   []byte
+}
+
+func (v Value) String() string {
+	return fmt.Sprintf("%s: %.2f %s", v.Name, v.Value, v.Unit)
+}
+
+// Decode scales the data bytes of a standard PID. It fails for PIDs outside
+// the PIDs table and for short data.
+func Decode(pid byte, data []byte) (Value, error) {
+	p, ok := PIDs[pid]
+	if !ok {
+		return Value{}, fmt.Errorf("obd2: no decoder for PID $%02X", pid)
+	}
+	if len(data) < p.Bytes {
+		return Value{}, fmt.Errorf("obd2: PID $%02X needs %d bytes, got %d", pid, p.Bytes, len(data))
+	}
+	return Value{PID: pid, Name: p.Name, Value: p.Decode(data[:p.Bytes]), Unit: p.Unit, Raw: data[:p.Bytes]}, nil
+}
+
+// pidLength returns how many data bytes follow pid in a mode $01/$02 reply,
+// or 0 when unknown. The supported-PID bitmaps and the multi-byte status
+// PIDs are known even though they have no scalar decoding.
+func pidLength(pid byte) int {
+	if pid%0x20 == 0 {
+		return 4 // supported-PID bitmap
+	}
+	switch pid {
+	case PIDMonitorStatus:
+		return 4
+	case PIDFreezeDTC, PIDFuelSystemStatus:
+		return 2
+	}
+	if p, ok := PIDs[pid]; ok {
+		return p.Bytes
+	}
+	return 0
+}
@@ -0,0 +1,268 @@
+package obd2
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Mode $09 info types.
+const (
+	InfoSupported01_20    = 0x00
+	InfoVINMessageCount   = 0x01
+	InfoVIN               = 0x02
+	InfoCalibrationID     = 0x04
+	InfoCVN               = 0x06
+	InfoPerformanceSpark  = 0x08
+	InfoECUName           = 0x0A
+	InfoPerformanceDiesel = 0x0B
+)
+
+// maxPIDsPerRequest is how many PIDs a single mode $01 request may carry.
+const maxPIDsPerRequest = 6
+
+// CurrentData ($01) reads up to six PIDs from every ECU and decodes the ones
+// in the PIDs table. PIDs without a decoder are skipped; use Request for
+// those.
+func (cl *Client) CurrentData(ctx context.Context, pids ...byte) ([]Value, error) {
+	if len(pids) == 0 || len(pids) > maxPIDsPerRequest {
+		return nil, fmt.Errorf("obd2: mode $01 takes 1-%d PIDs, got %d", maxPIDsPerRequest, len(pids))
+	}
+	resps, err := cl.Request(ctx, append([]byte{ModeCurrentData}, pids...))
+	if err != nil {
+		return nil, err
+	}
+	var out []Value
+	for _, r := range resps {
+		out = append(out, decodeRecords(r.ECU, r.Data, 0)...)
+	}
+	return out, nil
+}
+
+// FreezeFrame ($02) reads one PID of a stored freeze frame from every ECU.
+func (cl *Client) FreezeFrame(ctx context.Context, pid, frame byte) ([]Value, error) {
+	resps, err := cl.Request(ctx, []byte{ModeFreezeFrame, pid, frame})
+	if err != nil {
+		return nil, err
+	}
+	var out []Value
+	for _, r := range resps {
+		out = append(out, decodeRecords(r.ECU, r.Data, 1)...)
+	}
+	return out, nil
+}
+
+// decodeRecords splits a mode $01/$02 reply into its PID records, each
+// followed by skip bytes (the freeze frame number) before the data.
+func decodeRecords(ecu uint32, data []byte, skip int) []Value {
+	var out []Value
+	for len(data) > 0 {
+		pid := data[0]
+		n := pidLength(pid)
+		if n == 0 || len(data) < 1+skip+n {
+			break // unknown length, the rest cannot be split
+		}
+		if v, err := Decode(pid, data[1+skip:1+skip+n]); err == nil {
+			v.ECU = ecu
+			out = append(out, v)
+		}
+		data = data[1+skip+n:]
+	}
+	return out
+}
+
+// SupportedPIDs returns, per ECU, the PIDs (mode $01 or $02) or info types
+// (mode $09) it supports, following the $00/$20/$40… bitmaps for as long as
+// an ECU reports the next range.
+func (cl *Client) SupportedPIDs(ctx context.Context, mode byte) (map[uint32][]byte, error) {
+	var extra []byte
+	switch mode {
+	case ModeCurrentData, ModeVehicleInformation:
+	case ModeFreezeFrame:
+		extra = []byte{0}
+	default:
+		return nil, fmt.Errorf("obd2: mode $%02X has no supported-PID bitmaps", mode)
+	}
+	out := make(map[uint32][]byte)
+	more := map[uint32]bool{}
+	for base := 0; base < 0x100; base += 0x20 {
+		resps, err := cl.Request(ctx, append([]byte{mode, byte(base)}, extra...))
+		if err != nil {
+			if base > 0 {
+				break // a partial answer is still an answer
+			}
+			return nil, err
+		}
+		next := map[uint32]bool{}
+		for _, r := range resps {
+			if base > 0 && !more[r.ECU] {
+				continue
+			}
+			d := r.Data
+			if len(d) < 1+len(extra)+4 || d[0] != byte(base) {
+				continue
+			}
+			bits := d[1+len(extra):][:4]
+			for i := range 32 {
+				if bits[i/8]&(0x80>>(i%8)) != 0 {
+					out[r.ECU] = append(out[r.ECU], byte(base+i+1))
+				}
+			}
+			if _, ok := out[r.ECU]; !ok {
+				out[r.ECU] = nil
+			}
+			next[r.ECU] = bits[3]&0x01 != 0
+		}
+		if !anyTrue(next) {
+			break
+		}
+		more = next
+	}
+	if len(out) == 0 {
+		return nil, ErrNoResponse
+	}
+	return out, nil
+}
+
+func anyTrue(m map[uint32]bool) bool {
+	for _, v := range m {
+		if v {
+			return true
+		}
+	}
+	return false
+}
+
+// DTC is an emission-related trouble code reported by an ECU.
+type DTC struct {
+	ECU  uint32
+	Code uint16
+}
+
+// String formats the code the SAE J2012 way, e.g. "P0420".
+func (d DTC) String() string {
+	letters := [...]byte{'P', 'C', 'B', 'U'}
+	return fmt.Sprintf("%c%X%03X", letters[d.Code>>14], (d.Code>>12)&0x03, d.Code&0x0FFF)
+}
+
+// StoredDTCs ($03) reads the confirmed emission-related DTCs.
+func (cl *Client) StoredDTCs(ctx context.Context) ([]DTC, error) {
+	return cl.dtcs(ctx, ModeStoredDTC)
+}
+
+// PendingDTCs ($07) reads the DTCs detected during the current or last
+// driving cycle.
+func (cl *Client) PendingDTCs(ctx context.Context) ([]DTC, error) {
+	return cl.dtcs(ctx, ModePendingDTC)
+}
+
+// PermanentDTCs ($0A) reads the DTCs that ClearDTCs cannot erase.
+func (cl *Client) PermanentDTCs(ctx context.Context) ([]DTC, error) {
+	return cl.dtcs(ctx, ModePermanentDTC)
+}
+
+// dtcs parses the CAN reply format: a count byte followed by two bytes per
+// DTC.
+func (cl *Client) dtcs(ctx context.Context, mode byte) ([]DTC, error) {
+	resps, err := cl.Request(ctx, []byte{mode})
+	if err != nil {
+		return nil, err
+	}
+	var out []DTC
+	for _, r := range resps {
+		if len(r.Data) == 0 {
+			return nil, fmt.Errorf("obd2: mode $%02X: empty reply from 0x%03X", mode, r.ECU)
+		}
+		n := int(r.Data[0])
+		if len(r.Data) < 1+2*n {
+			return nil, fmt.Errorf("obd2: mode $%02X: 0x%03X reported %d DTCs in %d bytes", mode, r.ECU, n, len(r.Data)-1)
+		}
+		for i := range n {
+			code := uint16(r.Data[1+2*i])<<8 | uint16(r.Data[2+2*i])
+			out = append(out, DTC{ECU: r.ECU, Code: code})
+		}
+	}
+	return out, nil
+}
+
+// ClearDTCs ($04) clears the DTCs, freeze frames and test results of every
+// ECU and turns off the MIL.
+func (cl *Client) ClearDTCs(ctx context.Context) error {
+	_, err := cl.Request(ctx, []byte{ModeClearDTC})
+	return err
+}
+
+// OxygenSensorTest ($05) requests oxygen sensor monitoring results. Over CAN
+// these are reported by mode $06 instead and most ECUs reject it.
+func (cl *Client) OxygenSensorTest(ctx context.Context, tid, sensor byte) ([]Response, error) {
+	return cl.Request(ctx, []byte{ModeOxygenSensor, tid, sensor})
+}
+
+// TestResults ($06) reads the on-board monitoring results of a monitor ID.
+func (cl *Client) TestResults(ctx context.Context, mid byte) ([]Response, error) {
+	return cl.Request(ctx, []byte{ModeTestResults, mid})
+}
+
+// Control ($08) requests control of an on-board system, test or component.
+func (cl *Client) Control(ctx context.Context, tid byte, data ...byte) ([]Response, error) {
+	return cl.Request(ctx, append([]byte{ModeControl, tid}, data...))
+}
+
+// VehicleInformation ($09) reads an info type from every ECU. The echoed
+// info type and the data item count are stripped.
+func (cl *Client) VehicleInformation(ctx context.Context, infoType byte) ([]Response, error) {
+	resps, err := cl.Request(ctx, []byte{ModeVehicleInformation, infoType})
+	if err != nil {
+		return nil, err
+	}
+	for i, r := range resps {
+		if len(r.Data) < 2 || r.Data[0] != infoType {
+			return nil, fmt.Errorf("obd2: mode $09: unexpected reply % X from 0x%03X", r.Data, r.ECU)
+		}
+		resps[i].Data = r.Data[2:]
+	}
+	return resps, nil
+}
+
+// VIN reads the vehicle identification number, from the first ECU that
+// reports one.
+func (cl *Client) VIN(ctx context.Context) (string, error) {
+	resps, err := cl.VehicleInformation(ctx, InfoVIN)
+	if err != nil {
+		return "", err
+	}
+	return trimInfo(resps[0].Data), nil
+}
+
+// ECUNames reads the name of every ECU, keyed by response identifier.
+func (cl *Client) ECUNames(ctx context.Context) (map[uint32]string, error) {
+	resps, err := cl.VehicleInformation(ctx, InfoECUName)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[uint32]string, len(resps))
+	for _, r := range resps {
+		out[r.ECU] = trimInfo(r.Data)
+	}
+	return out, nil
+}
+
+// CalibrationIDs reads the calibration IDs of every ECU, 16 characters each.
+func (cl *Client) CalibrationIDs(ctx context.Context) (map[uint32][]string, error) {
+	resps, err := cl.VehicleInformation(ctx, InfoCalibrationID)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[uint32][]string, len(resps))
+	for _, r := range resps {
+		for d := r.Data; len(d) >= 16; d = d[16:] {
+			out[r.ECU] = append(out[r.ECU], trimInfo(d[:16]))
+		}
+	}
+	return out, nil
+}
+
+// trimInfo strips the NUL and space padding of a mode $09 string.
+func trimInfo(b []byte) string {
+	return strings.Trim(string(b), "\x00 ")
+}
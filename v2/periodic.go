@@ -0,0 +1,416 @@
+package gocan
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Periodic describes a cyclic frame for Bus.SendPeriodic.
+type Periodic struct {
+	Frame  Frame
+	Period time.Duration
+	// Offset delays the first cycle, so frames sharing a period can be
+	// spread out instead of all going at once.
+	Offset time.Duration
+	Count  int // cycles to send before stopping, 0 to send until stopped
+	Burst  int // frames sent back to back each cycle, 0 counts as 1
+	// Prepare, when set, is called with a copy of Frame before each
+	// transmission, to fill in rolling counters and checksums; n counts
+	// transmissions from 0. It runs on the scheduler goroutine: keep it
+	// quick. Frames with Prepare are always sent from the host.
+	Prepare func(f *Frame, n uint64)
+}
+
+func (p *Periodic) validate() error {
+	if p.Period <= 0 {
+		return fmt.Errorf("gocan: invalid period %v", p.Period)
+	}
+	if p.Count < 0 || p.Burst < 0 || p.Offset < 0 {
+		return errors.New("gocan: negative count, burst or offset")
+	}
+	return p.Frame.Validate()
+}
+
+// offloadable reports whether an adapter's own scheduler can send p.
+func (p *Periodic) offloadable() bool {
+	return p.Prepare == nil && p.Burst <= 1
+}
+
+// CyclicSender is implemented by adapters whose hardware or driver can
+// send a frame periodically on its own (SocketCAN's broadcast manager,
+// Kvaser object buffers), so the period doesn't depend on host scheduling.
+// Bus.SendPeriodic uses it when it can and falls back to sending from the
+// host when StartCyclic fails.
+//
+// Frames sent this way never pass through Bus.Send: they are not counted
+// in Stats, and neither OnSend taps nor a recorder's WithSent see them.
+// Adapters must not deliver them back as received frames.
+type CyclicSender interface {
+	// StartCyclic starts sending f every period, count times, or until
+	// stopped when count is 0.
+	StartCyclic(f Frame, period time.Duration, count int) (CyclicTx, error)
+}
+
+// CyclicTx is a transmission started by CyclicSender.
+type CyclicTx interface {
+	// Update replaces the frame and period without stopping.
+	Update(f Frame, period time.Duration) error
+	Stop() error
+}
+
+// PeriodicTask is a cyclic frame scheduled with Bus.SendPeriodic.
+type PeriodicTask struct {
+	bus  *Bus
+	done chan struct{}
+
+	// Guarded by the bus's scheduler lock.
+	p        Periodic
+	next     time.Time // next cycle, or when an offloaded Count runs out
+	index    int       // heap index, -1 when not scheduled
+	sent     uint64
+	cycles   int
+	gen      int           // bumped by Update
+	failing  bool          // the last send failed; reported once
+	hw       CyclicTx      // set while the adapter is sending it
+	hwStart  time.Time     // when the adapter's next cycle to count goes out
+	hwPeriod time.Duration // the adapter's period
+	hwCount  int           // cycles left for the adapter to send, 0 for no limit
+	hostOnly bool          // the adapter refused it
+	stopped  bool
+}
+
+// SendPeriodic starts sending p.Frame every p.Period until ctx is done,
+// the task is stopped, p.Count cycles have been sent or the bus terminates.
+// Cycles are scheduled on absolute times, so they don't drift; cycles
+// missed because sending fell behind are skipped rather than bunched up.
+//
+// Frames without Prepare or Burst are handed to the adapter's own
+// scheduler when it has one (see CyclicSender). Failed host sends are
+// reported as error events.
+func (b *Bus) SendPeriodic(ctx context.Context, p Periodic) (*PeriodicTask, error) {
+	if err := b.alive(); err != nil {
+		return nil, err
+	}
+	if b.listenOnly {
+		return nil, ErrListenOnly
+	}
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	if p.Frame.FD && b.capsKnown && !b.caps.FD {
+		return nil, ErrFDNotSupported
+	}
+	t := &PeriodicTask{bus: b, done: make(chan struct{}), p: p, index: -1}
+	s := &b.sched
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil, b.alive()
+	}
+	if s.wake == nil {
+		s.wake = make(chan struct{}, 1)
+		s.all = make(map[*PeriodicTask]struct{})
+		go b.runScheduler()
+	}
+	t.next = time.Now().Add(p.Offset)
+	heap.Push(&s.tasks, t)
+	s.all[t] = struct{}{}
+	s.mu.Unlock()
+	s.poke()
+	context.AfterFunc(ctx, t.Stop)
+	return t, nil
+}
+
+// Update replaces the task's frame, period, count, burst and Prepare
+// callback from the next cycle on; Offset is ignored. Counts carry on:
+// Prepare keeps numbering transmissions, and Count includes the cycles
+// already sent.
+func (t *PeriodicTask) Update(p Periodic) error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+	s := &t.bus.sched
+	s.mu.Lock()
+	if t.stopped {
+		s.mu.Unlock()
+		return ErrClosed
+	}
+	old := t.p
+	t.p = p
+	t.gen++
+	hw := t.hw
+	switch {
+	case hw == nil:
+		if p.Count > 0 && t.cycles >= p.Count {
+			t.finish()
+			s.mu.Unlock()
+			return nil
+		}
+		if p.Period != old.Period && t.index >= 0 {
+			t.next = t.next.Add(p.Period - old.Period)
+			heap.Fix(&s.tasks, t.index)
+		}
+		s.mu.Unlock()
+		s.poke()
+		return nil
+	case !p.offloadable() || p.Count != old.Count || p.Count > 0 && p.Period != old.Period:
+		// Back to the host, from the next period on, counting what the
+		// adapter sent.
+		n := t.hwCycles(time.Now())
+		t.cycles += n
+		t.sent += uint64(n)
+		t.hw = nil
+		if p.Count > 0 && t.cycles >= p.Count {
+			t.finish()
+			s.mu.Unlock()
+			return hw.Stop()
+		}
+		t.next = time.Now().Add(p.Period)
+		if t.index >= 0 {
+			heap.Fix(&s.tasks, t.index)
+		} else {
+			heap.Push(&s.tasks, t)
+		}
+		s.mu.Unlock()
+		s.poke()
+		return hw.Stop()
+	}
+	// The adapter carries on with its current cycle and takes the new
+	// period after it.
+	n := t.hwCycles(time.Now())
+	t.cycles += n
+	t.sent += uint64(n)
+	t.hwStart = t.hwStart.Add(time.Duration(n) * t.hwPeriod)
+	if t.hwCount > 0 {
+		t.hwCount -= n
+	}
+	t.hwPeriod = p.Period
+	s.mu.Unlock()
+	return hw.Update(p.Frame, p.Period)
+}
+
+// hwCycles returns how many cycles the adapter has sent since t.hwStart,
+// going by its period: one at the start and one each period after. Call
+// with the scheduler lock held.
+func (t *PeriodicTask) hwCycles(now time.Time) int {
+	if now.Before(t.hwStart) {
+		return 0
+	}
+	n := int(now.Sub(t.hwStart)/t.hwPeriod) + 1
+	if t.hwCount > 0 {
+		n = min(n, t.hwCount)
+	}
+	return n
+}
+
+// Stop stops the task. It is safe to call more than once.
+func (t *PeriodicTask) Stop() {
+	s := &t.bus.sched
+	s.mu.Lock()
+	hw := t.finish()
+	s.mu.Unlock()
+	if hw != nil {
+		hw.Stop()
+	}
+}
+
+// Done returns a channel that is closed when the task ends.
+func (t *PeriodicTask) Done() <-chan struct{} { return t.done }
+
+// finish unschedules the task and returns the adapter transmission to
+// stop, if any. Call with the scheduler lock held.
+func (t *PeriodicTask) finish() CyclicTx {
+	if t.stopped {
+		return nil
+	}
+	t.stopped = true
+	s := &t.bus.sched
+	if t.index >= 0 {
+		heap.Remove(&s.tasks, t.index)
+	}
+	delete(s.all, t)
+	close(t.done)
+	hw := t.hw
+	t.hw = nil
+	return hw
+}
+
+// scheduler runs a bus's periodic tasks from one goroutine, started with
+// the first task.
+type scheduler struct {
+	mu     sync.Mutex
+	tasks  taskHeap                   // host-sent tasks and offloaded ones with a Count
+	all    map[*PeriodicTask]struct{} // every live task
+	wake   chan struct{}
+	closed bool // the bus terminated
+}
+
+func (s *scheduler) poke() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (b *Bus) runScheduler() {
+	s := &b.sched
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		s.mu.Lock()
+		wait := time.Hour
+		if len(s.tasks) > 0 {
+			wait = time.Until(s.tasks[0].next)
+		}
+		s.mu.Unlock()
+		timer.Reset(wait)
+		select {
+		case <-b.ctx.Done():
+			s.mu.Lock()
+			s.closed = true
+			var hws []CyclicTx
+			for t := range s.all {
+				if hw := t.finish(); hw != nil {
+					hws = append(hws, hw)
+				}
+			}
+			s.mu.Unlock()
+			for _, hw := range hws {
+				hw.Stop()
+			}
+			return
+		case <-s.wake:
+		case <-timer.C:
+		}
+		for b.runDue() {
+		}
+	}
+}
+
+// runDue runs the earliest task if it is due, reporting whether it did.
+func (b *Bus) runDue() bool {
+	s := &b.sched
+	s.mu.Lock()
+	if len(s.tasks) == 0 || time.Until(s.tasks[0].next) > 0 {
+		s.mu.Unlock()
+		return false
+	}
+	t := s.tasks[0]
+	p := t.p
+	if t.hw != nil {
+		// An offloaded Count has run out.
+		hw := t.finish()
+		s.mu.Unlock()
+		hw.Stop()
+		return true
+	}
+	if cs, ok := b.adapter.(CyclicSender); ok && p.offloadable() && !t.hostOnly {
+		return b.startCyclic(cs, t)
+	}
+	n := t.sent
+	burst := max(p.Burst, 1)
+	t.sent += uint64(burst)
+	t.cycles++
+	if p.Count > 0 && t.cycles >= p.Count {
+		heap.Remove(&s.tasks, t.index)
+	} else {
+		t.next = t.next.Add(p.Period)
+		if behind := time.Since(t.next); behind > 0 {
+			t.next = t.next.Add((behind/p.Period + 1) * p.Period)
+		}
+		heap.Fix(&s.tasks, t.index)
+	}
+	last := t.index < 0
+	s.mu.Unlock()
+
+	var err error
+	for i := range burst {
+		f := p.Frame
+		if p.Prepare != nil {
+			p.Prepare(&f, n+uint64(i))
+		}
+		if err = b.Send(b.ctx, f); err != nil {
+			break
+		}
+	}
+
+	s.mu.Lock()
+	report := err != nil && !t.failing && b.alive() == nil
+	t.failing = err != nil
+	if last {
+		t.finish()
+	}
+	s.mu.Unlock()
+	if report {
+		b.Emit(Event{Type: EventTypeError, Details: fmt.Sprintf("periodic frame 0x%03X: %v", p.Frame.ID, err), Err: err})
+	}
+	return true
+}
+
+// startCyclic hands a due task to the adapter's scheduler. Called with the
+// scheduler lock held, which it releases.
+func (b *Bus) startCyclic(cs CyclicSender, t *PeriodicTask) bool {
+	s := &b.sched
+	p, gen := t.p, t.gen
+	count := p.Count
+	if count > 0 {
+		count -= t.cycles // cycles sent before an Update moved it here
+	}
+	heap.Remove(&s.tasks, t.index)
+	s.mu.Unlock()
+	start := time.Now()
+	hw, err := cs.StartCyclic(p.Frame, p.Period, count)
+	s.mu.Lock()
+	started := err == nil && !t.stopped && t.gen == gen
+	if started {
+		t.hw = hw
+		t.hwStart, t.hwPeriod, t.hwCount = start, p.Period, count
+		if count > 0 {
+			// Back in the heap to end the task once the count runs out.
+			t.next = t.next.Add(time.Duration(count) * p.Period)
+			heap.Push(&s.tasks, t)
+		}
+	} else if !t.stopped {
+		// Refused, or updated while starting: the host sends this cycle.
+		t.hostOnly = err != nil
+		heap.Push(&s.tasks, t)
+	}
+	s.mu.Unlock()
+	switch {
+	case err != nil:
+		b.Emit(Event{Type: EventTypeDebug, Details: fmt.Sprintf("periodic frame 0x%03X sent from the host: %v", p.Frame.ID, err), Err: err})
+	case !started:
+		hw.Stop()
+	}
+	return true
+}
+
+// taskHeap orders tasks by their next cycle.
+type taskHeap []*PeriodicTask
+
+func (h taskHeap) Len() int           { return len(h) }
+func (h taskHeap) Less(i, j int) bool { return h[i].next.Before(h[j].next) }
+func (h taskHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *taskHeap) Push(x any) {
+	t := x.(*PeriodicTask)
+	t.index = len(*h)
+	*h = append(*h, t)
+}
+
+func (h *taskHeap) Pop() any {
+	old := *h
+	t := old[len(old)-1]
+	old[len(old)-1] = nil
+	t.index = -1
+	*h = old[:len(old)-1]
+	return t
+}
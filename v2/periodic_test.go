@@ -0,0 +1,276 @@
+package gocan
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSendPeriodic(t *testing.T) {
+	bus := openLoopback(t)
+	ctx := context.Background()
+	ch := bus.Subscribe(ctx, 0x3E0)
+
+	start := time.Now()
+	task, err := bus.SendPeriodic(ctx, Periodic{
+		Frame:  NewFrame(0x3E0, []byte{0, 0}),
+		Period: 5 * time.Millisecond,
+		Offset: 10 * time.Millisecond,
+		Count:  4,
+		Burst:  2,
+		Prepare: func(f *Frame, n uint64) {
+			f.Data[0] = byte(n)          // rolling counter
+			f.Data[1] = 0xFF - f.Data[0] // checksum
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-task.Done()
+	if d := time.Since(start); d < 25*time.Millisecond {
+		t.Fatalf("4 cycles after a 10ms offset took only %v", d)
+	}
+	for n := range 8 {
+		select {
+		case f := <-ch:
+			if f.Data[0] != byte(n) || f.Data[1] != 0xFF-byte(n) {
+				t.Fatalf("frame %d: %s", n, f)
+			}
+		default:
+			t.Fatalf("got %d of 8 frames", n)
+		}
+	}
+	select {
+	case f := <-ch:
+		t.Fatalf("frame after the count ran out: %s", f)
+	default:
+	}
+
+	if _, err := bus.SendPeriodic(ctx, Periodic{Frame: NewFrame(0x3E0, nil)}); err == nil {
+		t.Fatal("zero period accepted")
+	}
+}
+
+func TestPeriodicUpdateStop(t *testing.T) {
+	bus := openLoopback(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := bus.Subscribe(ctx, 0x100)
+	task, err := bus.SendPeriodic(ctx, Periodic{Frame: NewFrame(0x100, []byte{1}), Period: 2 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-ch
+	if err := task.Update(Periodic{Frame: NewFrame(0x100, []byte{2}), Period: 2 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	for f := range ch {
+		if f.Data[0] == 2 {
+			break
+		}
+	}
+	cancel()
+	select {
+	case <-task.Done():
+	case <-time.After(time.Second):
+		t.Fatal("task outlived its context")
+	}
+	if err := task.Update(Periodic{Frame: NewFrame(0x100, nil), Period: time.Millisecond}); !errors.Is(err, ErrClosed) {
+		t.Fatalf("update after stop: %v", err)
+	}
+}
+
+func TestPeriodicUpdateCountReached(t *testing.T) {
+	bus := openLoopback(t)
+	ctx := t.Context()
+	ch := bus.Subscribe(ctx, 0x100)
+	task, err := bus.SendPeriodic(ctx, Periodic{Frame: NewFrame(0x100, nil), Period: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-ch
+	<-ch
+	if err := task.Update(Periodic{Frame: NewFrame(0x100, nil), Period: 20 * time.Millisecond, Count: 1}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-task.Done():
+	default:
+		t.Fatal("task carried on past its new count")
+	}
+	select {
+	case f := <-ch:
+		t.Fatalf("frame after the count ran out: %s", f)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// cyclic is a loopback with an emulated cyclic transmit scheduler.
+type cyclic struct {
+	Loopback
+
+	mu     sync.Mutex
+	refuse bool
+	jobs   []*cyclicJob
+}
+
+type cyclicJob struct {
+	f       Frame
+	period  time.Duration
+	count   int
+	stopped bool
+}
+
+func (c *cyclic) StartCyclic(f Frame, period time.Duration, count int) (CyclicTx, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.refuse {
+		return nil, errors.ErrUnsupported
+	}
+	j := &cyclicJob{f: f, period: period, count: count}
+	c.jobs = append(c.jobs, j)
+	return &cyclicHandle{c, j}, nil
+}
+
+type cyclicHandle struct {
+	c *cyclic
+	j *cyclicJob
+}
+
+func (h *cyclicHandle) Update(f Frame, period time.Duration) error {
+	h.c.mu.Lock()
+	defer h.c.mu.Unlock()
+	h.j.f, h.j.period = f, period
+	return nil
+}
+
+func (h *cyclicHandle) Stop() error {
+	h.c.mu.Lock()
+	defer h.c.mu.Unlock()
+	h.j.stopped = true
+	return nil
+}
+
+func TestPeriodicOffload(t *testing.T) {
+	hw := &cyclic{}
+	bus, err := OpenAdapter(context.Background(), hw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bus.Close()
+	ctx := context.Background()
+
+	task, err := bus.SendPeriodic(ctx, Periodic{Frame: NewFrame(0x200, []byte{1}), Period: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool {
+		hw.mu.Lock()
+		defer hw.mu.Unlock()
+		return len(hw.jobs) == 1
+	})
+	if err := task.Update(Periodic{Frame: NewFrame(0x200, []byte{2}), Period: 50 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	hw.mu.Lock()
+	j := *hw.jobs[0]
+	hw.mu.Unlock()
+	if j.f.Data[0] != 2 || j.period != 50*time.Millisecond || j.stopped {
+		t.Fatalf("update not passed on: %+v", j)
+	}
+
+	// A counter needs the host.
+	ch := bus.Subscribe(ctx, 0x200)
+	err = task.Update(Periodic{Frame: NewFrame(0x200, []byte{3}), Period: time.Millisecond,
+		Prepare: func(f *Frame, n uint64) { f.Data[1] = byte(n) }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := <-ch; f.Data[0] != 3 {
+		t.Fatalf("host sent %s", f)
+	}
+	hw.mu.Lock()
+	stopped := hw.jobs[0].stopped
+	hw.mu.Unlock()
+	if !stopped {
+		t.Fatal("adapter job left running")
+	}
+	task.Stop()
+
+	// Adapters may refuse; the host takes over.
+	hw.mu.Lock()
+	hw.refuse = true
+	hw.mu.Unlock()
+	task, err = bus.SendPeriodic(ctx, Periodic{Frame: NewFrame(0x300, nil), Period: time.Millisecond, Count: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-task.Done()
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+	if len(hw.jobs) != 1 {
+		t.Fatalf("want no new adapter jobs, got %d", len(hw.jobs))
+	}
+}
+
+// TestPeriodicOffloadCount checks that a Count set while the adapter is
+// sending includes the cycles it already sent.
+func TestPeriodicOffloadCount(t *testing.T) {
+	hw := &cyclic{}
+	bus, err := OpenAdapter(context.Background(), hw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bus.Close()
+
+	task, err := bus.SendPeriodic(context.Background(), Periodic{Frame: NewFrame(0x200, nil), Period: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool {
+		hw.mu.Lock()
+		defer hw.mu.Unlock()
+		return len(hw.jobs) == 1
+	})
+	time.Sleep(55 * time.Millisecond) // about six cycles
+	if err := task.Update(Periodic{Frame: NewFrame(0x200, nil), Period: 10 * time.Millisecond, Count: 40}); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool {
+		hw.mu.Lock()
+		defer hw.mu.Unlock()
+		return len(hw.jobs) == 2
+	})
+	hw.mu.Lock()
+	first, second := *hw.jobs[0], *hw.jobs[1]
+	hw.mu.Unlock()
+	if !first.stopped {
+		t.Fatal("first adapter job left running")
+	}
+	if second.count < 20 || second.count > 35 {
+		t.Fatalf("want the count less the cycles already sent, adapter got %d", second.count)
+	}
+
+	// A count the adapter has already reached ends the task.
+	if err := task.Update(Periodic{Frame: NewFrame(0x200, nil), Period: 10 * time.Millisecond, Count: 1}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-task.Done():
+	case <-time.After(time.Second):
+		t.Fatal("task still running past its count")
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
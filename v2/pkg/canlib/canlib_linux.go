@@ -199,6 +199,18 @@ const (
 	MSG_TXNACK      MsgFlag = 0x2000000
 	MSG_ABL         MsgFlag = 0x4000000
 
+	MSGERR_MASK       MsgFlag = 0xff00
+	MSGERR_HW_OVERRUN MsgFlag = 0x200
+	MSGERR_SW_OVERRUN MsgFlag = 0x400
+	MSGERR_STUFF      MsgFlag = 0x800
+	MSGERR_FORM       MsgFlag = 0x1000
+	MSGERR_CRC        MsgFlag = 0x2000
+	MSGERR_BIT0       MsgFlag = 0x4000
+	MSGERR_BIT1       MsgFlag = 0x8000
+	MSGERR_OVERRUN    MsgFlag = 0x600
+	MSGERR_BIT        MsgFlag = 0xC000
+	MSGERR_BUSERR     MsgFlag = 0xF800
+
 	FDMSG_MASK MsgFlag = 0xff0000
 	FDMSG_EDL  MsgFlag = 0x10000
 	FDMSG_FDF  MsgFlag = 0x10000
@@ -206,6 +218,23 @@ const (
 	FDMSG_ESI  MsgFlag = 0x40000
 )
 
+// StatusFlag is a canReadStatus flag.
+type StatusFlag uint32
+
+const (
+	STAT_ERROR_PASSIVE StatusFlag = 0x1
+	STAT_BUS_OFF       StatusFlag = 0x2
+	STAT_ERROR_WARNING StatusFlag = 0x4
+	STAT_ERROR_ACTIVE  StatusFlag = 0x8
+	STAT_TX_PENDING    StatusFlag = 0x10
+	STAT_RX_PENDING    StatusFlag = 0x20
+	STAT_TXERR         StatusFlag = 0x80
+	STAT_RXERR         StatusFlag = 0x100
+	STAT_HW_OVERRUN    StatusFlag = 0x200
+	STAT_SW_OVERRUN    StatusFlag = 0x400
+	STAT_OVERRUN       StatusFlag = 0x600
+)
+
 func (h Handle) ObjBufWrite(idx, id int, message []byte, flags MsgFlag) error {
 	if len(message) == 0 {
 		return checkErr(C.canObjBufWrite(C.CanHandle(h), C.int(idx), C.int(id), nil, 0, C.uint(flags)))
@@ -231,6 +260,17 @@ const (
 	BITRATE_10K  BusParamsFreq = -0x09
 )
 
+// Predefined CAN FD bus parameters, with the sample point in percent. Use the
+// 80P arbitration rates with SetBusParams and any of them with
+// SetBusParamsFd on channels opened with OPEN_CAN_FD.
+const (
+	FD_BITRATE_500K_80P BusParamsFreq = -1000
+	FD_BITRATE_1M_80P   BusParamsFreq = -1001
+	FD_BITRATE_2M_80P   BusParamsFreq = -1002
+	FD_BITRATE_4M_80P   BusParamsFreq = -1003
+	FD_BITRATE_8M_60P   BusParamsFreq = -1004
+)
+
 func (h Handle) SetAcceptanceFilter(code, mask uint, extended bool) error {
 	var ext C.int
 	if extended {
@@ -252,6 +292,13 @@ func (h Handle) SetBusParams(freq BusParamsFreq, tseg1, tseg2, sjw, noSamp, sync
 	return checkErr(C.canSetBusParams(C.CanHandle(h), C.long(freq), C.uint(tseg1), C.uint(tseg2), C.uint(sjw), C.uint(noSamp), C.uint(syncmode)))
 }
 
+// SetBusParamsFd sets the CAN FD data phase bus timing; the channel must be
+// opened with OPEN_CAN_FD. tseg1, tseg2 and sjw default when freq is one of
+// the FD_BITRATE constants.
+func (h Handle) SetBusParamsFd(freq BusParamsFreq, tseg1, tseg2, sjw uint32) error {
+	return checkErr(C.canSetBusParamsFd(C.CanHandle(h), C.long(freq), C.uint(tseg1), C.uint(tseg2), C.uint(sjw)))
+}
+
 func (h Handle) SetBusParamsC200(btr0, btr1 uint8) error {
 	return checkErr(C.canSetBusParamsC200(C.CanHandle(h), C.uchar(btr0), C.uchar(btr1)))
 }
@@ -275,6 +322,13 @@ func (h Handle) ReadErrorCounters() (uint32, uint32, uint32, error) {
 	return uint32(tx), uint32(rx), uint32(overrun), NewError(int32(r))
 }
 
+// ReadStatus returns the circuit's status flags.
+func (h Handle) ReadStatus() (StatusFlag, error) {
+	var flags C.ulong
+	r := C.canReadStatus(C.CanHandle(h), &flags)
+	return StatusFlag(flags), NewError(int32(r))
+}
+
 func (h Handle) Read() (*CANMessage, error) {
 	var (
 		id    C.long
@@ -29,8 +29,10 @@ var (
 		"canSetBitrate":          &procSetBitrate,
 		"canSetBusParams":        &procSetBusParams,
 		"canSetBusParamsC200":    &procSetBusParamsC200,
+		"canSetBusParamsFd":      &procSetBusParamsFd,
 		"canSetBusOutputControl": &procSetBusOutputControl,
 		"canReadErrorCounters":   &procReadErrorCounters,
+		"canReadStatus":          &procReadStatus,
 		"canRead":                &procRead,
 		"canReadWait":            &procReadWait,
 		"canWrite":               &procWrite,
@@ -89,8 +91,10 @@ var (
 	procSetBitrate          *syscall.Proc
 	procSetBusParams        *syscall.Proc
 	procSetBusParamsC200    *syscall.Proc
+	procSetBusParamsFd      *syscall.Proc
 	procSetBusOutputControl *syscall.Proc
 	procReadErrorCounters   *syscall.Proc
+	procReadStatus          *syscall.Proc
 	procRead                *syscall.Proc
 	procReadWait            *syscall.Proc
 	procWrite               *syscall.Proc
@@ -288,6 +292,18 @@ const (
 	MSG_TXNACK      MsgFlag = 0x2000000
 	MSG_ABL         MsgFlag = 0x4000000
 
+	MSGERR_MASK       MsgFlag = 0xff00
+	MSGERR_HW_OVERRUN MsgFlag = 0x200
+	MSGERR_SW_OVERRUN MsgFlag = 0x400
+	MSGERR_STUFF      MsgFlag = 0x800
+	MSGERR_FORM       MsgFlag = 0x1000
+	MSGERR_CRC        MsgFlag = 0x2000
+	MSGERR_BIT0       MsgFlag = 0x4000
+	MSGERR_BIT1       MsgFlag = 0x8000
+	MSGERR_OVERRUN    MsgFlag = 0x600
+	MSGERR_BIT        MsgFlag = 0xC000
+	MSGERR_BUSERR     MsgFlag = 0xF800
+
 	FDMSG_MASK MsgFlag = 0xff0000
 	FDMSG_EDL  MsgFlag = 0x10000
 	FDMSG_FDF  MsgFlag = 0x10000
@@ -295,6 +311,23 @@ const (
 	FDMSG_ESI  MsgFlag = 0x40000
 )
 
+// StatusFlag is a canReadStatus flag.
+type StatusFlag uint32
+
+const (
+	STAT_ERROR_PASSIVE StatusFlag = 0x1
+	STAT_BUS_OFF       StatusFlag = 0x2
+	STAT_ERROR_WARNING StatusFlag = 0x4
+	STAT_ERROR_ACTIVE  StatusFlag = 0x8
+	STAT_TX_PENDING    StatusFlag = 0x10
+	STAT_RX_PENDING    StatusFlag = 0x20
+	STAT_TXERR         StatusFlag = 0x80
+	STAT_RXERR         StatusFlag = 0x100
+	STAT_HW_OVERRUN    StatusFlag = 0x200
+	STAT_SW_OVERRUN    StatusFlag = 0x400
+	STAT_OVERRUN       StatusFlag = 0x600
+)
+
 func (hnd Handle) ObjBufWrite(idx, id int, message []byte, flags MsgFlag) error {
 	return checkErr(procObjBufWrite.Call(uintptr(hnd), uintptr(idx), uintptr(id), uintptr(unsafe.Pointer(&message[0])), uintptr(len(message)), uintptr(flags)))
 }
@@ -319,6 +352,17 @@ const (
 	BITRATE_10K  BusParamsFreq = -0x09
 )
 
+// Predefined CAN FD bus parameters, with the sample point in percent. Use the
+// 80P arbitration rates with SetBusParams and any of them with
+// SetBusParamsFd on channels opened with OPEN_CAN_FD.
+const (
+	FD_BITRATE_500K_80P BusParamsFreq = -1000
+	FD_BITRATE_1M_80P   BusParamsFreq = -1001
+	FD_BITRATE_2M_80P   BusParamsFreq = -1002
+	FD_BITRATE_4M_80P   BusParamsFreq = -1003
+	FD_BITRATE_8M_60P   BusParamsFreq = -1004
+)
+
 // This routine sets the message acceptance filters on a CAN channel.
 //
 // Format of code and mask:
@@ -364,6 +408,12 @@ func (hnd Handle) SetBusParams(freq BusParamsFreq, tseg1, tseg2, sjw, noSamp, sy
 	return checkErr(procSetBusParams.Call(uintptr(hnd), uintptr(freq), uintptr(tseg1), uintptr(tseg2), uintptr(sjw), uintptr(noSamp), uintptr(syncmode)))
 }
 
+// This function sets the data phase bus timing parameters for a CAN FD channel, which must have been opened with canOPEN_CAN_FD.
+// The library provides default values for tseg1, tseg2 and sjw when freq is one of the canFD_BITRATE_xxx constants.
+func (hnd Handle) SetBusParamsFd(freq BusParamsFreq, tseg1, tseg2, sjw uint32) error {
+	return checkErr(procSetBusParamsFd.Call(uintptr(hnd), uintptr(freq), uintptr(tseg1), uintptr(tseg2), uintptr(sjw)))
+}
+
 // This function sets the bus timing parameters using the same convention as the 82c200 CAN controller (which is the same as many other CAN controllers, for example, the 82527.)
 // To calculate the bit timing parameters, you can use the bit timing calculator that is included with CANlib SDK. Look in the BIN directory.
 func (hnd Handle) SetBusParamsC200(btr0, btr1 uint8) error {
@@ -395,6 +445,13 @@ func (hnd Handle) ReadErrorCounters() (uint32, uint32, uint32, error) {
 	return tx, rx, overrun, NewError(int32(r1))
 }
 
+// ReadStatus returns the circuit's status flags.
+func (hnd Handle) ReadStatus() (StatusFlag, error) {
+	var flags uint32
+	r1, _, _ := procReadStatus.Call(uintptr(hnd), uintptr(unsafe.Pointer(&flags)))
+	return StatusFlag(flags), NewError(int32(r1))
+}
+
 func (hnd Handle) Read() (*CANMessage, error) {
 	msg := &CANMessage{
 		Data: make([]byte, 64),
@@ -222,6 +222,17 @@ func (ch *CANHANDLE) Status() error {
 	return &Error{ErrorCode(status), "Unknown"}
 }
 
+// StatusFlags returns the raw CANSTATUS_* bits for the channel: all of
+// them, where Status reports only the first.
+func (ch *CANHANDLE) StatusFlags() (int32, error) {
+	r1, _, _ := procStatus.Call(uintptr(ch.h))
+	status := int32(r1)
+	if err := NewError(status); err != nil {
+		return 0, err
+	}
+	return status, nil
+}
+
 // Get hardware/firmware and driver version for channel
 func (ch *CANHANDLE) VersionInfo() (string, error) {
 	data := make([]byte, 64)
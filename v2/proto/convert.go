@@ -0,0 +1,84 @@
+package proto
+
+import (
+	"errors"
+	"time"
+
+	gocan "github.com/roffe/gocan/v2"
+)
+
+// FromFrame converts a gocan frame for the wire. Received frames keep their
+// timestamp; frames to send have none.
+func FromFrame(f gocan.Frame) *CANFrame {
+	m := &CANFrame{
+		Id:       f.ID,
+		Data:     f.Bytes(),
+		Extended: f.Extended,
+		Remote:   f.Remote,
+		Fd:       f.FD,
+		Brs:      f.BRS,
+		Esi:      f.ESI,
+	}
+	if f.TimestampSource != gocan.TimestampNone {
+		m.Timestamp, m.TimestampSource = f.Timestamp.UnixNano(), uint32(f.TimestampSource)
+	}
+	return m
+}
+
+// Frame converts m to a gocan frame. Data beyond what the frame format can
+// carry is truncated.
+func (m *CANFrame) Frame() gocan.Frame {
+	f := gocan.Frame{
+		ID:       m.GetId(),
+		Extended: m.GetExtended(),
+		Remote:   m.GetRemote(),
+		FD:       m.GetFd(),
+		BRS:      m.GetBrs(),
+		ESI:      m.GetEsi(),
+	}
+	n := 8
+	if f.FD {
+		n = gocan.MaxFDLength
+	}
+	f.Length = uint8(copy(f.Data[:n], m.GetData()))
+	if src := gocan.TimestampSource(m.GetTimestampSource()); src != gocan.TimestampNone {
+		f.Timestamp, f.TimestampSource = time.Unix(0, m.GetTimestamp()), src
+	}
+	return f
+}
+
+// FromEvent converts a gocan event for the wire. The structured Status of
+// bus events does not travel; Details describes it.
+func FromEvent(e gocan.Event) *Event {
+	level := EventLevel_EVENT_DEBUG
+	switch e.Type {
+	case gocan.EventTypeInfo:
+		level = EventLevel_EVENT_INFO
+	case gocan.EventTypeWarning:
+		level = EventLevel_EVENT_WARN
+	case gocan.EventTypeError:
+		level = EventLevel_EVENT_ERROR
+	case gocan.EventTypeFatal:
+		level = EventLevel_EVENT_FATAL
+	}
+	return &Event{Level: level, Message: e.Details, Kind: uint32(e.Kind)}
+}
+
+// Event converts m to a gocan event. Error and fatal events carry their
+// message as Err.
+func (m *Event) Event() gocan.Event {
+	e := gocan.Event{Details: m.GetMessage(), Kind: gocan.EventKind(m.GetKind())}
+	switch m.GetLevel() {
+	case EventLevel_EVENT_INFO:
+		e.Type = gocan.EventTypeInfo
+	case EventLevel_EVENT_WARN:
+		e.Type = gocan.EventTypeWarning
+	case EventLevel_EVENT_ERROR:
+		e.Type, e.Err = gocan.EventTypeError, errors.New(m.GetMessage())
+	case EventLevel_EVENT_FATAL:
+		e.Type, e.Err = gocan.EventTypeFatal, errors.New(m.GetMessage())
+	default:
+		e.Type = gocan.EventTypeDebug
+	}
+	return e
+}
@@ -0,0 +1,927 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        v7.35.0
+// source: v2/proto/server.proto
+
+package proto
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	emptypb "google.golang.org/protobuf/types/known/emptypb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type CANFrameTypeEnum int32
+
+const (
+	CANFrameTypeEnum_Incoming                 CANFrameTypeEnum = 0
+	CANFrameTypeEnum_Outgoing                 CANFrameTypeEnum = 1
+	CANFrameTypeEnum_OutgoingResponseRequired CANFrameTypeEnum = 2
+)
+
+// Enum value maps for CANFrameTypeEnum.
+var (
+	CANFrameTypeEnum_name = map[int32]string{
+		0: "Incoming",
+		1: "Outgoing",
+		2: "OutgoingResponseRequired",
+	}
+	CANFrameTypeEnum_value = map[string]int32{
+		"Incoming":                 0,
+		"Outgoing":                 1,
+		"OutgoingResponseRequired": 2,
+	}
+)
+
+func (x CANFrameTypeEnum) Enum() *CANFrameTypeEnum {
+	p := new(CANFrameTypeEnum)
+	*p = x
+	return p
+}
+
+func (x CANFrameTypeEnum) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (CANFrameTypeEnum) Descriptor() protoreflect.EnumDescriptor {
+	return file_v2_proto_server_proto_enumTypes[0].Descriptor()
+}
+
+func (CANFrameTypeEnum) Type() protoreflect.EnumType {
+	return &file_v2_proto_server_proto_enumTypes[0]
+}
+
+func (x CANFrameTypeEnum) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use CANFrameTypeEnum.Descriptor instead.
+func (CANFrameTypeEnum) EnumDescriptor() ([]byte, []int) {
+	return file_v2_proto_server_proto_rawDescGZIP(), []int{0}
+}
+
+// EventLevel mirrors gocan.EventType so adapter event severity survives the wire
+// instead of being collapsed to a single "info" system message.
+type EventLevel int32
+
+const (
+	EventLevel_EVENT_DEBUG EventLevel = 0
+	EventLevel_EVENT_INFO  EventLevel = 1
+	EventLevel_EVENT_WARN  EventLevel = 2
+	EventLevel_EVENT_ERROR EventLevel = 3
+	EventLevel_EVENT_FATAL EventLevel = 4
+)
+
+// Enum value maps for EventLevel.
+var (
+	EventLevel_name = map[int32]string{
+		0: "EVENT_DEBUG",
+		1: "EVENT_INFO",
+		2: "EVENT_WARN",
+		3: "EVENT_ERROR",
+		4: "EVENT_FATAL",
+	}
+	EventLevel_value = map[string]int32{
+		"EVENT_DEBUG": 0,
+		"EVENT_INFO":  1,
+		"EVENT_WARN":  2,
+		"EVENT_ERROR": 3,
+		"EVENT_FATAL": 4,
+	}
+)
+
+func (x EventLevel) Enum() *EventLevel {
+	p := new(EventLevel)
+	*p = x
+	return p
+}
+
+func (x EventLevel) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (EventLevel) Descriptor() protoreflect.EnumDescriptor {
+	return file_v2_proto_server_proto_enumTypes[1].Descriptor()
+}
+
+func (EventLevel) Type() protoreflect.EnumType {
+	return &file_v2_proto_server_proto_enumTypes[1]
+}
+
+func (x EventLevel) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use EventLevel.Descriptor instead.
+func (EventLevel) EnumDescriptor() ([]byte, []int) {
+	return file_v2_proto_server_proto_rawDescGZIP(), []int{1}
+}
+
+type Adapters struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Adapters      []*AdapterInfo         `protobuf:"bytes,1,rep,name=adapters,proto3" json:"adapters,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Adapters) Reset() {
+	*x = Adapters{}
+	mi := &file_v2_proto_server_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Adapters) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Adapters) ProtoMessage() {}
+
+func (x *Adapters) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_proto_server_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Adapters.ProtoReflect.Descriptor instead.
+func (*Adapters) Descriptor() ([]byte, []int) {
+	return file_v2_proto_server_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Adapters) GetAdapters() []*AdapterInfo {
+	if x != nil {
+		return x.Adapters
+	}
+	return nil
+}
+
+type AdapterInfo struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	Name              string                 `protobuf:"bytes,1,opt,name=Name,proto3" json:"Name,omitempty"`
+	Description       string                 `protobuf:"bytes,2,opt,name=Description,proto3" json:"Description,omitempty"`
+	Capabilities      *AdapterCapabilities   `protobuf:"bytes,3,opt,name=Capabilities,proto3" json:"Capabilities,omitempty"`
+	RequireSerialPort bool                   `protobuf:"varint,4,opt,name=RequireSerialPort,proto3" json:"RequireSerialPort,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *AdapterInfo) Reset() {
+	*x = AdapterInfo{}
+	mi := &file_v2_proto_server_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AdapterInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AdapterInfo) ProtoMessage() {}
+
+func (x *AdapterInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_proto_server_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AdapterInfo.ProtoReflect.Descriptor instead.
+func (*AdapterInfo) Descriptor() ([]byte, []int) {
+	return file_v2_proto_server_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *AdapterInfo) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *AdapterInfo) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *AdapterInfo) GetCapabilities() *AdapterCapabilities {
+	if x != nil {
+		return x.Capabilities
+	}
+	return nil
+}
+
+func (x *AdapterInfo) GetRequireSerialPort() bool {
+	if x != nil {
+		return x.RequireSerialPort
+	}
+	return false
+}
+
+type SerialPorts struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ports         []*SerialPort          `protobuf:"bytes,1,rep,name=ports,proto3" json:"ports,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SerialPorts) Reset() {
+	*x = SerialPorts{}
+	mi := &file_v2_proto_server_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SerialPorts) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SerialPorts) ProtoMessage() {}
+
+func (x *SerialPorts) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_proto_server_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SerialPorts.ProtoReflect.Descriptor instead.
+func (*SerialPorts) Descriptor() ([]byte, []int) {
+	return file_v2_proto_server_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *SerialPorts) GetPorts() []*SerialPort {
+	if x != nil {
+		return x.Ports
+	}
+	return nil
+}
+
+type SerialPort struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=Name,proto3" json:"Name,omitempty"`
+	Description   string                 `protobuf:"bytes,2,opt,name=Description,proto3" json:"Description,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SerialPort) Reset() {
+	*x = SerialPort{}
+	mi := &file_v2_proto_server_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SerialPort) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SerialPort) ProtoMessage() {}
+
+func (x *SerialPort) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_proto_server_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SerialPort.ProtoReflect.Descriptor instead.
+func (*SerialPort) Descriptor() ([]byte, []int) {
+	return file_v2_proto_server_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *SerialPort) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *SerialPort) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+type AdapterCapabilities struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	HSCAN         bool                   `protobuf:"varint,1,opt,name=HSCAN,proto3" json:"HSCAN,omitempty"`
+	SWCAN         bool                   `protobuf:"varint,2,opt,name=SWCAN,proto3" json:"SWCAN,omitempty"`
+	KLine         bool                   `protobuf:"varint,3,opt,name=KLine,proto3" json:"KLine,omitempty"`
+	FD            bool                   `protobuf:"varint,4,opt,name=FD,proto3" json:"FD,omitempty"`
+	ListenOnly    bool                   `protobuf:"varint,5,opt,name=ListenOnly,proto3" json:"ListenOnly,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AdapterCapabilities) Reset() {
+	*x = AdapterCapabilities{}
+	mi := &file_v2_proto_server_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AdapterCapabilities) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AdapterCapabilities) ProtoMessage() {}
+
+func (x *AdapterCapabilities) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_proto_server_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AdapterCapabilities.ProtoReflect.Descriptor instead.
+func (*AdapterCapabilities) Descriptor() ([]byte, []int) {
+	return file_v2_proto_server_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *AdapterCapabilities) GetHSCAN() bool {
+	if x != nil {
+		return x.HSCAN
+	}
+	return false
+}
+
+func (x *AdapterCapabilities) GetSWCAN() bool {
+	if x != nil {
+		return x.SWCAN
+	}
+	return false
+}
+
+func (x *AdapterCapabilities) GetKLine() bool {
+	if x != nil {
+		return x.KLine
+	}
+	return false
+}
+
+func (x *AdapterCapabilities) GetFD() bool {
+	if x != nil {
+		return x.FD
+	}
+	return false
+}
+
+func (x *AdapterCapabilities) GetListenOnly() bool {
+	if x != nil {
+		return x.ListenOnly
+	}
+	return false
+}
+
+type Command struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Data          []byte                 `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Command) Reset() {
+	*x = Command{}
+	mi := &file_v2_proto_server_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Command) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Command) ProtoMessage() {}
+
+func (x *Command) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_proto_server_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Command.ProtoReflect.Descriptor instead.
+func (*Command) Descriptor() ([]byte, []int) {
+	return file_v2_proto_server_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Command) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type CommandResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Data          []byte                 `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CommandResponse) Reset() {
+	*x = CommandResponse{}
+	mi := &file_v2_proto_server_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CommandResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CommandResponse) ProtoMessage() {}
+
+func (x *CommandResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_proto_server_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CommandResponse.ProtoReflect.Descriptor instead.
+func (*CommandResponse) Descriptor() ([]byte, []int) {
+	return file_v2_proto_server_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *CommandResponse) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+// CANFrame is the flat representation of a single CAN frame. Frame-type and
+// response-count are inlined (previously a nested CANFrameType message) so the
+// hot streaming path allocates a single message with scalar (value) fields.
+type CANFrame struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Id        uint32                 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Data      []byte                 `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	FrameType CANFrameTypeEnum       `protobuf:"varint,3,opt,name=frame_type,json=frameType,proto3,enum=gocan.v2.CANFrameTypeEnum" json:"frame_type,omitempty"`
+	Responses uint32                 `protobuf:"varint,4,opt,name=responses,proto3" json:"responses,omitempty"`
+	Extended  bool                   `protobuf:"varint,5,opt,name=extended,proto3" json:"extended,omitempty"`
+	Remote    bool                   `protobuf:"varint,6,opt,name=remote,proto3" json:"remote,omitempty"`
+	Fd        bool                   `protobuf:"varint,7,opt,name=fd,proto3" json:"fd,omitempty"`
+	Brs       bool                   `protobuf:"varint,8,opt,name=brs,proto3" json:"brs,omitempty"`
+	Esi       bool                   `protobuf:"varint,9,opt,name=esi,proto3" json:"esi,omitempty"`
+	// timestamp is when an incoming frame came off the bus, in Unix
+	// nanoseconds, and timestamp_source the gocan.TimestampSource that took it.
+	Timestamp       int64  `protobuf:"varint,10,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	TimestampSource uint32 `protobuf:"varint,11,opt,name=timestamp_source,json=timestampSource,proto3" json:"timestamp_source,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *CANFrame) Reset() {
+	*x = CANFrame{}
+	mi := &file_v2_proto_server_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CANFrame) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CANFrame) ProtoMessage() {}
+
+func (x *CANFrame) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_proto_server_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CANFrame.ProtoReflect.Descriptor instead.
+func (*CANFrame) Descriptor() ([]byte, []int) {
+	return file_v2_proto_server_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *CANFrame) GetId() uint32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *CANFrame) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *CANFrame) GetFrameType() CANFrameTypeEnum {
+	if x != nil {
+		return x.FrameType
+	}
+	return CANFrameTypeEnum_Incoming
+}
+
+func (x *CANFrame) GetResponses() uint32 {
+	if x != nil {
+		return x.Responses
+	}
+	return 0
+}
+
+func (x *CANFrame) GetExtended() bool {
+	if x != nil {
+		return x.Extended
+	}
+	return false
+}
+
+func (x *CANFrame) GetRemote() bool {
+	if x != nil {
+		return x.Remote
+	}
+	return false
+}
+
+func (x *CANFrame) GetFd() bool {
+	if x != nil {
+		return x.Fd
+	}
+	return false
+}
+
+func (x *CANFrame) GetBrs() bool {
+	if x != nil {
+		return x.Brs
+	}
+	return false
+}
+
+func (x *CANFrame) GetEsi() bool {
+	if x != nil {
+		return x.Esi
+	}
+	return false
+}
+
+func (x *CANFrame) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+func (x *CANFrame) GetTimestampSource() uint32 {
+	if x != nil {
+		return x.TimestampSource
+	}
+	return 0
+}
+
+type Event struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Level   EventLevel             `protobuf:"varint,1,opt,name=level,proto3,enum=gocan.v2.EventLevel" json:"level,omitempty"`
+	Message string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	// kind is the gocan.EventKind of v2 events, 0 (a plain message) otherwise.
+	Kind          uint32 `protobuf:"varint,3,opt,name=kind,proto3" json:"kind,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_v2_proto_server_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_proto_server_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_v2_proto_server_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *Event) GetLevel() EventLevel {
+	if x != nil {
+		return x.Level
+	}
+	return EventLevel_EVENT_DEBUG
+}
+
+func (x *Event) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *Event) GetKind() uint32 {
+	if x != nil {
+		return x.Kind
+	}
+	return 0
+}
+
+// StreamMessage is what the gateway sends to the client: either a CAN frame or a
+// typed event/error. The client→gateway direction stays a plain CANFrame.
+type StreamMessage struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Payload:
+	//
+	//	*StreamMessage_Frame
+	//	*StreamMessage_Event
+	Payload       isStreamMessage_Payload `protobuf_oneof:"payload"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StreamMessage) Reset() {
+	*x = StreamMessage{}
+	mi := &file_v2_proto_server_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StreamMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StreamMessage) ProtoMessage() {}
+
+func (x *StreamMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_proto_server_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StreamMessage.ProtoReflect.Descriptor instead.
+func (*StreamMessage) Descriptor() ([]byte, []int) {
+	return file_v2_proto_server_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *StreamMessage) GetPayload() isStreamMessage_Payload {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *StreamMessage) GetFrame() *CANFrame {
+	if x != nil {
+		if x, ok := x.Payload.(*StreamMessage_Frame); ok {
+			return x.Frame
+		}
+	}
+	return nil
+}
+
+func (x *StreamMessage) GetEvent() *Event {
+	if x != nil {
+		if x, ok := x.Payload.(*StreamMessage_Event); ok {
+			return x.Event
+		}
+	}
+	return nil
+}
+
+type isStreamMessage_Payload interface {
+	isStreamMessage_Payload()
+}
+
+type StreamMessage_Frame struct {
+	Frame *CANFrame `protobuf:"bytes,1,opt,name=frame,proto3,oneof"`
+}
+
+type StreamMessage_Event struct {
+	Event *Event `protobuf:"bytes,2,opt,name=event,proto3,oneof"`
+}
+
+func (*StreamMessage_Frame) isStreamMessage_Payload() {}
+
+func (*StreamMessage_Event) isStreamMessage_Payload() {}
+
+var File_v2_proto_server_proto protoreflect.FileDescriptor
+
+const file_v2_proto_server_proto_rawDesc = "" +
+	"\n" +
+	"\x15v2/proto/server.proto\x12\bgocan.v2\x1a\x1bgoogle/protobuf/empty.proto\"=\n" +
+	"\bAdapters\x121\n" +
+	"\badapters\x18\x01 \x03(\v2\x15.gocan.v2.AdapterInfoR\badapters\"\xb4\x01\n" +
+	"\vAdapterInfo\x12\x12\n" +
+	"\x04Name\x18\x01 \x01(\tR\x04Name\x12 \n" +
+	"\vDescription\x18\x02 \x01(\tR\vDescription\x12A\n" +
+	"\fCapabilities\x18\x03 \x01(\v2\x1d.gocan.v2.AdapterCapabilitiesR\fCapabilities\x12,\n" +
+	"\x11RequireSerialPort\x18\x04 \x01(\bR\x11RequireSerialPort\"9\n" +
+	"\vSerialPorts\x12*\n" +
+	"\x05ports\x18\x01 \x03(\v2\x14.gocan.v2.SerialPortR\x05ports\"B\n" +
+	"\n" +
+	"SerialPort\x12\x12\n" +
+	"\x04Name\x18\x01 \x01(\tR\x04Name\x12 \n" +
+	"\vDescription\x18\x02 \x01(\tR\vDescription\"\x87\x01\n" +
+	"\x13AdapterCapabilities\x12\x14\n" +
+	"\x05HSCAN\x18\x01 \x01(\bR\x05HSCAN\x12\x14\n" +
+	"\x05SWCAN\x18\x02 \x01(\bR\x05SWCAN\x12\x14\n" +
+	"\x05KLine\x18\x03 \x01(\bR\x05KLine\x12\x0e\n" +
+	"\x02FD\x18\x04 \x01(\bR\x02FD\x12\x1e\n" +
+	"\n" +
+	"ListenOnly\x18\x05 \x01(\bR\n" +
+	"ListenOnly\"\x1d\n" +
+	"\aCommand\x12\x12\n" +
+	"\x04data\x18\x01 \x01(\fR\x04data\"%\n" +
+	"\x0fCommandResponse\x12\x12\n" +
+	"\x04data\x18\x01 \x01(\fR\x04data\"\xb8\x02\n" +
+	"\bCANFrame\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\rR\x02id\x12\x12\n" +
+	"\x04data\x18\x02 \x01(\fR\x04data\x129\n" +
+	"\n" +
+	"frame_type\x18\x03 \x01(\x0e2\x1a.gocan.v2.CANFrameTypeEnumR\tframeType\x12\x1c\n" +
+	"\tresponses\x18\x04 \x01(\rR\tresponses\x12\x1a\n" +
+	"\bextended\x18\x05 \x01(\bR\bextended\x12\x16\n" +
+	"\x06remote\x18\x06 \x01(\bR\x06remote\x12\x0e\n" +
+	"\x02fd\x18\a \x01(\bR\x02fd\x12\x10\n" +
+	"\x03brs\x18\b \x01(\bR\x03brs\x12\x10\n" +
+	"\x03esi\x18\t \x01(\bR\x03esi\x12\x1c\n" +
+	"\ttimestamp\x18\n" +
+	" \x01(\x03R\ttimestamp\x12)\n" +
+	"\x10timestamp_source\x18\v \x01(\rR\x0ftimestampSource\"a\n" +
+	"\x05Event\x12*\n" +
+	"\x05level\x18\x01 \x01(\x0e2\x14.gocan.v2.EventLevelR\x05level\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\x12\x12\n" +
+	"\x04kind\x18\x03 \x01(\rR\x04kind\"o\n" +
+	"\rStreamMessage\x12*\n" +
+	"\x05frame\x18\x01 \x01(\v2\x12.gocan.v2.CANFrameH\x00R\x05frame\x12'\n" +
+	"\x05event\x18\x02 \x01(\v2\x0f.gocan.v2.EventH\x00R\x05eventB\t\n" +
+	"\apayload*L\n" +
+	"\x10CANFrameTypeEnum\x12\f\n" +
+	"\bIncoming\x10\x00\x12\f\n" +
+	"\bOutgoing\x10\x01\x12\x1c\n" +
+	"\x18OutgoingResponseRequired\x10\x02*_\n" +
+	"\n" +
+	"EventLevel\x12\x0f\n" +
+	"\vEVENT_DEBUG\x10\x00\x12\x0e\n" +
+	"\n" +
+	"EVENT_INFO\x10\x01\x12\x0e\n" +
+	"\n" +
+	"EVENT_WARN\x10\x02\x12\x0f\n" +
+	"\vEVENT_ERROR\x10\x03\x12\x0f\n" +
+	"\vEVENT_FATAL\x10\x042\x83\x02\n" +
+	"\x05Gocan\x12=\n" +
+	"\vSendCommand\x12\x11.gocan.v2.Command\x1a\x19.gocan.v2.CommandResponse\"\x00\x12A\n" +
+	"\x0eGetSerialPorts\x12\x16.google.protobuf.Empty\x1a\x15.gocan.v2.SerialPorts\"\x00\x12;\n" +
+	"\vGetAdapters\x12\x16.google.protobuf.Empty\x1a\x12.gocan.v2.Adapters\"\x00\x12;\n" +
+	"\x06Stream\x12\x12.gocan.v2.CANFrame\x1a\x17.gocan.v2.StreamMessage\"\x00(\x010\x01B!Z\x1fgithub.com/roffe/gocan/v2/protob\x06proto3"
+
+var (
+	file_v2_proto_server_proto_rawDescOnce sync.Once
+	file_v2_proto_server_proto_rawDescData []byte
+)
+
+func file_v2_proto_server_proto_rawDescGZIP() []byte {
+	file_v2_proto_server_proto_rawDescOnce.Do(func() {
+		file_v2_proto_server_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_v2_proto_server_proto_rawDesc), len(file_v2_proto_server_proto_rawDesc)))
+	})
+	return file_v2_proto_server_proto_rawDescData
+}
+
+var file_v2_proto_server_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
+var file_v2_proto_server_proto_msgTypes = make([]protoimpl.MessageInfo, 10)
+var file_v2_proto_server_proto_goTypes = []any{
+	(CANFrameTypeEnum)(0),       // 0: gocan.v2.CANFrameTypeEnum
+	(EventLevel)(0),             // 1: gocan.v2.EventLevel
+	(*Adapters)(nil),            // 2: gocan.v2.Adapters
+	(*AdapterInfo)(nil),         // 3: gocan.v2.AdapterInfo
+	(*SerialPorts)(nil),         // 4: gocan.v2.SerialPorts
+	(*SerialPort)(nil),          // 5: gocan.v2.SerialPort
+	(*AdapterCapabilities)(nil), // 6: gocan.v2.AdapterCapabilities
+	(*Command)(nil),             // 7: gocan.v2.Command
+	(*CommandResponse)(nil),     // 8: gocan.v2.CommandResponse
+	(*CANFrame)(nil),            // 9: gocan.v2.CANFrame
+	(*Event)(nil),               // 10: gocan.v2.Event
+	(*StreamMessage)(nil),       // 11: gocan.v2.StreamMessage
+	(*emptypb.Empty)(nil),       // 12: google.protobuf.Empty
+}
+var file_v2_proto_server_proto_depIdxs = []int32{
+	3,  // 0: gocan.v2.Adapters.adapters:type_name -> gocan.v2.AdapterInfo
+	6,  // 1: gocan.v2.AdapterInfo.Capabilities:type_name -> gocan.v2.AdapterCapabilities
+	5,  // 2: gocan.v2.SerialPorts.ports:type_name -> gocan.v2.SerialPort
+	0,  // 3: gocan.v2.CANFrame.frame_type:type_name -> gocan.v2.CANFrameTypeEnum
+	1,  // 4: gocan.v2.Event.level:type_name -> gocan.v2.EventLevel
+	9,  // 5: gocan.v2.StreamMessage.frame:type_name -> gocan.v2.CANFrame
+	10, // 6: gocan.v2.StreamMessage.event:type_name -> gocan.v2.Event
+	7,  // 7: gocan.v2.Gocan.SendCommand:input_type -> gocan.v2.Command
+	12, // 8: gocan.v2.Gocan.GetSerialPorts:input_type -> google.protobuf.Empty
+	12, // 9: gocan.v2.Gocan.GetAdapters:input_type -> google.protobuf.Empty
+	9,  // 10: gocan.v2.Gocan.Stream:input_type -> gocan.v2.CANFrame
+	8,  // 11: gocan.v2.Gocan.SendCommand:output_type -> gocan.v2.CommandResponse
+	4,  // 12: gocan.v2.Gocan.GetSerialPorts:output_type -> gocan.v2.SerialPorts
+	2,  // 13: gocan.v2.Gocan.GetAdapters:output_type -> gocan.v2.Adapters
+	11, // 14: gocan.v2.Gocan.Stream:output_type -> gocan.v2.StreamMessage
+	11, // [11:15] is the sub-list for method output_type
+	7,  // [7:11] is the sub-list for method input_type
+	7,  // [7:7] is the sub-list for extension type_name
+	7,  // [7:7] is the sub-list for extension extendee
+	0,  // [0:7] is the sub-list for field type_name
+}
+
+func init() { file_v2_proto_server_proto_init() }
+func file_v2_proto_server_proto_init() {
+	if File_v2_proto_server_proto != nil {
+		return
+	}
+	file_v2_proto_server_proto_msgTypes[9].OneofWrappers = []any{
+		(*StreamMessage_Frame)(nil),
+		(*StreamMessage_Event)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_v2_proto_server_proto_rawDesc), len(file_v2_proto_server_proto_rawDesc)),
+			NumEnums:      2,
+			NumMessages:   10,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_v2_proto_server_proto_goTypes,
+		DependencyIndexes: file_v2_proto_server_proto_depIdxs,
+		EnumInfos:         file_v2_proto_server_proto_enumTypes,
+		MessageInfos:      file_v2_proto_server_proto_msgTypes,
+	}.Build()
+	File_v2_proto_server_proto = out.File
+	file_v2_proto_server_proto_goTypes = nil
+	file_v2_proto_server_proto_depIdxs = nil
+}
@@ -0,0 +1,241 @@
+package gocan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrOffline is returned by Bus.Send on a bus opened WithReconnect while
+// its adapter is being reopened, unless Reconnect.QueueSends is set.
+var ErrOffline = errors.New("gocan: adapter offline, reconnecting")
+
+// Reconnect configures WithReconnect.
+type Reconnect struct {
+	// MinDelay and MaxDelay bound the wait before each attempt, which
+	// doubles from MinDelay on every failure. They default to 250ms and 10s.
+	MinDelay, MaxDelay time.Duration
+	// MaxAttempts is how many attempts in a row may fail before the bus
+	// gives up and terminates with the last error; 0 keeps trying.
+	MaxAttempts int
+	// QueueSends holds Send while the adapter is offline, until it is back
+	// or the send's context is done, instead of failing with ErrOffline.
+	QueueSends bool
+}
+
+// WithReconnect keeps the bus alive through adapter failures: when the
+// adapter reports a fatal error the bus reopens it with backoff instead of
+// terminating, so subscriptions, taps and clients built on the bus carry
+// on. Each loss and failed attempt is an EventKindReconnecting warning,
+// and success an EventKindReconnected event. Frames arriving while the
+// adapter is offline are lost.
+//
+// Buses from Open construct a fresh adapter from the registry for every
+// attempt; an adapter given to OpenAdapter is closed and opened again, so
+// it must support that. The first open is not retried. Cyclic frames are
+// sent from the host rather than the adapter (see CyclicSender).
+func WithReconnect(r Reconnect) Option {
+	if r.MinDelay <= 0 {
+		r.MinDelay = 250 * time.Millisecond
+	}
+	if r.MaxDelay < r.MinDelay {
+		r.MaxDelay = max(10*time.Second, r.MinDelay)
+	}
+	return func(b *Bus) { b.reconnect = &r }
+}
+
+// reconnector is the adapter of a bus opened WithReconnect. It runs the
+// real adapter on a private bus of its own, relaying its frames and events,
+// and replaces it when that bus dies.
+type reconnector struct {
+	cfg        Reconnect
+	adapter    Adapter                 // the first adapter, reused without newAdapter
+	newAdapter func() (Adapter, error) // nil for OpenAdapter
+	ctx        context.Context
+	bus        *Bus
+
+	mu      sync.Mutex
+	inner   *Bus          // the current session, nil while offline
+	last    Adapter       // the adapter of the current or last session
+	online  chan struct{} // closed when the next session starts
+	caps    FilterCaps
+	entries []AcceptanceFilter // last programmed filter
+	filter  bool               // entries must be programmed on new adapters
+}
+
+func (r *reconnector) Open(ctx context.Context, bus *Bus) error {
+	r.ctx, r.bus = ctx, bus
+	r.online = make(chan struct{})
+	return r.connect(r.adapter)
+}
+
+// connect opens a session on a, reprograms its filter and starts watching
+// it.
+func (r *reconnector) connect(a Adapter) error {
+	inner, err := OpenAdapter(r.ctx, a, WithHostFiltering(), WithEventFunc(r.relay), WithReceiveFunc(r.bus.Deliver))
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	var ferr error
+	if hf, ok := a.(HardwareFilter); ok {
+		r.caps = hf.FilterCaps()
+		if r.filter {
+			ferr = hf.SetAcceptanceFilters(r.entries)
+		}
+	}
+	r.inner, r.last = inner, a
+	close(r.online)
+	r.mu.Unlock()
+	if ferr != nil {
+		r.bus.Emit(Event{Type: EventTypeError, Details: "reprogramming hardware filter: " + ferr.Error(), Err: ferr})
+	}
+	if r.ctx.Err() != nil {
+		// The bus closed while this session was opening.
+		return inner.Close()
+	}
+	go r.watch(inner)
+	return nil
+}
+
+// relay passes the session's events on to the bus. A fatal event is not
+// final any more: watch reports the loss instead.
+func (r *reconnector) relay(e Event) {
+	switch {
+	case e.IsFatal():
+	case e.Kind == EventKindBusState:
+		r.bus.ReportState(e.Status)
+	default:
+		r.bus.Emit(e)
+	}
+}
+
+// watch waits for the session to die and starts reconnecting, unless the
+// bus itself is shutting down.
+func (r *reconnector) watch(inner *Bus) {
+	<-inner.Done()
+	if r.ctx.Err() != nil {
+		return
+	}
+	r.drop(inner)
+	inner.Close()
+	cause := context.Cause(inner.Context())
+	r.bus.Emit(Event{Type: EventTypeWarning, Kind: EventKindReconnecting, Details: "adapter lost, reconnecting: " + cause.Error(), Err: cause})
+
+	delay := r.cfg.MinDelay
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-timer.C:
+		}
+		err := r.attempt()
+		if err == nil {
+			r.bus.Emit(Event{Type: EventTypeInfo, Kind: EventKindReconnected, Details: fmt.Sprintf("adapter reconnected after %d attempt(s)", attempt)})
+			return
+		}
+		if r.cfg.MaxAttempts > 0 && attempt >= r.cfg.MaxAttempts {
+			r.bus.Fatal(fmt.Errorf("gocan: reconnect failed after %d attempts: %w", attempt, err))
+			return
+		}
+		r.bus.Emit(Event{Type: EventTypeWarning, Kind: EventKindReconnecting, Details: fmt.Sprintf("reconnect attempt %d: %v", attempt, err), Err: err})
+		delay = min(delay*2, r.cfg.MaxDelay)
+		timer.Reset(delay)
+	}
+}
+
+func (r *reconnector) attempt() error {
+	a := r.adapter
+	if r.newAdapter != nil {
+		var err error
+		if a, err = r.newAdapter(); err != nil {
+			return err
+		}
+	}
+	return r.connect(a)
+}
+
+// drop marks the session inner as gone, if it is still the current one.
+func (r *reconnector) drop(inner *Bus) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.inner == inner {
+		r.inner = nil
+		r.online = make(chan struct{})
+	}
+}
+
+func (r *reconnector) current() Adapter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.last
+}
+
+func (r *reconnector) Send(ctx context.Context, f Frame) error {
+	for {
+		r.mu.Lock()
+		inner, online := r.inner, r.online
+		r.mu.Unlock()
+		if inner == nil {
+			if !r.cfg.QueueSends {
+				return ErrOffline
+			}
+			select {
+			case <-online:
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-r.ctx.Done():
+				return ErrClosed
+			}
+		}
+		err := inner.Send(ctx, f)
+		if err != nil && inner.alive() != nil && ctx.Err() == nil && r.ctx.Err() == nil {
+			// The adapter died under the send.
+			r.drop(inner)
+			if r.cfg.QueueSends {
+				continue
+			}
+			return ErrOffline
+		}
+		return err
+	}
+}
+
+func (r *reconnector) Close() error {
+	r.mu.Lock()
+	inner := r.inner
+	r.mu.Unlock()
+	if inner == nil {
+		return nil
+	}
+	return inner.Close()
+}
+
+// FilterCaps reports the last adapter's filter.
+func (r *reconnector) FilterCaps() FilterCaps {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.caps
+}
+
+// SetAcceptanceFilters programs the current adapter and remembers entries
+// for the ones that replace it.
+func (r *reconnector) SetAcceptanceFilters(entries []AcceptanceFilter) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	hf, ok := r.last.(HardwareFilter)
+	if !ok {
+		return fmt.Errorf("%w: adapter has no hardware filter", errors.ErrUnsupported)
+	}
+	r.entries, r.filter = entries, true
+	if r.inner == nil {
+		return nil
+	}
+	return hf.SetAcceptanceFilters(entries)
+}
@@ -0,0 +1,165 @@
+package gocan
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flaky is a loopback that can be unplugged and refuse to open.
+type flaky struct {
+	mu        sync.Mutex
+	bus       *Bus
+	opens     int
+	failOpens int // Opens to refuse before succeeding again
+}
+
+func (f *flaky) Open(_ context.Context, bus *Bus) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.opens++
+	if f.failOpens > 0 {
+		f.failOpens--
+		return errors.New("no device")
+	}
+	f.bus = bus
+	return nil
+}
+
+func (f *flaky) Send(_ context.Context, fr Frame) error {
+	f.mu.Lock()
+	bus := f.bus
+	f.mu.Unlock()
+	bus.Deliver(fr)
+	return nil
+}
+
+func (f *flaky) Close() error { return nil }
+
+func (f *flaky) unplug(failOpens int) {
+	f.mu.Lock()
+	bus := f.bus
+	f.failOpens = failOpens
+	f.mu.Unlock()
+	bus.Fatal(errors.New("unplugged"))
+}
+
+func TestReconnect(t *testing.T) {
+	hw := &flaky{}
+	events := make(chan Event, 16)
+	bus, err := OpenAdapter(context.Background(), hw,
+		WithReconnect(Reconnect{MinDelay: 5 * time.Millisecond}),
+		WithEventFunc(func(e Event) {
+			if e.Kind == EventKindReconnecting || e.Kind == EventKindReconnected {
+				events <- e
+			}
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bus.Close()
+	ctx := context.Background()
+	ch := bus.Subscribe(ctx, 0x100)
+
+	hw.unplug(2)
+	if e := <-events; e.Kind != EventKindReconnecting || e.Err == nil || e.Err.Error() != "unplugged" {
+		t.Fatalf("want the loss reported, got %v", e)
+	}
+	if err := bus.Send(ctx, NewFrame(0x100, nil)); !errors.Is(err, ErrOffline) {
+		t.Fatalf("send while offline: %v", err)
+	}
+	for range 2 {
+		if e := <-events; e.Kind != EventKindReconnecting {
+			t.Fatalf("want a failed attempt, got %v", e)
+		}
+	}
+	if e := <-events; e.Kind != EventKindReconnected {
+		t.Fatalf("want reconnected, got %v", e)
+	}
+	if err := bus.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if err := bus.Send(ctx, NewFrame(0x100, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if f := <-ch; f.ID != 0x100 {
+		t.Fatalf("subscription after reconnect got %s", f)
+	}
+	if bus.Adapter() != hw {
+		t.Fatal("Adapter should return the real adapter")
+	}
+}
+
+// eager delivers a frame as soon as it opens.
+type eager struct{ flaky }
+
+func (e *eager) Open(ctx context.Context, bus *Bus) error {
+	if err := e.flaky.Open(ctx, bus); err != nil {
+		return err
+	}
+	bus.Deliver(NewFrame(0x123, nil))
+	return nil
+}
+
+func TestReconnectFirstFrame(t *testing.T) {
+	got := make(chan Frame, 1)
+	bus, err := OpenAdapter(context.Background(), &eager{},
+		WithReconnect(Reconnect{MinDelay: 5 * time.Millisecond}),
+		WithReceiveFunc(func(f Frame) { got <- f }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bus.Close()
+	select {
+	case f := <-got:
+		if f.ID != 0x123 {
+			t.Fatalf("got %s", f)
+		}
+	default:
+		t.Fatal("frame delivered while opening was lost")
+	}
+}
+
+func TestReconnectQueueSends(t *testing.T) {
+	hw := &flaky{}
+	bus, err := OpenAdapter(context.Background(), hw, WithReconnect(Reconnect{MinDelay: 20 * time.Millisecond, QueueSends: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bus.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	ch := bus.Subscribe(ctx, 0x100)
+	hw.unplug(0)
+	if err := bus.Send(ctx, NewFrame(0x100, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if f := <-ch; f.ID != 0x100 {
+		t.Fatalf("queued frame: %s", f)
+	}
+}
+
+func TestReconnectGivesUp(t *testing.T) {
+	hw := &flaky{}
+	bus, err := OpenAdapter(context.Background(), hw, WithReconnect(Reconnect{MinDelay: time.Millisecond, MaxAttempts: 3}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bus.Close()
+	hw.unplug(5)
+	select {
+	case <-bus.Done():
+	case <-time.After(time.Second):
+		t.Fatal("bus outlived its attempts")
+	}
+	if err := bus.Err(); err == nil {
+		t.Fatal("want the last error")
+	}
+	hw.mu.Lock()
+	defer hw.mu.Unlock()
+	if hw.opens != 4 {
+		t.Fatalf("want 1 open and 3 attempts, got %d opens", hw.opens)
+	}
+}
@@ -0,0 +1,36 @@
+//go:build !windows
+
+package server
+
+import (
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// DefaultAddress is where the v1 GWClient expects the gateway: a Unix
+// socket in the temporary directory.
+var DefaultAddress = filepath.Join(os.TempDir(), "cangateway.sock")
+
+// Listen listens on the Unix socket at address, removing a stale socket
+// file left by a server that didn't shut down cleanly.
+func Listen(address string) (net.Listener, error) {
+	if c, err := net.Dial("unix", address); err == nil {
+		c.Close()
+		return nil, errors.New("server: a gateway is already listening on " + address)
+	}
+	if err := os.Remove(address); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return net.Listen("unix", address)
+}
+
+// Dial connects to the gateway listening on address.
+func Dial(address string) (*grpc.ClientConn, error) {
+	return grpc.NewClient("unix:"+address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+}
@@ -0,0 +1,26 @@
+package server
+
+import (
+	"net"
+
+	"github.com/Microsoft/go-winio"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// DefaultAddress is where the v1 GWClient expects the gateway: a named
+// pipe.
+var DefaultAddress = `\\.\pipe\gocangateway`
+
+// Listen listens on the named pipe at address.
+func Listen(address string) (net.Listener, error) {
+	return winio.ListenPipe(address, nil)
+}
+
+// Dial connects to the gateway listening on address.
+func Dial(address string) (*grpc.ClientConn, error) {
+	return grpc.NewClient("passthrough:"+address,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(winio.DialPipeContext),
+	)
+}
@@ -0,0 +1,420 @@
+// Package server shares gocan v2 adapters over the gRPC Gocan service
+// (see the proto package), so one process owns the hardware and any number
+// of tools use it at once: through the "gateway" adapter (package
+// adapters/gateway), or the v1 GWClient, which speaks the same protocol.
+//
+//	lis, err := server.Listen(server.DefaultAddress)
+//	err = server.New().Serve(ctx, lis)
+//
+// A client opens a Stream carrying its adapter name and Config as metadata.
+// The server opens the adapter with gocan.Open, answers with an "OK" info
+// event, then relays frames and events to the client and sends the frames
+// the client writes. Clients asking for the same adapter and port share one
+// bus, which closes when the last of them leaves; they must agree on the
+// bit rates and listen-only mode. The adapter must be registered in the
+// server process: import the adapter packages it should offer, or
+// adapters/all.
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	gocan "github.com/roffe/gocan/v2"
+	"github.com/roffe/gocan/v2/proto"
+	"go.bug.st/serial/enumerator"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// queueLen bounds the messages waiting for each client; a client that
+// falls further behind loses frames.
+const queueLen = 1024
+
+// Server serves the Gocan service. Build one with New.
+type Server struct {
+	proto.UnimplementedGocanServer
+
+	mu    sync.Mutex
+	buses map[busKey]*shared
+}
+
+type busKey struct{ adapter, port string }
+
+// shared is a bus and the clients streaming it.
+type shared struct {
+	bus     *gocan.Bus
+	cfg     gocan.Config
+	ready   chan struct{} // closed once the bus is open, or failed to
+	err     error         // why it failed
+	mu      sync.Mutex
+	clients map[*client]struct{}
+}
+
+// client is one Stream.
+type client struct {
+	filter  []uint32 // identifiers the client wants, none for all
+	out     chan *proto.StreamMessage
+	dropped atomic.Uint64
+}
+
+// New returns a server with no buses open.
+func New() *Server {
+	return &Server{buses: make(map[busKey]*shared)}
+}
+
+// Serve serves gRPC on lis until ctx is done, then stops, ending open
+// streams and closing their buses.
+func (s *Server) Serve(ctx context.Context, lis net.Listener) error {
+	gs := grpc.NewServer()
+	proto.RegisterGocanServer(gs, s)
+	stop := context.AfterFunc(ctx, gs.Stop)
+	defer stop()
+	err := gs.Serve(lis)
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// GetAdapters lists the adapters registered in the server process.
+func (s *Server) GetAdapters(context.Context, *emptypb.Empty) (*proto.Adapters, error) {
+	var out proto.Adapters
+	for _, info := range gocan.Adapters() {
+		c := info.Capabilities
+		out.Adapters = append(out.Adapters, &proto.AdapterInfo{
+			Name:        info.Name,
+			Description: info.Description,
+			Capabilities: &proto.AdapterCapabilities{
+				HSCAN:      c.HSCAN,
+				SWCAN:      c.SWCAN,
+				KLine:      c.KLine,
+				FD:         c.FD,
+				ListenOnly: c.ListenOnly,
+			},
+			RequireSerialPort: info.RequiresSerialPort,
+		})
+	}
+	return &out, nil
+}
+
+// GetSerialPorts lists the server's serial ports, described by their USB
+// product name where there is one.
+func (s *Server) GetSerialPorts(context.Context, *emptypb.Empty) (*proto.SerialPorts, error) {
+	ports, err := enumerator.GetDetailedPortsList()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "listing serial ports: %v", err)
+	}
+	var out proto.SerialPorts
+	for _, p := range ports {
+		desc := p.Product
+		if desc == "" && p.IsUSB {
+			desc = fmt.Sprintf("USB %s:%s", p.VID, p.PID)
+		}
+		out.Ports = append(out.Ports, &proto.SerialPort{Name: p.Name, Description: desc})
+	}
+	return &out, nil
+}
+
+// Stream connects a client to the bus its metadata asks for.
+func (s *Server) Stream(stream grpc.BidiStreamingServer[proto.CANFrame, proto.StreamMessage]) error {
+	ctx := stream.Context()
+	md, _ := metadata.FromIncomingContext(ctx)
+	name, cfg, filter, err := ParseMetadata(md)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	c := &client{filter: filter, out: make(chan *proto.StreamMessage, queueLen)}
+	sb, err := s.join(name, cfg, c)
+	if err != nil {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	defer s.leave(busKey{name, cfg.Port}, sb, c)
+
+	if err := stream.Send(event(gocan.EventTypeInfo, "OK")); err != nil {
+		return err
+	}
+	recvErr := make(chan error, 1)
+	go func() { recvErr <- s.recv(ctx, stream, sb.bus, c, cfg.UseExtendedID) }()
+	for {
+		select {
+		case m := <-c.out:
+			if err := stream.Send(m); err != nil {
+				return err
+			}
+		case err := <-recvErr:
+			if err != nil {
+				return err
+			}
+			recvErr = nil // the client is done sending, not receiving
+		case <-ctx.Done():
+			return nil
+		case <-sb.bus.Done():
+			// Flush what the bus said before it died, the fatal event last.
+			for len(c.out) > 0 {
+				if err := stream.Send(<-c.out); err != nil {
+					return err
+				}
+			}
+			return status.Error(codes.Unavailable, context.Cause(sb.bus.Context()).Error())
+		}
+	}
+}
+
+// recv sends the client's frames to the bus until the client stops
+// sending, returning nil if it stopped cleanly. Failed sends are reported to
+// the client as error events.
+func (s *Server) recv(ctx context.Context, stream grpc.BidiStreamingServer[proto.CANFrame, proto.StreamMessage], bus *gocan.Bus, c *client, useExtendedID bool) error {
+	for {
+		m, err := stream.Recv()
+		if err != nil {
+			if err == io.EOF || status.Code(err) == codes.Canceled {
+				return nil
+			}
+			return err
+		}
+		sctx := ctx
+		if m.GetFrameType() == proto.CANFrameTypeEnum_OutgoingResponseRequired {
+			sctx = gocan.WithExpectedResponses(ctx, int(m.GetResponses()))
+		}
+		if err := bus.Send(sctx, clientFrame(m, useExtendedID)); err != nil {
+			c.push(event(gocan.EventTypeError, "send: "+err.Error()))
+		}
+	}
+}
+
+// clientFrame converts a frame from a client. v1 clients send none of the
+// v2 fields, extended included, so their identifiers are 29-bit when they
+// don't fit in 11 bits or the client asked for UseExtendedID.
+func clientFrame(m *proto.CANFrame, useExtendedID bool) gocan.Frame {
+	f := m.Frame()
+	v1 := !m.GetExtended() && !m.GetRemote() && !m.GetFd() && !m.GetBrs() && !m.GetEsi() && m.GetTimestampSource() == 0
+	if v1 && (f.ID > 0x7FF || useExtendedID) {
+		f.Extended = true
+	}
+	return f
+}
+
+// join adds c to the bus for adapter name on cfg.Port, opening it if it
+// isn't open yet.
+func (s *Server) join(name string, cfg gocan.Config, c *client) (*shared, error) {
+	key := busKey{name, cfg.Port}
+	for {
+		s.mu.Lock()
+		sb := s.buses[key]
+		if sb == nil {
+			sb = &shared{cfg: cfg, ready: make(chan struct{}), clients: map[*client]struct{}{c: {}}}
+			s.buses[key] = sb
+			s.mu.Unlock()
+			return sb, s.open(key, sb)
+		}
+		s.mu.Unlock()
+		<-sb.ready
+		if sb.err != nil {
+			return nil, sb.err
+		}
+		if sb.cfg.CANRate != cfg.CANRate || sb.cfg.CANDataRate != cfg.CANDataRate || sb.cfg.ListenOnly != cfg.ListenOnly {
+			return nil, fmt.Errorf("%s on %q is open at %g/%g kbit/s, listen-only %v", name, cfg.Port, sb.cfg.CANRate, sb.cfg.CANDataRate, sb.cfg.ListenOnly)
+		}
+		if sb.add(c) {
+			return sb, nil
+		}
+		// The bus died, or its last client left while this one waited.
+		s.retire(key, sb)
+	}
+}
+
+// open opens the bus of a new shared entry.
+func (s *Server) open(key busKey, sb *shared) error {
+	defer close(sb.ready)
+	// The bus outlives the stream that opened it.
+	sb.bus, sb.err = gocan.Open(context.Background(), key.adapter, sb.cfg, gocan.WithEventFunc(sb.event))
+	if sb.err != nil {
+		s.retire(key, sb)
+		return sb.err
+	}
+	sb.bus.OnReceive(sb.frame)
+	return nil
+}
+
+// add adds c to a live bus's clients.
+func (sb *shared) add(c *client) bool {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	if sb.clients == nil || sb.bus.Context().Err() != nil {
+		return false
+	}
+	sb.clients[c] = struct{}{}
+	return true
+}
+
+// leave removes c from sb, closing the bus after the last client.
+func (s *Server) leave(key busKey, sb *shared, c *client) {
+	sb.mu.Lock()
+	delete(sb.clients, c)
+	last := len(sb.clients) == 0
+	if last {
+		sb.clients = nil
+	}
+	sb.mu.Unlock()
+	if last {
+		s.retire(key, sb)
+		sb.bus.Close()
+	}
+}
+
+// retire forgets sb, so the next client opens the adapter afresh.
+func (s *Server) retire(key busKey, sb *shared) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.buses[key] == sb {
+		delete(s.buses, key)
+	}
+}
+
+// frame passes a received frame to the clients that want it. It runs on
+// the bus's receive goroutine.
+func (sb *shared) frame(f gocan.Frame) {
+	m := &proto.StreamMessage{Payload: &proto.StreamMessage_Frame{Frame: proto.FromFrame(f)}}
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	for c := range sb.clients {
+		if len(c.filter) == 0 || containsID(c.filter, f.ID) {
+			c.push(m)
+		}
+	}
+}
+
+// event passes a bus event to every client.
+func (sb *shared) event(e gocan.Event) {
+	m := &proto.StreamMessage{Payload: &proto.StreamMessage_Event{Event: proto.FromEvent(e)}}
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	for c := range sb.clients {
+		c.push(m)
+	}
+}
+
+// push queues m for the client, dropping it if the client is too far
+// behind; the first drop after a catch-up is reported.
+func (c *client) push(m *proto.StreamMessage) {
+	select {
+	case c.out <- m:
+		if n := c.dropped.Swap(0); n > 0 {
+			select {
+			case c.out <- event(gocan.EventTypeWarning, fmt.Sprintf("client too slow, %d messages dropped", n)):
+			default:
+				c.dropped.Add(n)
+			}
+		}
+	default:
+		c.dropped.Add(1)
+	}
+}
+
+func event(t gocan.EventType, msg string) *proto.StreamMessage {
+	return &proto.StreamMessage{Payload: &proto.StreamMessage_Event{Event: proto.FromEvent(gocan.Event{Type: t, Details: msg})}}
+}
+
+func containsID(ids []uint32, id uint32) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Metadata returns the stream metadata asking for adapter name opened with
+// cfg. It carries the keys the v1 GWClient sends, plus "candatarate",
+// "listenonly" and one "extra" key=value entry per Config.Extra item.
+func Metadata(name string, cfg gocan.Config) metadata.MD {
+	ids := make([]string, 0, len(cfg.CANFilter))
+	for _, id := range cfg.CANFilter {
+		ids = append(ids, strconv.FormatUint(uint64(id), 10))
+	}
+	md := metadata.Pairs(
+		"adapter", name,
+		"port", cfg.Port,
+		"port_baudrate", strconv.Itoa(cfg.PortBaudrate),
+		"canrate", strconv.FormatFloat(cfg.CANRate, 'f', 3, 64),
+		"candatarate", strconv.FormatFloat(cfg.CANDataRate, 'f', 3, 64),
+		"canfilter", strings.Join(ids, ","),
+		"debug", strconv.FormatBool(cfg.Debug),
+		"useextendedid", strconv.FormatBool(cfg.UseExtendedID),
+		"listenonly", strconv.FormatBool(cfg.ListenOnly),
+	)
+	for k, v := range cfg.Extra {
+		md.Append("extra", k+"="+v)
+	}
+	return md
+}
+
+// ParseMetadata is the inverse of Metadata. The filter is returned apart
+// from the Config: the server filters for each client, leaving the shared
+// bus open to all traffic.
+func ParseMetadata(md metadata.MD) (name string, cfg gocan.Config, filter []uint32, err error) {
+	get := func(key string) string {
+		if v := md.Get(key); len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+	if name = get("adapter"); name == "" {
+		return "", cfg, nil, errors.New("no adapter given")
+	}
+	cfg.Port = get("port")
+	for key, dst := range map[string]*float64{"canrate": &cfg.CANRate, "candatarate": &cfg.CANDataRate} {
+		if v := get(key); v != "" {
+			if *dst, err = strconv.ParseFloat(v, 64); err != nil {
+				return "", cfg, nil, fmt.Errorf("invalid %s %q", key, v)
+			}
+		}
+	}
+	if v := get("port_baudrate"); v != "" {
+		if cfg.PortBaudrate, err = strconv.Atoi(v); err != nil {
+			return "", cfg, nil, fmt.Errorf("invalid port_baudrate %q", v)
+		}
+	}
+	for key, dst := range map[string]*bool{"debug": &cfg.Debug, "useextendedid": &cfg.UseExtendedID, "listenonly": &cfg.ListenOnly} {
+		if v := get(key); v != "" {
+			if *dst, err = strconv.ParseBool(v); err != nil {
+				return "", cfg, nil, fmt.Errorf("invalid %s %q", key, v)
+			}
+		}
+	}
+	if v := get("canfilter"); v != "" {
+		for s := range strings.SplitSeq(v, ",") {
+			id, err := strconv.ParseUint(strings.TrimSpace(s), 10, 32)
+			if err != nil {
+				return "", cfg, nil, fmt.Errorf("invalid canfilter %q", v)
+			}
+			filter = append(filter, uint32(id))
+		}
+	}
+	for _, kv := range md.Get("extra") {
+		k, v, _ := strings.Cut(kv, "=")
+		if cfg.Extra == nil {
+			cfg.Extra = make(map[string]string)
+		}
+		cfg.Extra[k] = v
+	}
+	if v := get("minversion"); v != "" {
+		// v1 clients pass it through AdditionalConfig.
+		if cfg.Extra == nil {
+			cfg.Extra = make(map[string]string)
+		}
+		cfg.Extra["minversion"] = v
+	}
+	return name, cfg, filter, nil
+}
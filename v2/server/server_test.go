@@ -0,0 +1,65 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+
+	gocan "github.com/roffe/gocan/v2"
+	"github.com/roffe/gocan/v2/proto"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestMetadata(t *testing.T) {
+	cfg := gocan.Config{
+		Port:          "/dev/ttyUSB0",
+		PortBaudrate:  115200,
+		CANRate:       615.384,
+		CANDataRate:   2000,
+		CANFilter:     []uint32{0x7E8, 0x5E8},
+		UseExtendedID: true,
+		ListenOnly:    true,
+		Extra:         map[string]string{"latency": "1ms"},
+	}
+	name, got, filter, err := ParseMetadata(Metadata("virtual", cfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "virtual" || !reflect.DeepEqual(filter, cfg.CANFilter) {
+		t.Fatalf("got %q, filter %v", name, filter)
+	}
+	want := cfg
+	want.CANFilter = nil
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("want %+v, got %+v", want, got)
+	}
+
+	// What the v1 GWClient sends.
+	_, got, filter, err = ParseMetadata(metadata.Pairs("adapter", "CANlib #0", "canrate", "500.000", "canfilter", "", "minversion", "1.0.0"))
+	if err != nil || got.CANRate != 500 || filter != nil || got.Extra["minversion"] != "1.0.0" {
+		t.Fatalf("v1 metadata: %+v, %v", got, err)
+	}
+	if _, _, _, err := ParseMetadata(metadata.Pairs("adapter", "x", "canrate", "fast")); err == nil {
+		t.Fatal("bad rate accepted")
+	}
+}
+
+// TestClientFrame covers frames from the v1 GWClient, which carry no
+// extended flag.
+func TestClientFrame(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		m             *proto.CANFrame
+		useExtendedID bool
+		extended      bool
+	}{
+		{"v1 11-bit", &proto.CANFrame{Id: 0x7E0}, false, false},
+		{"v1 29-bit", &proto.CANFrame{Id: 0x18DA10F1}, false, true},
+		{"v1 UseExtendedID", &proto.CANFrame{Id: 0x7E0}, true, true},
+		{"v2 11-bit", &proto.CANFrame{Id: 0x7E0, Fd: true}, true, false},
+		{"v2 29-bit", &proto.CANFrame{Id: 0x7E0, Extended: true}, false, true},
+	} {
+		if f := clientFrame(tc.m, tc.useExtendedID); f.Extended != tc.extended || f.ID != tc.m.GetId() {
+			t.Errorf("%s: got %s, want extended %v", tc.name, f, tc.extended)
+		}
+	}
+}
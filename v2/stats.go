@@ -0,0 +1,346 @@
+package gocan
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Stats is a snapshot of a bus's traffic since it was opened, from
+// Bus.Stats.
+type Stats struct {
+	Since time.Time // when the bus was opened
+
+	RxFrames, TxFrames uint64
+	RxBytes, TxBytes   uint64 // payload bytes
+	TxFailed           uint64 // sends the adapter returned an error for
+	ErrorFrames        uint64 // EventKindErrorFrame events
+	Overruns           uint64 // EventKindOverrun events
+	Dropped            uint64 // received frames lost to slow subscribers, once per subscriber
+
+	// Load is the percentage of the last full second the bus spent carrying
+	// frames, from their bit lengths at the bus's bit rates. It counts the
+	// frames this node sees, and is 0 when the bit rate is unknown.
+	Load float64
+
+	SendLatency Latency           // time the adapter took to accept a frame
+	IDs         []IDStats         // received frames per identifier, by ID
+	Subscribers []SubscriberStats // live subscriptions
+}
+
+// Latency summarizes a set of durations.
+type Latency struct {
+	Min, Mean, Max time.Duration
+}
+
+// IDStats describes the received frames carrying one identifier. Period and
+// Jitter come from the frames' timestamps, so they are as precise as the
+// adapter's clock.
+type IDStats struct {
+	ID       uint32
+	Extended bool
+	Count    uint64
+	Period   time.Duration // mean interval between frames
+	Jitter   time.Duration // standard deviation of the interval
+	Last     time.Time     // timestamp of the latest frame
+}
+
+// SubscriberStats describes one subscription.
+type SubscriberStats struct {
+	IDs      []uint32 // identifiers subscribed to
+	Filters  []Filter // filters subscribed to; both nil for all traffic
+	Queued   int      // frames waiting to be read
+	Capacity int      // channel buffer size
+	Dropped  uint64   // frames lost because the buffer was full
+}
+
+// loadWindow is the interval Stats.Load is measured over.
+const loadWindow = time.Second
+
+type idKey struct {
+	id       uint32
+	extended bool
+}
+
+// idCounter accumulates the intervals of one identifier with Welford's
+// online algorithm.
+type idCounter struct {
+	count     uint64
+	intervals uint64
+	last      time.Time
+	mean, m2  float64 // interval mean and sum of squared deviations, seconds
+}
+
+// busStats holds the counters behind Bus.Stats. Subscriber drops live on
+// the subscriptions themselves.
+type busStats struct {
+	mu sync.Mutex
+	Stats
+	ids map[idKey]*idCounter
+
+	latencies  uint64
+	latencySum time.Duration
+
+	loadStart time.Time
+	loadBusy  float64 // seconds of bus time in the current window
+}
+
+// WithBitrate sets the arbitration and CAN FD data bit rates, in kbit/s,
+// that Stats.Load is computed from. Open takes them from the Config; use
+// this with OpenAdapter.
+func WithBitrate(canRate, dataRate float64) Option {
+	return func(b *Bus) { b.bitrate, b.dataBitrate = canRate, dataRate }
+}
+
+func (s *busStats) init(now time.Time) {
+	s.Since = now
+	s.loadStart = now
+	s.ids = make(map[idKey]*idCounter)
+}
+
+func (s *busStats) received(now time.Time, f *Frame, busy float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.RxFrames++
+	s.RxBytes += uint64(f.Length)
+	s.addLoad(now, busy)
+
+	k := idKey{f.ID, f.Extended}
+	c := s.ids[k]
+	if c == nil {
+		c = &idCounter{}
+		s.ids[k] = c
+	}
+	if c.count > 0 {
+		if d := f.Timestamp.Sub(c.last).Seconds(); d >= 0 {
+			c.intervals++
+			delta := d - c.mean
+			c.mean += delta / float64(c.intervals)
+			c.m2 += delta * (d - c.mean)
+		}
+	}
+	c.count++
+	c.last = f.Timestamp
+}
+
+func (s *busStats) sent(now time.Time, f *Frame, busy float64, latency time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.TxFailed++
+		return
+	}
+	s.TxFrames++
+	s.TxBytes += uint64(f.Length)
+	s.addLoad(now, busy)
+	if s.latencies == 0 || latency < s.SendLatency.Min {
+		s.SendLatency.Min = latency
+	}
+	s.SendLatency.Max = max(s.SendLatency.Max, latency)
+	s.latencies++
+	s.latencySum += latency
+}
+
+func (s *busStats) event(e *Event) {
+	switch e.Kind {
+	case EventKindErrorFrame:
+		s.mu.Lock()
+		s.ErrorFrames++
+		s.mu.Unlock()
+	case EventKindOverrun:
+		s.mu.Lock()
+		s.Overruns++
+		s.mu.Unlock()
+	}
+}
+
+func (s *busStats) dropped(n int) {
+	s.mu.Lock()
+	s.Dropped += uint64(n)
+	s.mu.Unlock()
+}
+
+// addLoad adds busy seconds of bus time, closing the load window first if
+// it has run out.
+func (s *busStats) addLoad(now time.Time, busy float64) {
+	s.rollLoad(now)
+	s.loadBusy += busy
+}
+
+func (s *busStats) rollLoad(now time.Time) {
+	elapsed := now.Sub(s.loadStart)
+	if elapsed < loadWindow {
+		return
+	}
+	if elapsed < 2*loadWindow {
+		s.Load = min(100*s.loadBusy/loadWindow.Seconds(), 100)
+	} else {
+		s.Load = 0 // a whole window went by without traffic
+	}
+	s.loadStart = s.loadStart.Add(elapsed / loadWindow * loadWindow)
+	s.loadBusy = 0
+}
+
+func (s *busStats) snapshot(now time.Time) Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rollLoad(now)
+	out := s.Stats
+	if s.latencies > 0 {
+		out.SendLatency.Mean = s.latencySum / time.Duration(s.latencies)
+	}
+	out.IDs = make([]IDStats, 0, len(s.ids))
+	for k, c := range s.ids {
+		st := IDStats{ID: k.id, Extended: k.extended, Count: c.count, Last: c.last}
+		if c.intervals > 0 {
+			st.Period = seconds(c.mean)
+		}
+		if c.intervals > 1 {
+			st.Jitter = seconds(math.Sqrt(c.m2 / float64(c.intervals-1)))
+		}
+		out.IDs = append(out.IDs, st)
+	}
+	slices.SortFunc(out.IDs, func(a, b IDStats) int {
+		if a.ID != b.ID {
+			return int(int64(a.ID) - int64(b.ID))
+		}
+		if a.Extended {
+			return 1
+		}
+		return -1
+	})
+	return out
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// Stats returns a snapshot of the bus's traffic counters.
+func (b *Bus) Stats() Stats {
+	st := b.stats.snapshot(time.Now())
+	b.subMu.Lock()
+	for _, s := range b.subs() {
+		ss := SubscriberStats{Filters: s.filters, Queued: len(s.ch), Capacity: cap(s.ch), Dropped: s.dropped}
+		for id := range s.ids {
+			ss.IDs = append(ss.IDs, id)
+		}
+		slices.Sort(ss.IDs)
+		st.Subscribers = append(st.Subscribers, ss)
+	}
+	b.subMu.Unlock()
+	return st
+}
+
+// busTime returns how long f occupies the bus, in seconds, at the bus's
+// bit rates, or 0 when they are unknown.
+func (b *Bus) busTime(f *Frame) float64 {
+	if b.bitrate <= 0 {
+		return 0
+	}
+	nominal, data := FrameBits(f)
+	if f.BRS && b.dataBitrate > 0 {
+		return float64(nominal)/(b.bitrate*1000) + float64(data)/(b.dataBitrate*1000)
+	}
+	return float64(nominal+data) / (b.bitrate * 1000)
+}
+
+// FrameBits returns the length of f on the wire, interframe space
+// included, split into the bits sent at the arbitration bit rate and those
+// sent at the data bit rate of a CAN FD frame with BRS set (0 otherwise).
+// Classic frames are counted exactly, stuff bits included; CAN FD frames
+// assume worst-case stuffing of the data phase.
+func FrameBits(f *Frame) (nominal, data int) {
+	if !f.FD {
+		return classicBits(f), 0
+	}
+	// SOF, 11-bit ID and RRS, IDE, FDF, res, BRS; extended IDs add SRR and
+	// 18 ID bits.
+	arb := 1 + 11 + 5
+	if f.Extended {
+		arb += 1 + 18
+	}
+	arb += (arb - 1) / 4 // worst-case stuffing
+	crc, fixed := 17, 6
+	if f.Length > 16 {
+		crc, fixed = 21, 7
+	}
+	// ESI, DLC, payload, then the stuff count and CRC with their fixed
+	// stuff bits, and the CRC delimiter's sample point.
+	dyn := 1 + 4 + 8*int(f.Length)
+	data = dyn + (dyn-1)/4 + 4 + crc + fixed
+	// CRC delimiter, ACK slot and delimiter, EOF, interframe space.
+	tail := 1 + 2 + 7 + 3
+	if !f.BRS {
+		return arb + data + tail, 0
+	}
+	return arb + tail, data
+}
+
+// classicBits counts a classic frame's bits exactly: the stuffed span from
+// SOF through the CRC, then the fixed-form CRC delimiter, ACK, EOF and
+// interframe space. It runs for every frame sent and received, so the CRC
+// and stuff bits are worked out as the bits go by rather than collected.
+func classicBits(f *Frame) int {
+	var s bitStuffer
+	rtr := uint32(0)
+	if f.Remote {
+		rtr = 1
+	}
+	s.put(0, 1) // SOF
+	if f.Extended {
+		s.put(f.ID>>18, 11)
+		s.put(1, 1) // SRR
+		s.put(1, 1) // IDE
+		s.put(f.ID, 18)
+		s.put(rtr, 1)
+		s.put(0, 2) // r1, r0
+	} else {
+		s.put(f.ID, 11)
+		s.put(rtr, 1)
+		s.put(0, 2) // IDE, r0
+	}
+	n := min(int(f.Length), 8)
+	s.put(uint32(n), 4)
+	if !f.Remote {
+		for _, b := range f.Data[:n] {
+			s.put(uint32(b), 8)
+		}
+	}
+	s.put(s.crc, 15)
+	return s.bits + 1 + 2 + 7 + 3
+}
+
+// bitStuffer follows the stuffed part of a classic frame bit by bit,
+// keeping its CRC-15 and the wire length with stuff bits.
+type bitStuffer struct {
+	crc  uint32
+	bits int // on the wire so far, stuff bits included
+	run  int // length of the current run of equal bits
+	prev bool
+}
+
+// put sends the n low bits of v, most significant first.
+func (s *bitStuffer) put(v uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		bit := v>>i&1 != 0
+		next := bit != (s.crc>>14&1 != 0)
+		s.crc = s.crc << 1 & 0x7FFF
+		if next {
+			s.crc ^= 0x4599
+		}
+		if s.bits > 0 && bit == s.prev {
+			s.run++
+		} else {
+			s.run = 1
+		}
+		s.prev = bit
+		s.bits++
+		if s.run == 5 {
+			// The stuff bit is the complement and starts the next run.
+			s.bits++
+			s.prev, s.run = !bit, 1
+		}
+	}
+}
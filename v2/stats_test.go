@@ -0,0 +1,103 @@
+package gocan
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	bus, err := Open(context.Background(), "loopback", Config{CANRate: 500})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bus.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	slow := bus.Subscribe(ctx, 0x7E8)
+
+	for range 70 {
+		if err := bus.Send(ctx, NewFrame(0x7E8, []byte{1, 2, 3, 4})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	base := time.Unix(1000, 0)
+	for i, ms := range []int{0, 10, 20, 30} {
+		bus.Deliver(Frame{ID: 0x100, Length: 1, Timestamp: base.Add(time.Duration(ms) * time.Millisecond), TimestampSource: TimestampHardware})
+		if i == 0 {
+			bus.Emit(BusEvent(EventKindErrorFrame, BusStatus{Errors: BusErrorStuff}))
+		}
+	}
+
+	st := bus.Stats()
+	if st.TxFrames != 70 || st.TxBytes != 280 || st.RxFrames != 74 || st.ErrorFrames != 1 {
+		t.Fatalf("bad counters %+v", st)
+	}
+	if st.SendLatency.Min > st.SendLatency.Mean || st.SendLatency.Mean > st.SendLatency.Max {
+		t.Fatalf("inconsistent latency %+v", st.SendLatency)
+	}
+	if len(st.IDs) != 2 || st.IDs[0].ID != 0x100 || st.IDs[1].ID != 0x7E8 {
+		t.Fatalf("bad per-ID stats %+v", st.IDs)
+	}
+	if id := st.IDs[0]; id.Count != 4 || id.Period != 10*time.Millisecond || id.Jitter != 0 || !id.Last.Equal(base.Add(30*time.Millisecond)) {
+		t.Fatalf("bad 0x100 stats %+v", id)
+	}
+	if st.Dropped != 6 || len(st.Subscribers) != 1 {
+		t.Fatalf("want 6 drops on one subscriber, got %d on %+v", st.Dropped, st.Subscribers)
+	}
+	if s := st.Subscribers[0]; s.Dropped != 6 || s.Queued != 64 || s.Capacity != 64 || len(s.IDs) != 1 || s.IDs[0] != 0x7E8 {
+		t.Fatalf("bad subscriber stats %+v", s)
+	}
+	<-slow
+}
+
+func TestStatsLoad(t *testing.T) {
+	start := time.Unix(0, 0)
+	var s busStats
+	s.init(start)
+	f := NewFrame(0x123, make([]byte, 8))
+	// A quarter second of traffic in the first second, reported once it has passed.
+	for i := range 8 {
+		s.received(start.Add(time.Duration(i)*time.Millisecond), &f, 0.03125)
+	}
+	if st := s.snapshot(start.Add(500 * time.Millisecond)); st.Load != 0 {
+		t.Fatalf("load reported before the window closed: %v", st.Load)
+	}
+	if st := s.snapshot(start.Add(1500 * time.Millisecond)); st.Load != 25 {
+		t.Fatalf("want 25%% load, got %v", st.Load)
+	}
+	if st := s.snapshot(start.Add(3 * time.Second)); st.Load != 0 {
+		t.Fatalf("want 0%% after an idle second, got %v", st.Load)
+	}
+}
+
+func TestFrameBits(t *testing.T) {
+	// 98 bits from SOF through CRC, up to one stuff bit per four after the
+	// first, and 13 fixed bits after.
+	for _, f := range []Frame{
+		NewFrame(0x000, make([]byte, 8)),
+		NewFrame(0x7FF, []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}),
+		NewFrame(0x555, []byte{0x55, 0xAA, 0x55, 0xAA, 0x55, 0xAA, 0x55, 0xAA}),
+	} {
+		if n, d := FrameBits(&f); n < 111 || n > 135 || d != 0 {
+			t.Errorf("%s: %d+%d bits", f, n, d)
+		}
+	}
+	zeros, alternating := NewFrame(0x000, make([]byte, 8)), NewFrame(0x555, []byte{0x55, 0xAA, 0x55, 0xAA, 0x55, 0xAA, 0x55, 0xAA})
+	if z, a := classicBits(&zeros), classicBits(&alternating); z <= a {
+		t.Errorf("all-zero frame should stuff more: %d vs %d bits", z, a)
+	}
+	if n := testing.AllocsPerRun(100, func() { classicBits(&alternating) }); n != 0 {
+		t.Errorf("classicBits allocates %v times per frame", n)
+	}
+
+	fd := Frame{ID: 0x123, FD: true, BRS: true, Length: 64}
+	n, d := FrameBits(&fd)
+	if n != 34 || d < 5+8*64+4+21+7 {
+		t.Errorf("64-byte FD frame: %d+%d bits", n, d)
+	}
+	fd.BRS = false
+	if n2, d2 := FrameBits(&fd); n2 != n+d || d2 != 0 {
+		t.Errorf("without BRS want %d+0 bits, got %d+%d", n+d, n2, d2)
+	}
+}
@@ -0,0 +1,90 @@
+package gocan
+
+import "time"
+
+// TimestampSource says which clock produced a frame's Timestamp.
+type TimestampSource uint8
+
+const (
+	// TimestampNone marks a frame that was never received, e.g. one built
+	// for sending.
+	TimestampNone TimestampSource = iota
+	// TimestampHost is the host clock when the adapter handed the frame to
+	// Bus.Deliver. It carries a monotonic reading, so differences between
+	// host-stamped frames are immune to wall clock steps, but it includes
+	// the adapter's USB or serial latency and jitter.
+	TimestampHost
+	// TimestampKernel is the operating system's receive time, taken by the
+	// driver before the frame is queued to the socket (SocketCAN).
+	TimestampKernel
+	// TimestampHardware is the adapter's own receive clock, converted to
+	// wall time.
+	TimestampHardware
+	// TimestampLog is the time recorded in a log file being played back.
+	TimestampLog
+)
+
+func (s TimestampSource) String() string {
+	switch s {
+	case TimestampNone:
+		return "none"
+	case TimestampHost:
+		return "host"
+	case TimestampKernel:
+		return "kernel"
+	case TimestampHardware:
+		return "hardware"
+	case TimestampLog:
+		return "log"
+	}
+	return "unknown"
+}
+
+// DeviceClock converts an adapter's free-running receive counter into wall
+// time. The first reading is anchored to the host clock and later ones
+// advance from there at the device's rate, so the spacing between frames is
+// as precise as the counter rather than the link latency. When the two
+// clocks drift more than maxClockSkew apart, or the counter restarts, the
+// next reading is anchored afresh.
+//
+// Counters that wrap set Period; whole periods are counted with the host
+// clock, so gaps longer than a period are unwrapped correctly as long as
+// the link latency stays under half a period.
+//
+// The zero value is ready to use. A DeviceClock is meant for an adapter's
+// read loop and is not safe for concurrent use.
+type DeviceClock struct {
+	Period time.Duration // counter wrap-around period, 0 if it never wraps
+
+	anchor time.Time // host time of counter zero
+}
+
+// maxClockSkew is how far a DeviceClock lets the device and host clocks
+// disagree before re-anchoring.
+const maxClockSkew = time.Second
+
+// Time returns the wall time of a frame stamped d by the device counter.
+func (c *DeviceClock) Time(d time.Duration) time.Time {
+	now := time.Now()
+	if c.anchor.IsZero() {
+		c.anchor = now.Add(-d)
+		return now
+	}
+	t := c.anchor.Add(d)
+	if c.Period > 0 {
+		if behind := now.Sub(t); behind > c.Period/2 {
+			t = t.Add((behind + c.Period/2) / c.Period * c.Period)
+		}
+	}
+	if skew := now.Sub(t); skew > maxClockSkew || skew < -maxClockSkew {
+		c.anchor = now.Add(-d)
+		return now
+	}
+	return t
+}
+
+// Reset forgets the anchor, for when the device counter restarts (e.g. the
+// channel was reopened).
+func (c *DeviceClock) Reset() {
+	c.anchor = time.Time{}
+}
@@ -0,0 +1,32 @@
+package gocan
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeviceClock(t *testing.T) {
+	c := DeviceClock{Period: time.Minute}
+	first := c.Time(59900 * time.Millisecond)
+	if d := c.Time(59950 * time.Millisecond).Sub(first); d != 50*time.Millisecond {
+		t.Fatalf("want 50ms between readings, got %v", d)
+	}
+	// The counter wrapped: 59.9s + 300ms is 200ms on the counter.
+	if d := c.Time(200 * time.Millisecond).Sub(first); d != 300*time.Millisecond {
+		t.Fatalf("want 300ms across the wrap, got %v", d)
+	}
+
+	// A whole period without frames: the host clock says how many wraps.
+	c = DeviceClock{Period: time.Minute}
+	c.anchor = time.Now().Add(-2*time.Minute - 10*time.Second)
+	if d := time.Until(c.Time(10 * time.Second)); d > time.Millisecond || d < -time.Millisecond {
+		t.Fatalf("reading after two wraps is %v off the host clock", d)
+	}
+
+	// A counter restart re-anchors to the host clock.
+	c = DeviceClock{}
+	c.Time(time.Hour)
+	if d := time.Until(c.Time(time.Second)); d > time.Millisecond || d < -time.Millisecond {
+		t.Fatalf("restarted counter is %v off the host clock", d)
+	}
+}
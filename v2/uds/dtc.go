@@ -0,0 +1,134 @@
+package uds
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+)
+
+// ReadDTCInformation ($19) sub-functions.
+const (
+	ReportNumberOfDTCByStatusMask      = 0x01
+	ReportDTCByStatusMask              = 0x02
+	ReportDTCSnapshotIdentification    = 0x03
+	ReportDTCSnapshotRecordByDTCNumber = 0x04
+	ReportDTCStoredDataByRecordNumber  = 0x05
+	ReportDTCExtDataRecordByDTCNumber  = 0x06
+	ReportNumberOfDTCBySeverityMask    = 0x07
+	ReportDTCBySeverityMaskRecord      = 0x08
+	ReportSupportedDTC                 = 0x0A
+	ReportFirstTestFailedDTC           = 0x0B
+	ReportFirstConfirmedDTC            = 0x0C
+	ReportMostRecentTestFailedDTC      = 0x0D
+	ReportMostRecentConfirmedDTC       = 0x0E
+	ReportDTCFaultDetectionCounter     = 0x14
+	ReportDTCWithPermanentStatus       = 0x15
+)
+
+// DTC status bits (ISO 14229-1 D.2).
+const (
+	StatusTestFailed                         = 0x01
+	StatusTestFailedThisOperationCycle       = 0x02
+	StatusPendingDTC                         = 0x04
+	StatusConfirmedDTC                       = 0x08
+	StatusTestNotCompletedSinceLastClear     = 0x10
+	StatusTestFailedSinceLastClear           = 0x20
+	StatusTestNotCompletedThisOperationCycle = 0x40
+	StatusWarningIndicatorRequested          = 0x80
+)
+
+// DTC is a 3-byte UDS trouble code with its status byte.
+type DTC struct {
+	Code   uint32 // 24-bit DTC: high two bytes are the SAE code, low byte the failure type
+	Status byte
+}
+
+// String formats the DTC the SAE J2012 way with the failure type appended,
+// e.g. "P0420-00".
+func (d DTC) String() string {
+	letters := [...]byte{'P', 'C', 'B', 'U'}
+	hi := byte(d.Code >> 16)
+	return fmt.Sprintf("%c%X%03X-%02X", letters[hi>>6], (hi>>4)&0x03, (d.Code>>8)&0x0FFF, byte(d.Code))
+}
+
+// ReadDTCInformation ($19) runs a raw sub-function and returns the response
+// after the echoed sub-function byte.
+func (cl *Client) ReadDTCInformation(ctx context.Context, sub byte, params ...byte) ([]byte, error) {
+	resp, err := cl.requestSub(ctx, SIDReadDTCInformation, sub, params...)
+	if err != nil {
+		return nil, err
+	}
+	return resp[2:], nil
+}
+
+// NumberOfDTCByStatusMask ($19 01) counts DTCs matching mask. It returns
+// the ECU's status availability mask, the DTC format identifier and the
+// count.
+func (cl *Client) NumberOfDTCByStatusMask(ctx context.Context, mask byte) (avail, format byte, count uint16, err error) {
+	d, err := cl.ReadDTCInformation(ctx, ReportNumberOfDTCByStatusMask, mask)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if len(d) < 4 {
+		return 0, 0, 0, fmt.Errorf("ReadDTCInformation: %w", ErrInvalidResponse)
+	}
+	return d[0], d[1], binary.BigEndian.Uint16(d[2:]), nil
+}
+
+// DTCByStatusMask ($19 02) lists DTCs matching mask, along with the ECU's
+// status availability mask.
+func (cl *Client) DTCByStatusMask(ctx context.Context, mask byte) (byte, []DTC, error) {
+	return cl.dtcList(ctx, ReportDTCByStatusMask, mask)
+}
+
+// SupportedDTC ($19 0A) lists every DTC the ECU supports.
+func (cl *Client) SupportedDTC(ctx context.Context) (byte, []DTC, error) {
+	return cl.dtcList(ctx, ReportSupportedDTC)
+}
+
+// DTCWithPermanentStatus ($19 15) lists permanent DTCs.
+func (cl *Client) DTCWithPermanentStatus(ctx context.Context) (byte, []DTC, error) {
+	return cl.dtcList(ctx, ReportDTCWithPermanentStatus)
+}
+
+// DTCSnapshotRecord ($19 04) returns the raw snapshot (freeze frame) records
+// stored for dtc; record 0xFF requests all of them.
+func (cl *Client) DTCSnapshotRecord(ctx context.Context, dtc uint32, record byte) ([]byte, error) {
+	return cl.dtcRecord(ctx, ReportDTCSnapshotRecordByDTCNumber, dtc, record)
+}
+
+// DTCExtendedDataRecord ($19 06) returns the raw extended data records
+// stored for dtc; record 0xFF requests all of them.
+func (cl *Client) DTCExtendedDataRecord(ctx context.Context, dtc uint32, record byte) ([]byte, error) {
+	return cl.dtcRecord(ctx, ReportDTCExtDataRecordByDTCNumber, dtc, record)
+}
+
+// dtcRecord requests a per-DTC record, checks the echoed DTC and returns
+// what follows its status byte.
+func (cl *Client) dtcRecord(ctx context.Context, sub byte, dtc uint32, record byte) ([]byte, error) {
+	d, err := cl.ReadDTCInformation(ctx, sub, byte(dtc>>16), byte(dtc>>8), byte(dtc), record)
+	if err != nil {
+		return nil, err
+	}
+	if len(d) < 4 || uint32(d[0])<<16|uint32(d[1])<<8|uint32(d[2]) != dtc&0xFFFFFF {
+		return nil, fmt.Errorf("ReadDTCInformation: %w", ErrInvalidResponse)
+	}
+	return d[4:], nil
+}
+
+// dtcList parses the availability mask + (DTC, status) list shared by the
+// listing sub-functions.
+func (cl *Client) dtcList(ctx context.Context, sub byte, params ...byte) (byte, []DTC, error) {
+	d, err := cl.ReadDTCInformation(ctx, sub, params...)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(d) < 1 || (len(d)-1)%4 != 0 {
+		return 0, nil, fmt.Errorf("ReadDTCInformation: %w", ErrInvalidResponse)
+	}
+	var out []DTC
+	for r := d[1:]; len(r) >= 4; r = r[4:] {
+		out = append(out, DTC{Code: uint32(r[0])<<16 | uint32(r[1])<<8 | uint32(r[2]), Status: r[3]})
+	}
+	return d[0], out, nil
+}
@@ -0,0 +1,210 @@
+package uds
+
+import (
+	"errors"
+	"fmt"
+)
+
+// NRC is a UDS negative response code (ISO 14229-1 Annex A).
+type NRC byte
+
+const (
+	NRCGeneralReject                          NRC = 0x10
+	NRCServiceNotSupported                    NRC = 0x11
+	NRCSubFunctionNotSupported                NRC = 0x12
+	NRCIncorrectMessageLengthOrInvalidFormat  NRC = 0x13
+	NRCResponseTooLong                        NRC = 0x14
+	NRCBusyRepeatRequest                      NRC = 0x21
+	NRCConditionsNotCorrect                   NRC = 0x22
+	NRCRequestSequenceError                   NRC = 0x24
+	NRCNoResponseFromSubnetComponent          NRC = 0x25
+	NRCFailurePreventsExecution               NRC = 0x26
+	NRCRequestOutOfRange                      NRC = 0x31
+	NRCSecurityAccessDenied                   NRC = 0x33
+	NRCInvalidKey                             NRC = 0x35
+	NRCExceededNumberOfAttempts               NRC = 0x36
+	NRCRequiredTimeDelayNotExpired            NRC = 0x37
+	NRCUploadDownloadNotAccepted              NRC = 0x70
+	NRCTransferDataSuspended                  NRC = 0x71
+	NRCGeneralProgrammingFailure              NRC = 0x72
+	NRCWrongBlockSequenceCounter              NRC = 0x73
+	NRCResponsePending                        NRC = 0x78
+	NRCSubFunctionNotSupportedInActiveSession NRC = 0x7E
+	NRCServiceNotSupportedInActiveSession     NRC = 0x7F
+	NRCRPMTooHigh                             NRC = 0x81
+	NRCRPMTooLow                              NRC = 0x82
+	NRCEngineIsRunning                        NRC = 0x83
+	NRCEngineIsNotRunning                     NRC = 0x84
+	NRCEngineRunTimeTooLow                    NRC = 0x85
+	NRCTemperatureTooHigh                     NRC = 0x86
+	NRCTemperatureTooLow                      NRC = 0x87
+	NRCVehicleSpeedTooHigh                    NRC = 0x88
+	NRCVehicleSpeedTooLow                     NRC = 0x89
+	NRCThrottlePedalTooHigh                   NRC = 0x8A
+	NRCThrottlePedalTooLow                    NRC = 0x8B
+	NRCTransmissionRangeNotInNeutral          NRC = 0x8C
+	NRCTransmissionRangeNotInGear             NRC = 0x8D
+	NRCBrakeSwitchNotClosed                   NRC = 0x8F
+	NRCShifterLeverNotInPark                  NRC = 0x90
+	NRCTorqueConverterClutchLocked            NRC = 0x91
+	NRCVoltageTooHigh                         NRC = 0x92
+	NRCVoltageTooLow                          NRC = 0x93
+)
+
+func (n NRC) String() string {
+	switch n {
+	case NRCGeneralReject:
+		return "general reject"
+	case NRCServiceNotSupported:
+		return "service not supported"
+	case NRCSubFunctionNotSupported:
+		return "sub-function not supported"
+	case NRCIncorrectMessageLengthOrInvalidFormat:
+		return "incorrect message length or invalid format"
+	case NRCResponseTooLong:
+		return "response too long"
+	case NRCBusyRepeatRequest:
+		return "busy, repeat request"
+	case NRCConditionsNotCorrect:
+		return "conditions not correct"
+	case NRCRequestSequenceError:
+		return "request sequence error"
+	case NRCNoResponseFromSubnetComponent:
+		return "no response from subnet component"
+	case NRCFailurePreventsExecution:
+		return "failure prevents execution of requested action"
+	case NRCRequestOutOfRange:
+		return "request out of range"
+	case NRCSecurityAccessDenied:
+		return "security access denied"
+	case NRCInvalidKey:
+		return "invalid key"
+	case NRCExceededNumberOfAttempts:
+		return "exceeded number of attempts"
+	case NRCRequiredTimeDelayNotExpired:
+		return "required time delay not expired"
+	case NRCUploadDownloadNotAccepted:
+		return "upload/download not accepted"
+	case NRCTransferDataSuspended:
+		return "transfer data suspended"
+	case NRCGeneralProgrammingFailure:
+		return "general programming failure"
+	case NRCWrongBlockSequenceCounter:
+		return "wrong block sequence counter"
+	case NRCResponsePending:
+		return "request correctly received, response pending"
+	case NRCSubFunctionNotSupportedInActiveSession:
+		return "sub-function not supported in active session"
+	case NRCServiceNotSupportedInActiveSession:
+		return "service not supported in active session"
+	case NRCRPMTooHigh:
+		return "RPM too high"
+	case NRCRPMTooLow:
+		return "RPM too low"
+	case NRCEngineIsRunning:
+		return "engine is running"
+	case NRCEngineIsNotRunning:
+		return "engine is not running"
+	case NRCEngineRunTimeTooLow:
+		return "engine run time too low"
+	case NRCTemperatureTooHigh:
+		return "temperature too high"
+	case NRCTemperatureTooLow:
+		return "temperature too low"
+	case NRCVehicleSpeedTooHigh:
+		return "vehicle speed too high"
+	case NRCVehicleSpeedTooLow:
+		return "vehicle speed too low"
+	case NRCThrottlePedalTooHigh:
+		return "throttle/pedal too high"
+	case NRCThrottlePedalTooLow:
+		return "throttle/pedal too low"
+	case NRCTransmissionRangeNotInNeutral:
+		return "transmission range not in neutral"
+	case NRCTransmissionRangeNotInGear:
+		return "transmission range not in gear"
+	case NRCBrakeSwitchNotClosed:
+		return "brake switch(es) not closed"
+	case NRCShifterLeverNotInPark:
+		return "shifter lever not in park"
+	case NRCTorqueConverterClutchLocked:
+		return "torque converter clutch locked"
+	case NRCVoltageTooHigh:
+		return "voltage too high"
+	case NRCVoltageTooLow:
+		return "voltage too low"
+	}
+	switch {
+	case n >= 0x38 && n <= 0x4F:
+		return "reserved by extended data link security"
+	case n >= 0x94 && n <= 0xEF:
+		return "reserved for specific conditions not correct"
+	case n >= 0xF0 && n <= 0xFE:
+		return "vehicle manufacturer specific"
+	}
+	return "unknown"
+}
+
+// NegativeResponseError is a negative response (0x7F) from the ECU.
+type NegativeResponseError struct {
+	Service byte
+	Code    NRC
+}
+
+func (e *NegativeResponseError) Error() string {
+	return fmt.Sprintf("%s: %s (0x%02X)", ServiceName(e.Service), e.Code, byte(e.Code))
+}
+
+// IsNRC reports whether err is a negative response carrying code.
+func IsNRC(err error, code NRC) bool {
+	var nr *NegativeResponseError
+	return errors.As(err, &nr) && nr.Code == code
+}
+
+// ErrInvalidResponse is returned when a positive response does not match the
+// request (wrong service, echoed parameter or length).
+var ErrInvalidResponse = errors.New("uds: invalid response")
+
+// ServiceName returns the ISO 14229 name of a service identifier.
+func ServiceName(sid byte) string {
+	switch sid {
+	case SIDDiagnosticSessionControl:
+		return "DiagnosticSessionControl"
+	case SIDECUReset:
+		return "ECUReset"
+	case SIDClearDiagnosticInformation:
+		return "ClearDiagnosticInformation"
+	case SIDReadDTCInformation:
+		return "ReadDTCInformation"
+	case SIDReadDataByIdentifier:
+		return "ReadDataByIdentifier"
+	case SIDReadMemoryByAddress:
+		return "ReadMemoryByAddress"
+	case SIDSecurityAccess:
+		return "SecurityAccess"
+	case SIDCommunicationControl:
+		return "CommunicationControl"
+	case SIDWriteDataByIdentifier:
+		return "WriteDataByIdentifier"
+	case SIDInputOutputControlByIdentifier:
+		return "InputOutputControlByIdentifier"
+	case SIDRoutineControl:
+		return "RoutineControl"
+	case SIDRequestDownload:
+		return "RequestDownload"
+	case SIDRequestUpload:
+		return "RequestUpload"
+	case SIDTransferData:
+		return "TransferData"
+	case SIDRequestTransferExit:
+		return "RequestTransferExit"
+	case SIDWriteMemoryByAddress:
+		return "WriteMemoryByAddress"
+	case SIDTesterPresent:
+		return "TesterPresent"
+	case SIDControlDTCSetting:
+		return "ControlDTCSetting"
+	default:
+		return fmt.Sprintf("Service 0x%02X", sid)
+	}
+}
@@ -0,0 +1,469 @@
+// Package uds implements the Unified Diagnostic Services (ISO 14229-1) client
+// side on a gocan v2 bus, carried over ISO-TP (see package isotp).
+//
+//	cl := uds.New(bus, 0x7E0, 0x7E8)
+//	if _, err := cl.DiagnosticSessionControl(ctx, uds.SessionExtended); err != nil { ... }
+//	vin, err := cl.ReadDataByIdentifier(ctx, 0xF190)
+//
+// Negative responses are returned as *NegativeResponseError; responsePending
+// (0x78) is waited out transparently and busyRepeatRequest (0x21) retried.
+package uds
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	gocan "github.com/roffe/gocan/v2"
+	"github.com/roffe/gocan/v2/isotp"
+)
+
+// Service identifiers.
+const (
+	SIDDiagnosticSessionControl       = 0x10
+	SIDECUReset                       = 0x11
+	SIDClearDiagnosticInformation     = 0x14
+	SIDReadDTCInformation             = 0x19
+	SIDReadDataByIdentifier           = 0x22
+	SIDReadMemoryByAddress            = 0x23
+	SIDSecurityAccess                 = 0x27
+	SIDCommunicationControl           = 0x28
+	SIDWriteDataByIdentifier          = 0x2E
+	SIDInputOutputControlByIdentifier = 0x2F
+	SIDRoutineControl                 = 0x31
+	SIDRequestDownload                = 0x34
+	SIDRequestUpload                  = 0x35
+	SIDTransferData                   = 0x36
+	SIDRequestTransferExit            = 0x37
+	SIDWriteMemoryByAddress           = 0x3D
+	SIDTesterPresent                  = 0x3E
+	SIDControlDTCSetting              = 0x85
+
+	negativeResponse = 0x7F
+	positiveOffset   = 0x40
+	// suppressPosRsp is the sub-function bit asking the ECU not to reply.
+	suppressPosRsp = 0x80
+)
+
+// Diagnostic sessions for DiagnosticSessionControl.
+const (
+	SessionDefault      = 0x01
+	SessionProgramming  = 0x02
+	SessionExtended     = 0x03
+	SessionSafetySystem = 0x04
+)
+
+// Reset types for ECUReset.
+const (
+	ResetHard                      = 0x01
+	ResetKeyOffOn                  = 0x02
+	ResetSoft                      = 0x03
+	ResetEnableRapidPowerShutDown  = 0x04
+	ResetDisableRapidPowerShutDown = 0x05
+)
+
+// Routine control types for RoutineControl.
+const (
+	RoutineStart          = 0x01
+	RoutineStop           = 0x02
+	RoutineRequestResults = 0x03
+)
+
+// Control types and communication types for CommunicationControl.
+const (
+	CommEnableRxAndTx     = 0x00
+	CommEnableRxDisableTx = 0x01
+	CommDisableRxEnableTx = 0x02
+	CommDisableRxAndTx    = 0x03
+
+	CommNormal            = 0x01
+	CommNetworkManagement = 0x02
+	CommNormalAndNM       = 0x03
+)
+
+type Option func(*Client)
+
+// Client talks UDS to one ECU.
+type Client struct {
+	tp             *isotp.Conn
+	tpOpts         []isotp.Option
+	defaultTimeout time.Duration
+	pendingTimeout time.Duration
+}
+
+// New creates a client sending requests on txID and reading responses on
+// rxID.
+func New(bus *gocan.Bus, txID, rxID uint32, opts ...Option) *Client {
+	cl := &Client{
+		defaultTimeout: 500 * time.Millisecond,
+		pendingTimeout: 5 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(cl)
+	}
+	cl.tp = isotp.New(bus, txID, rxID, cl.tpOpts...)
+	return cl
+}
+
+// WithDefaultTimeout sets how long to wait for a response (P2client). The
+// default is 500 ms.
+func WithDefaultTimeout(timeout time.Duration) Option {
+	return func(cl *Client) { cl.defaultTimeout = timeout }
+}
+
+// WithPendingTimeout sets how long to wait for the final response after each
+// responsePending (P2*client). The default is 5 s.
+func WithPendingTimeout(timeout time.Duration) Option {
+	return func(cl *Client) { cl.pendingTimeout = timeout }
+}
+
+// WithTransportOptions passes options (padding, addressing, block size, ...)
+// to the underlying ISO-TP link.
+func WithTransportOptions(opts ...isotp.Option) Option {
+	return func(cl *Client) { cl.tpOpts = append(cl.tpOpts, opts...) }
+}
+
+// Transport returns the ISO-TP link the client runs on.
+func (cl *Client) Transport() *isotp.Conn { return cl.tp }
+
+// busyRepeatRequest (0x21) means "repeat the request": give the ECU a moment
+// and try again before surfacing the error.
+const (
+	busyRetries    = 3
+	busyRetryDelay = 100 * time.Millisecond
+)
+
+// Request sends a raw service request and returns the positive response,
+// SID included. Negative responses are returned as *NegativeResponseError,
+// responsePending is waited out and busyRepeatRequest retried.
+func (cl *Client) Request(ctx context.Context, req []byte) ([]byte, error) {
+	if len(req) == 0 {
+		return nil, errors.New("uds: empty request")
+	}
+	for attempt := 0; ; attempt++ {
+		resp, err := cl.exchange(ctx, req)
+		if attempt < busyRetries && IsNRC(err, NRCBusyRepeatRequest) {
+			select {
+			case <-time.After(busyRetryDelay):
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		return resp, err
+	}
+}
+
+// exchange runs one request/response, following responsePending. The
+// subscription is held across the pending replies so the final response
+// cannot slip through between receives.
+func (cl *Client) exchange(ctx context.Context, req []byte) ([]byte, error) {
+	sctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ch := cl.tp.Bus().Subscribe(sctx, cl.tp.RxID())
+	rctx := gocan.WithExpectedResponses(ctx, 1)
+	if err := cl.tp.Send(rctx, req); err != nil {
+		return nil, fmt.Errorf("%s: %w", ServiceName(req[0]), err)
+	}
+	timeout := cl.defaultTimeout
+	for {
+		tctx, tcancel := context.WithTimeout(ctx, timeout)
+		resp, err := cl.tp.RecvFrom(tctx, ch)
+		tcancel()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", ServiceName(req[0]), err)
+		}
+		if len(resp) >= 3 && resp[0] == negativeResponse && resp[1] == req[0] {
+			if NRC(resp[2]) == NRCResponsePending {
+				timeout = cl.pendingTimeout
+				continue
+			}
+			return nil, &NegativeResponseError{Service: req[0], Code: NRC(resp[2])}
+		}
+		if len(resp) == 0 || resp[0] != req[0]+positiveOffset {
+			continue // not ours (e.g. a late reply to an earlier request)
+		}
+		return resp, nil
+	}
+}
+
+// send transmits a request that expects no response (suppressPosRsp).
+func (cl *Client) send(ctx context.Context, req []byte) error {
+	if err := cl.tp.Send(ctx, req); err != nil {
+		return fmt.Errorf("%s: %w", ServiceName(req[0]), err)
+	}
+	return nil
+}
+
+// requestSub is Request for services with a sub-function, checking that the
+// response echoes it.
+func (cl *Client) requestSub(ctx context.Context, sid, sub byte, params ...byte) ([]byte, error) {
+	resp, err := cl.Request(ctx, append([]byte{sid, sub}, params...))
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) < 2 || resp[1] != sub&^suppressPosRsp {
+		return nil, fmt.Errorf("%s: %w", ServiceName(sid), ErrInvalidResponse)
+	}
+	return resp, nil
+}
+
+// SessionTiming is the server timing reported in a DiagnosticSessionControl
+// response.
+type SessionTiming struct {
+	P2     time.Duration // P2server_max
+	P2Star time.Duration // P2*server_max
+}
+
+// DiagnosticSessionControl ($10) switches the ECU to the given session and
+// returns the timing it announces.
+func (cl *Client) DiagnosticSessionControl(ctx context.Context, session byte) (SessionTiming, error) {
+	resp, err := cl.requestSub(ctx, SIDDiagnosticSessionControl, session)
+	if err != nil {
+		return SessionTiming{}, err
+	}
+	var t SessionTiming
+	if len(resp) >= 6 {
+		t.P2 = time.Duration(binary.BigEndian.Uint16(resp[2:])) * time.Millisecond
+		t.P2Star = time.Duration(binary.BigEndian.Uint16(resp[4:])) * 10 * time.Millisecond
+	}
+	return t, nil
+}
+
+// ECUReset ($11) resets the ECU.
+func (cl *Client) ECUReset(ctx context.Context, resetType byte) error {
+	_, err := cl.requestSub(ctx, SIDECUReset, resetType)
+	return err
+}
+
+// SecurityAccessRequestSeed ($27, odd sub-function) requests the seed for
+// level. An all-zero seed means the level is already unlocked.
+func (cl *Client) SecurityAccessRequestSeed(ctx context.Context, level byte) ([]byte, error) {
+	resp, err := cl.requestSub(ctx, SIDSecurityAccess, level)
+	if err != nil {
+		return nil, err
+	}
+	return resp[2:], nil
+}
+
+// SecurityAccessSendKey ($27, even sub-function) sends the key for level,
+// where level is the odd requestSeed value.
+func (cl *Client) SecurityAccessSendKey(ctx context.Context, level byte, key []byte) error {
+	_, err := cl.requestSub(ctx, SIDSecurityAccess, level+1, key...)
+	return err
+}
+
+// RequestSecurityAccess performs the full seed/key exchange for level,
+// computing the key with keyfunc. A zero seed is accepted as already
+// unlocked.
+func (cl *Client) RequestSecurityAccess(ctx context.Context, level byte, keyfunc func(seed []byte, level byte) ([]byte, error)) error {
+	seed, err := cl.SecurityAccessRequestSeed(ctx, level)
+	if err != nil {
+		return err
+	}
+	unlocked := true
+	for _, b := range seed {
+		if b != 0 {
+			unlocked = false
+			break
+		}
+	}
+	if unlocked {
+		return nil
+	}
+	key, err := keyfunc(seed, level)
+	if err != nil {
+		return fmt.Errorf("SecurityAccess: %w", err)
+	}
+	return cl.SecurityAccessSendKey(ctx, level, key)
+}
+
+// CommunicationControl ($28) enables or disables normal message
+// transmission/reception.
+func (cl *Client) CommunicationControl(ctx context.Context, control, commType byte) error {
+	_, err := cl.requestSub(ctx, SIDCommunicationControl, control, commType)
+	return err
+}
+
+// TesterPresent ($3E) keeps a non-default session alive, waiting for the
+// positive response.
+func (cl *Client) TesterPresent(ctx context.Context) error {
+	_, err := cl.requestSub(ctx, SIDTesterPresent, 0x00)
+	return err
+}
+
+// TesterPresentNoResponse ($3E 80) keeps a non-default session alive
+// without asking for a response.
+func (cl *Client) TesterPresentNoResponse(ctx context.Context) error {
+	return cl.send(ctx, []byte{SIDTesterPresent, suppressPosRsp})
+}
+
+// ReadDataByIdentifier ($22) reads a single data identifier.
+func (cl *Client) ReadDataByIdentifier(ctx context.Context, did uint16) ([]byte, error) {
+	out, err := cl.ReadDataByIdentifiers(ctx, DID{ID: did})
+	if err != nil {
+		return nil, err
+	}
+	return out[0], nil
+}
+
+// DID names a data identifier to read and its record length. UDS responses
+// concatenate records without framing, so the length of every record but
+// the last must be known up front; a Length of 0 on the last DID takes the
+// rest of the response.
+type DID struct {
+	ID     uint16
+	Length int
+}
+
+// ReadDataByIdentifiers ($22) reads several data identifiers in one request
+// and returns their records in request order.
+func (cl *Client) ReadDataByIdentifiers(ctx context.Context, dids ...DID) ([][]byte, error) {
+	if len(dids) == 0 {
+		return nil, errors.New("ReadDataByIdentifier: no identifiers")
+	}
+	req := []byte{SIDReadDataByIdentifier}
+	for i, d := range dids {
+		if d.Length <= 0 && i != len(dids)-1 {
+			return nil, fmt.Errorf("ReadDataByIdentifier: length of 0x%04X must be known", d.ID)
+		}
+		req = binary.BigEndian.AppendUint16(req, d.ID)
+	}
+	resp, err := cl.Request(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	out := make([][]byte, 0, len(dids))
+	rest := resp[1:]
+	for i, d := range dids {
+		if len(rest) < 2 || binary.BigEndian.Uint16(rest) != d.ID {
+			return nil, fmt.Errorf("ReadDataByIdentifier: 0x%04X: %w", d.ID, ErrInvalidResponse)
+		}
+		rest = rest[2:]
+		n := d.Length
+		if n <= 0 && i == len(dids)-1 {
+			n = len(rest)
+		}
+		if n > len(rest) {
+			return nil, fmt.Errorf("ReadDataByIdentifier: 0x%04X short record: %w", d.ID, ErrInvalidResponse)
+		}
+		out = append(out, rest[:n])
+		rest = rest[n:]
+	}
+	return out, nil
+}
+
+// WriteDataByIdentifier ($2E) writes data to a data identifier.
+func (cl *Client) WriteDataByIdentifier(ctx context.Context, did uint16, data []byte) error {
+	req := binary.BigEndian.AppendUint16([]byte{SIDWriteDataByIdentifier}, did)
+	resp, err := cl.Request(ctx, append(req, data...))
+	if err != nil {
+		return err
+	}
+	if len(resp) < 3 || binary.BigEndian.Uint16(resp[1:]) != did {
+		return fmt.Errorf("WriteDataByIdentifier: %w", ErrInvalidResponse)
+	}
+	return nil
+}
+
+// ReadMemoryByAddress ($23) reads size bytes at address, using 4-byte
+// address and size parameters.
+func (cl *Client) ReadMemoryByAddress(ctx context.Context, address, size uint32) ([]byte, error) {
+	req := []byte{SIDReadMemoryByAddress, 0x44}
+	req = binary.BigEndian.AppendUint32(req, address)
+	req = binary.BigEndian.AppendUint32(req, size)
+	resp, err := cl.Request(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return resp[1:], nil
+}
+
+// RoutineControl ($31) starts, stops or requests the results of a routine
+// and returns the routine status record.
+func (cl *Client) RoutineControl(ctx context.Context, control byte, routine uint16, params ...byte) ([]byte, error) {
+	req := binary.BigEndian.AppendUint16([]byte{SIDRoutineControl, control}, routine)
+	resp, err := cl.Request(ctx, append(req, params...))
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) < 4 || resp[1] != control || binary.BigEndian.Uint16(resp[2:]) != routine {
+		return nil, fmt.Errorf("RoutineControl: %w", ErrInvalidResponse)
+	}
+	return resp[4:], nil
+}
+
+// RequestDownload ($34) prepares the ECU to receive size bytes at address
+// and returns the maximum TransferData request length it accepts (SID and
+// sequence counter included). dataFormat is the compression/encryption
+// method, 0x00 for plain data.
+func (cl *Client) RequestDownload(ctx context.Context, dataFormat byte, address, size uint32) (int, error) {
+	return cl.requestTransfer(ctx, SIDRequestDownload, dataFormat, address, size)
+}
+
+// RequestUpload ($35) prepares the ECU to send size bytes from address and
+// returns the maximum TransferData response length it will use.
+func (cl *Client) RequestUpload(ctx context.Context, dataFormat byte, address, size uint32) (int, error) {
+	return cl.requestTransfer(ctx, SIDRequestUpload, dataFormat, address, size)
+}
+
+func (cl *Client) requestTransfer(ctx context.Context, sid, dataFormat byte, address, size uint32) (int, error) {
+	req := []byte{sid, dataFormat, 0x44}
+	req = binary.BigEndian.AppendUint32(req, address)
+	req = binary.BigEndian.AppendUint32(req, size)
+	resp, err := cl.Request(ctx, req)
+	if err != nil {
+		return 0, err
+	}
+	if len(resp) < 2 {
+		return 0, fmt.Errorf("%s: %w", ServiceName(sid), ErrInvalidResponse)
+	}
+	n := int(resp[1] >> 4)
+	if n == 0 || n > 8 || len(resp) < 2+n {
+		return 0, fmt.Errorf("%s: bad maxNumberOfBlockLength: %w", ServiceName(sid), ErrInvalidResponse)
+	}
+	var maxLen int
+	for _, b := range resp[2 : 2+n] {
+		maxLen = maxLen<<8 | int(b)
+	}
+	return maxLen, nil
+}
+
+// TransferData ($36) sends (download) or fetches (upload) one block. seq is
+// the block sequence counter, starting at 1 and wrapping to 0 after 0xFF.
+// It returns the transferResponseParameterRecord, the block data for
+// uploads.
+func (cl *Client) TransferData(ctx context.Context, seq byte, data []byte) ([]byte, error) {
+	resp, err := cl.Request(ctx, append([]byte{SIDTransferData, seq}, data...))
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) < 2 || resp[1] != seq {
+		return nil, fmt.Errorf("TransferData: %w", ErrInvalidResponse)
+	}
+	return resp[2:], nil
+}
+
+// RequestTransferExit ($37) ends a download or upload.
+func (cl *Client) RequestTransferExit(ctx context.Context, params ...byte) ([]byte, error) {
+	resp, err := cl.Request(ctx, append([]byte{SIDRequestTransferExit}, params...))
+	if err != nil {
+		return nil, err
+	}
+	return resp[1:], nil
+}
+
+// ClearDiagnosticInformation ($14) clears DTCs of the given group (0xFFFFFF
+// for all).
+func (cl *Client) ClearDiagnosticInformation(ctx context.Context, group uint32) error {
+	_, err := cl.Request(ctx, []byte{SIDClearDiagnosticInformation, byte(group >> 16), byte(group >> 8), byte(group)})
+	return err
+}
+
+// ControlDTCSetting ($85) turns DTC setting on (0x01) or off (0x02).
+func (cl *Client) ControlDTCSetting(ctx context.Context, setting byte) error {
+	_, err := cl.requestSub(ctx, SIDControlDTCSetting, setting)
+	return err
+}
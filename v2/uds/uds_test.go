@@ -0,0 +1,139 @@
+package uds
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/roffe/gocan/v2/internal/ecutest"
+)
+
+// fakeECU answers requests on 0x7E0 from 0x7E8 with whatever handle returns;
+// each returned PDU is sent as a separate response.
+func fakeECU(t *testing.T, handle func(req []byte) [][]byte) *Client {
+	t.Helper()
+	bus := ecutest.Loopback(t)
+	ecutest.Serve(t, bus, 0x7E8, 0x7E0, handle)
+	return New(bus, 0x7E0, 0x7E8)
+}
+
+func TestReadDataByIdentifiers(t *testing.T) {
+	vin := []byte("YS3FB45F231234567")
+	cl := fakeECU(t, func(req []byte) [][]byte {
+		if !bytes.Equal(req, []byte{0x22, 0xF1, 0x90, 0xF1, 0x8C}) {
+			return [][]byte{{0x7F, req[0], byte(NRCRequestOutOfRange)}}
+		}
+		resp := append([]byte{0x62, 0xF1, 0x90}, vin...)
+		return [][]byte{append(resp, 0xF1, 0x8C, 0x01, 0x02, 0x03)}
+	})
+	recs, err := cl.ReadDataByIdentifiers(t.Context(), DID{ID: 0xF190, Length: len(vin)}, DID{ID: 0xF18C})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(recs[0], vin) || !bytes.Equal(recs[1], []byte{1, 2, 3}) {
+		t.Fatalf("unexpected records % X", recs)
+	}
+
+	_, err = cl.ReadDataByIdentifier(t.Context(), 0x1234)
+	var nr *NegativeResponseError
+	if !errors.As(err, &nr) || nr.Code != NRCRequestOutOfRange || nr.Service != SIDReadDataByIdentifier {
+		t.Fatalf("want requestOutOfRange, got %v", err)
+	}
+	if want := "ReadDataByIdentifier: request out of range (0x31)"; err.Error() != want {
+		t.Fatalf("error text %q, want %q", err, want)
+	}
+}
+
+func TestResponsePending(t *testing.T) {
+	cl := fakeECU(t, func(req []byte) [][]byte {
+		return [][]byte{
+			{0x7F, req[0], byte(NRCResponsePending)},
+			{0x7F, req[0], byte(NRCResponsePending)},
+			{0x71, 0x01, 0xFF, 0x00, 0xAA},
+		}
+	})
+	ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+	defer cancel()
+	status, err := cl.RoutineControl(ctx, RoutineStart, 0xFF00)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(status, []byte{0xAA}) {
+		t.Fatalf("status % X", status)
+	}
+}
+
+func TestSecurityAccess(t *testing.T) {
+	cl := fakeECU(t, func(req []byte) [][]byte {
+		switch {
+		case bytes.Equal(req, []byte{0x27, 0x01}):
+			return [][]byte{{0x67, 0x01, 0x12, 0x34}}
+		case bytes.Equal(req, []byte{0x27, 0x02, 0xED, 0xCB}):
+			return [][]byte{{0x67, 0x02}}
+		default:
+			return [][]byte{{0x7F, 0x27, byte(NRCInvalidKey)}}
+		}
+	})
+	invert := func(seed []byte, _ byte) ([]byte, error) {
+		out := make([]byte, len(seed))
+		for i, b := range seed {
+			out[i] = ^b
+		}
+		return out, nil
+	}
+	if err := cl.RequestSecurityAccess(t.Context(), 0x01, invert); err != nil {
+		t.Fatal(err)
+	}
+	wrong := func([]byte, byte) ([]byte, error) { return []byte{0, 0}, nil }
+	if err := cl.RequestSecurityAccess(t.Context(), 0x01, wrong); !IsNRC(err, NRCInvalidKey) {
+		t.Fatalf("want invalidKey, got %v", err)
+	}
+}
+
+func TestRequestDownload(t *testing.T) {
+	cl := fakeECU(t, func(req []byte) [][]byte {
+		switch req[0] {
+		case SIDRequestDownload:
+			return [][]byte{{0x74, 0x20, 0x0F, 0xFA}}
+		case SIDTransferData:
+			return [][]byte{{0x76, req[1]}}
+		case SIDRequestTransferExit:
+			return [][]byte{{0x77}}
+		}
+		return nil
+	})
+	n, err := cl.RequestDownload(t.Context(), 0x00, 0x8000, 0x100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0x0FFA {
+		t.Fatalf("maxNumberOfBlockLength %d", n)
+	}
+	if _, err := cl.TransferData(t.Context(), 1, make([]byte, 200)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cl.RequestTransferExit(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDTCByStatusMask(t *testing.T) {
+	cl := fakeECU(t, func(req []byte) [][]byte {
+		return [][]byte{{0x59, 0x02, 0xFF, 0x04, 0x20, 0x00, 0x09, 0xC1, 0x23, 0x45, 0x08}}
+	})
+	avail, dtcs, err := cl.DTCByStatusMask(t.Context(), StatusConfirmedDTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if avail != 0xFF || len(dtcs) != 2 {
+		t.Fatalf("avail %02X dtcs %v", avail, dtcs)
+	}
+	if got := dtcs[0].String(); got != "P0420-00" {
+		t.Errorf("dtc 0 = %s", got)
+	}
+	if got := dtcs[1].String(); got != "U0123-45" {
+		t.Errorf("dtc 1 = %s", got)
+	}
+}
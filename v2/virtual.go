@@ -0,0 +1,318 @@
+package gocan
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+func init() {
+	Register(AdapterInfo{
+		Name:         "virtual",
+		Description:  "in-process virtual CAN network; buses opened on the same Port share it",
+		Capabilities: Capabilities{FD: true, ListenOnly: true},
+		New:          newVirtualAdapter,
+	})
+}
+
+// newVirtualAdapter joins the network named by cfg.Port. CANRate and
+// CANDataRate set the network's bit rates if it has none yet and must
+// match them otherwise. Extra "latency" (a duration) and "echo" (a bool)
+// configure the node.
+func newVirtualAdapter(cfg Config) (Adapter, error) {
+	nc := VirtualNodeConfig{ListenOnly: cfg.ListenOnly}
+	if v := cfg.Extra["latency"]; v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid latency %q: %w", v, err)
+		}
+		nc.Latency = d
+	}
+	if v := cfg.Extra["echo"]; v != "" {
+		echo, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid echo %q: %w", v, err)
+		}
+		nc.Echo = echo
+	}
+	n := Virtual(cfg.Port)
+	if cfg.CANRate > 0 {
+		n.mu.Lock()
+		if n.bitrate == 0 {
+			n.bitrate, n.dataBitrate = cfg.CANRate*1000, cfg.CANDataRate*1000
+		}
+		rate, dataRate := n.bitrate/1000, n.dataBitrate/1000
+		n.mu.Unlock()
+		if rate != cfg.CANRate || cfg.CANDataRate > 0 && dataRate != cfg.CANDataRate {
+			return nil, fmt.Errorf("virtual network %q runs at %v/%v kbit/s", n.name, rate, dataRate)
+		}
+	}
+	return n.Node(nc), nil
+}
+
+var (
+	virtualMu       sync.Mutex
+	virtualNetworks = make(map[string]*VirtualNetwork)
+)
+
+// Virtual returns the in-process virtual network with the given name,
+// creating it on first use. Named networks live for the rest of the
+// process, so buses opened anywhere in it with the "virtual" adapter and
+// the same Config.Port talk to each other.
+func Virtual(name string) *VirtualNetwork {
+	virtualMu.Lock()
+	defer virtualMu.Unlock()
+	n, ok := virtualNetworks[name]
+	if !ok {
+		n = NewVirtualNetwork()
+		n.name = name
+		virtualNetworks[name] = n
+	}
+	return n
+}
+
+// VirtualNetwork is a CAN network simulated in process: every frame a node
+// sends reaches all the other nodes, in the same order everywhere. Without
+// a bit rate frames go through as fast as they are sent. With one, the
+// network carries one frame at a time for as long as it would take on a
+// real bus, and frames waiting to go are arbitrated by identifier the way
+// controllers do, lowest first.
+type VirtualNetwork struct {
+	name string
+
+	mu          sync.Mutex
+	nodes       []*VirtualNode
+	bitrate     float64 // bit/s, 0 for no timing
+	dataBitrate float64
+	pending     []*virtualTx // waiting for the wire, in send order
+	running     bool         // the wire goroutine is up
+	idle        time.Time    // when the frame on the wire ends
+}
+
+// virtualTx is a frame waiting for the wire.
+type virtualTx struct {
+	from *VirtualNode
+	f    Frame
+	done chan struct{} // closed once the frame is on every node's queue
+}
+
+// NewVirtualNetwork returns a private virtual network, for tests that
+// should not share one with the rest of the process.
+func NewVirtualNetwork() *VirtualNetwork {
+	return &VirtualNetwork{}
+}
+
+// SetBitrate sets the simulated bit rate and CAN FD data phase bit rate in
+// kbit/s, like Config.CANRate and Config.CANDataRate. A rate of 0 turns
+// timing off; a data rate of 0 sends FD data phases at the nominal rate.
+func (n *VirtualNetwork) SetBitrate(rate, dataRate float64) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.bitrate, n.dataBitrate = rate*1000, dataRate*1000
+}
+
+// VirtualNodeConfig configures a node on a virtual network.
+type VirtualNodeConfig struct {
+	// Latency delays every frame the node receives, as a slow adapter or
+	// driver would.
+	Latency time.Duration
+	// Echo also delivers the node's own frames back to it once sent.
+	Echo bool
+	// ListenOnly makes the node refuse to send, like a silent controller.
+	ListenOnly bool
+}
+
+// Node returns an adapter that joins the network when opened on a Bus and
+// leaves it when closed.
+func (n *VirtualNetwork) Node(cfg VirtualNodeConfig) *VirtualNode {
+	return &VirtualNode{net: n, cfg: cfg, wake: make(chan struct{}, 1)}
+}
+
+// VirtualNode is a Bus's adapter on a virtual network.
+type VirtualNode struct {
+	net *VirtualNetwork
+	cfg VirtualNodeConfig
+	bus *Bus
+
+	mu   sync.Mutex
+	rx   []virtualRx // frames on their way to the bus
+	wake chan struct{}
+}
+
+type virtualRx struct {
+	f   Frame
+	due time.Time
+}
+
+func (v *VirtualNode) Open(ctx context.Context, bus *Bus) error {
+	v.bus = bus
+	n := v.net
+	n.mu.Lock()
+	n.nodes = append(n.nodes, v)
+	n.mu.Unlock()
+	go v.receive(ctx)
+	return nil
+}
+
+// Send returns once the frame has been on the wire, so with a bit rate set
+// it also waits for arbitration and the frames that won it.
+func (v *VirtualNode) Send(ctx context.Context, f Frame) error {
+	if v.cfg.ListenOnly {
+		return ErrListenOnly
+	}
+	n := v.net
+	n.mu.Lock()
+	if !slices.Contains(n.nodes, v) {
+		n.mu.Unlock()
+		return ErrClosed
+	}
+	if n.bitrate <= 0 {
+		n.broadcast(v, f)
+		n.mu.Unlock()
+		return nil
+	}
+	tx := &virtualTx{from: v, f: f, done: make(chan struct{})}
+	n.pending = append(n.pending, tx)
+	if !n.running {
+		n.running = true
+		go n.run()
+	}
+	n.mu.Unlock()
+	select {
+	case <-tx.done:
+		return nil
+	case <-ctx.Done():
+	}
+	n.mu.Lock()
+	i := slices.Index(n.pending, tx)
+	if i >= 0 {
+		n.pending = slices.Delete(n.pending, i, i+1)
+	}
+	n.mu.Unlock()
+	if i < 0 {
+		// Already on the wire: it goes out regardless.
+		<-tx.done
+		return nil
+	}
+	return ctx.Err()
+}
+
+func (v *VirtualNode) Close() error {
+	n := v.net
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.nodes = slices.DeleteFunc(n.nodes, func(o *VirtualNode) bool { return o == v })
+	return nil
+}
+
+// receive delivers queued frames to the bus once they are due.
+func (v *VirtualNode) receive(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		v.mu.Lock()
+		var batch []Frame
+		for len(v.rx) > 0 && !time.Now().Before(v.rx[0].due) {
+			batch = append(batch, v.rx[0].f)
+			v.rx = v.rx[1:]
+		}
+		wait := time.Hour
+		if len(v.rx) > 0 {
+			wait = time.Until(v.rx[0].due)
+		}
+		v.mu.Unlock()
+		for _, f := range batch {
+			v.bus.Deliver(f)
+		}
+		timer.Reset(wait)
+		select {
+		case <-ctx.Done():
+			return
+		case <-v.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// broadcast queues f on every node that should see it. Called with n.mu
+// held, which keeps the order the same on every node.
+func (n *VirtualNetwork) broadcast(from *VirtualNode, f Frame) {
+	now := time.Now()
+	for _, v := range n.nodes {
+		if v == from && !v.cfg.Echo {
+			continue
+		}
+		v.mu.Lock()
+		v.rx = append(v.rx, virtualRx{f: f, due: now.Add(v.cfg.Latency)})
+		v.mu.Unlock()
+		select {
+		case v.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// run is the wire: it sends pending frames one at a time, each taking its
+// time on the bus, until none are left.
+func (n *VirtualNetwork) run() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for len(n.pending) > 0 {
+		// Arbitration: frames queued while the last one was on the wire
+		// compete, and the lowest arbitration field wins.
+		i := 0
+		for j, tx := range n.pending {
+			if arbitration(&tx.f) < arbitration(&n.pending[i].f) {
+				i = j
+			}
+		}
+		tx := n.pending[i]
+		n.pending = slices.Delete(n.pending, i, i+1)
+		start := time.Now()
+		if n.idle.After(start) {
+			start = n.idle
+		}
+		end := start.Add(n.frameTime(&tx.f))
+		n.idle = end
+		n.mu.Unlock()
+		time.Sleep(time.Until(end))
+		n.mu.Lock()
+		n.broadcast(tx.from, tx.f)
+		close(tx.done)
+	}
+	n.running = false
+}
+
+// frameTime is how long f occupies the wire. Call with n.mu held.
+func (n *VirtualNetwork) frameTime(f *Frame) time.Duration {
+	nominal, data := FrameBits(f)
+	secs := float64(nominal) / n.bitrate
+	if data > 0 {
+		rate := n.dataBitrate
+		if rate <= 0 {
+			rate = n.bitrate
+		}
+		secs += float64(data) / rate
+	}
+	return time.Duration(secs * float64(time.Second))
+}
+
+// arbitration returns f's arbitration field as sent, left-aligned so that
+// a lower value wins: the 11 base identifier bits, then RTR (standard) or
+// SRR (extended), IDE, and for extended frames the 18 identifier extension
+// bits and RTR. A standard frame beats an extended one with the same base
+// identifier, and a data frame beats a remote frame.
+func arbitration(f *Frame) uint32 {
+	var rtr uint32
+	if f.Remote {
+		rtr = 1
+	}
+	if !f.Extended {
+		return (f.ID&0x7FF)<<21 | rtr<<20
+	}
+	id := f.ID & 0x1FFFFFFF
+	return (id>>18)<<21 | 1<<20 | 1<<19 | (id&0x3FFFF)<<1 | rtr
+}
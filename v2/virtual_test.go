@@ -0,0 +1,122 @@
+package gocan
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestVirtualNetwork(t *testing.T) {
+	ctx := context.Background()
+	tester, err := Open(ctx, "virtual", Config{Port: t.Name()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tester.Close()
+	ecu, err := Open(ctx, "virtual", Config{Port: t.Name(), Extra: map[string]string{"echo": "true"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ecu.Close()
+
+	rctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	reqs := ecu.Subscribe(rctx, 0x7E0)
+	go func() {
+		if req, ok := <-reqs; ok {
+			ecu.Send(ctx, NewFrame(0x7E8, []byte{req.Data[0] + 0x40}))
+		}
+	}()
+	echo := ecu.Subscribe(rctx, 0x7E8)
+	reply, err := tester.Request(rctx, NewFrame(0x7E0, []byte{0x10}), 0x7E8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Data[0] != 0x50 {
+		t.Fatalf("reply %s", reply)
+	}
+	if f := <-echo; f.ID != 0x7E8 {
+		t.Fatalf("echo %s", f)
+	}
+
+	// The tester doesn't echo.
+	if _, err := tester.Recv(ctxTimeout(t, 20*time.Millisecond), 0x7E0); err == nil {
+		t.Fatal("tester received its own frame")
+	}
+
+	rated, err := Open(ctx, "virtual", Config{Port: "rated" + t.Name(), CANRate: 500})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rated.Close()
+	if _, err := Open(ctx, "virtual", Config{Port: "rated" + t.Name(), CANRate: 250}); err == nil {
+		t.Fatal("joined a 500 kbit/s network at 250")
+	}
+}
+
+func TestVirtualArbitration(t *testing.T) {
+	n := NewVirtualNetwork()
+	n.SetBitrate(5, 0) // ~26ms a frame
+	ctx := context.Background()
+	open := func(cfg VirtualNodeConfig) *Bus {
+		bus, err := OpenAdapter(ctx, n.Node(cfg))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { bus.Close() })
+		return bus
+	}
+	a, b, c := open(VirtualNodeConfig{}), open(VirtualNodeConfig{}), open(VirtualNodeConfig{})
+	slow := open(VirtualNodeConfig{Latency: 50 * time.Millisecond})
+	ch := open(VirtualNodeConfig{}).Subscribe(ctx)
+	late := slow.Subscribe(ctx)
+
+	start := time.Now()
+	go a.Send(ctx, NewFrame(0x300, make([]byte, 8)))
+	waitFor(t, func() bool {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		return n.running && len(n.pending) == 0
+	})
+	// Both queue while 0x300 is on the wire; the lower identifier goes next.
+	go b.Send(ctx, NewExtendedFrame(0x100<<18, nil))
+	go c.Send(ctx, NewFrame(0x100, nil))
+	waitFor(t, func() bool {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		return len(n.pending) == 2
+	})
+	for _, want := range []Frame{NewFrame(0x300, nil), NewFrame(0x100, nil), NewExtendedFrame(0x100<<18, nil)} {
+		f := <-ch
+		if f.ID != want.ID || f.Extended != want.Extended {
+			t.Fatalf("want %s, got %s", want, f)
+		}
+	}
+	if d := time.Since(start); d < 40*time.Millisecond {
+		t.Fatalf("three frames at 5 kbit/s took %v", d)
+	}
+	if f := <-late; f.Timestamp.Sub(start) < 70*time.Millisecond {
+		t.Fatalf("frame reached the 50ms node after %v", f.Timestamp.Sub(start))
+	}
+}
+
+func TestArbitration(t *testing.T) {
+	order := []Frame{
+		NewFrame(0x100, nil),
+		{ID: 0x100, Remote: true},
+		NewExtendedFrame(0x100<<18, nil),
+		NewExtendedFrame(0x100<<18|1, nil),
+		NewFrame(0x101, nil),
+	}
+	for i := 1; i < len(order); i++ {
+		if arbitration(&order[i-1]) >= arbitration(&order[i]) {
+			t.Errorf("%s should win over %s", order[i-1], order[i])
+		}
+	}
+}
+
+func ctxTimeout(t *testing.T, d time.Duration) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	t.Cleanup(cancel)
+	return ctx
+}